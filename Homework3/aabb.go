@@ -0,0 +1,258 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+// AABB is an axis-aligned bounding box given by its minimal and maximal corners.
+type AABB struct {
+	Min, Max geom.Vector
+}
+
+// Primitive is a Hittable which can report its extent and limit its queries
+// to a segment of the ray.
+type Primitive interface {
+	Hittable
+
+	// Bounds returns a box containing the whole primitive.
+	Bounds() AABB
+
+	// IntersectSegment reports whether the ray hits the primitive at a
+	// parameter between tMin and tMax inclusive. It may stop at any hit, so
+	// it is the query to use for shadows and occlusion.
+	IntersectSegment(ray geom.Ray, tMin, tMax float64) bool
+
+	// ClosestHitSegment returns the nearest hit with a parameter between
+	// tMin and tMax inclusive.
+	ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool)
+
+	// AllHits returns every crossing of the ray with the primitive with a
+	// parameter between tMin and tMax inclusive, ordered along the ray.
+	AllHits(ray geom.Ray, tMin, tMax float64) []Crossing
+}
+
+// EmptyAABB returns a box which contains nothing and is the identity for Union.
+func EmptyAABB() AABB {
+	inf := math.Inf(1)
+	return AABB{
+		Min: geom.NewVector(inf, inf, inf),
+		Max: geom.NewVector(-inf, -inf, -inf),
+	}
+}
+
+func boundsOfPoints(points ...geom.Vector) AABB {
+	box := EmptyAABB()
+	for _, p := range points {
+		box.Min = minVector(box.Min, p)
+		box.Max = maxVector(box.Max, p)
+	}
+	return box
+}
+
+// Union returns the smallest box containing both boxes.
+func (box AABB) Union(other AABB) AABB {
+	return AABB{
+		Min: minVector(box.Min, other.Min),
+		Max: maxVector(box.Max, other.Max),
+	}
+}
+
+// Intersection returns the box common to both boxes, which is empty if they
+// do not overlap. Boxes which only touch have a flat intersection.
+func (box AABB) Intersection(other AABB) AABB {
+	result := AABB{
+		Min: maxVector(box.Min, other.Min),
+		Max: minVector(box.Max, other.Max),
+	}
+	if result.Empty() {
+		return EmptyAABB()
+	}
+	return result
+}
+
+// Overlaps reports whether the boxes have a point in common, so touching
+// boxes overlap.
+func (box AABB) Overlaps(other AABB) bool {
+	return !box.Intersection(other).Empty()
+}
+
+// Contains reports whether the point is inside the box or on its surface.
+func (box AABB) Contains(point geom.Vector) bool {
+	return point.X >= box.Min.X && point.X <= box.Max.X &&
+		point.Y >= box.Min.Y && point.Y <= box.Max.Y &&
+		point.Z >= box.Min.Z && point.Z <= box.Max.Z
+}
+
+// Empty reports whether the box contains nothing. Flat boxes, such as the
+// bounds of a triangle lying in an axis plane, are not empty.
+func (box AABB) Empty() bool {
+	return box.Min.X > box.Max.X || box.Min.Y > box.Max.Y || box.Min.Z > box.Max.Z
+}
+
+// centroid returns the center of the box. Along axes on which the box is
+// infinite, as for planes, the finite side or the origin is used instead.
+func (box AABB) centroid() geom.Vector {
+	center := func(lo, hi float64) float64 {
+		switch {
+		case !math.IsInf(lo, 0) && !math.IsInf(hi, 0):
+			return (lo + hi) / 2
+		case !math.IsInf(lo, 0):
+			return lo
+		case !math.IsInf(hi, 0):
+			return hi
+		default:
+			return 0
+		}
+	}
+	return geom.NewVector(center(box.Min.X, box.Max.X), center(box.Min.Y, box.Max.Y), center(box.Min.Z, box.Max.Z))
+}
+
+func (box AABB) surfaceArea() float64 {
+	if box.Empty() {
+		return 0
+	}
+	d := geom.Sub(box.Max, box.Min)
+	return 2 * (d.X*d.Y + d.Y*d.Z + d.Z*d.X)
+}
+
+// hitSlab reports whether the ray enters the box for some parameter in
+// [tMin, tMax]. invDirection must be the reciprocal of the ray direction.
+func (box AABB) hitSlab(origin, invDirection geom.Vector, tMin, tMax float64) bool {
+	// Grow the far ends a little so rounding never culls a grazing ray or one
+	// aimed at a corner, which would make watertight triangles leak
+	tMax *= 1 + 1e-9
+
+	for axis := 0; axis < 3; axis++ {
+		o, inv := component(origin, axis), component(invDirection, axis)
+		t0 := (component(box.Min, axis) - o) * inv
+		t1 := (component(box.Max, axis) - o) * inv
+		if inv < 0 {
+			t0, t1 = t1, t0
+		}
+		t1 += math.Abs(t1) * 1e-9
+
+		// NaNs (a ray lying in a slab plane) fail both comparisons and are ignored
+		if t0 > tMin {
+			tMin = t0
+		}
+		if t1 < tMax {
+			tMax = t1
+		}
+		if tMin > tMax {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Clip returns the parameters at which the ray enters and leaves the box,
+// limited to [tMin, tMax]. Unlike the test BVHs use it is exact, so rays
+// which only graze an edge may go either way.
+func (box AABB) Clip(ray geom.Ray, tMin, tMax float64) (float64, float64, bool) {
+	if box.Empty() {
+		return 0, 0, false
+	}
+
+	for axis := 0; axis < 3; axis++ {
+		o, d := component(ray.Origin, axis), component(ray.Direction, axis)
+		lo, hi := component(box.Min, axis), component(box.Max, axis)
+
+		if d == 0 {
+			if o < lo || o > hi {
+				return 0, 0, false
+			}
+			continue
+		}
+
+		t0, t1 := (lo-o)/d, (hi-o)/d
+		if d < 0 {
+			t0, t1 = t1, t0
+		}
+		tMin, tMax = math.Max(tMin, t0), math.Min(tMax, t1)
+		if tMin > tMax {
+			return 0, 0, false
+		}
+	}
+
+	return tMin, tMax, true
+}
+
+// BoundingSphere returns a sphere containing the whole primitive. It is the
+// smallest one for spheres, triangles, disks, cylinders and tori, while for
+// other primitives it is the sphere around their bounds. It fails for empty
+// primitives and for unbounded ones such as planes.
+func BoundingSphere(primitive Primitive) (Sphere, bool) {
+	if bounded, ok := primitive.(interface{ BoundingSphere() Sphere }); ok {
+		return bounded.BoundingSphere(), true
+	}
+
+	box := primitive.Bounds()
+	if box.Empty() || !finite(box.Min) || !finite(box.Max) {
+		return Sphere{}, false
+	}
+	center := scale(geom.Add(box.Min, box.Max), 0.5)
+	return NewSphere(center, length(geom.Sub(box.Max, center))), true
+}
+
+func (triangle Triangle) Bounds() AABB {
+	return boundsOfPoints(triangle.a, triangle.b, triangle.c)
+}
+
+func (quad Quad) Bounds() AABB {
+	return boundsOfPoints(quad.a, quad.b, quad.c, quad.d)
+}
+
+func (sphere Sphere) Bounds() AABB {
+	r := math.Abs(sphere.r)
+	extent := geom.NewVector(r, r, r)
+	return AABB{
+		Min: geom.Sub(sphere.origin, extent),
+		Max: geom.Add(sphere.origin, extent),
+	}
+}
+
+// BoundingSphere returns the smallest sphere containing the triangle. For
+// right and obtuse triangles, degenerate ones included, that is the sphere
+// around the longest edge, otherwise it is the circumsphere.
+func (triangle Triangle) BoundingSphere() Sphere {
+	vertices := [3]geom.Vector{triangle.a, triangle.b, triangle.c}
+
+	longest := 0
+	for i := 1; i < 3; i++ {
+		if length(geom.Sub(vertices[(i+1)%3], vertices[(i+2)%3])) >
+			length(geom.Sub(vertices[(longest+1)%3], vertices[(longest+2)%3])) {
+			longest = i
+		}
+	}
+
+	opposite, p, q := vertices[longest], vertices[(longest+1)%3], vertices[(longest+2)%3]
+	if geom.Dot(geom.Sub(p, opposite), geom.Sub(q, opposite)) <= 0 {
+		center := scale(geom.Add(p, q), 0.5)
+		return NewSphere(center, length(geom.Sub(q, center)))
+	}
+
+	u, v := geom.Sub(p, opposite), geom.Sub(q, opposite)
+	w := geom.Cross(u, v)
+	offset := scale(geom.Add(scale(geom.Cross(v, w), geom.Dot(u, u)), scale(geom.Cross(w, u), geom.Dot(v, v))), 1/(2*geom.Dot(w, w)))
+	return NewSphere(geom.Add(opposite, offset), length(offset))
+}
+
+func (sphere Sphere) BoundingSphere() Sphere {
+	sphere.r = math.Abs(sphere.r)
+	return sphere
+}
+
+func (disk Disk) BoundingSphere() Sphere {
+	return NewSphere(disk.frame.origin, math.Abs(disk.r))
+}
+
+func (cylinder Cylinder) BoundingSphere() Sphere {
+	center := geom.Add(cylinder.frame.origin, scale(cylinder.frame.w, cylinder.height/2))
+	return NewSphere(center, math.Hypot(cylinder.height/2, cylinder.r))
+}
+
+func (torus Torus) BoundingSphere() Sphere {
+	return NewSphere(torus.frame.origin, torus.major+torus.minor)
+}
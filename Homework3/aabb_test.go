@@ -0,0 +1,221 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+func TestAABBUnionWithEmpty(t *testing.T) {
+	box := AABB{Min: geom.NewVector(-1, 0, 2), Max: geom.NewVector(1, 0, 3)}
+
+	if !EmptyAABB().Empty() {
+		t.Errorf("Expected the empty box to be empty")
+	}
+	if box.Empty() {
+		t.Errorf("Expected a flat box not to be empty")
+	}
+	if union := EmptyAABB().Union(box); union != box {
+		t.Errorf("Expected the empty box to leave %#v unchanged, got %#v", box, union)
+	}
+}
+
+func TestAABBOverlaps(t *testing.T) {
+	unit := AABB{Min: geom.NewVector(0, 0, 0), Max: geom.NewVector(1, 1, 1)}
+
+	cases := []struct {
+		other    AABB
+		overlaps bool
+	}{
+		{AABB{Min: geom.NewVector(0.5, 0.5, 0.5), Max: geom.NewVector(2, 2, 2)}, true},
+		{AABB{Min: geom.NewVector(1, 0, 0), Max: geom.NewVector(2, 1, 1)}, true},
+		{AABB{Min: geom.NewVector(1, 1, 1), Max: geom.NewVector(2, 2, 2)}, true},
+		{AABB{Min: geom.NewVector(1.5, 0, 0), Max: geom.NewVector(2, 1, 1)}, false},
+		{AABB{Min: geom.NewVector(0.5, 0.5, 0.5), Max: geom.NewVector(0.5, 0.5, 0.5)}, true},
+		{EmptyAABB(), false},
+	}
+
+	for _, c := range cases {
+		if unit.Overlaps(c.other) != c.overlaps || c.other.Overlaps(unit) != c.overlaps {
+			t.Errorf("Expected overlap of %#v with the unit box to be %v", c.other, c.overlaps)
+		}
+	}
+
+	touching := unit.Intersection(AABB{Min: geom.NewVector(1, 0, 0), Max: geom.NewVector(2, 1, 1)})
+	if touching.Min.X != 1 || touching.Max.X != 1 || touching.Max.Y != 1 {
+		t.Errorf("Expected boxes sharing a face to intersect in it, got %#v", touching)
+	}
+	if disjoint := unit.Intersection(AABB{Min: geom.NewVector(2, 2, 2), Max: geom.NewVector(3, 3, 3)}); disjoint != EmptyAABB() {
+		t.Errorf("Expected disjoint boxes to have an empty intersection, got %#v", disjoint)
+	}
+}
+
+func TestAABBContains(t *testing.T) {
+	box := AABB{Min: geom.NewVector(-1, -1, -1), Max: geom.NewVector(1, 1, 1)}
+
+	for _, p := range []geom.Vector{{}, geom.NewVector(1, 1, 1), geom.NewVector(-1, 0.5, 0)} {
+		if !box.Contains(p) {
+			t.Errorf("Expected %#v to be in the box", p)
+		}
+	}
+	for _, p := range []geom.Vector{geom.NewVector(1.01, 0, 0), geom.NewVector(0, 0, -2)} {
+		if box.Contains(p) {
+			t.Errorf("Expected %#v not to be in the box", p)
+		}
+	}
+	if EmptyAABB().Contains(geom.Vector{}) {
+		t.Errorf("Expected the empty box to contain nothing")
+	}
+}
+
+func TestAABBClip(t *testing.T) {
+	unit := AABB{Min: geom.NewVector(0, 0, 0), Max: geom.NewVector(1, 1, 1)}
+	flat := NewTriangle(geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0), geom.NewVector(2, 0, 0)).Bounds()
+	plane := NewPlane(geom.NewVector(0, 0, 0), geom.NewVector(1, 1, 0)).Bounds()
+
+	cases := []struct {
+		name        string
+		box         AABB
+		ray         geom.Ray
+		tMin, tMax  float64
+		ok          bool
+		enter, exit float64
+	}{
+		{"through", unit, geom.NewRay(geom.NewVector(0.5, 0.5, -1), geom.NewVector(0, 0, 1)), 0, math.Inf(1), true, 1, 2},
+		{"from inside", unit, geom.NewRay(geom.NewVector(0.5, 0.5, 0.5), geom.NewVector(1, 0, 0)), 0, math.Inf(1), true, 0, 0.5},
+		{"backwards", unit, geom.NewRay(geom.NewVector(0.5, 0.5, -1), geom.NewVector(0, 0, -1)), 0, math.Inf(1), false, 0, 0},
+		{"stops short", unit, geom.NewRay(geom.NewVector(0.5, 0.5, -1), geom.NewVector(0, 0, 1)), 0, 0.5, false, 0, 0},
+		{"along a face", unit, geom.NewRay(geom.NewVector(0, 0.5, -1), geom.NewVector(0, 0, 1)), 0, math.Inf(1), true, 1, 2},
+		{"parallel outside", unit, geom.NewRay(geom.NewVector(2, 0.5, -1), geom.NewVector(0, 0, 1)), 0, math.Inf(1), false, 0, 0},
+		{"zero-area triangle", flat, geom.NewRay(geom.NewVector(1.5, 0, -1), geom.NewVector(0, 0, 2)), 0, math.Inf(1), true, 0.5, 0.5},
+		{"unbounded", plane, geom.NewRay(geom.NewVector(0, 0, 0), geom.NewVector(1, 2, 3)), 0, 10, true, 0, 10},
+		{"empty", EmptyAABB(), geom.NewRay(geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0)), 0, math.Inf(1), false, 0, 0},
+	}
+
+	for _, c := range cases {
+		enter, exit, ok := c.box.Clip(c.ray, c.tMin, c.tMax)
+		if ok != c.ok || (ok && (!almostEqual(enter, c.enter) || !almostEqual(exit, c.exit))) {
+			t.Errorf("%s: expected %v [%v, %v], got %v [%v, %v]", c.name, c.ok, c.enter, c.exit, ok, enter, exit)
+		}
+	}
+}
+
+func TestDegenerateBounds(t *testing.T) {
+	cases := []struct {
+		name      string
+		primitive Primitive
+		bounds    AABB
+	}{
+		{
+			"collinear triangle",
+			NewTriangle(geom.NewVector(0, 0, 0), geom.NewVector(2, 2, 0), geom.NewVector(1, 1, 0)),
+			AABB{Min: geom.NewVector(0, 0, 0), Max: geom.NewVector(2, 2, 0)},
+		},
+		{
+			"point triangle",
+			NewTriangle(geom.NewVector(1, 2, 3), geom.NewVector(1, 2, 3), geom.NewVector(1, 2, 3)),
+			AABB{Min: geom.NewVector(1, 2, 3), Max: geom.NewVector(1, 2, 3)},
+		},
+		{
+			"point quad",
+			NewQuad(geom.NewVector(1, 1, 1), geom.NewVector(1, 1, 1), geom.NewVector(1, 1, 1), geom.NewVector(1, 1, 1)),
+			AABB{Min: geom.NewVector(1, 1, 1), Max: geom.NewVector(1, 1, 1)},
+		},
+		{
+			"zero sphere",
+			NewSphere(geom.NewVector(0, 1, 0), 0),
+			AABB{Min: geom.NewVector(0, 1, 0), Max: geom.NewVector(0, 1, 0)},
+		},
+		{
+			"negative sphere",
+			NewSphere(geom.NewVector(0, 0, 0), -2),
+			AABB{Min: geom.NewVector(-2, -2, -2), Max: geom.NewVector(2, 2, 2)},
+		},
+	}
+
+	for _, c := range cases {
+		if bounds := c.primitive.Bounds(); bounds != c.bounds {
+			t.Errorf("%s: expected bounds %#v, got %#v", c.name, c.bounds, bounds)
+		}
+	}
+
+	if bounds := NewBVH(nil).Bounds(); !bounds.Empty() {
+		t.Errorf("Expected an empty BVH to have empty bounds, got %#v", bounds)
+	}
+}
+
+func TestTriangleBoundingSphere(t *testing.T) {
+	cases := []struct {
+		name     string
+		triangle Triangle
+		center   geom.Vector
+		r        float64
+	}{
+		{
+			"acute",
+			NewTriangle(geom.NewVector(-1, 0, 0), geom.NewVector(1, 0, 0), geom.NewVector(0, 2, 0)),
+			geom.NewVector(0, 0.75, 0), 1.25,
+		},
+		{
+			"obtuse",
+			NewTriangle(geom.NewVector(-2, 0, 0), geom.NewVector(2, 0, 0), geom.NewVector(0, 0.5, 0)),
+			geom.NewVector(0, 0, 0), 2,
+		},
+		{
+			"collinear",
+			NewTriangle(geom.NewVector(0, 0, 0), geom.NewVector(3, 0, 0), geom.NewVector(1, 0, 0)),
+			geom.NewVector(1.5, 0, 0), 1.5,
+		},
+		{
+			"point",
+			NewTriangle(geom.NewVector(1, 1, 1), geom.NewVector(1, 1, 1), geom.NewVector(1, 1, 1)),
+			geom.NewVector(1, 1, 1), 0,
+		},
+	}
+
+	for _, c := range cases {
+		sphere := c.triangle.BoundingSphere()
+		if !vectorsAlmostEqual(sphere.origin, c.center) || !almostEqual(sphere.r, c.r) {
+			t.Errorf("%s: expected a sphere of radius %v at %#v, got %#v", c.name, c.r, c.center, sphere)
+		}
+	}
+}
+
+func TestBoundingSphereContainsPrimitive(t *testing.T) {
+	random := rand.New(rand.NewSource(18))
+
+	for _, primitive := range randomPrimitives(random, 200) {
+		sphere, ok := BoundingSphere(primitive)
+		if !ok {
+			t.Fatalf("Expected a bounding sphere for %#v", primitive)
+		}
+
+		var points []geom.Vector
+		switch p := primitive.(type) {
+		case Triangle:
+			points = []geom.Vector{p.a, p.b, p.c}
+		case Quad:
+			points = []geom.Vector{p.a, p.b, p.c, p.d}
+		case Sphere:
+			points = []geom.Vector{geom.Add(p.origin, geom.NewVector(p.r, 0, 0)), geom.Sub(p.origin, geom.NewVector(0, 0, p.r))}
+		}
+		for _, point := range points {
+			if length(geom.Sub(point, sphere.origin)) > sphere.r*(1+1e-9)+1e-12 {
+				t.Errorf("Expected %#v to be inside the bounding sphere %#v of %#v", point, sphere, primitive)
+			}
+		}
+	}
+
+	mesh := unitCube()
+	if sphere, ok := BoundingSphere(mesh); !ok || !vectorsAlmostEqual(sphere.origin, geom.NewVector(0.5, 0.5, 0.5)) || !almostEqual(sphere.r, math.Sqrt(0.75)) {
+		t.Errorf("Expected the sphere around the bounds of the cube, got %#v", sphere)
+	}
+	if _, ok := BoundingSphere(NewPlane(geom.Vector{}, geom.NewVector(0, 1, 0))); ok {
+		t.Errorf("Expected a plane to have no bounding sphere")
+	}
+	if _, ok := BoundingSphere(NewBVH(nil)); ok {
+		t.Errorf("Expected an empty BVH to have no bounding sphere")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+// Accelerator is a spatial index over a set of primitives which answers ray
+// queries without testing every one of them. Which one is fastest depends on
+// how the primitives are spread: grids suit dense uniform clouds, while BVHs
+// and octrees adapt to sparse scenes.
+type Accelerator interface {
+	Primitive
+
+	// Primitives returns the indexed primitives.
+	Primitives() []Primitive
+}
+
+// AcceleratorKind selects the structure NewAccelerator builds.
+type AcceleratorKind int
+
+const (
+	BVHAccelerator AcceleratorKind = iota
+	GridAccelerator
+	OctreeAccelerator
+)
+
+// NewAccelerator builds an accelerator of the given kind over the primitives.
+func NewAccelerator(kind AcceleratorKind, primitives []Primitive) Accelerator {
+	switch kind {
+	case GridAccelerator:
+		return NewGrid(primitives)
+	case OctreeAccelerator:
+		return NewOctree(primitives)
+	default:
+		return NewBVH(primitives)
+	}
+}
+
+// Primitives returns the primitives in the order they were given to NewBVH,
+// not in the one the BVH keeps them in.
+func (bvh *BVH) Primitives() []Primitive {
+	return bvh.given
+}
+
+// spatialIndex is what grids and octrees have in common: they put the
+// primitives in cells and answer queries by walking the cells along the ray.
+// Primitives with infinite bounds, such as planes, are kept out of the cells
+// and tested by every query.
+type spatialIndex struct {
+	primitives []Primitive
+	bounds     AABB
+
+	// The primitives in cells, with their bounds grown by margin so that
+	// rounding while walking the cells never misses one
+	indexed    []int
+	boxes      []AABB
+	cellBounds AABB
+	margin     float64
+
+	unbounded []int
+
+	// walk calls visit for the indexed primitives in the cells the ray
+	// passes through between tMin and tMax, nearest cells first. Primitives
+	// in several cells may be visited more than once. visit returns the new
+	// search distance and whether to stop the walk.
+	walk func(ray geom.Ray, tMin, tMax float64, visit func(index int, tMax float64) (float64, bool))
+}
+
+func newSpatialIndex(primitives []Primitive) spatialIndex {
+	index := spatialIndex{
+		primitives: primitives,
+		bounds:     EmptyAABB(),
+		boxes:      make([]AABB, len(primitives)),
+		cellBounds: EmptyAABB(),
+	}
+
+	for i, primitive := range primitives {
+		box := primitive.Bounds()
+		index.bounds = index.bounds.Union(box)
+		index.boxes[i] = box
+
+		switch {
+		case box.Empty():
+			// Nothing to hit
+		case !finite(box.Min) || !finite(box.Max):
+			index.unbounded = append(index.unbounded, i)
+		default:
+			index.indexed = append(index.indexed, i)
+			index.cellBounds = index.cellBounds.Union(box)
+		}
+	}
+
+	if len(index.indexed) > 0 {
+		index.margin = 1e-7 * math.Max(length(geom.Sub(index.cellBounds.Max, index.cellBounds.Min)), 1e-3)
+		index.cellBounds = index.cellBounds.grow(index.margin)
+		for _, i := range index.indexed {
+			index.boxes[i] = index.boxes[i].grow(index.margin)
+		}
+	}
+
+	return index
+}
+
+// grow returns the box extended by margin on every side.
+func (box AABB) grow(margin float64) AABB {
+	extent := geom.NewVector(margin, margin, margin)
+	return AABB{Min: geom.Sub(box.Min, extent), Max: geom.Add(box.Max, extent)}
+}
+
+// traverse calls visit for the primitives the ray may hit between tMin and
+// tMax in the same way as BVH.traverse.
+func (index *spatialIndex) traverse(ray geom.Ray, tMin, tMax float64, visit func(primitive Primitive, tMax float64) (float64, bool)) {
+	index.walkPrimitives(ray, tMin, tMax, func(i int, tMax float64) (float64, bool) {
+		return visit(index.primitives[i], tMax)
+	})
+}
+
+// walkPrimitives is traverse with the primitives given by their index.
+func (index *spatialIndex) walkPrimitives(ray geom.Ray, tMin, tMax float64, visit func(i int, tMax float64) (float64, bool)) {
+	for _, i := range index.unbounded {
+		var stop bool
+		if tMax, stop = visit(i, tMax); stop {
+			return
+		}
+	}
+
+	if len(index.indexed) > 0 {
+		index.walk(ray, tMin, tMax, visit)
+	}
+}
+
+func (index *spatialIndex) Primitives() []Primitive {
+	return index.primitives
+}
+
+func (index *spatialIndex) Bounds() AABB {
+	return index.bounds
+}
+
+func (index *spatialIndex) Intersect(ray geom.Ray) bool {
+	found := false
+	index.traverse(ray, 0, math.Inf(1), func(primitive Primitive, _ float64) (float64, bool) {
+		if primitive.Intersect(ray) {
+			found = true
+			return 0, true
+		}
+		return math.Inf(1), false
+	})
+	return found
+}
+
+func (index *spatialIndex) ClosestHit(ray geom.Ray) (Hit, bool) {
+	var closest Hit
+	found := false
+	index.traverse(ray, 0, math.Inf(1), func(primitive Primitive, tMax float64) (float64, bool) {
+		if hit, ok := primitive.ClosestHit(ray); ok && hit.T < tMax {
+			closest, found = hit, true
+			return hit.T, false
+		}
+		return tMax, false
+	})
+	return closest, found
+}
+
+func (index *spatialIndex) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	found := false
+	index.traverse(ray, tMin, tMax, func(primitive Primitive, _ float64) (float64, bool) {
+		if primitive.IntersectSegment(ray, tMin, tMax) {
+			found = true
+			return 0, true
+		}
+		return tMax, false
+	})
+	return found
+}
+
+func (index *spatialIndex) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	var closest Hit
+	found := false
+	index.traverse(ray, tMin, tMax, func(primitive Primitive, tMax float64) (float64, bool) {
+		if hit, ok := primitive.ClosestHitSegment(ray, tMin, tMax); ok {
+			closest, found = hit, true
+			return hit.T, false
+		}
+		return tMax, false
+	})
+	return closest, found
+}
+
+// AllHits returns the crossings with all primitives between tMin and tMax.
+// Primitives met in several cells give the same crossings each time, which
+// are reported once.
+func (index *spatialIndex) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	var crossings []Crossing
+	index.traverse(ray, tMin, tMax, func(primitive Primitive, tMax float64) (float64, bool) {
+		crossings = append(crossings, primitive.AllHits(ray, tMin, tMax)...)
+		return tMax, false
+	})
+	return sortCrossings(crossings)
+}
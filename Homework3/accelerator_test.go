@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+var acceleratorKinds = map[string]AcceleratorKind{
+	"bvh":    BVHAccelerator,
+	"grid":   GridAccelerator,
+	"octree": OctreeAccelerator,
+}
+
+func TestAcceleratorsMatchBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(19))
+	primitives := append(randomPrimitives(rng, 300), NewPlane(geom.NewVector(0, -25, 0), geom.NewVector(0, 1, 0)))
+
+	for name, kind := range acceleratorKinds {
+		accelerator := NewAccelerator(kind, primitives)
+		if len(accelerator.Primitives()) != len(primitives) {
+			t.Errorf("%s: expected %d primitives, got %d", name, len(primitives), len(accelerator.Primitives()))
+		}
+
+		for i := 0; i < 2000; i++ {
+			ray := geom.NewRay(randomVector(rng, 30), randomVector(rng, 1))
+
+			expected, expectedOK := bruteForceClosestHit(primitives, ray)
+			hit, ok := accelerator.ClosestHit(ray)
+			if ok != expectedOK || (ok && !almostEqual(hit.T, expected.T)) {
+				t.Fatalf("%s, ray %#v: expected closest hit %v at %v, got %v at %v", name, ray, expectedOK, expected.T, ok, hit.T)
+			}
+			if accelerator.Intersect(ray) != expectedOK {
+				t.Fatalf("%s, ray %#v: expected any-hit query to return %v", name, ray, expectedOK)
+			}
+
+			// A segment ending halfway to the closest hit hits nothing
+			if ok && accelerator.IntersectSegment(ray, epsilon, hit.T/2) {
+				t.Fatalf("%s, ray %#v: expected nothing before %v", name, ray, hit.T/2)
+			}
+
+			var expectedCrossings []Crossing
+			for _, primitive := range primitives {
+				expectedCrossings = append(expectedCrossings, primitive.AllHits(ray, 0, 40)...)
+			}
+			expectedCrossings = sortCrossings(expectedCrossings)
+			if crossings := accelerator.AllHits(ray, 0, 40); len(crossings) != len(expectedCrossings) {
+				t.Fatalf("%s, ray %#v: expected %d crossings, got %d", name, ray, len(expectedCrossings), len(crossings))
+			}
+		}
+	}
+}
+
+func TestAcceleratorsSegmentsBehindOrigin(t *testing.T) {
+	// Segments starting behind the origin have hits at negative parameters,
+	// which must not be taken for a request to stop
+	rng := rand.New(rand.NewSource(19))
+	primitives := append(randomPrimitives(rng, 300), NewPlane(geom.NewVector(0, -25, 0), geom.NewVector(0, 1, 0)))
+
+	for name, kind := range acceleratorKinds {
+		accelerator := NewAccelerator(kind, primitives)
+
+		for i := 0; i < 2000; i++ {
+			ray := geom.NewRay(randomVector(rng, 30), randomVector(rng, 1))
+
+			expected, expectedOK := Hit{T: math.Inf(1)}, false
+			for _, primitive := range primitives {
+				if hit, ok := primitive.ClosestHitSegment(ray, -40, 40); ok && hit.T < expected.T {
+					expected, expectedOK = hit, true
+				}
+			}
+			hit, ok := accelerator.ClosestHitSegment(ray, -40, 40)
+			if ok != expectedOK || (ok && !almostEqual(hit.T, expected.T)) {
+				t.Fatalf("%s, ray %#v: expected closest hit %v at %v, got %v at %v", name, ray, expectedOK, expected.T, ok, hit.T)
+			}
+		}
+	}
+}
+
+func TestAcceleratorsEmpty(t *testing.T) {
+	ray := geom.NewRay(geom.NewVector(0, 0, -1), geom.NewVector(0, 0, 1))
+
+	for name, kind := range acceleratorKinds {
+		empty := NewAccelerator(kind, nil)
+		if empty.Intersect(ray) || !empty.Bounds().Empty() {
+			t.Errorf("%s: expected an empty accelerator to hit nothing", name)
+		}
+
+		plane := NewAccelerator(kind, []Primitive{NewPlane(geom.NewVector(0, 0, 3), geom.NewVector(0, 0, 1))})
+		if hit, ok := plane.ClosestHit(ray); !ok || !almostEqual(hit.T, 4) {
+			t.Errorf("%s: expected an accelerator holding only a plane to hit it at 4, got %v at %v", name, ok, hit.T)
+		}
+	}
+}
+
+func TestAcceleratorsCoincidentPrimitives(t *testing.T) {
+	primitives := make([]Primitive, 0, 50)
+	for i := 0; i < 50; i++ {
+		primitives = append(primitives, NewSphere(geom.NewVector(0, 0, 0), float64(i+1)))
+	}
+	ray := geom.NewRay(geom.NewVector(0, 0, -100), geom.NewVector(0, 0, 1))
+
+	for name, kind := range acceleratorKinds {
+		hit, ok := NewAccelerator(kind, primitives).ClosestHit(ray)
+		if !ok || !almostEqual(hit.T, 50) {
+			t.Errorf("%s: expected the outermost sphere to be hit at 50, got %v at %v", name, ok, hit.T)
+		}
+	}
+}
+
+func TestAcceleratorsFlatScene(t *testing.T) {
+	// Triangles tiling the unit square of the XY plane give a flat grid
+	var primitives []Primitive
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			a := geom.NewVector(float64(x)/20, float64(y)/20, 0)
+			b := geom.Add(a, geom.NewVector(0.05, 0, 0))
+			c := geom.Add(a, geom.NewVector(0, 0.05, 0))
+			d := geom.Add(a, geom.NewVector(0.05, 0.05, 0))
+			primitives = append(primitives, NewTriangle(a, b, d), NewTriangle(a, d, c))
+		}
+	}
+
+	rng := rand.New(rand.NewSource(19))
+	for name, kind := range acceleratorKinds {
+		accelerator := WithTriangleMode(NewAccelerator(kind, primitives), WatertightTriangles)
+
+		for i := 0; i < 500; i++ {
+			target := geom.NewVector(rng.Float64(), rng.Float64(), 0)
+			origin := geom.Add(target, randomVector(rng, 2))
+			if origin.Z == 0 {
+				continue
+			}
+			ray := geom.NewRay(origin, geom.Sub(target, origin))
+			if hit, ok := accelerator.ClosestHit(ray); !ok || !almostEqual(hit.T, 1) {
+				t.Fatalf("%s: expected ray %#v to hit the plane at 1, got %v at %v", name, ray, ok, hit.T)
+			}
+		}
+	}
+}
+
+func TestAcceleratorsClosedMesh(t *testing.T) {
+	rng := rand.New(rand.NewSource(19))
+	mesh := randomClosedMesh(rng, 12, 24)
+
+	for name, kind := range acceleratorKinds {
+		accelerator := WithTriangleMode(NewAccelerator(kind, mesh.Primitives()), WatertightTriangles)
+
+		for i := 0; i < 2000; i++ {
+			ray := geom.NewRay(geom.Vector{}, randomVector(rng, 1))
+			if !accelerator.Intersect(ray) {
+				t.Fatalf("%s: expected ray %#v from inside the mesh to hit it", name, ray)
+			}
+		}
+	}
+}
+
+// architectureScene has a few large walls and small detailed objects far
+// apart, the kind of scene uniform grids handle poorly.
+func architectureScene(rng *rand.Rand) []Primitive {
+	primitives := []Primitive{
+		NewQuad(geom.NewVector(-50, 0, -50), geom.NewVector(50, 0, -50), geom.NewVector(50, 0, 50), geom.NewVector(-50, 0, 50)),
+		NewQuad(geom.NewVector(-50, 0, -50), geom.NewVector(-50, 20, -50), geom.NewVector(50, 20, -50), geom.NewVector(50, 0, -50)),
+		NewQuad(geom.NewVector(-50, 0, -50), geom.NewVector(-50, 0, 50), geom.NewVector(-50, 20, 50), geom.NewVector(-50, 20, -50)),
+	}
+
+	for cluster := 0; cluster < 6; cluster++ {
+		center := geom.NewVector(80*rng.Float64()-40, 1, 80*rng.Float64()-40)
+		for i := 0; i < 500; i++ {
+			a := geom.Add(center, randomVector(rng, 1))
+			primitives = append(primitives, NewTriangle(a, geom.Add(a, randomVector(rng, 0.05)), geom.Add(a, randomVector(rng, 0.05))))
+		}
+	}
+	return primitives
+}
+
+func BenchmarkAccelerators(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+
+	cloud := make([]Primitive, 3000)
+	for i := range cloud {
+		cloud[i] = NewSphere(randomVector(rng, 20), 0.3)
+	}
+	scenes := []struct {
+		name       string
+		primitives []Primitive
+	}{
+		{"cloud", cloud},
+		{"architecture", architectureScene(rng)},
+	}
+
+	rays := make([]geom.Ray, 1024)
+	for i := range rays {
+		rays[i] = geom.NewRay(geom.Add(randomVector(rng, 30), geom.NewVector(0, 10, 0)), randomVector(rng, 1))
+	}
+
+	for _, scene := range scenes {
+		for _, name := range []string{"bvh", "grid", "octree"} {
+			kind := acceleratorKinds[name]
+
+			b.Run(fmt.Sprintf("%s/%s/build", scene.name, name), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					NewAccelerator(kind, scene.primitives)
+				}
+			})
+
+			accelerator := NewAccelerator(kind, scene.primitives)
+			b.Run(fmt.Sprintf("%s/%s/closest", scene.name, name), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					accelerator.ClosestHit(rays[i%len(rays)])
+				}
+			})
+			b.Run(fmt.Sprintf("%s/%s/shadow", scene.name, name), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					accelerator.IntersectSegment(rays[i%len(rays)], epsilon, math.Inf(1))
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"sort"
+)
+
+// Crossing is a point where a ray passes through the surface of a primitive.
+type Crossing struct {
+	Hit
+
+	// Entering is set when the ray goes into the primitive. Open surfaces
+	// like triangles have no inside, for them it is set when the ray goes
+	// against the normal, so closed meshes wound outwards report it right.
+	Entering bool
+}
+
+// facing returns the crossing for a hit with an open surface.
+func facing(ray geom.Ray, hit Hit) Crossing {
+	return Crossing{Hit: hit, Entering: geom.Dot(hit.Normal, ray.Direction) < 0}
+}
+
+// sortCrossings orders crossings along the ray and drops those found twice,
+// as on an edge shared by two triangles of a mesh.
+func sortCrossings(crossings []Crossing) []Crossing {
+	sort.SliceStable(crossings, func(i, j int) bool {
+		return crossings[i].T < crossings[j].T
+	})
+
+	result := crossings[:0]
+	for _, crossing := range crossings {
+		if n := len(result); n > 0 {
+			last := result[n-1]
+			if last.Entering == crossing.Entering && math.Abs(crossing.T-last.T) <= 1e-9*math.Max(1, math.Abs(last.T)) {
+				continue
+			}
+		}
+		result = append(result, crossing)
+	}
+	return result
+}
+
+// spanCrossings returns the ends of the spans of a solid between tMin and
+// tMax inclusive.
+func spanCrossings(spans []Span, tMin, tMax float64) []Crossing {
+	var crossings []Crossing
+	for _, span := range spans {
+		if span.Enter.T >= tMin && span.Enter.T <= tMax {
+			crossings = append(crossings, Crossing{Hit: span.Enter, Entering: true})
+		}
+		if span.Exit.T >= tMin && span.Exit.T <= tMax {
+			crossings = append(crossings, Crossing{Hit: span.Exit})
+		}
+	}
+	return crossings
+}
+
+// AllHits returns the crossing of the ray with the triangle, if its
+// parameter is between tMin and tMax inclusive.
+func (triangle Triangle) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	if hit, ok := triangle.ClosestHitSegment(ray, tMin, tMax); ok {
+		return []Crossing{facing(ray, hit)}
+	}
+	return nil
+}
+
+// AllHits returns the crossings of the ray with the quad between tMin and
+// tMax inclusive. A planar quad is crossed at most once, a bilinear patch up
+// to twice.
+func (quad Quad) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	first, ok := quad.ClosestHitSegment(ray, tMin, tMax)
+	if !ok {
+		return nil
+	}
+	crossings := []Crossing{facing(ray, first)}
+
+	if !quad.planar {
+		if second, ok := quad.bilinearHit(ray, math.Nextafter(first.T, math.Inf(1)), tMax); ok {
+			crossings = append(crossings, facing(ray, second))
+		}
+	}
+	return crossings
+}
+
+// AllHits returns where the ray enters and leaves the sphere between tMin and
+// tMax inclusive. A tangent ray enters and leaves at the same point.
+func (sphere Sphere) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	return spanCrossings(sphere.Spans(ray), tMin, tMax)
+}
+
+func (polygon *Polygon) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	if hit, ok := polygon.ClosestHitSegment(ray, tMin, tMax); ok {
+		return []Crossing{facing(ray, hit)}
+	}
+	return nil
+}
+
+func (plane Plane) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	if hit, ok := plane.ClosestHitSegment(ray, tMin, tMax); ok {
+		return []Crossing{facing(ray, hit)}
+	}
+	return nil
+}
+
+func (disk Disk) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	if hit, ok := disk.ClosestHitSegment(ray, tMin, tMax); ok {
+		return []Crossing{facing(ray, hit)}
+	}
+	return nil
+}
+
+func (box Box) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	return spanCrossings(box.Spans(ray), tMin, tMax)
+}
+
+func (box OrientedBox) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	return spanCrossings(box.Spans(ray), tMin, tMax)
+}
+
+// AllHits returns the crossings with the cylinder between tMin and tMax
+// inclusive. An open cylinder is a surface like a triangle, so the crossings
+// with it are reported as for open surfaces.
+func (cylinder Cylinder) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	if cylinder.capped {
+		return spanCrossings(cylinder.Spans(ray), tMin, tMax)
+	}
+
+	local := cylinder.frame.localRay(ray)
+	found := cylinder.candidates(local)
+	return candidateCrossings(ray, found, tMin, tMax, func(c candidate) Hit {
+		return cylinder.hitAt(ray, local, c)
+	})
+}
+
+// AllHits returns the crossings with the cone between tMin and tMax
+// inclusive. As for cylinders an open cone is treated as an open surface.
+func (cone Cone) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	if cone.capped {
+		return spanCrossings(cone.Spans(ray), tMin, tMax)
+	}
+
+	local := cone.frame.localRay(ray)
+	found := cone.candidates(local)
+	return candidateCrossings(ray, found, tMin, tMax, func(c candidate) Hit {
+		return cone.hitAt(ray, local, c)
+	})
+}
+
+func (torus Torus) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	return spanCrossings(torus.Spans(ray), tMin, tMax)
+}
+
+func (csg *CSG) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	return spanCrossings(csg.Spans(ray), tMin, tMax)
+}
+
+// candidateCrossings turns the crossings of a ray with an open surface found
+// in the frame of the shape into crossings ordered along the ray.
+func candidateCrossings(ray geom.Ray, found candidates, tMin, tMax float64, hitAt func(candidate) Hit) []Crossing {
+	var crossings []Crossing
+	for _, item := range found.items[:found.n] {
+		if item.t >= tMin && item.t <= tMax {
+			crossings = append(crossings, facing(ray, hitAt(item)))
+		}
+	}
+	return sortCrossings(crossings)
+}
+
+// AllHits returns the crossings with all primitives between tMin and tMax
+// inclusive, ordered along the ray. Crossings of neighbouring primitives at
+// the same parameter, as on a shared edge, are reported once.
+func (bvh *BVH) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	var crossings []Crossing
+	bvh.traverse(ray, tMin, tMax, func(primitive Primitive, tMax float64) (float64, bool) {
+		crossings = append(crossings, primitive.AllHits(ray, tMin, tMax)...)
+		return tMax, false
+	})
+	return sortCrossings(crossings)
+}
+
+func (mesh *Mesh) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	return mesh.bvh.AllHits(ray, tMin, tMax)
+}
+
+// AllHits returns the crossings with the transformed primitive in world
+// space.
+func (instance *Instance) AllHits(ray geom.Ray, tMin, tMax float64) []Crossing {
+	crossings := instance.primitive.AllHits(instance.objectRay(ray), tMin, tMax)
+	for i := range crossings {
+		crossings[i].Hit, _ = instance.worldHit(ray, crossings[i].Hit, true)
+	}
+	return crossings
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"testing"
+)
+
+// unitCube returns a closed mesh of the cube from (0, 0, 0) to (1, 1, 1)
+// with its faces wound outwards and split into triangles.
+func unitCube() *Mesh {
+	vertices := make([]geom.Vector, 8)
+	for i := range vertices {
+		vertices[i] = geom.NewVector(float64(i&1), float64(i>>1&1), float64(i>>2&1))
+	}
+
+	var faces []Face
+	for _, quad := range [][4]int{
+		{0, 2, 3, 1}, {4, 5, 7, 6}, // z = 0, z = 1
+		{0, 1, 5, 4}, {2, 6, 7, 3}, // y = 0, y = 1
+		{0, 4, 6, 2}, {1, 3, 7, 5}, // x = 0, x = 1
+	} {
+		faces = append(faces,
+			Face{Vertices: []int{quad[0], quad[1], quad[2]}},
+			Face{Vertices: []int{quad[0], quad[2], quad[3]}},
+		)
+	}
+
+	mesh, err := NewMesh(vertices, faces)
+	if err != nil {
+		panic(err)
+	}
+	return mesh
+}
+
+func checkCrossings(t *testing.T, name string, crossings []Crossing, expected []float64, entering []bool) {
+	if len(crossings) != len(expected) {
+		t.Errorf("%s: expected %d crossings, got %d: %#v", name, len(expected), len(crossings), crossings)
+		return
+	}
+	for i, crossing := range crossings {
+		if !almostEqual(crossing.T, expected[i]) || crossing.Entering != entering[i] {
+			t.Errorf("%s: expected crossing %d at %v entering %v, got %v entering %v",
+				name, i, expected[i], entering[i], crossing.T, crossing.Entering)
+		}
+	}
+}
+
+func TestAllHitsPrimitives(t *testing.T) {
+	ray := geom.NewRay(geom.NewVector(0, 0, -5), geom.NewVector(0, 0, 1))
+	inf := math.Inf(1)
+
+	triangle := NewTriangle(geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0), geom.NewVector(0, 1, 0))
+	checkCrossings(t, "triangle", triangle.AllHits(ray, 0, inf), []float64{5}, []bool{false})
+
+	quad := NewQuad(geom.NewVector(-1, -1, 1), geom.NewVector(-1, 1, 1), geom.NewVector(1, 1, 1), geom.NewVector(1, -1, 1))
+	checkCrossings(t, "quad", quad.AllHits(ray, 0, inf), []float64{6}, []bool{true})
+
+	sphere := NewSphere(geom.NewVector(0, 0, 0), 2)
+	checkCrossings(t, "sphere", sphere.AllHits(ray, 0, inf), []float64{3, 7}, []bool{true, false})
+	checkCrossings(t, "sphere from inside", sphere.AllHits(ray, 4, inf), []float64{7}, []bool{false})
+	checkCrossings(t, "sphere segment", sphere.AllHits(ray, 0, 5), []float64{3}, []bool{true})
+
+	tangent := geom.NewRay(geom.NewVector(-5, 2, 0), geom.NewVector(1, 0, 0))
+	checkCrossings(t, "tangent sphere", sphere.AllHits(tangent, 0, inf), []float64{5, 5}, []bool{true, false})
+
+	torus := NewTorus(geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0), 2, 0.5)
+	across := geom.NewRay(geom.NewVector(-5, 0, 0), geom.NewVector(1, 0, 0))
+	checkCrossings(t, "torus", torus.AllHits(across, 0, inf), []float64{2.5, 3.5, 6.5, 7.5}, []bool{true, false, true, false})
+
+	open := NewOpenCylinder(geom.NewVector(0, -1, 0), geom.NewVector(0, 1, 0), 1)
+	checkCrossings(t, "open cylinder", open.AllHits(across, 0, inf), []float64{4, 6}, []bool{true, false})
+}
+
+func TestAllHitsBilinearQuad(t *testing.T) {
+	// The saddle z = u + v - 2uv is crossed twice along the diagonal
+	quad := NewQuad(geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 1), geom.NewVector(1, 1, 0), geom.NewVector(0, 1, 1))
+	ray := geom.NewRay(geom.NewVector(-1, -1, 0.3), geom.NewVector(1, 1, 0))
+
+	crossings := quad.AllHits(ray, 0, math.Inf(1))
+	if len(crossings) != 2 {
+		t.Fatalf("Expected two crossings with the saddle, got %#v", crossings)
+	}
+	root := math.Sqrt(4-2.4) / 4
+	if !almostEqual(crossings[0].T, 1.5-root) || !almostEqual(crossings[1].T, 1.5+root) {
+		t.Errorf("Expected crossings at %v and %v, got %v and %v", 1.5-root, 1.5+root, crossings[0].T, crossings[1].T)
+	}
+	if crossings[0].Entering == crossings[1].Entering {
+		t.Errorf("Expected the saddle to be crossed from both sides")
+	}
+}
+
+func TestAllHitsClosedMesh(t *testing.T) {
+	cube := unitCube()
+	inf := math.Inf(1)
+
+	ray := geom.NewRay(geom.NewVector(0.3, 0.6, -1), geom.NewVector(0, 0, 1))
+	checkCrossings(t, "cube", cube.AllHits(ray, 0, inf), []float64{1, 2}, []bool{true, false})
+
+	// Through the diagonals the faces are split along, which two triangles share
+	diagonal := geom.NewRay(geom.NewVector(0.5, 0.5, -1), geom.NewVector(0, 0, 1))
+	checkCrossings(t, "cube diagonal", cube.AllHits(diagonal, 0, inf), []float64{1, 2}, []bool{true, false})
+
+	instance, err := NewInstance(cube, Compose(Scale(2, 2, 2), Translate(geom.NewVector(0, 0, 3))))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	checkCrossings(t, "instance", instance.AllHits(ray, 0, inf), []float64{4, 6}, []bool{true, false})
+
+	bvh := NewBVH([]Primitive{cube, instance, NewSphere(geom.NewVector(0.3, 0.6, 10), 1)})
+	checkCrossings(t, "bvh", bvh.AllHits(ray, 0, inf), []float64{1, 2, 4, 6, 10, 12}, []bool{true, false, true, false, true, false})
+	checkCrossings(t, "bvh segment", bvh.AllHits(ray, 1.5, 5), []float64{2, 4}, []bool{false, true})
+}
+
+func TestAllHitsCSG(t *testing.T) {
+	hollow := NewDifference(NewSphere(geom.NewVector(0, 0, 0), 3), NewSphere(geom.NewVector(0, 0, 0), 1))
+	ray := geom.NewRay(geom.NewVector(-10, 0, 0), geom.NewVector(1, 0, 0))
+
+	crossings := hollow.AllHits(ray, 0, math.Inf(1))
+	checkCrossings(t, "hollow sphere", crossings, []float64{7, 9, 11, 13}, []bool{true, false, true, false})
+
+	// The length inside the solid is what volume measurements integrate
+	inside := 0.0
+	for i := 0; i+1 < len(crossings); i += 2 {
+		inside += crossings[i+1].T - crossings[i].T
+	}
+	if !almostEqual(inside, 4) {
+		t.Errorf("Expected the ray to spend 4 units inside the shell, got %v", inside)
+	}
+}
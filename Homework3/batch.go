@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+// IntersectMany tests every ray against the triangle as Intersect does and
+// stores the results in hits. It returns how many of the rays hit, or an
+// error without testing any if hits is shorter than rays. What only depends
+// on the triangle is looked up once for all rays and nothing is allocated.
+func (triangle Triangle) IntersectMany(rays []geom.Ray, hits []bool) (int, error) {
+	hits, err := clearHits(rays, hits)
+	if err != nil {
+		return 0, err
+	}
+
+	triangle.markHits(rays, hits)
+	return countHits(hits), nil
+}
+
+// IntersectMany tests every ray against the quad as Intersect does. See
+// Triangle.IntersectMany.
+func (quad Quad) IntersectMany(rays []geom.Ray, hits []bool) (int, error) {
+	hits, err := clearHits(rays, hits)
+	if err != nil {
+		return 0, err
+	}
+
+	if !quad.planar {
+		patch := quad.patch()
+		for i, ray := range rays {
+			_, _, _, hits[i] = patch.intersect(ray, epsilon, math.Inf(1))
+		}
+		return countHits(hits), nil
+	}
+
+	// The second triangle is only tried for the rays the first one missed
+	quad.triangles[0].markHits(rays, hits)
+	quad.triangles[1].markHits(rays, hits)
+	return countHits(hits), nil
+}
+
+// IntersectMany tests every ray against the sphere as Intersect does. See
+// Triangle.IntersectMany.
+func (sphere Sphere) IntersectMany(rays []geom.Ray, hits []bool) (int, error) {
+	hits, err := clearHits(rays, hits)
+	if err != nil {
+		return 0, err
+	}
+
+	// With no upper limit the ray hits if the farther root is far enough
+	for i, ray := range rays {
+		x1, x2, ok := sphere.roots(ray)
+		hits[i] = ok && math.Max(x1, x2) >= sphere.epsilon
+	}
+	return countHits(hits), nil
+}
+
+// clearHits returns the first len(rays) of hits set to false.
+func clearHits(rays []geom.Ray, hits []bool) ([]bool, error) {
+	if len(hits) < len(rays) {
+		return nil, fmt.Errorf("IntersectMany: %d results for %d rays", len(hits), len(rays))
+	}
+
+	hits = hits[:len(rays)]
+	for i := range hits {
+		hits[i] = false
+	}
+	return hits, nil
+}
+
+// markHits sets hits[i] for the rays which hit the triangle, skipping the
+// ones already marked.
+func (triangle Triangle) markHits(rays []geom.Ray, hits []bool) {
+	if triangle.mode == WatertightTriangles {
+		for i, ray := range rays {
+			if !hits[i] {
+				_, _, _, hits[i] = triangle.intersectWatertight(ray, epsilon, math.Inf(1))
+			}
+		}
+		return
+	}
+
+	// The triangle is kept in locals rather than looked up for every ray
+	a, edge1, edge2 := triangle.a, triangle.edge1, triangle.edge2
+	for i := range rays {
+		if !hits[i] {
+			t, _, _, ok := mollerTrumbore(a, edge1, edge2, rays[i].Origin, rays[i].Direction)
+			hits[i] = ok && t >= epsilon
+		}
+	}
+}
+
+func countHits(hits []bool) int {
+	count := 0
+	for _, hit := range hits {
+		if hit {
+			count++
+		}
+	}
+	return count
+}
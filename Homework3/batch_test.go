@@ -0,0 +1,151 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+// coherentRays returns rays from one point through a width x height grid
+// covering [-1, 1] x [-1, 1] of the plane z = 0, like camera rays.
+func coherentRays(origin geom.Vector, width, height int) []geom.Ray {
+	rays := make([]geom.Ray, 0, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			target := geom.NewVector(2*(float64(x)+0.5)/float64(width)-1, 2*(float64(y)+0.5)/float64(height)-1, 0)
+			rays = append(rays, geom.NewRay(origin, geom.Sub(target, origin)))
+		}
+	}
+	return rays
+}
+
+type batchIntersectable interface {
+	Intersect(ray geom.Ray) bool
+	IntersectMany(rays []geom.Ray, hits []bool) (int, error)
+}
+
+func batchPrimitives() map[string]batchIntersectable {
+	triangle := NewTriangle(geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0), geom.NewVector(0, 1, 0))
+	return map[string]batchIntersectable{
+		"triangle":            triangle,
+		"watertight triangle": triangle.WithMode(WatertightTriangles),
+		"behind triangle":     NewTriangle(geom.NewVector(-1, -1, 5), geom.NewVector(1, -1, 5), geom.NewVector(0, 1, 5)),
+		"quad":                NewQuad(geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0), geom.NewVector(1, 1, 0), geom.NewVector(-1, 1, 0)),
+		"concave quad":        NewQuad(geom.NewVector(0, -1, 0), geom.NewVector(1, 0, 0), geom.NewVector(0, 1, 0), geom.NewVector(0.5, 0, 0)),
+		"watertight quad":     WithTriangleMode(NewQuad(geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0), geom.NewVector(1, 1, 0), geom.NewVector(-1, 1, 0)), WatertightTriangles).(Quad),
+		"bilinear quad":       NewQuad(geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0.5), geom.NewVector(1, 1, 0), geom.NewVector(-1, 1, 0.5)),
+		"sphere":              NewSphere(geom.NewVector(0, 0, 0), 0.7),
+		"sphere around":       NewSphere(geom.NewVector(0, 0, 2), 5),
+		"sphere with epsilon": NewSphere(geom.NewVector(0, 0, 0), 0.7).WithEpsilon(4),
+	}
+}
+
+func TestIntersectManyMatchesIntersect(t *testing.T) {
+	rng := rand.New(rand.NewSource(20))
+	rays := coherentRays(geom.NewVector(0, 0, 3), 64, 64)
+	for i := 0; i < 4096; i++ {
+		rays = append(rays, geom.NewRay(randomVector(rng, 3), randomVector(rng, 1)))
+	}
+	rays = append(rays, geom.NewRay(geom.NewVector(0, 0, 3), geom.Vector{}))
+
+	for name, primitive := range batchPrimitives() {
+		hits := make([]bool, len(rays)+10)
+		for i := range hits {
+			hits[i] = true
+		}
+
+		count, err := primitive.IntersectMany(rays, hits)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		expected := 0
+		for i, ray := range rays {
+			if want := primitive.Intersect(ray); hits[i] != want {
+				t.Errorf("%s: expected ray %#v to give %v like Intersect", name, ray, want)
+			} else if want {
+				expected++
+			}
+		}
+		if count != expected || expected == 0 {
+			t.Errorf("%s: expected %d hits, got %d", name, expected, count)
+		}
+		if !hits[len(rays)] {
+			t.Errorf("%s: expected results past the rays to be left alone", name)
+		}
+	}
+}
+
+func TestIntersectManyDoesNotAllocate(t *testing.T) {
+	rays := coherentRays(geom.NewVector(0, 0, 3), 16, 16)
+	hits := make([]bool, len(rays))
+
+	for name, primitive := range batchPrimitives() {
+		if allocs := testing.AllocsPerRun(10, func() { primitive.IntersectMany(rays, hits) }); allocs != 0 {
+			t.Errorf("%s: expected IntersectMany to not allocate, got %v allocations per call", name, allocs)
+		}
+	}
+}
+
+func TestIntersectManyShortResults(t *testing.T) {
+	rays := coherentRays(geom.NewVector(0, 0, 3), 4, 4)
+	for name, primitive := range batchPrimitives() {
+		hits := make([]bool, 15)
+		hits[0] = true
+		if count, err := primitive.IntersectMany(rays, hits); err == nil || count != 0 {
+			t.Errorf("%s: expected an error when the results do not fit, got %d hits", name, count)
+		}
+		if !hits[0] {
+			t.Errorf("%s: expected the results to be left alone on error", name)
+		}
+	}
+}
+
+func benchmarkIntersectMany(b *testing.B, primitive batchIntersectable, batch bool) {
+	rays := coherentRays(geom.NewVector(0, 0, 3), 64, 64)
+	hits := make([]bool, len(rays))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if batch {
+			primitive.IntersectMany(rays, hits)
+			continue
+		}
+		for j, ray := range rays {
+			hits[j] = primitive.Intersect(ray)
+		}
+	}
+}
+
+func BenchmarkTriangleIntersectMany(b *testing.B) {
+	benchmarkIntersectMany(b, batchPrimitives()["triangle"], true)
+}
+
+func BenchmarkTriangleIntersectLoop(b *testing.B) {
+	benchmarkIntersectMany(b, batchPrimitives()["triangle"], false)
+}
+
+func BenchmarkQuadIntersectMany(b *testing.B) {
+	benchmarkIntersectMany(b, batchPrimitives()["quad"], true)
+}
+
+func BenchmarkQuadIntersectLoop(b *testing.B) {
+	benchmarkIntersectMany(b, batchPrimitives()["quad"], false)
+}
+
+func BenchmarkBilinearQuadIntersectMany(b *testing.B) {
+	benchmarkIntersectMany(b, batchPrimitives()["bilinear quad"], true)
+}
+
+func BenchmarkBilinearQuadIntersectLoop(b *testing.B) {
+	benchmarkIntersectMany(b, batchPrimitives()["bilinear quad"], false)
+}
+
+func BenchmarkSphereIntersectMany(b *testing.B) {
+	benchmarkIntersectMany(b, batchPrimitives()["sphere"], true)
+}
+
+func BenchmarkSphereIntersectLoop(b *testing.B) {
+	benchmarkIntersectMany(b, batchPrimitives()["sphere"], false)
+}
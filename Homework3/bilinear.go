@@ -0,0 +1,119 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+func lerp(a, b geom.Vector, t float64) geom.Vector {
+	return geom.Add(scale(a, 1-t), scale(b, t))
+}
+
+// bilinearIntersect intersects the ray with the bilinear patch
+//
+//	P(u, v) = (1-u)(1-v)a + u(1-v)b + uv c + (1-u)v d
+//
+// spanned by the quad, which is the natural surface of a non-planar quad.
+// It follows "Cool Patches: A Geometric Approach to Ray/Bilinear Patch
+// Intersections" by Reshetov, solving a quadratic for u and then finding
+// v and t in closed form. It returns the ray parameter and the patch
+// coordinates of the nearest hit between tMin and tMax.
+func (quad Quad) bilinearIntersect(ray geom.Ray, tMin, tMax float64) (t, u, v float64, ok bool) {
+	return quad.patch().intersect(ray, tMin, tMax)
+}
+
+// bilinearPatch holds what the intersection with the patch of a quad needs
+// besides the ray, so that it can be reused for many rays.
+type bilinearPatch struct {
+	a, b     geom.Vector
+	e00, e11 geom.Vector
+	qn       geom.Vector
+}
+
+func (quad Quad) patch() bilinearPatch {
+	return bilinearPatch{
+		a:   quad.a,
+		b:   quad.b,
+		e00: geom.Sub(quad.d, quad.a),
+		e11: geom.Sub(quad.c, quad.b),
+		qn:  geom.Cross(geom.Sub(quad.b, quad.a), geom.Sub(quad.d, quad.c)),
+	}
+}
+
+func (patch bilinearPatch) intersect(ray geom.Ray, tMin, tMax float64) (t, u, v float64, ok bool) {
+	e00, e11 := patch.e00, patch.e11
+
+	// Work relative to the ray origin
+	q00 := geom.Sub(patch.a, ray.Origin)
+	q10 := geom.Sub(patch.b, ray.Origin)
+
+	a := geom.Dot(geom.Cross(q00, ray.Direction), e00)
+	c := geom.Dot(patch.qn, ray.Direction)
+	b := geom.Dot(geom.Cross(q10, ray.Direction), e11) - (a + c)
+
+	discriminant := b*b - 4*a*c
+	if discriminant < 0 {
+		return 0, 0, 0, false
+	}
+	discriminant = math.Sqrt(discriminant)
+
+	var u1, u2 float64
+	if c == 0 {
+		// The quadratic degenerates into a linear equation with a single root
+		u1, u2 = -a/b, -1
+	} else {
+		u1 = (-b - math.Copysign(discriminant, b)) / 2
+		u2 = a / u1
+		u1 /= c
+	}
+
+	t = math.Inf(1)
+	found := false
+	for _, candidate := range [2]float64{u1, u2} {
+		if !(candidate >= 0 && candidate <= 1) {
+			continue
+		}
+
+		// The patch contains the segment between pa and pa+pb for this u
+		pa := lerp(q00, q10, candidate)
+		pb := lerp(e00, e11, candidate)
+		n := geom.Cross(ray.Direction, pb)
+		det := geom.Dot(n, n)
+		if det == 0 {
+			continue
+		}
+		n = geom.Cross(n, pa)
+
+		tc := geom.Dot(n, pb) / det
+		vc := geom.Dot(n, ray.Direction) / det
+		if tc >= tMin && tc <= tMax && tc < t && vc >= 0 && vc <= 1 {
+			t, u, v, found = tc, candidate, vc, true
+		}
+	}
+
+	if !found {
+		return 0, 0, 0, false
+	}
+
+	return t, u, v, true
+}
+
+func (quad Quad) bilinearHit(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	t, u, v, ok := quad.bilinearIntersect(ray, tMin, tMax)
+	if !ok {
+		return Hit{}, false
+	}
+
+	// Partial derivatives of the patch give the normal
+	du := lerp(geom.Sub(quad.b, quad.a), geom.Sub(quad.c, quad.d), v)
+	dv := lerp(geom.Sub(quad.d, quad.a), geom.Sub(quad.c, quad.b), u)
+
+	return Hit{
+		T:         t,
+		Point:     pointAt(ray, t),
+		Normal:    normalize(geom.Cross(du, dv)),
+		U:         u,
+		V:         v,
+		Primitive: quad,
+	}, true
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+// Box is a solid axis-aligned box.
+type Box struct {
+	min, max geom.Vector
+}
+
+// OrientedBox is a box which may be rotated. It is intersected as a Box
+// centered at the origin, in the coordinates of its own axes.
+type OrientedBox struct {
+	frame frame
+	box   Box
+}
+
+// NewBox returns the box with the given opposite corners.
+func NewBox(a, b geom.Vector) Box {
+	return Box{
+		min: minVector(a, b),
+		max: maxVector(a, b),
+	}
+}
+
+// NewOrientedBox returns the box around center whose edges follow xAxis and
+// yAxis, with halfSize holding half of its size along X, Y and Z. The axes
+// need not be unit or perpendicular but must not be parallel: yAxis is made
+// perpendicular to xAxis and the Z axis is perpendicular to both.
+func NewOrientedBox(center, xAxis, yAxis, halfSize geom.Vector) OrientedBox {
+	u := normalize(xAxis)
+	v := normalize(geom.Sub(yAxis, scale(u, geom.Dot(yAxis, u))))
+	half := geom.NewVector(math.Abs(halfSize.X), math.Abs(halfSize.Y), math.Abs(halfSize.Z))
+
+	return OrientedBox{
+		frame: frame{origin: center, u: u, v: v, w: geom.Cross(u, v)},
+		box:   Box{min: scale(half, -1), max: half},
+	}
+}
+
+func (box Box) Intersect(ray geom.Ray) bool {
+	return box.IntersectSegment(ray, epsilon, math.Inf(1))
+}
+
+// ClosestHit returns the hit with the surface of the box. U and V are the
+// coordinates of the hit on the face it is on, from 0 to 1 along the two
+// other axes in X, Y, Z order.
+func (box Box) ClosestHit(ray geom.Ray) (Hit, bool) {
+	return box.ClosestHitSegment(ray, epsilon, math.Inf(1))
+}
+
+func (box Box) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	found := box.candidates(ray)
+	_, ok := found.nearest(tMin, tMax)
+	return ok
+}
+
+func (box Box) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	found := box.candidates(ray)
+	nearest, ok := found.nearest(tMin, tMax)
+	if !ok {
+		return Hit{}, false
+	}
+
+	hit := box.hitAt(ray, nearest)
+	hit.Primitive = box
+	return hit, true
+}
+
+// candidates returns where the ray enters and leaves the box. Parts are the
+// faces, numbered 2*axis for the low side and 2*axis+1 for the high one.
+func (box Box) candidates(ray geom.Ray) candidates {
+	var found candidates
+	tNear, tFar := math.Inf(-1), math.Inf(1)
+	nearFace, farFace := -1, -1
+
+	for axis := 0; axis < 3; axis++ {
+		o, d := component(ray.Origin, axis), component(ray.Direction, axis)
+		lo, hi := component(box.min, axis), component(box.max, axis)
+
+		if d == 0 {
+			if o < lo || o > hi {
+				return found
+			}
+			continue
+		}
+
+		t0, t1 := (lo-o)/d, (hi-o)/d
+		face0, face1 := 2*axis, 2*axis+1
+		if d < 0 {
+			t0, t1 = t1, t0
+			face0, face1 = face1, face0
+		}
+		if t0 > tNear {
+			tNear, nearFace = t0, face0
+		}
+		if t1 < tFar {
+			tFar, farFace = t1, face1
+		}
+	}
+
+	if nearFace < 0 || tNear > tFar {
+		return found
+	}
+
+	found.add(tNear, nearFace)
+	found.add(tFar, farFace)
+	return found
+}
+
+// hitAt returns the hit for a crossing found by candidates.
+func (box Box) hitAt(ray geom.Ray, c candidate) Hit {
+	axis, high := c.part/2, c.part%2 == 1
+
+	point := pointAt(ray, c.t)
+	var normal geom.Vector
+	side := -1.0
+	if high {
+		side = 1
+	}
+	switch axis {
+	case 0:
+		normal = geom.NewVector(side, 0, 0)
+	case 1:
+		normal = geom.NewVector(0, side, 0)
+	default:
+		normal = geom.NewVector(0, 0, side)
+	}
+
+	relative := func(axis int) float64 {
+		lo, hi := component(box.min, axis), component(box.max, axis)
+		if hi == lo {
+			return 0
+		}
+		return (component(point, axis) - lo) / (hi - lo)
+	}
+
+	return Hit{
+		T:      c.t,
+		Point:  point,
+		Normal: normal,
+		U:      relative((axis + 1) % 3),
+		V:      relative((axis + 2) % 3),
+	}
+}
+
+func (box Box) Bounds() AABB {
+	return AABB{Min: box.min, Max: box.max}
+}
+
+func (box OrientedBox) Intersect(ray geom.Ray) bool {
+	return box.IntersectSegment(ray, epsilon, math.Inf(1))
+}
+
+// ClosestHit returns the hit with the surface of the box. U and V are the
+// coordinates of the hit on its face as for Box, along the axes of the box.
+func (box OrientedBox) ClosestHit(ray geom.Ray) (Hit, bool) {
+	return box.ClosestHitSegment(ray, epsilon, math.Inf(1))
+}
+
+func (box OrientedBox) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	found := box.box.candidates(box.frame.localRay(ray))
+	_, ok := found.nearest(tMin, tMax)
+	return ok
+}
+
+func (box OrientedBox) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	local := box.frame.localRay(ray)
+	found := box.box.candidates(local)
+	nearest, ok := found.nearest(tMin, tMax)
+	if !ok {
+		return Hit{}, false
+	}
+	return box.hitAt(ray, local, nearest), true
+}
+
+// hitAt returns the hit for a crossing found in the frame of the box.
+func (box OrientedBox) hitAt(ray, local geom.Ray, c candidate) Hit {
+	hit := box.box.hitAt(local, c)
+	hit.Point = pointAt(ray, c.t)
+	hit.Normal = box.frame.worldVector(hit.Normal)
+	hit.Primitive = box
+	return hit
+}
+
+func (box OrientedBox) Bounds() AABB {
+	half := box.box.max
+	f := box.frame
+	extent := geom.NewVector(
+		half.X*math.Abs(f.u.X)+half.Y*math.Abs(f.v.X)+half.Z*math.Abs(f.w.X),
+		half.X*math.Abs(f.u.Y)+half.Y*math.Abs(f.v.Y)+half.Z*math.Abs(f.w.Y),
+		half.X*math.Abs(f.u.Z)+half.Y*math.Abs(f.v.Z)+half.Z*math.Abs(f.w.Z),
+	)
+	return AABB{Min: geom.Sub(f.origin, extent), Max: geom.Add(f.origin, extent)}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"testing"
+)
+
+func TestSampleSimpleBoxShouldIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	prim = NewBox(geom.NewVector(1, 1, 1), geom.NewVector(-1, -1, -1))
+	ray := geom.NewRay(geom.NewVector(-5, 0.5, 0.5), geom.NewVector(1, 0, 0))
+
+	if !prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect box %#v but it did not.", ray, prim)
+	}
+}
+
+func TestSampleRayMissingBoxShouldNotIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	prim = NewBox(geom.NewVector(-1, -1, -1), geom.NewVector(1, 1, 1))
+	ray := geom.NewRay(geom.NewVector(-5, 0, 0), geom.NewVector(1, 1.5, 0))
+
+	if prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to not intersect box %#v but it did.", ray, prim)
+	}
+}
+
+func TestBoxClosestHit(t *testing.T) {
+	prim := NewBox(geom.NewVector(-1, -1, -1), geom.NewVector(1, 1, 1))
+
+	cases := []struct {
+		ray    geom.Ray
+		t      float64
+		normal geom.Vector
+		u, v   float64
+	}{
+		{geom.NewRay(geom.NewVector(-5, 0.5, 0), geom.NewVector(1, 0, 0)), 4, geom.NewVector(-1, 0, 0), 0.75, 0.5},
+		{geom.NewRay(geom.NewVector(0, 5, 0), geom.NewVector(0, -2, 0)), 2, geom.NewVector(0, 1, 0), 0.5, 0.5},
+		{geom.NewRay(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, -1)), 1, geom.NewVector(0, 0, -1), 0.5, 0.5},
+	}
+
+	for _, c := range cases {
+		hit, ok := prim.ClosestHit(c.ray)
+		if !ok {
+			t.Errorf("Expected ray %#v to hit box %#v but it did not.", c.ray, prim)
+			continue
+		}
+		if !almostEqual(hit.T, c.t) || !vectorsAlmostEqual(hit.Normal, c.normal) ||
+			!almostEqual(hit.U, c.u) || !almostEqual(hit.V, c.v) {
+			t.Errorf("Expected a hit at %v with normal %#v and UV %v, %v, got %#v", c.t, c.normal, c.u, c.v, hit)
+		}
+	}
+}
+
+func TestSampleOrientedBoxShouldIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	// A cube rotated by 45 degrees around Z reaches sqrt(2) along X
+	prim = NewOrientedBox(geom.NewVector(0, 0, 0), geom.NewVector(1, 1, 0), geom.NewVector(-1, 1, 0), geom.NewVector(1, 1, 1))
+	ray := geom.NewRay(geom.NewVector(1.3, 0, 5), geom.NewVector(0, 0, -1))
+
+	if !prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect box %#v but it did not.", ray, prim)
+	}
+}
+
+func TestOrientedBoxClosestHit(t *testing.T) {
+	prim := NewOrientedBox(geom.NewVector(0, 0, 0), geom.NewVector(1, 1, 0), geom.NewVector(-1, 1, 0), geom.NewVector(1, 1, 1))
+	ray := geom.NewRay(geom.NewVector(5, 0, 0), geom.NewVector(-1, 0, 0))
+
+	hit, ok := prim.ClosestHit(ray)
+	if !ok {
+		t.Fatalf("Expected ray %#v to hit box %#v but it did not.", ray, prim)
+	}
+	if !almostEqual(hit.T, 5-math.Sqrt2) {
+		t.Errorf("Expected the corner at %v, got %v", 5-math.Sqrt2, hit.T)
+	}
+
+	bounds := prim.Bounds()
+	if !vectorsAlmostEqual(bounds.Max, geom.NewVector(math.Sqrt2, math.Sqrt2, 1)) {
+		t.Errorf("Expected the box to reach (sqrt(2), sqrt(2), 1), got %#v", bounds.Max)
+	}
+
+	ray = geom.NewRay(geom.NewVector(1.3, 0, 5), geom.NewVector(0, 0, -1))
+	hit, ok = prim.ClosestHit(ray)
+	if !ok || !almostEqual(hit.T, 4) || !vectorsAlmostEqual(hit.Normal, geom.NewVector(0, 0, 1)) {
+		t.Errorf("Expected the top face at 4, got %#v", hit)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"sort"
+)
+
+const (
+	bvhBins          = 12
+	bvhMaxLeafSize   = 4
+	bvhTraversalCost = 0.5 // relative to the cost of testing a single primitive
+	bvhMaxDepth      = 64  // also sizes the traversal stack, see traverse
+)
+
+// BVH is a bounding volume hierarchy over a set of primitives. It is built
+// once with the surface area heuristic and answers ray queries by visiting
+// only the boxes the ray passes through.
+type BVH struct {
+	primitives []Primitive
+	nodes      []bvhNode
+
+	// given holds the primitives in the order they were given to NewBVH
+	// and order the index in it of each of the reordered primitives
+	given []Primitive
+	order []int
+}
+
+// bvhNode is a node of the flattened tree. The first child of an interior
+// node is stored right after it and second points to the other one. Leaves
+// own count primitives starting at first.
+type bvhNode struct {
+	bounds AABB
+	first  int
+	second int
+	count  int
+	axis   int
+}
+
+// bvhItem is the build-time summary of a primitive.
+type bvhItem struct {
+	primitive Primitive
+	index     int
+	bounds    AABB
+	centroid  geom.Vector
+}
+
+func NewBVH(primitives []Primitive) *BVH {
+	items := make([]bvhItem, len(primitives))
+	for i, primitive := range primitives {
+		bounds := primitive.Bounds()
+		items[i] = bvhItem{primitive: primitive, index: i, bounds: bounds, centroid: bounds.centroid()}
+	}
+
+	bvh := &BVH{
+		primitives: make([]Primitive, 0, len(primitives)),
+		nodes:      make([]bvhNode, 0, 2*len(primitives)),
+		given:      primitives,
+		order:      make([]int, 0, len(primitives)),
+	}
+	if len(items) > 0 {
+		bvh.build(items, 0)
+	}
+
+	return bvh
+}
+
+// build appends the subtree over items to the node list and returns its index.
+func (bvh *BVH) build(items []bvhItem, depth int) int {
+	index := len(bvh.nodes)
+	bvh.nodes = append(bvh.nodes, bvhNode{})
+
+	bounds, centroids := EmptyAABB(), EmptyAABB()
+	for _, item := range items {
+		bounds = bounds.Union(item.bounds)
+		centroids = centroids.Union(boundsOfPoints(item.centroid))
+	}
+	bvh.nodes[index].bounds = bounds
+
+	if len(items) == 1 || depth >= bvhMaxDepth-1 {
+		bvh.makeLeaf(index, items)
+		return index
+	}
+
+	axis := 0
+	extent := geom.Sub(centroids.Max, centroids.Min)
+	if extent.Y > extent.X && extent.Y >= extent.Z {
+		axis = 1
+	} else if extent.Z > extent.X && extent.Z > extent.Y {
+		axis = 2
+	}
+
+	mid, ok := bvhPartition(items, bounds, centroids, axis)
+	if !ok {
+		if len(items) <= bvhMaxLeafSize {
+			bvh.makeLeaf(index, items)
+			return index
+		}
+
+		// All centroids coincide or the heuristic found nothing better, split in the median
+		sort.Slice(items, func(i, j int) bool {
+			return component(items[i].centroid, axis) < component(items[j].centroid, axis)
+		})
+		mid = len(items) / 2
+	}
+
+	bvh.build(items[:mid], depth+1)
+	second := bvh.build(items[mid:], depth+1)
+	bvh.nodes[index].second = second
+	bvh.nodes[index].axis = axis
+
+	return index
+}
+
+func (bvh *BVH) makeLeaf(index int, items []bvhItem) {
+	bvh.nodes[index].first = len(bvh.primitives)
+	bvh.nodes[index].count = len(items)
+	for _, item := range items {
+		bvh.primitives = append(bvh.primitives, item.primitive)
+		bvh.order = append(bvh.order, item.index)
+	}
+}
+
+// bvhPartition bins the centroids along axis and reorders items around the
+// cheapest split according to the surface area heuristic. It reports false
+// when keeping all items in a single leaf is expected to be cheaper.
+func bvhPartition(items []bvhItem, bounds, centroids AABB, axis int) (int, bool) {
+	lo, hi := component(centroids.Min, axis), component(centroids.Max, axis)
+	if hi <= lo {
+		return 0, false
+	}
+
+	binOf := func(item bvhItem) int {
+		bin := int(bvhBins * (component(item.centroid, axis) - lo) / (hi - lo))
+		if bin >= bvhBins {
+			bin = bvhBins - 1
+		}
+		return bin
+	}
+
+	var counts [bvhBins]int
+	var boxes [bvhBins]AABB
+	for i := range boxes {
+		boxes[i] = EmptyAABB()
+	}
+	for _, item := range items {
+		bin := binOf(item)
+		counts[bin]++
+		boxes[bin] = boxes[bin].Union(item.bounds)
+	}
+
+	// Sweep from the right to know the cost of every right-hand side
+	var rightArea [bvhBins]float64
+	var rightCount [bvhBins]int
+	box, count := EmptyAABB(), 0
+	for i := bvhBins - 1; i > 0; i-- {
+		box, count = box.Union(boxes[i]), count+counts[i]
+		rightArea[i], rightCount[i] = box.surfaceArea(), count
+	}
+
+	area := bounds.surfaceArea()
+	if area == 0 {
+		area = 1
+	}
+
+	bestCost, bestSplit := math.Inf(1), 0
+	box, count = EmptyAABB(), 0
+	for i := 1; i < bvhBins; i++ {
+		box, count = box.Union(boxes[i-1]), count+counts[i-1]
+		if count == 0 || rightCount[i] == 0 {
+			continue
+		}
+
+		cost := bvhTraversalCost + (box.surfaceArea()*float64(count)+rightArea[i]*float64(rightCount[i]))/area
+		if cost < bestCost {
+			bestCost, bestSplit = cost, i
+		}
+	}
+
+	if bestSplit == 0 || (len(items) <= bvhMaxLeafSize && bestCost >= float64(len(items))) {
+		return 0, false
+	}
+
+	mid := 0
+	for i := range items {
+		if binOf(items[i]) < bestSplit {
+			items[i], items[mid] = items[mid], items[i]
+			mid++
+		}
+	}
+
+	return mid, true
+}
+
+func (bvh *BVH) Bounds() AABB {
+	if len(bvh.nodes) == 0 {
+		return EmptyAABB()
+	}
+	return bvh.nodes[0].bounds
+}
+
+// Intersect reports whether the ray hits any of the primitives. It stops at
+// the first hit found rather than looking for the closest one.
+func (bvh *BVH) Intersect(ray geom.Ray) bool {
+	found := false
+	bvh.traverse(ray, 0, math.Inf(1), func(primitive Primitive, _ float64) (float64, bool) {
+		if primitive.Intersect(ray) {
+			found = true
+			return 0, true
+		}
+		return math.Inf(1), false
+	})
+	return found
+}
+
+// ClosestHit returns the nearest hit of the ray among all primitives.
+func (bvh *BVH) ClosestHit(ray geom.Ray) (Hit, bool) {
+	var closest Hit
+	found := false
+	bvh.traverse(ray, 0, math.Inf(1), func(primitive Primitive, tMax float64) (float64, bool) {
+		if hit, ok := primitive.ClosestHit(ray); ok && hit.T < tMax {
+			closest, found = hit, true
+			return hit.T, false
+		}
+		return tMax, false
+	})
+	return closest, found
+}
+
+// IntersectSegment reports whether any primitive is hit between tMin and
+// tMax. Like Intersect it stops at the first hit found.
+func (bvh *BVH) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	found := false
+	bvh.traverse(ray, tMin, tMax, func(primitive Primitive, _ float64) (float64, bool) {
+		if primitive.IntersectSegment(ray, tMin, tMax) {
+			found = true
+			return 0, true
+		}
+		return tMax, false
+	})
+	return found
+}
+
+// ClosestHitSegment returns the nearest hit between tMin and tMax among all
+// primitives.
+func (bvh *BVH) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	var closest Hit
+	found := false
+	bvh.traverse(ray, tMin, tMax, func(primitive Primitive, tMax float64) (float64, bool) {
+		if hit, ok := primitive.ClosestHitSegment(ray, tMin, tMax); ok {
+			closest, found = hit, true
+			return hit.T, false
+		}
+		return tMax, false
+	})
+	return closest, found
+}
+
+// traverse walks the nodes the ray passes through between tMin and tMax,
+// nearest first. visit is called for every primitive in them with the
+// current search distance and returns the new one and whether to stop the
+// traversal. Distances may be negative when tMin is.
+func (bvh *BVH) traverse(ray geom.Ray, tMin, tMax float64, visit func(primitive Primitive, tMax float64) (float64, bool)) {
+	bvh.walk(ray, tMin, tMax, func(i int, tMax float64) (float64, bool) {
+		return visit(bvh.primitives[i], tMax)
+	})
+}
+
+// walk is traverse with the primitives given by their index.
+func (bvh *BVH) walk(ray geom.Ray, tMin, tMax float64, visit func(index int, tMax float64) (float64, bool)) {
+	if len(bvh.nodes) == 0 {
+		return
+	}
+
+	invDirection := reciprocal(ray.Direction)
+
+	// Every level below the root leaves at most one sibling on the stack.
+	// build stops splitting before bvhMaxDepth levels, so this is enough
+	// with one to spare.
+	var stack [bvhMaxDepth + 1]int
+	top := 0
+	stack[top] = 0
+	top++
+
+	for top > 0 {
+		top--
+		index := stack[top]
+		node := &bvh.nodes[index]
+		if !node.bounds.hitSlab(ray.Origin, invDirection, tMin, tMax) {
+			continue
+		}
+
+		if node.count > 0 {
+			for i := node.first; i < node.first+node.count; i++ {
+				var stop bool
+				if tMax, stop = visit(i, tMax); stop {
+					return
+				}
+			}
+			continue
+		}
+
+		// Push the far child first so the near one is visited next
+		near, far := index+1, node.second
+		if component(ray.Direction, node.axis) < 0 {
+			near, far = far, near
+		}
+		stack[top] = far
+		stack[top+1] = near
+		top += 2
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+func randomVector(rng *rand.Rand, extent float64) geom.Vector {
+	return geom.NewVector(
+		(rng.Float64()*2-1)*extent,
+		(rng.Float64()*2-1)*extent,
+		(rng.Float64()*2-1)*extent,
+	)
+}
+
+func randomPrimitives(rng *rand.Rand, n int) []Primitive {
+	primitives := make([]Primitive, 0, n)
+	for i := 0; i < n; i++ {
+		center := randomVector(rng, 20)
+		switch i % 3 {
+		case 0:
+			primitives = append(primitives, NewTriangle(
+				geom.Add(center, randomVector(rng, 1)),
+				geom.Add(center, randomVector(rng, 1)),
+				geom.Add(center, randomVector(rng, 1)),
+			))
+		case 1:
+			primitives = append(primitives, NewSphere(center, rng.Float64()+0.1))
+		default:
+			primitives = append(primitives, NewQuad(
+				geom.Add(center, geom.NewVector(-1, -1, 0)),
+				geom.Add(center, geom.NewVector(1, -1, 0)),
+				geom.Add(center, geom.NewVector(1, 1, 0)),
+				geom.Add(center, geom.NewVector(-1, 1, 0)),
+			))
+		}
+	}
+	return primitives
+}
+
+func bruteForceClosestHit(primitives []Primitive, ray geom.Ray) (Hit, bool) {
+	var closest Hit
+	found := false
+	for _, primitive := range primitives {
+		if hit, ok := primitive.ClosestHit(ray); ok && (!found || hit.T < closest.T) {
+			closest, found = hit, true
+		}
+	}
+	return closest, found
+}
+
+func TestBVHMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	primitives := randomPrimitives(rng, 300)
+	bvh := NewBVH(primitives)
+
+	for i := 0; i < 2000; i++ {
+		ray := geom.NewRay(randomVector(rng, 30), randomVector(rng, 1))
+
+		expected, expectedOK := bruteForceClosestHit(primitives, ray)
+		hit, ok := bvh.ClosestHit(ray)
+		if ok != expectedOK || (ok && !almostEqual(hit.T, expected.T)) {
+			t.Fatalf("Ray %#v: expected closest hit %v at %v, got %v at %v", ray, expectedOK, expected.T, ok, hit.T)
+		}
+
+		if bvh.Intersect(ray) != expectedOK {
+			t.Fatalf("Ray %#v: expected any-hit query to return %v", ray, expectedOK)
+		}
+	}
+}
+
+func TestBVHSinglePrimitive(t *testing.T) {
+	var prim geom.Intersectable
+
+	a, b, c := geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0), geom.NewVector(0, 1, 0)
+	prim = NewBVH([]Primitive{NewTriangle(a, b, c)})
+	ray := geom.NewRay(geom.NewVector(0, 0, -1), geom.NewVector(0, 0, 1))
+
+	if !prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect BVH %#v but it did not.", ray, prim)
+	}
+}
+
+func TestBVHEmpty(t *testing.T) {
+	bvh := NewBVH(nil)
+	ray := geom.NewRay(geom.NewVector(0, 0, -1), geom.NewVector(0, 0, 1))
+
+	if bvh.Intersect(ray) {
+		t.Errorf("Expected ray %#v to not intersect an empty BVH.", ray)
+	}
+	if _, ok := bvh.ClosestHit(ray); ok {
+		t.Errorf("Expected no closest hit in an empty BVH.")
+	}
+}
+
+func TestBVHCoincidentPrimitives(t *testing.T) {
+	primitives := make([]Primitive, 0, 50)
+	for i := 0; i < 50; i++ {
+		primitives = append(primitives, NewSphere(geom.NewVector(0, 0, 0), float64(i+1)))
+	}
+	bvh := NewBVH(primitives)
+	ray := geom.NewRay(geom.NewVector(0, 0, -100), geom.NewVector(0, 0, 1))
+
+	hit, ok := bvh.ClosestHit(ray)
+	if !ok || !almostEqual(hit.T, 50) {
+		t.Errorf("Expected the outermost sphere to be hit at 50, got %v at %v", ok, hit.T)
+	}
+}
+
+func TestBVHNested(t *testing.T) {
+	inner := NewBVH([]Primitive{NewSphere(geom.NewVector(5, 0, 0), 1)})
+	outer := NewBVH([]Primitive{inner, NewSphere(geom.NewVector(-5, 0, 0), 1)})
+	ray := geom.NewRay(geom.NewVector(5, 0, -10), geom.NewVector(0, 0, 1))
+
+	hit, ok := outer.ClosestHit(ray)
+	if !ok || !almostEqual(hit.T, 9) {
+		t.Errorf("Expected the nested sphere to be hit at 9, got %v at %v", ok, hit.T)
+	}
+	if bounds := outer.Bounds(); !almostEqual(bounds.Min.X, -6) || !almostEqual(bounds.Max.X, 6) {
+		t.Errorf("Expected bounds spanning [-6, 6] on X, got %#v", bounds)
+	}
+}
+
+func BenchmarkBVHClosestHit(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	bvh := NewBVH(randomPrimitives(rng, 3000))
+	rays := make([]geom.Ray, 1024)
+	for i := range rays {
+		rays[i] = geom.NewRay(randomVector(rng, 30), randomVector(rng, 1))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bvh.ClosestHit(rays[i%len(rays)])
+	}
+}
+
+func BenchmarkLinearClosestHit(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	primitives := randomPrimitives(rng, 3000)
+	rays := make([]geom.Ray, 1024)
+	for i := range rays {
+		rays[i] = geom.NewRay(randomVector(rng, 30), randomVector(rng, 1))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bruteForceClosestHit(primitives, rays[i%len(rays)])
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+// Projection is how a camera maps directions onto its image.
+type Projection int
+
+const (
+	// PerspectiveProjection is the projection of a pinhole or a thin lens.
+	PerspectiveProjection Projection = iota
+
+	// OrthographicProjection sends parallel rays from a rectangle.
+	OrthographicProjection
+
+	// FisheyeProjection is the equidistant fisheye projection, in which the
+	// distance from the center of the image is proportional to the angle
+	// from the view direction.
+	FisheyeProjection
+)
+
+// Camera turns points of an image into rays. Image coordinates are such
+// that (0, 0) is the top left corner of a width x height image and pixel
+// centers are at half coordinates.
+type Camera struct {
+	projection Projection
+	position   geom.Vector
+	forward    geom.Vector
+	right      geom.Vector
+	up         geom.Vector
+
+	// tanHalf is the tangent of half the vertical field of view of
+	// perspective cameras, halfHeight is half the height of the view of
+	// orthographic ones and halfAngle is half the vertical field of view of
+	// fisheye ones in radians.
+	tanHalf    float64
+	halfHeight float64
+	halfAngle  float64
+
+	// Thin lens cameras have a lens of radius lensRadius focused at
+	// focusDistance along the view direction.
+	lensRadius    float64
+	focusDistance float64
+}
+
+// newCameraFrame returns a camera at position looking at lookAt, with no
+// projection set up.
+func newCameraFrame(projection Projection, position, lookAt, up geom.Vector) Camera {
+	forward := normalize(geom.Sub(lookAt, position))
+	right := normalize(geom.Cross(forward, up))
+
+	return Camera{
+		projection: projection,
+		position:   position,
+		forward:    forward,
+		right:      right,
+		up:         geom.Cross(right, forward),
+	}
+}
+
+// NewCamera returns a pinhole camera at position looking at lookAt. up only
+// needs to point roughly upwards and fov is the vertical field of view in
+// degrees.
+func NewCamera(position, lookAt, up geom.Vector, fov float64) Camera {
+	camera := newCameraFrame(PerspectiveProjection, position, lookAt, up)
+	camera.tanHalf = math.Tan(fov * math.Pi / 360)
+	return camera
+}
+
+// NewThinLensCamera returns a perspective camera with a lens of the given
+// diameter, which keeps only the points at focusDistance along the view
+// direction sharp.
+func NewThinLensCamera(position, lookAt, up geom.Vector, fov, aperture, focusDistance float64) Camera {
+	camera := NewCamera(position, lookAt, up, fov)
+	camera.lensRadius = aperture / 2
+	camera.focusDistance = focusDistance
+	return camera
+}
+
+// NewOrthographicCamera returns a camera sending rays along the view
+// direction from a rectangle around position which is height tall.
+func NewOrthographicCamera(position, lookAt, up geom.Vector, height float64) Camera {
+	camera := newCameraFrame(OrthographicProjection, position, lookAt, up)
+	camera.halfHeight = height / 2
+	return camera
+}
+
+// NewFisheyeCamera returns an equidistant fisheye camera. fov is the
+// vertical field of view in degrees and may be up to 360.
+func NewFisheyeCamera(position, lookAt, up geom.Vector, fov float64) Camera {
+	camera := newCameraFrame(FisheyeProjection, position, lookAt, up)
+	camera.halfAngle = fov * math.Pi / 360
+	return camera
+}
+
+// Projection returns the projection of the camera.
+func (camera Camera) Projection() Projection {
+	return camera.projection
+}
+
+// Ray returns the ray through the point (x, y) of a width x height image,
+// starting at the center of the lens. Fisheye cameras see nothing further
+// than 180 degrees from the view direction and return a ray with a zero
+// direction there.
+func (camera Camera) Ray(x, y float64, width, height int) geom.Ray {
+	return camera.LensRay(x, y, width, height, 0, 0)
+}
+
+// LensRay is like Ray, but starts at the point of the lens which u and v in
+// [0, 1) select. Only thin lens cameras have a lens bigger than a point.
+func (camera Camera) LensRay(x, y float64, width, height int, u, v float64) geom.Ray {
+	aspect := float64(width) / float64(height)
+	sx := (2*x/float64(width) - 1) * aspect
+	sy := 1 - 2*y/float64(height)
+
+	switch camera.projection {
+	case OrthographicProjection:
+		origin := geom.Add(camera.position, camera.onImage(sx*camera.halfHeight, sy*camera.halfHeight))
+		return geom.NewRay(origin, camera.forward)
+
+	case FisheyeProjection:
+		r := math.Hypot(sx, sy)
+		theta := r * camera.halfAngle
+		if theta > math.Pi {
+			return geom.NewRay(camera.position, geom.Vector{})
+		}
+		direction := camera.forward
+		if r > 0 {
+			sine := math.Sin(theta) / r
+			direction = geom.Add(scale(camera.forward, math.Cos(theta)), camera.onImage(sx*sine, sy*sine))
+		}
+		return geom.NewRay(camera.position, normalize(direction))
+	}
+
+	direction := geom.Add(camera.forward, camera.onImage(sx*camera.tanHalf, sy*camera.tanHalf))
+	if camera.lensRadius == 0 || (u == 0 && v == 0) {
+		return geom.NewRay(camera.position, normalize(direction))
+	}
+
+	// Rays through any point of the lens meet on the focus plane
+	focus := geom.Add(camera.position, scale(direction, camera.focusDistance))
+	r, phi := camera.lensRadius*math.Sqrt(u), 2*math.Pi*v
+	origin := geom.Add(camera.position, camera.onImage(r*math.Cos(phi), r*math.Sin(phi)))
+	return geom.NewRay(origin, normalize(geom.Sub(focus, origin)))
+}
+
+// Project returns the image coordinates at which the camera sees a point,
+// which may be outside of the image, or false if it does not see it. Thin
+// lens cameras see points off the focus plane blurred around the returned
+// coordinates.
+func (camera Camera) Project(point geom.Vector, width, height int) (x, y float64, ok bool) {
+	d := geom.Sub(point, camera.position)
+	px, py, depth := geom.Dot(d, camera.right), geom.Dot(d, camera.up), geom.Dot(d, camera.forward)
+
+	var sx, sy float64
+	switch camera.projection {
+	case OrthographicProjection:
+		if depth < 0 {
+			return 0, 0, false
+		}
+		sx, sy = px/camera.halfHeight, py/camera.halfHeight
+
+	case FisheyeProjection:
+		// Points on the axis are at the center, or all around the edge of
+		// the image if they are behind
+		lateral := math.Hypot(px, py)
+		if lateral <= 1e-9*length(d) {
+			if depth <= 0 {
+				return 0, 0, false
+			}
+			return float64(width) / 2, float64(height) / 2, true
+		}
+		r := math.Atan2(lateral, depth) / camera.halfAngle
+		sx, sy = px/lateral*r, py/lateral*r
+
+	default:
+		if depth <= 0 {
+			return 0, 0, false
+		}
+		sx, sy = px/(depth*camera.tanHalf), py/(depth*camera.tanHalf)
+	}
+
+	aspect := float64(width) / float64(height)
+	return (sx/aspect + 1) * float64(width) / 2, (1 - sy) * float64(height) / 2, true
+}
+
+// onImage returns the vector going x to the right and y up in the image.
+func (camera Camera) onImage(x, y float64) geom.Vector {
+	return geom.Add(scale(camera.right, x), scale(camera.up, y))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+func testCameras() map[string]Camera {
+	position, lookAt, up := geom.NewVector(1, 2, 5), geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0)
+	return map[string]Camera{
+		"perspective":  NewCamera(position, lookAt, up, 60),
+		"thin lens":    NewThinLensCamera(position, lookAt, up, 60, 0.5, 4),
+		"orthographic": NewOrthographicCamera(position, lookAt, up, 3),
+		"fisheye":      NewFisheyeCamera(position, lookAt, up, 150),
+	}
+}
+
+func TestCameraProjectInvertsRay(t *testing.T) {
+	rng := rand.New(rand.NewSource(22))
+
+	for name, camera := range testCameras() {
+		for i := 0; i < 1000; i++ {
+			x, y := 80*rng.Float64(), 50*rng.Float64()
+			ray := camera.Ray(x, y, 80, 50)
+			if !almostEqual(length(ray.Direction), 1) {
+				t.Fatalf("%s: expected a unit direction for (%v, %v), got %#v", name, x, y, ray.Direction)
+			}
+
+			px, py, ok := camera.Project(pointAt(ray, 10*rng.Float64()+0.1), 80, 50)
+			if !ok || math.Abs(px-x) > 1e-6 || math.Abs(py-y) > 1e-6 {
+				t.Fatalf("%s: expected a point on the ray through (%v, %v) to project back, got %v (%v, %v)", name, x, y, ok, px, py)
+			}
+		}
+	}
+}
+
+func TestCameraProjectBehind(t *testing.T) {
+	behind := geom.NewVector(2, 4, 10)
+
+	for name, camera := range testCameras() {
+		if _, _, ok := camera.Project(behind, 80, 50); ok {
+			t.Errorf("%s: expected a point straight behind the camera to not be seen", name)
+		}
+	}
+
+	// The center of the view is the center of the image
+	for name, camera := range testCameras() {
+		if x, y, ok := camera.Project(geom.Vector{}, 80, 50); !ok || !almostEqual(x, 40) || !almostEqual(y, 25) {
+			t.Errorf("%s: expected the point looked at to be at (40, 25), got %v (%v, %v)", name, ok, x, y)
+		}
+	}
+}
+
+func TestOrthographicCamera(t *testing.T) {
+	camera := NewOrthographicCamera(geom.NewVector(0, 0, 5), geom.Vector{}, geom.NewVector(0, 1, 0), 2)
+
+	// The view is 2 tall and, for a 2:1 image, 4 wide
+	top, corner := camera.Ray(50, 0, 100, 50), camera.Ray(0, 50, 100, 50)
+	if !vectorsAlmostEqual(top.Origin, geom.NewVector(0, 1, 5)) || !vectorsAlmostEqual(corner.Origin, geom.NewVector(-2, -1, 5)) {
+		t.Errorf("Expected rays from (0, 1, 5) and (-2, -1, 5), got %#v and %#v", top.Origin, corner.Origin)
+	}
+	if !vectorsAlmostEqual(top.Direction, geom.NewVector(0, 0, -1)) || top.Direction != corner.Direction {
+		t.Errorf("Expected all rays to look along -Z, got %#v and %#v", top.Direction, corner.Direction)
+	}
+}
+
+func TestFisheyeCamera(t *testing.T) {
+	camera := NewFisheyeCamera(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, -1), geom.NewVector(0, 1, 0), 180)
+
+	// The edges of the image height look sideways
+	if ray := camera.Ray(50, 0, 100, 100); !vectorsAlmostEqual(ray.Direction, geom.NewVector(0, 1, 0)) {
+		t.Errorf("Expected the top of a 180 degree fisheye to look up, got %#v", ray.Direction)
+	}
+
+	// Halfway to the edge is 45 degrees off the view direction
+	if ray := camera.Ray(75, 50, 100, 100); !vectorsAlmostEqual(ray.Direction, normalize(geom.NewVector(1, 0, -1))) {
+		t.Errorf("Expected a ray at 45 degrees to the right, got %#v", ray.Direction)
+	}
+
+	// A full circle fisheye sees nothing beyond 180 degrees in the corners
+	full := NewFisheyeCamera(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, -1), geom.NewVector(0, 1, 0), 360)
+	if ray := full.Ray(0, 0, 100, 100); ray.Direction != (geom.Vector{}) {
+		t.Errorf("Expected no ray in the corner of a full fisheye, got %#v", ray.Direction)
+	}
+	if x, y, ok := full.Project(geom.NewVector(0.001, 0, 1), 100, 100); !ok || x < 99 || !almostEqual(y, 50) {
+		t.Errorf("Expected a point almost behind to be near the right edge, got %v (%v, %v)", ok, x, y)
+	}
+}
+
+func TestThinLensCamera(t *testing.T) {
+	rng := rand.New(rand.NewSource(22))
+	camera := NewThinLensCamera(geom.NewVector(0, 0, 5), geom.Vector{}, geom.NewVector(0, 1, 0), 60, 0.5, 4)
+	pinhole := NewCamera(geom.NewVector(0, 0, 5), geom.Vector{}, geom.NewVector(0, 1, 0), 60)
+
+	for i := 0; i < 100; i++ {
+		x, y := 64*rng.Float64(), 48*rng.Float64()
+		ray := camera.LensRay(x, y, 64, 48, rng.Float64(), rng.Float64())
+		if d := geom.Sub(ray.Origin, geom.NewVector(0, 0, 5)); d.Z != 0 || length(d) > 0.25 {
+			t.Fatalf("Expected rays to start on the lens, got %#v", ray.Origin)
+		}
+
+		// All rays through a pixel meet the pinhole ray on the focus plane
+		center := pinhole.Ray(x, y, 64, 48)
+		focus := pointAt(center, 4/-center.Direction.Z)
+		if !vectorsAlmostEqual(pointAt(ray, (ray.Origin.Z-1)/-ray.Direction.Z), focus) {
+			t.Fatalf("Expected the lens ray to pass through %#v, got %#v", focus, ray)
+		}
+	}
+
+	// A pinhole camera ignores the point of the lens
+	if pinhole.LensRay(10, 10, 64, 48, 0.3, 0.7) != pinhole.Ray(10, 10, 64, 48) {
+		t.Errorf("Expected the pinhole camera to not have a lens")
+	}
+	if camera.LensRay(10, 10, 64, 48, 0.3, 0.7) == camera.Ray(10, 10, 64, 48) {
+		t.Errorf("Expected the thin lens to move the ray")
+	}
+}
+
+func TestFisheyeRenders(t *testing.T) {
+	scene := testScene()
+	scene.Camera = NewFisheyeCamera(geom.NewVector(0, 0, 5), geom.Vector{}, geom.NewVector(0, 1, 0), 360)
+	scene.Background = Color{R: 0.3}
+
+	traced, err := scene.PathTrace(context.Background(), PathTraceOptions{RenderOptions: RenderOptions{Width: 16, Height: 16}, Samples: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	background := scene.Background.rgba()
+	for name, img := range map[string]*image.RGBA{"Render": scene.Render(16, 16), "PathTrace": traced} {
+		if c := img.RGBAAt(0, 0); c != background {
+			t.Errorf("%s: expected the corner outside the fisheye to be the background %v, got %v", name, background, c)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+// Contact describes how two shapes overlap.
+type Contact struct {
+	// Point is a point where the shapes meet, halfway between the deepest
+	// points of each inside the other.
+	Point geom.Vector
+
+	// Normal is the unit direction in which the second shape has to move
+	// to separate from the first.
+	Normal geom.Vector
+
+	// Depth is how far it has to move, which is zero if the shapes only
+	// touch.
+	Depth float64
+}
+
+// CollideSpheres reports whether two spheres overlap or touch.
+func CollideSpheres(a, b Sphere) (Contact, bool) {
+	d := geom.Sub(b.origin, a.origin)
+	distance := length(d)
+	if distance > a.r+b.r {
+		return Contact{}, false
+	}
+
+	// Concentric spheres may separate in any direction
+	normal := geom.NewVector(0, 0, 1)
+	if distance > 0 {
+		normal = scale(d, 1/distance)
+	}
+	depth := a.r + b.r - distance
+	return Contact{Point: geom.Add(a.origin, scale(normal, a.r-depth/2)), Normal: normal, Depth: depth}, true
+}
+
+// CollideSphereTriangle reports whether a sphere overlaps or touches a
+// triangle. A sphere centered on the triangle pushes it along its normal,
+// or across it if the triangle has no area.
+func CollideSphereTriangle(sphere Sphere, triangle Triangle) (Contact, bool) {
+	closest := closestPointOnTriangle(sphere.origin, triangle)
+	d := geom.Sub(closest, sphere.origin)
+	distance := length(d)
+	if distance > sphere.r {
+		return Contact{}, false
+	}
+
+	normal := triangle.separatingNormal()
+	if distance > epsilon*sphere.r {
+		normal = scale(d, 1/distance)
+	}
+	depth := sphere.r - distance
+	return Contact{Point: geom.Add(closest, scale(normal, depth/2)), Normal: normal, Depth: depth}, true
+}
+
+// separatingNormal returns the unit normal of the triangle. Triangles which
+// have collapsed to a segment have none, and get a direction perpendicular
+// to their longest edge instead, and ones which are a single point get Z.
+func (triangle Triangle) separatingNormal() geom.Vector {
+	longest := triangle.edge1
+	for _, edge := range []geom.Vector{triangle.edge2, geom.Sub(triangle.c, triangle.b)} {
+		if length(edge) > length(longest) {
+			longest = edge
+		}
+	}
+
+	size := length(longest)
+	switch normal := geom.Cross(triangle.edge1, triangle.edge2); {
+	case size == 0:
+		return geom.NewVector(0, 0, 1)
+	case length(normal) > epsilon*size*size:
+		return normalize(normal)
+	}
+	across, _ := planeBasis(scale(longest, 1/size))
+	return across
+}
+
+// CollideSphereBox reports whether a sphere overlaps or touches a box. A
+// sphere whose center is inside the box pushes it out through the face
+// nearest to the center.
+func CollideSphereBox(sphere Sphere, box Box) (Contact, bool) {
+	closest := maxVector(box.min, minVector(box.max, sphere.origin))
+	d := geom.Sub(closest, sphere.origin)
+	distance := length(d)
+	if distance > sphere.r {
+		return Contact{}, false
+	}
+
+	if distance > 0 {
+		normal := scale(d, 1/distance)
+		depth := sphere.r - distance
+		return Contact{Point: geom.Add(closest, scale(normal, depth/2)), Normal: normal, Depth: depth}, true
+	}
+
+	// The box leaves through the face opposite to the nearest one
+	var normal geom.Vector
+	nearest := math.Inf(1)
+	for axis, unit := range [3]geom.Vector{{X: 1}, {Y: 1}, {Z: 1}} {
+		center := component(sphere.origin, axis)
+		if below := center - component(box.min, axis); below < nearest {
+			normal, nearest = unit, below
+		}
+		if above := component(box.max, axis) - center; above < nearest {
+			normal, nearest = scale(unit, -1), above
+		}
+	}
+	depth := sphere.r + nearest
+	face := geom.Add(sphere.origin, scale(normal, -nearest))
+	return Contact{Point: geom.Add(face, scale(normal, depth/2)), Normal: normal, Depth: depth}, true
+}
+
+// CollideTriangles reports whether two triangles overlap or touch using
+// Möller's interval overlap test. The point of the contact is the middle of
+// the segment the triangles share, and its normal and depth are the
+// smallest move which separates them.
+func CollideTriangles(a, b Triangle) (Contact, bool) {
+	u := []geom.Vector{a.a, a.b, a.c}
+	v := []geom.Vector{b.a, b.b, b.c}
+	point, ok := triangleOverlap(u, v)
+	if !ok {
+		return Contact{}, false
+	}
+
+	normal, depth := separation(u, v)
+	return Contact{Point: point, Normal: normal, Depth: depth}, true
+}
+
+// CollideQuads reports whether two quads overlap or touch. Quads are tested
+// as the two triangles each is split into, so quads which are not planar are
+// approximated. The point of the contact is the average of the points where
+// the triangles meet. Planar convex quads are separated as a whole, others by
+// the largest move which separates a pair of their triangles.
+func CollideQuads(a, b Quad) (Contact, bool) {
+	var contact Contact
+	var points int
+	for _, ta := range a.triangles {
+		for _, tb := range b.triangles {
+			pair, ok := CollideTriangles(ta, tb)
+			if !ok {
+				continue
+			}
+			contact.Point = geom.Add(contact.Point, pair.Point)
+			points++
+			if pair.Depth >= contact.Depth {
+				contact.Normal, contact.Depth = pair.Normal, pair.Depth
+			}
+		}
+	}
+	if points == 0 {
+		return Contact{}, false
+	}
+	contact.Point = scale(contact.Point, 1/float64(points))
+
+	if a.planar && b.planar && a.reflexVertex() < 0 && b.reflexVertex() < 0 {
+		va, vb := a.vertices(), b.vertices()
+		contact.Normal, contact.Depth = separation(va[:], vb[:])
+	}
+	return contact, true
+}
+
+// triangleOverlap returns a point the triangles share, or false if they do
+// not meet.
+func triangleOverlap(u, v []geom.Vector) (geom.Vector, bool) {
+	// Each triangle has to cross the plane of the other
+	nu := normalize(geom.Cross(geom.Sub(u[1], u[0]), geom.Sub(u[2], u[0])))
+	nv := normalize(geom.Cross(geom.Sub(v[1], v[0]), geom.Sub(v[2], v[0])))
+	size := extent(u, v)
+	du, ok := planeDistances(u, nv, v[0], epsilon*size)
+	if !ok {
+		return geom.Vector{}, false
+	}
+	dv, ok := planeDistances(v, nu, u[0], epsilon*size)
+	if !ok {
+		return geom.Vector{}, false
+	}
+
+	if du == [3]float64{} {
+		return coplanarOverlap(u, v, nu, size)
+	}
+
+	// Both cross the line where the planes meet, and overlap if the
+	// segments on it do
+	direction := geom.Cross(nu, nv)
+	uStart, uEnd := crossingSegment(u, du, direction)
+	vStart, vEnd := crossingSegment(v, dv, direction)
+
+	start, end := uStart, uEnd
+	if geom.Dot(vStart, direction) > geom.Dot(start, direction) {
+		start = vStart
+	}
+	if geom.Dot(vEnd, direction) < geom.Dot(end, direction) {
+		end = vEnd
+	}
+	if geom.Dot(geom.Sub(end, start), direction) < -epsilon*size {
+		return geom.Vector{}, false
+	}
+	return scale(geom.Add(start, end), 0.5), true
+}
+
+// extent returns the longest side of the box around the points of the
+// polygons. Tolerances are scaled by it, so that the tests work the same
+// for shapes of any size.
+func extent(polygons ...[]geom.Vector) float64 {
+	bounds := EmptyAABB()
+	for _, polygon := range polygons {
+		for _, point := range polygon {
+			bounds = bounds.Union(AABB{Min: point, Max: point})
+		}
+	}
+	size := geom.Sub(bounds.Max, bounds.Min)
+	return math.Max(size.X, math.Max(size.Y, size.Z))
+}
+
+// planeDistances returns the signed distances of the vertices from a plane,
+// with those within tolerance of it set to zero, or false if all are on the
+// same side of it.
+func planeDistances(vertices []geom.Vector, normal, point geom.Vector, tolerance float64) ([3]float64, bool) {
+	var d [3]float64
+	above, below := false, false
+	for i, vertex := range vertices {
+		d[i] = geom.Dot(geom.Sub(vertex, point), normal)
+		if math.Abs(d[i]) <= tolerance {
+			d[i] = 0
+		}
+		above = above || d[i] >= 0
+		below = below || d[i] <= 0
+	}
+	return d, above && below
+}
+
+// crossingSegment returns the ends, ordered along direction, of the segment
+// where a triangle with the given distances from a plane crosses it.
+func crossingSegment(vertices []geom.Vector, d [3]float64, direction geom.Vector) (geom.Vector, geom.Vector) {
+	var points [3]geom.Vector
+	n := 0
+	for i := range vertices {
+		j := (i + 1) % 3
+		if d[i] == 0 {
+			points[n] = vertices[i]
+			n++
+		} else if d[i]*d[j] < 0 {
+			points[n] = geom.Add(vertices[i], scale(geom.Sub(vertices[j], vertices[i]), d[i]/(d[i]-d[j])))
+			n++
+		}
+	}
+
+	start, end := points[0], points[0]
+	for _, point := range points[1:n] {
+		if geom.Dot(point, direction) < geom.Dot(start, direction) {
+			start = point
+		}
+		if geom.Dot(point, direction) > geom.Dot(end, direction) {
+			end = point
+		}
+	}
+	return start, end
+}
+
+// coplanarOverlap returns the average of the corners of the region two
+// triangles in the same plane share, or false if they do not meet. Areas
+// below epsilon times the square of size count as zero.
+func coplanarOverlap(u, v []geom.Vector, normal geom.Vector, size float64) (geom.Vector, bool) {
+	tolerance := epsilon * size * size
+
+	// Work in the coordinate plane the triangles are least slanted to
+	axis := 0
+	for i := 1; i < 3; i++ {
+		if math.Abs(component(normal, i)) > math.Abs(component(normal, axis)) {
+			axis = i
+		}
+	}
+	flat := func(p geom.Vector) [2]float64 {
+		switch axis {
+		case 0:
+			return [2]float64{p.Y, p.Z}
+		case 1:
+			return [2]float64{p.Z, p.X}
+		}
+		return [2]float64{p.X, p.Y}
+	}
+
+	var sum geom.Vector
+	n := 0
+	for i := range u {
+		if insideTriangle2D(flat(u[i]), flat(v[0]), flat(v[1]), flat(v[2]), tolerance) {
+			sum, n = geom.Add(sum, u[i]), n+1
+		}
+		if insideTriangle2D(flat(v[i]), flat(u[0]), flat(u[1]), flat(u[2]), tolerance) {
+			sum, n = geom.Add(sum, v[i]), n+1
+		}
+		for j := range v {
+			a, b := u[i], u[(i+1)%3]
+			if t, ok := segmentsCross2D(flat(a), flat(b), flat(v[j]), flat(v[(j+1)%3]), tolerance); ok {
+				sum, n = geom.Add(sum, geom.Add(a, scale(geom.Sub(b, a), t))), n+1
+			}
+		}
+	}
+
+	if n == 0 {
+		return geom.Vector{}, false
+	}
+	return scale(sum, 1/float64(n)), true
+}
+
+func cross2D(o, a, b [2]float64) float64 {
+	return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+}
+
+// insideTriangle2D reports whether p is inside the triangle abc or on its
+// edges, whatever its winding. Cross products within tolerance of zero put
+// p on an edge.
+func insideTriangle2D(p, a, b, c [2]float64, tolerance float64) bool {
+	d1, d2, d3 := cross2D(a, b, p), cross2D(b, c, p), cross2D(c, a, p)
+	negative := d1 < -tolerance || d2 < -tolerance || d3 < -tolerance
+	positive := d1 > tolerance || d2 > tolerance || d3 > tolerance
+	return !(negative && positive)
+}
+
+// segmentsCross2D returns where along ab the segments ab and cd cross, or
+// false if they do not or are parallel, which they are taken to be when
+// the cross product of their directions is within tolerance of zero.
+func segmentsCross2D(a, b, c, d [2]float64, tolerance float64) (float64, bool) {
+	r := [2]float64{b[0] - a[0], b[1] - a[1]}
+	s := [2]float64{d[0] - c[0], d[1] - c[1]}
+	denominator := r[0]*s[1] - r[1]*s[0]
+	if math.Abs(denominator) <= tolerance {
+		return 0, false
+	}
+
+	ac := [2]float64{c[0] - a[0], c[1] - a[1]}
+	t := (ac[0]*s[1] - ac[1]*s[0]) / denominator
+	w := (ac[0]*r[1] - ac[1]*r[0]) / denominator
+	return t, t >= 0 && t <= 1 && w >= 0 && w <= 1
+}
+
+// separation returns the shortest move of the convex planar polygon b which
+// separates it from a, found by trying every axis which could separate them.
+func separation(a, b []geom.Vector) (geom.Vector, float64) {
+	na := newellNormal(a)
+	nb := newellNormal(b)
+	axes := []geom.Vector{na, nb}
+	for i := range a {
+		ea := geom.Sub(a[(i+1)%len(a)], a[i])
+		axes = append(axes, geom.Cross(na, ea))
+		for j := range b {
+			axes = append(axes, geom.Cross(ea, geom.Sub(b[(j+1)%len(b)], b[j])))
+		}
+	}
+	for j := range b {
+		axes = append(axes, geom.Cross(nb, geom.Sub(b[(j+1)%len(b)], b[j])))
+	}
+
+	// Edges which are nearly parallel give no axis
+	size := extent(a, b)
+	tolerance := epsilon * size * size
+	normal, depth := na, math.Inf(1)
+	for _, axis := range axes {
+		if geom.Dot(axis, axis) <= tolerance*tolerance {
+			continue
+		}
+		axis = normalize(axis)
+
+		minA, maxA := projectOnto(a, axis)
+		minB, maxB := projectOnto(b, axis)
+		if forward := maxA - minB; forward < depth {
+			normal, depth = axis, forward
+		}
+		if backward := maxB - minA; backward < depth {
+			normal, depth = scale(axis, -1), backward
+		}
+	}
+	return normal, math.Max(depth, 0)
+}
+
+func projectOnto(vertices []geom.Vector, axis geom.Vector) (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, vertex := range vertices {
+		p := geom.Dot(vertex, axis)
+		lo, hi = math.Min(lo, p), math.Max(hi, p)
+	}
+	return lo, hi
+}
+
+// closestPointOnTriangle returns the point of the triangle nearest to p,
+// as in Ericson's Real-Time Collision Detection.
+func closestPointOnTriangle(p geom.Vector, triangle Triangle) geom.Vector {
+	a, b, c := triangle.a, triangle.b, triangle.c
+	ab, ac, ap := triangle.edge1, triangle.edge2, geom.Sub(p, a)
+
+	d1, d2 := geom.Dot(ab, ap), geom.Dot(ac, ap)
+	if d1 <= 0 && d2 <= 0 {
+		return a
+	}
+
+	bp := geom.Sub(p, b)
+	d3, d4 := geom.Dot(ab, bp), geom.Dot(ac, bp)
+	if d3 >= 0 && d4 <= d3 {
+		return b
+	}
+
+	vc := d1*d4 - d3*d2
+	if vc <= 0 && d1 >= 0 && d3 <= 0 {
+		return geom.Add(a, scale(ab, d1/(d1-d3)))
+	}
+
+	cp := geom.Sub(p, c)
+	d5, d6 := geom.Dot(ab, cp), geom.Dot(ac, cp)
+	if d6 >= 0 && d5 <= d6 {
+		return c
+	}
+
+	vb := d5*d2 - d1*d6
+	if vb <= 0 && d2 >= 0 && d6 <= 0 {
+		return geom.Add(a, scale(ac, d2/(d2-d6)))
+	}
+
+	va := d3*d6 - d5*d4
+	if va <= 0 && d4-d3 >= 0 && d5-d6 >= 0 {
+		return geom.Add(b, scale(geom.Sub(c, b), (d4-d3)/((d4-d3)+(d5-d6))))
+	}
+
+	// Inside the face
+	denominator := 1 / (va + vb + vc)
+	return geom.Add(a, geom.Add(scale(ab, vb*denominator), scale(ac, vc*denominator)))
+}
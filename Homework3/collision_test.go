@@ -0,0 +1,226 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+func checkContact(t *testing.T, name string, contact Contact, ok bool, point, normal geom.Vector, depth float64) {
+	t.Helper()
+	if !ok {
+		t.Errorf("%s: expected a contact", name)
+		return
+	}
+	if !vectorsAlmostEqual(contact.Point, point) || !vectorsAlmostEqual(contact.Normal, normal) || !almostEqual(contact.Depth, depth) {
+		t.Errorf("%s: expected a contact at %#v along %#v of depth %v, got %#v", name, point, normal, depth, contact)
+	}
+}
+
+func TestCollideSpheres(t *testing.T) {
+	a := NewSphere(geom.NewVector(0, 0, 0), 1)
+
+	contact, ok := CollideSpheres(a, NewSphere(geom.NewVector(1.5, 0, 0), 1))
+	checkContact(t, "overlapping", contact, ok, geom.NewVector(0.75, 0, 0), geom.NewVector(1, 0, 0), 0.5)
+
+	contact, ok = CollideSpheres(a, NewSphere(geom.NewVector(0, 3, 0), 2))
+	checkContact(t, "touching", contact, ok, geom.NewVector(0, 1, 0), geom.NewVector(0, 1, 0), 0)
+
+	if _, ok := CollideSpheres(a, NewSphere(geom.NewVector(0, 0, 2.1), 1)); ok {
+		t.Errorf("Expected spheres 0.1 apart to not collide")
+	}
+
+	if contact, ok := CollideSpheres(a, NewSphere(geom.Vector{}, 0.5)); !ok || !almostEqual(length(contact.Normal), 1) || !almostEqual(contact.Depth, 1.5) {
+		t.Errorf("Expected concentric spheres to separate by 1.5 in some direction, got %#v", contact)
+	}
+}
+
+func TestCollideSphereTriangle(t *testing.T) {
+	triangle := NewTriangle(geom.NewVector(0, 0, 0), geom.NewVector(4, 0, 0), geom.NewVector(0, 4, 0))
+
+	contact, ok := CollideSphereTriangle(NewSphere(geom.NewVector(1, 1, 0.5), 1), triangle)
+	checkContact(t, "face", contact, ok, geom.NewVector(1, 1, -0.25), geom.NewVector(0, 0, -1), 0.5)
+
+	contact, ok = CollideSphereTriangle(NewSphere(geom.NewVector(2, -0.5, 0), 1), triangle)
+	checkContact(t, "edge", contact, ok, geom.NewVector(2, 0.25, 0), geom.NewVector(0, 1, 0), 0.5)
+
+	contact, ok = CollideSphereTriangle(NewSphere(geom.NewVector(-0.6, -0.8, 0), 2), triangle)
+	checkContact(t, "vertex", contact, ok, geom.NewVector(0.3, 0.4, 0), geom.NewVector(0.6, 0.8, 0), 1)
+
+	contact, ok = CollideSphereTriangle(NewSphere(geom.NewVector(1, 1, 0), 0.5), triangle)
+	checkContact(t, "centered", contact, ok, geom.NewVector(1, 1, 0.25), geom.NewVector(0, 0, 1), 0.5)
+
+	if _, ok := CollideSphereTriangle(NewSphere(geom.NewVector(3, 3, 0), 0.5), triangle); ok {
+		t.Errorf("Expected a sphere beyond the long edge to miss the triangle")
+	}
+
+	// Triangles without area have no normal, so spheres centered on them
+	// are pushed across them
+	sliver := NewTriangle(geom.NewVector(0, 0, 0), geom.NewVector(2, 0, 0), geom.NewVector(1, 0, 0))
+	contact, ok = CollideSphereTriangle(NewSphere(geom.NewVector(1, 0, 0), 0.5), sliver)
+	if !ok || !almostEqual(length(contact.Normal), 1) || !almostEqual(contact.Normal.X, 0) || !almostEqual(contact.Depth, 0.5) {
+		t.Errorf("Expected a sphere centered on a sliver to be pushed across it by 0.5, got %#v", contact)
+	}
+	point := NewTriangle(geom.NewVector(1, 1, 1), geom.NewVector(1, 1, 1), geom.NewVector(1, 1, 1))
+	contact, ok = CollideSphereTriangle(NewSphere(geom.NewVector(1, 1, 1), 0.5), point)
+	checkContact(t, "point", contact, ok, geom.NewVector(1, 1, 1.25), geom.NewVector(0, 0, 1), 0.5)
+}
+
+func TestCollideSphereBox(t *testing.T) {
+	box := NewBox(geom.NewVector(0, 0, 0), geom.NewVector(2, 2, 2))
+
+	contact, ok := CollideSphereBox(NewSphere(geom.NewVector(1, 2.5, 1), 1), box)
+	checkContact(t, "face", contact, ok, geom.NewVector(1, 1.75, 1), geom.NewVector(0, -1, 0), 0.5)
+
+	contact, ok = CollideSphereBox(NewSphere(geom.NewVector(-1, -1, 1), 2), box)
+	d := 2 - math.Sqrt2
+	checkContact(t, "edge", contact, ok, geom.Add(geom.Vector{Z: 1}, scale(normalize(geom.NewVector(1, 1, 0)), d/2)), normalize(geom.NewVector(1, 1, 0)), d)
+
+	contact, ok = CollideSphereBox(NewSphere(geom.NewVector(1, 1, 1.8), 0.5), box)
+	checkContact(t, "inside", contact, ok, geom.NewVector(1, 1, 1.65), geom.NewVector(0, 0, -1), 0.7)
+
+	if _, ok := CollideSphereBox(NewSphere(geom.NewVector(3, 3, 3), 1.5), box); ok {
+		t.Errorf("Expected a sphere by the corner to miss the box")
+	}
+}
+
+func TestCollideTriangles(t *testing.T) {
+	floor := NewTriangle(geom.NewVector(-2, 0, -2), geom.NewVector(2, 0, -2), geom.NewVector(0, 0, 2))
+
+	// A triangle dipping 0.5 into the floor crosses it from x = -0.25 to 0.25
+	dipping := NewTriangle(geom.NewVector(-1, 1.5, 0), geom.NewVector(1, 1.5, 0), geom.NewVector(0, -0.5, 0))
+	contact, ok := CollideTriangles(floor, dipping)
+	checkContact(t, "crossing", contact, ok, geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0), 0.5)
+
+	touching := NewTriangle(geom.NewVector(-1, 1, 0), geom.NewVector(1, 1, 0), geom.NewVector(0, 0, 0))
+	contact, ok = CollideTriangles(floor, touching)
+	checkContact(t, "touching", contact, ok, geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0), 0)
+
+	// Both cross the line of the other plane, but apart
+	apart := NewTriangle(geom.NewVector(-1, 1, 3), geom.NewVector(1, 1, 3), geom.NewVector(0, -1, 3))
+	if _, ok := CollideTriangles(floor, apart); ok {
+		t.Errorf("Expected a triangle beyond the floor to miss it")
+	}
+
+	coplanar := NewTriangle(geom.NewVector(0, 0, 0), geom.NewVector(3, 0, 0), geom.NewVector(3, 0, 3))
+	if contact, ok := CollideTriangles(floor, coplanar); !ok || contact.Point.Y != 0 || !almostEqual(length(contact.Normal), 1) {
+		t.Errorf("Expected overlapping triangles in one plane to collide, got %#v", contact)
+	}
+	if _, ok := CollideTriangles(floor, NewTriangle(geom.NewVector(2, 0, 1), geom.NewVector(4, 0, 1), geom.NewVector(4, 0, 3))); ok {
+		t.Errorf("Expected separate triangles in one plane to not collide")
+	}
+}
+
+func TestCollideTrianglesAtAnyScale(t *testing.T) {
+	// The triangles of TestCollideTriangles, turned so that their
+	// coordinates are rounded and made tiny or huge
+	turn := Compose(RotateX(0.3), RotateY(0.7), RotateZ(1.1))
+	for _, size := range []float64{1e-5, 1e9} {
+		m := turn.Mul(Scale(size, size, size))
+		triangle := func(a, b, c geom.Vector) Triangle {
+			return NewTriangle(m.Point(a), m.Point(b), m.Point(c))
+		}
+		floor := triangle(geom.NewVector(-2, 0, -2), geom.NewVector(2, 0, -2), geom.NewVector(0, 0, 2))
+		up := m.Vector(geom.NewVector(0, 1, 0))
+
+		dipping := triangle(geom.NewVector(-1, 1.5, 0), geom.NewVector(1, 1.5, 0), geom.NewVector(0, -0.5, 0))
+		if contact, ok := CollideTriangles(floor, dipping); !ok || !almostEqual(contact.Depth/size, 0.5) {
+			t.Errorf("Expected triangles of size %v to cross 0.5 deep, got %#v", size, contact)
+		}
+		touching := triangle(geom.NewVector(-1, 1, 0), geom.NewVector(1, 1, 0), geom.NewVector(0, 0, 0))
+		if contact, ok := CollideTriangles(floor, touching); !ok || !almostEqual(contact.Depth/size, 0) {
+			t.Errorf("Expected triangles of size %v to touch, got %#v", size, contact)
+		}
+		above := moveTriangle(touching, scale(up, 1e-4))
+		if _, ok := CollideTriangles(floor, above); ok {
+			t.Errorf("Expected a triangle of size %v slightly above the floor to miss it", size)
+		}
+		coplanar := triangle(geom.NewVector(0, 0, 0), geom.NewVector(3, 0, 0), geom.NewVector(3, 0, 3))
+		if _, ok := CollideTriangles(floor, coplanar); !ok {
+			t.Errorf("Expected overlapping triangles of size %v in one plane to collide", size)
+		}
+	}
+}
+
+// edgesHit reports whether an edge of one triangle passes through the
+// other, which for triangles in general position is when they intersect.
+func edgesHit(a, b Triangle) bool {
+	for _, pair := range [][2]Triangle{{a, b}, {b, a}} {
+		vertices := []geom.Vector{pair[0].a, pair[0].b, pair[0].c}
+		for i := range vertices {
+			edge := geom.NewRay(vertices[i], geom.Sub(vertices[(i+1)%3], vertices[i]))
+			if pair[1].IntersectSegment(edge, 0, 1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func moveTriangle(triangle Triangle, offset geom.Vector) Triangle {
+	return NewTriangle(geom.Add(triangle.a, offset), geom.Add(triangle.b, offset), geom.Add(triangle.c, offset))
+}
+
+func TestCollideTrianglesRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(24))
+	random := func() Triangle {
+		center := randomVector(rng, 1)
+		return NewTriangle(geom.Add(center, randomVector(rng, 1)), geom.Add(center, randomVector(rng, 1)), geom.Add(center, randomVector(rng, 1)))
+	}
+
+	collisions := 0
+	for i := 0; i < 5000; i++ {
+		a, b := random(), random()
+		contact, ok := CollideTriangles(a, b)
+		if ok != edgesHit(a, b) {
+			t.Fatalf("Expected %#v and %#v to collide: %v", a, b, !ok)
+		}
+		if !ok {
+			continue
+		}
+		collisions++
+
+		// The point is on both and moving by the depth separates them
+		for _, triangle := range []Triangle{a, b} {
+			if d := length(geom.Sub(closestPointOnTriangle(contact.Point, triangle), contact.Point)); d > 1e-6 {
+				t.Fatalf("Expected the contact point to be on both triangles, got %v off", d)
+			}
+		}
+		if _, ok := CollideTriangles(a, moveTriangle(b, scale(contact.Normal, contact.Depth+1e-6))); ok {
+			t.Fatalf("Expected moving along the normal by the depth to separate %#v and %#v", a, b)
+		}
+		if contact.Depth > 1e-3 {
+			if _, ok := CollideTriangles(a, moveTriangle(b, scale(contact.Normal, contact.Depth/2))); !ok {
+				t.Fatalf("Expected moving by half the depth to not separate %#v and %#v", a, b)
+			}
+		}
+	}
+	if collisions < 200 {
+		t.Errorf("Expected many of the random triangles to collide, got %d", collisions)
+	}
+}
+
+func TestCollideQuads(t *testing.T) {
+	floor := NewQuad(geom.NewVector(-1, 0, -1), geom.NewVector(1, 0, -1), geom.NewVector(1, 0, 1), geom.NewVector(-1, 0, 1))
+	wall := NewQuad(geom.NewVector(-2, -0.25, 0), geom.NewVector(2, -0.25, 0), geom.NewVector(2, 2, 0), geom.NewVector(-2, 2, 0))
+
+	contact, ok := CollideQuads(floor, wall)
+	if !ok || !almostEqual(contact.Point.Y, 0) || !almostEqual(contact.Point.Z, 0) {
+		t.Fatalf("Expected the wall to cross the floor along the X axis, got %#v", contact)
+	}
+	checkContact(t, "wall", contact, ok, contact.Point, geom.NewVector(0, 1, 0), 0.25)
+
+	if _, ok := CollideQuads(floor, NewQuad(
+		geom.NewVector(-2, 0.1, 0), geom.NewVector(2, 0.1, 0), geom.NewVector(2, 2, 0), geom.NewVector(-2, 2, 0),
+	)); ok {
+		t.Errorf("Expected a wall above the floor to not touch it")
+	}
+
+	// A twisted quad is tested as its two triangles
+	twisted := NewQuad(geom.NewVector(-1, 0.5, 0), geom.NewVector(1, -0.5, 0), geom.NewVector(1, 0.5, 1), geom.NewVector(-1, 0.5, 1))
+	if contact, ok := CollideQuads(floor, twisted); !ok || !almostEqual(contact.Point.Y, 0) {
+		t.Errorf("Expected the twisted quad to dip into the floor, got %#v", contact)
+	}
+}
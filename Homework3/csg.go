@@ -0,0 +1,302 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"sort"
+)
+
+// Span is a stretch of the line of a ray which is inside a solid, from the
+// hit where the line enters it to the hit where it leaves it.
+type Span struct {
+	Enter, Exit Hit
+}
+
+// Solid is a closed primitive which can tell where a ray is inside it.
+type Solid interface {
+	Primitive
+
+	// Spans returns the stretches of the whole line of the ray inside the
+	// solid, ordered along the ray. Parameters may be negative.
+	Spans(ray geom.Ray) []Span
+}
+
+// CSGOperation is a boolean operation combining two solids.
+type CSGOperation int
+
+const (
+	Union CSGOperation = iota
+	Intersection
+	Difference
+)
+
+// CSG is the solid made of two solids by a boolean operation. CSG nodes are
+// solids themselves, so they can be nested.
+type CSG struct {
+	operation   CSGOperation
+	left, right Solid
+	bounds      AABB
+}
+
+// NewCSG returns the solid left <operation> right. For Difference it is the
+// part of left outside right.
+func NewCSG(operation CSGOperation, left, right Solid) *CSG {
+	csg := &CSG{operation: operation, left: left, right: right}
+
+	switch operation {
+	case Union:
+		csg.bounds = left.Bounds().Union(right.Bounds())
+	case Intersection:
+		csg.bounds = left.Bounds().Intersection(right.Bounds())
+	default:
+		csg.bounds = left.Bounds()
+	}
+
+	return csg
+}
+
+func NewUnion(left, right Solid) *CSG {
+	return NewCSG(Union, left, right)
+}
+
+func NewIntersection(left, right Solid) *CSG {
+	return NewCSG(Intersection, left, right)
+}
+
+func NewDifference(left, right Solid) *CSG {
+	return NewCSG(Difference, left, right)
+}
+
+// inside tells whether a point inside or outside of the two operands is
+// inside the result.
+func (operation CSGOperation) inside(left, right bool) bool {
+	switch operation {
+	case Union:
+		return left || right
+	case Intersection:
+		return left && right
+	default:
+		return left && !right
+	}
+}
+
+// csgEvent is a point where the line of a ray enters or leaves an operand.
+type csgEvent struct {
+	hit   Hit
+	right bool
+	enter bool
+}
+
+// Spans combines the spans of the operands by sweeping along the ray and
+// keeping the stretches where the result is inside.
+func (csg *CSG) Spans(ray geom.Ray) []Span {
+	if !csg.bounds.hitSlab(ray.Origin, reciprocal(ray.Direction), math.Inf(-1), math.Inf(1)) {
+		return nil
+	}
+
+	left := csg.left.Spans(ray)
+	if len(left) == 0 && csg.operation != Union {
+		return nil
+	}
+	right := csg.right.Spans(ray)
+
+	events := make([]csgEvent, 0, 2*(len(left)+len(right)))
+	for _, span := range left {
+		events = append(events, csgEvent{hit: span.Enter, enter: true}, csgEvent{hit: span.Exit})
+	}
+	for _, span := range right {
+		events = append(events, csgEvent{hit: span.Enter, right: true, enter: true}, csgEvent{hit: span.Exit, right: true})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].hit.T < events[j].hit.T
+	})
+
+	var spans []Span
+	var current Span
+	inLeft, inRight := false, false
+	for _, event := range events {
+		before := csg.operation.inside(inLeft, inRight)
+		if event.right {
+			inRight = event.enter
+		} else {
+			inLeft = event.enter
+		}
+		after := csg.operation.inside(inLeft, inRight)
+		if before == after {
+			continue
+		}
+
+		// The surface of the subtracted solid faces the other way in the result
+		hit := event.hit
+		if csg.operation == Difference && event.right {
+			hit.Normal = scale(hit.Normal, -1)
+		}
+
+		if after {
+			current.Enter = hit
+		} else {
+			current.Exit = hit
+			spans = append(spans, current)
+		}
+	}
+
+	return spans
+}
+
+func (csg *CSG) Intersect(ray geom.Ray) bool {
+	return csg.IntersectSegment(ray, epsilon, math.Inf(1))
+}
+
+// ClosestHit returns the first point where the ray crosses the surface of
+// the combined solid. The primitive of the hit is the operand whose surface
+// it is on, with its normal pointing out of the combined solid.
+func (csg *CSG) ClosestHit(ray geom.Ray) (Hit, bool) {
+	return csg.ClosestHitSegment(ray, epsilon, math.Inf(1))
+}
+
+func (csg *CSG) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	_, ok := csg.ClosestHitSegment(ray, tMin, tMax)
+	return ok
+}
+
+func (csg *CSG) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	for _, span := range csg.Spans(ray) {
+		for _, hit := range [2]Hit{span.Enter, span.Exit} {
+			if hit.T > tMax {
+				return Hit{}, false
+			}
+			if hit.T >= tMin {
+				return hit, true
+			}
+		}
+	}
+	return Hit{}, false
+}
+
+func (csg *CSG) Bounds() AABB {
+	return csg.bounds
+}
+
+// Spans returns the single stretch of the line inside the sphere.
+func (sphere Sphere) Spans(ray geom.Ray) []Span {
+	crossing, ok := sphere.Crossing(ray)
+	if !ok {
+		return nil
+	}
+	return []Span{{Enter: sphere.hitAt(ray, crossing.Entry), Exit: sphere.hitAt(ray, crossing.Exit)}}
+}
+
+func (box Box) Spans(ray geom.Ray) []Span {
+	found := box.candidates(ray)
+	return convexSpans(found, func(c candidate) Hit {
+		hit := box.hitAt(ray, c)
+		hit.Primitive = box
+		return hit
+	})
+}
+
+func (box OrientedBox) Spans(ray geom.Ray) []Span {
+	local := box.frame.localRay(ray)
+	found := box.box.candidates(local)
+	return convexSpans(found, func(c candidate) Hit {
+		return box.hitAt(ray, local, c)
+	})
+}
+
+// Spans returns the stretch of the line inside the cylinder. An open
+// cylinder encloses the same solid as a closed one, so the stretch may start
+// or end at a missing cap.
+func (cylinder Cylinder) Spans(ray geom.Ray) []Span {
+	cylinder.capped = true
+	local := cylinder.frame.localRay(ray)
+	found := cylinder.candidates(local)
+	return convexSpans(found, func(c candidate) Hit {
+		return cylinder.hitAt(ray, local, c)
+	})
+}
+
+// Spans returns the stretch of the line inside the cone. As for cylinders an
+// open cone encloses the same solid as a closed one.
+func (cone Cone) Spans(ray geom.Ray) []Span {
+	cone.capped = true
+	local := cone.frame.localRay(ray)
+	found := cone.candidates(local)
+	return convexSpans(found, func(c candidate) Hit {
+		return cone.hitAt(ray, local, c)
+	})
+}
+
+// torusGrazing is the cosine between the ray and the surface of a torus
+// below which a crossing is taken to be a tangent point. Those are found
+// once, twice or not at all, and do not lead in or out of the torus.
+const torusGrazing = 1e-3
+
+// Spans returns the stretches of the line inside the torus, of which there
+// are up to two. Whether a crossing enters or leaves the torus is told by
+// its normal rather than by pairing them in order.
+func (torus Torus) Spans(ray geom.Ray) []Span {
+	local := torus.frame.localRay(ray)
+	found := torus.candidates(local)
+	direction := normalize(ray.Direction)
+
+	var spans []Span
+	inside := false
+	for _, c := range found.items[:found.n] {
+		hit := torus.hitAt(ray, local, c)
+		cosine := geom.Dot(hit.Normal, direction)
+		switch {
+		case math.Abs(cosine) < torusGrazing:
+			continue
+		case cosine < 0 && !inside:
+			spans = append(spans, Span{Enter: hit})
+			inside = true
+		case cosine > 0 && inside:
+			spans[len(spans)-1].Exit = hit
+			inside = false
+		}
+	}
+
+	// An entry which is never left was a tangent point after all
+	if inside {
+		spans = spans[:len(spans)-1]
+	}
+	return spans
+}
+
+// Spans returns the spans of the transformed primitive in world space,
+// where the parameters are the same. Only instances of solids have an
+// inside, others have no spans.
+func (instance *Instance) Spans(ray geom.Ray) []Span {
+	solid, ok := instance.primitive.(Solid)
+	if !ok {
+		return nil
+	}
+
+	spans := solid.Spans(instance.objectRay(ray))
+	for i := range spans {
+		spans[i].Enter, _ = instance.worldHit(ray, spans[i].Enter, true)
+		spans[i].Exit, _ = instance.worldHit(ray, spans[i].Exit, true)
+	}
+	return spans
+}
+
+// convexSpans returns the stretch between the first and the last crossing of
+// a line with a convex solid. Crossings where two parts of the surface meet
+// may be found twice, so they are not simply paired.
+func convexSpans(found candidates, hitAt func(candidate) Hit) []Span {
+	if found.n == 0 {
+		return nil
+	}
+
+	first, last := found.items[0], found.items[0]
+	for _, item := range found.items[1:found.n] {
+		if item.t < first.t {
+			first = item
+		}
+		if item.t > last.t {
+			last = item
+		}
+	}
+
+	return []Span{{Enter: hitAt(first), Exit: hitAt(last)}}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSampleSphereMinusBoxShouldIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	sphere := NewSphere(geom.NewVector(0, 0, 0), 2)
+	box := NewBox(geom.NewVector(-3, -3, 0), geom.NewVector(3, 3, 3))
+	prim = NewDifference(sphere, box)
+	ray := geom.NewRay(geom.NewVector(0, 0, -5), geom.NewVector(0, 0, 1))
+
+	if !prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect %#v but it did not.", ray, prim)
+	}
+}
+
+func TestSampleRayThroughRemovedPartShouldNotIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	// The upper half of the sphere is cut away
+	sphere := NewSphere(geom.NewVector(0, 0, 0), 2)
+	box := NewBox(geom.NewVector(-3, -3, 0.5), geom.NewVector(3, 3, 3))
+	prim = NewDifference(sphere, box)
+	ray := geom.NewRay(geom.NewVector(-5, 0, 1), geom.NewVector(1, 0, 0))
+
+	if prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to not intersect %#v but it did.", ray, prim)
+	}
+}
+
+func TestCSGDifferenceClosestHit(t *testing.T) {
+	sphere := NewSphere(geom.NewVector(0, 0, 0), 2)
+	box := NewBox(geom.NewVector(-3, -3, 0), geom.NewVector(3, 3, 3))
+	prim := NewDifference(sphere, box)
+
+	// From above the ray passes the cut away half and hits the flat cut
+	ray := geom.NewRay(geom.NewVector(0.5, 0.5, 5), geom.NewVector(0, 0, -1))
+	hit, ok := prim.ClosestHit(ray)
+	if !ok {
+		t.Fatalf("Expected ray %#v to hit %#v but it did not.", ray, prim)
+	}
+	if !almostEqual(hit.T, 5) || !vectorsAlmostEqual(hit.Normal, geom.NewVector(0, 0, 1)) {
+		t.Errorf("Expected the cut at 5 facing up, got %#v", hit)
+	}
+	if hit.Primitive != box {
+		t.Errorf("Expected the cut to be on the box, got %#v", hit.Primitive)
+	}
+
+	spans := prim.Spans(ray)
+	if len(spans) != 1 || !almostEqual(spans[0].Enter.T, 5) || !almostEqual(spans[0].Exit.T, 5+math.Sqrt(3.5)) {
+		t.Errorf("Expected a single span from 5 to %v, got %#v", 5+math.Sqrt(3.5), spans)
+	}
+}
+
+func TestCSGSpans(t *testing.T) {
+	a := NewSphere(geom.NewVector(-1, 0, 0), 2)
+	b := NewSphere(geom.NewVector(1, 0, 0), 2)
+	ray := geom.NewRay(geom.NewVector(-10, 0, 0), geom.NewVector(1, 0, 0))
+
+	cases := []struct {
+		name     string
+		csg      *CSG
+		expected [][2]float64
+	}{
+		{"union", NewUnion(a, b), [][2]float64{{7, 13}}},
+		{"intersection", NewIntersection(a, b), [][2]float64{{9, 11}}},
+		{"difference", NewDifference(a, b), [][2]float64{{7, 9}}},
+		{"reversed difference", NewDifference(b, a), [][2]float64{{11, 13}}},
+		{"hollow", NewDifference(NewSphere(geom.NewVector(0, 0, 0), 3), NewSphere(geom.NewVector(0, 0, 0), 1)), [][2]float64{{7, 9}, {11, 13}}},
+		{"nested", NewDifference(NewUnion(a, b), NewBox(geom.NewVector(-0.5, -5, -5), geom.NewVector(0.5, 5, 5))), [][2]float64{{7, 9.5}, {10.5, 13}}},
+	}
+
+	for _, c := range cases {
+		spans := c.csg.Spans(ray)
+		if len(spans) != len(c.expected) {
+			t.Errorf("%s: expected %d spans, got %#v", c.name, len(c.expected), spans)
+			continue
+		}
+		for i, span := range spans {
+			if !almostEqual(span.Enter.T, c.expected[i][0]) || !almostEqual(span.Exit.T, c.expected[i][1]) {
+				t.Errorf("%s: expected span %v, got %v - %v", c.name, c.expected[i], span.Enter.T, span.Exit.T)
+			}
+			if geom.Dot(span.Enter.Normal, ray.Direction) > 0 || geom.Dot(span.Exit.Normal, ray.Direction) < 0 {
+				t.Errorf("%s: expected normals pointing out of the solid, got %#v", c.name, span)
+			}
+		}
+	}
+}
+
+func TestCSGFromInside(t *testing.T) {
+	prim := NewIntersection(NewSphere(geom.NewVector(0, 0, 0), 2), NewBox(geom.NewVector(-1, -1, -1), geom.NewVector(1, 1, 1)))
+	ray := geom.NewRay(geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0))
+
+	hit, ok := prim.ClosestHit(ray)
+	if !ok || !almostEqual(hit.T, 1) || !vectorsAlmostEqual(hit.Normal, geom.NewVector(1, 0, 0)) {
+		t.Errorf("Expected the box face at 1, got %#v", hit)
+	}
+	if prim.IntersectSegment(ray, 0, 0.5) {
+		t.Errorf("Expected nothing before 0.5")
+	}
+	if bounds := prim.Bounds(); !vectorsAlmostEqual(bounds.Max, geom.NewVector(1, 1, 1)) {
+		t.Errorf("Expected the bounds of the intersection to be those of the box, got %#v", bounds)
+	}
+}
+
+func TestCSGOfShapes(t *testing.T) {
+	// A tube made of a cylinder with a thinner one drilled out
+	tube := NewDifference(
+		NewCylinder(geom.NewVector(0, -1, 0), geom.NewVector(0, 1, 0), 2),
+		NewOpenCylinder(geom.NewVector(0, -2, 0), geom.NewVector(0, 2, 0), 1),
+	)
+	down := geom.NewRay(geom.NewVector(0, 5, 0), geom.NewVector(0, -1, 0))
+	if tube.Intersect(down) {
+		t.Errorf("Expected a ray down the bore to pass through the tube")
+	}
+
+	across := geom.NewRay(geom.NewVector(-5, 0, 0), geom.NewVector(1, 0, 0))
+	if spans := tube.Spans(across); len(spans) != 2 {
+		t.Errorf("Expected two walls across the tube, got %#v", spans)
+	}
+
+	ring := NewIntersection(
+		NewTorus(geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0), 2, 0.5),
+		NewBox(geom.NewVector(0, -1, -3), geom.NewVector(3, 1, 3)),
+	)
+	if spans := ring.Spans(across); len(spans) != 1 || !almostEqual(spans[0].Enter.T, 6.5) || !almostEqual(spans[0].Exit.T, 7.5) {
+		t.Errorf("Expected half a torus to be crossed once from 6.5 to 7.5, got %#v", spans)
+	}
+}
+
+// checkTorusSpans checks that the spans of a line with the torus of major
+// radius 2 and minor 0.5 around the Y axis are ordered and cover only its
+// inside.
+func checkTorusSpans(t *testing.T, ray geom.Ray, spans []Span) {
+	t.Helper()
+	inside := func(tm float64) float64 {
+		p := pointAt(ray, tm)
+		ring := math.Hypot(p.X, p.Z) - 2
+		return ring*ring + p.Y*p.Y - 0.25
+	}
+
+	for i, span := range spans {
+		if span.Exit.T < span.Enter.T || (i > 0 && span.Enter.T < spans[i-1].Exit.T) {
+			t.Fatalf("Expected ordered spans along %#v, got %#v", ray, spans)
+		}
+		if inside((span.Enter.T+span.Exit.T)/2) > 1e-6 {
+			t.Fatalf("Expected the span from %v to %v along %#v to be inside the torus", span.Enter.T, span.Exit.T, ray)
+		}
+	}
+}
+
+func TestTorusSpansTangent(t *testing.T) {
+	torus := NewTorus(geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0), 2, 0.5)
+
+	// Along the top of the tube and past its outer edge
+	for _, ray := range []geom.Ray{
+		geom.NewRay(geom.NewVector(-5, 0.5, 0), geom.NewVector(1, 0, 0)),
+		geom.NewRay(geom.NewVector(-5, 0, 2.5), geom.NewVector(1, 0, 0)),
+	} {
+		spans := torus.Spans(ray)
+		checkTorusSpans(t, ray, spans)
+		for _, span := range spans {
+			if span.Exit.T-span.Enter.T > 1e-3 {
+				t.Errorf("Expected a ray grazing the torus to only touch it, got %#v", spans)
+			}
+		}
+	}
+
+	// Inside the tube, touching its inner edge halfway
+	ray := geom.NewRay(geom.NewVector(-5, 0, 1.5), geom.NewVector(1, 0, 0))
+	spans := torus.Spans(ray)
+	checkTorusSpans(t, ray, spans)
+	if len(spans) == 0 || !almostEqual(spans[0].Enter.T, 3) || !almostEqual(spans[len(spans)-1].Exit.T, 7) {
+		t.Errorf("Expected the tube to be crossed from 3 to 7, got %#v", spans)
+	}
+
+	// Rays tangent to random points of the surface
+	rng := rand.New(rand.NewSource(15))
+	for i := 0; i < 1000; i++ {
+		u, v := 2*math.Pi*rng.Float64(), 2*math.Pi*rng.Float64()
+		point := geom.NewVector((2+0.5*math.Cos(v))*math.Cos(u), 0.5*math.Sin(v), (2+0.5*math.Cos(v))*math.Sin(u))
+		normal := geom.NewVector(math.Cos(v)*math.Cos(u), math.Sin(v), math.Cos(v)*math.Sin(u))
+		tangent := normalize(geom.Cross(normal, randomVector(rng, 1)))
+
+		ray := geom.NewRay(geom.Sub(point, scale(tangent, 4)), tangent)
+		checkTorusSpans(t, ray, torus.Spans(ray))
+	}
+}
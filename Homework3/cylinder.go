@@ -0,0 +1,236 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+// The parts of the surface of cylinders and cones.
+const (
+	sidePart = iota
+	basePart
+	topPart
+)
+
+// Cylinder is a circular cylinder between two points. Open cylinders are
+// tubes without caps.
+type Cylinder struct {
+	frame  frame
+	height float64
+	r      float64
+	capped bool
+}
+
+// Cone is a circular cone with its base around one point and its apex at
+// another. Open cones have no base.
+type Cone struct {
+	frame  frame
+	height float64
+	r      float64
+	capped bool
+}
+
+// NewCylinder returns the closed cylinder of radius r around the segment
+// from base to top.
+func NewCylinder(base, top geom.Vector, r float64) Cylinder {
+	return Cylinder{
+		frame:  newFrame(base, geom.Sub(top, base)),
+		height: length(geom.Sub(top, base)),
+		r:      math.Abs(r),
+		capped: true,
+	}
+}
+
+// NewOpenCylinder returns a cylinder like NewCylinder but without its caps.
+func NewOpenCylinder(base, top geom.Vector, r float64) Cylinder {
+	cylinder := NewCylinder(base, top, r)
+	cylinder.capped = false
+	return cylinder
+}
+
+// NewCone returns the closed cone whose base of radius r is centered at base.
+func NewCone(base, apex geom.Vector, r float64) Cone {
+	return Cone{
+		frame:  newFrame(base, geom.Sub(apex, base)),
+		height: length(geom.Sub(apex, base)),
+		r:      math.Abs(r),
+		capped: true,
+	}
+}
+
+// NewOpenCone returns a cone like NewCone but without its base.
+func NewOpenCone(base, apex geom.Vector, r float64) Cone {
+	cone := NewCone(base, apex, r)
+	cone.capped = false
+	return cone
+}
+
+func (cylinder Cylinder) Intersect(ray geom.Ray) bool {
+	return cylinder.IntersectSegment(ray, epsilon, math.Inf(1))
+}
+
+// ClosestHit returns the hit with the surface of the cylinder. On the side U
+// is the angle around the axis mapped to [0, 1) and V the height relative to
+// the length of the cylinder. On the caps U is the angle too and V is the
+// distance from the axis relative to the radius.
+func (cylinder Cylinder) ClosestHit(ray geom.Ray) (Hit, bool) {
+	return cylinder.ClosestHitSegment(ray, epsilon, math.Inf(1))
+}
+
+func (cylinder Cylinder) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	found := cylinder.candidates(cylinder.frame.localRay(ray))
+	_, ok := found.nearest(tMin, tMax)
+	return ok
+}
+
+func (cylinder Cylinder) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	local := cylinder.frame.localRay(ray)
+	found := cylinder.candidates(local)
+	nearest, ok := found.nearest(tMin, tMax)
+	if !ok {
+		return Hit{}, false
+	}
+	return cylinder.hitAt(ray, local, nearest), true
+}
+
+// hitAt returns the hit for a crossing found in the frame of the cylinder.
+func (cylinder Cylinder) hitAt(ray, local geom.Ray, c candidate) Hit {
+	p := pointAt(local, c.t)
+	var normal geom.Vector
+	if c.part == sidePart {
+		normal = normalize(geom.NewVector(p.X, p.Y, 0))
+	}
+	hit := capOrSideHit(cylinder.frame, ray, c, p, normal, cylinder.height, cylinder.r)
+	hit.Primitive = cylinder
+	return hit
+}
+
+// candidates finds the crossings of a ray, given in the frame of the
+// cylinder, with its side and caps.
+func (cylinder Cylinder) candidates(local geom.Ray) candidates {
+	var found candidates
+	o, d := local.Origin, local.Direction
+
+	// The side is x^2 + y^2 = r^2 between the caps
+	for _, t := range quadraticRoots(d.X*d.X+d.Y*d.Y, 2*(o.X*d.X+o.Y*d.Y), o.X*o.X+o.Y*o.Y-cylinder.r*cylinder.r) {
+		if z := o.Z + t*d.Z; z >= 0 && z <= cylinder.height {
+			found.add(t, sidePart)
+		}
+	}
+
+	if cylinder.capped {
+		addCapCandidate(&found, local, 0, cylinder.r, basePart)
+		addCapCandidate(&found, local, cylinder.height, cylinder.r, topPart)
+	}
+
+	return found
+}
+
+func (cylinder Cylinder) Bounds() AABB {
+	f := cylinder.frame
+	return diskBounds(f.origin, f.w, cylinder.r).Union(
+		diskBounds(geom.Add(f.origin, scale(f.w, cylinder.height)), f.w, cylinder.r))
+}
+
+func (cone Cone) Intersect(ray geom.Ray) bool {
+	return cone.IntersectSegment(ray, epsilon, math.Inf(1))
+}
+
+// ClosestHit returns the hit with the surface of the cone. U and V are as
+// for Cylinder, with V on the side going from 0 at the base to 1 at the apex.
+func (cone Cone) ClosestHit(ray geom.Ray) (Hit, bool) {
+	return cone.ClosestHitSegment(ray, epsilon, math.Inf(1))
+}
+
+func (cone Cone) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	found := cone.candidates(cone.frame.localRay(ray))
+	_, ok := found.nearest(tMin, tMax)
+	return ok
+}
+
+func (cone Cone) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	local := cone.frame.localRay(ray)
+	found := cone.candidates(local)
+	nearest, ok := found.nearest(tMin, tMax)
+	if !ok {
+		return Hit{}, false
+	}
+	return cone.hitAt(ray, local, nearest), true
+}
+
+// hitAt returns the hit for a crossing found in the frame of the cone.
+func (cone Cone) hitAt(ray, local geom.Ray, c candidate) Hit {
+	p := pointAt(local, c.t)
+	var normal geom.Vector
+	if c.part == sidePart {
+		// The gradient of x^2 + y^2 - k^2*(h - z)^2, which vanishes at the apex
+		k := cone.r / cone.height
+		normal = normalize(geom.NewVector(p.X, p.Y, k*k*(cone.height-p.Z)))
+		if normal == (geom.Vector{}) {
+			normal = geom.NewVector(0, 0, 1)
+		}
+	}
+	hit := capOrSideHit(cone.frame, ray, c, p, normal, cone.height, cone.r)
+	hit.Primitive = cone
+	return hit
+}
+
+// candidates finds the crossings of a ray, given in the frame of the cone,
+// with its side and base.
+func (cone Cone) candidates(local geom.Ray) candidates {
+	var found candidates
+	if cone.height == 0 {
+		return found
+	}
+	o, d := local.Origin, local.Direction
+
+	// The side is x^2 + y^2 = k^2*(h - z)^2 between the base and the apex
+	k2 := (cone.r / cone.height) * (cone.r / cone.height)
+	w := cone.height - o.Z
+	a := d.X*d.X + d.Y*d.Y - k2*d.Z*d.Z
+	b := 2 * (o.X*d.X + o.Y*d.Y + k2*w*d.Z)
+	c := o.X*o.X + o.Y*o.Y - k2*w*w
+	for _, t := range quadraticRoots(a, b, c) {
+		if z := o.Z + t*d.Z; z >= 0 && z <= cone.height {
+			found.add(t, sidePart)
+		}
+	}
+
+	if cone.capped {
+		addCapCandidate(&found, local, 0, cone.r, basePart)
+	}
+
+	return found
+}
+
+func (cone Cone) Bounds() AABB {
+	f := cone.frame
+	return diskBounds(f.origin, f.w, cone.r).Union(boundsOfPoints(geom.Add(f.origin, scale(f.w, cone.height))))
+}
+
+// capOrSideHit returns the hit with a cylinder or a cone. p is the point of
+// the hit in the frame of the shape and normal, in the same frame, is only
+// used on the side.
+func capOrSideHit(f frame, ray geom.Ray, c candidate, p, normal geom.Vector, height, r float64) Hit {
+	hit := Hit{
+		T:     c.t,
+		Point: pointAt(ray, c.t),
+		U:     angle(p.X, p.Y),
+	}
+
+	switch c.part {
+	case sidePart:
+		hit.Normal = f.worldVector(normal)
+		if height != 0 {
+			hit.V = p.Z / height
+		}
+	case basePart:
+		hit.Normal = scale(f.w, -1)
+		hit.V = math.Hypot(p.X, p.Y) / r
+	case topPart:
+		hit.Normal = f.w
+		hit.V = math.Hypot(p.X, p.Y) / r
+	}
+
+	return hit
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"testing"
+)
+
+func TestSampleSimpleCylinderShouldIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	prim = NewCylinder(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1)
+	ray := geom.NewRay(geom.NewVector(-5, 1, 0), geom.NewVector(1, 0, 0))
+
+	if !prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect cylinder %#v but it did not.", ray, prim)
+	}
+}
+
+func TestSampleRayThroughOpenCylinderShouldNotIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	prim = NewOpenCylinder(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1)
+	ray := geom.NewRay(geom.NewVector(0.5, 5, 0), geom.NewVector(0, -1, 0))
+
+	if prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to not intersect cylinder %#v but it did.", ray, prim)
+	}
+}
+
+func TestCylinderClosestHit(t *testing.T) {
+	capped := NewCylinder(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1)
+	open := NewOpenCylinder(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1)
+
+	side := geom.NewRay(geom.NewVector(-5, 0.5, 0), geom.NewVector(1, 0, 0))
+	for _, prim := range []Cylinder{capped, open} {
+		hit, ok := prim.ClosestHit(side)
+		if !ok || !almostEqual(hit.T, 4) || !vectorsAlmostEqual(hit.Normal, geom.NewVector(-1, 0, 0)) {
+			t.Errorf("Expected the side at 4 with normal (-1, 0, 0), got %#v", hit)
+		}
+		if !almostEqual(hit.V, 0.25) {
+			t.Errorf("Expected the hit a quarter up the side, got %v", hit.V)
+		}
+	}
+
+	top := geom.NewRay(geom.NewVector(0.5, 5, 0), geom.NewVector(0, -1, 0))
+	hit, ok := capped.ClosestHit(top)
+	if !ok || !almostEqual(hit.T, 3) || !vectorsAlmostEqual(hit.Normal, geom.NewVector(0, 1, 0)) {
+		t.Errorf("Expected the top cap at 3 with normal (0, 1, 0), got %#v", hit)
+	}
+
+	// From inside the open tube the far wall is hit
+	inside := geom.NewRay(geom.NewVector(0, 1, 0), geom.NewVector(0, 0, 1))
+	hit, ok = open.ClosestHit(inside)
+	if !ok || !almostEqual(hit.T, 1) || !vectorsAlmostEqual(hit.Normal, geom.NewVector(0, 0, 1)) {
+		t.Errorf("Expected the wall at 1 with normal (0, 0, 1), got %#v", hit)
+	}
+
+	bounds := capped.Bounds()
+	if !vectorsAlmostEqual(bounds.Min, geom.NewVector(-1, 0, -1)) || !vectorsAlmostEqual(bounds.Max, geom.NewVector(1, 2, 1)) {
+		t.Errorf("Expected the box (-1, 0, -1) - (1, 2, 1), got %#v", bounds)
+	}
+}
+
+func TestSampleSimpleConeShouldIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	prim = NewCone(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1)
+	ray := geom.NewRay(geom.NewVector(-5, 1, 0), geom.NewVector(1, 0, 0))
+
+	if !prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect cone %#v but it did not.", ray, prim)
+	}
+}
+
+func TestSampleRayAboveConeShouldNotIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	prim = NewCone(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1)
+	ray := geom.NewRay(geom.NewVector(-5, 1.5, 0.3), geom.NewVector(1, 0, 0))
+
+	if prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to not intersect cone %#v but it did.", ray, prim)
+	}
+}
+
+func TestConeClosestHit(t *testing.T) {
+	capped := NewCone(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1)
+	open := NewOpenCone(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1)
+
+	// At half the height the radius is 0.5
+	side := geom.NewRay(geom.NewVector(-5, 1, 0), geom.NewVector(1, 0, 0))
+	hit, ok := capped.ClosestHit(side)
+	if !ok || !almostEqual(hit.T, 4.5) {
+		t.Fatalf("Expected the side at 4.5, got %#v", hit)
+	}
+	expected := normalize(geom.NewVector(-2, 1, 0))
+	if !vectorsAlmostEqual(hit.Normal, expected) {
+		t.Errorf("Expected normal %#v, got %#v", expected, hit.Normal)
+	}
+
+	below := geom.NewRay(geom.NewVector(0.5, -3, 0), geom.NewVector(0, 1, 0))
+	hit, ok = capped.ClosestHit(below)
+	if !ok || !almostEqual(hit.T, 3) || !vectorsAlmostEqual(hit.Normal, geom.NewVector(0, -1, 0)) {
+		t.Errorf("Expected the base at 3 with normal (0, -1, 0), got %#v", hit)
+	}
+	hit, ok = open.ClosestHit(below)
+	if !ok || !almostEqual(hit.T, 4) {
+		t.Errorf("Expected the inside of the open cone at 4, got %#v", hit)
+	}
+
+	bounds := capped.Bounds()
+	if !vectorsAlmostEqual(bounds.Min, geom.NewVector(-1, 0, -1)) || !vectorsAlmostEqual(bounds.Max, geom.NewVector(1, 2, 1)) {
+		t.Errorf("Expected the box (-1, 0, -1) - (1, 2, 1), got %#v", bounds)
+	}
+
+	tilted := NewCone(geom.NewVector(1, 1, 1), geom.NewVector(3, 1, 1), math.Sqrt2)
+	if !tilted.Intersect(geom.NewRay(geom.NewVector(1.5, 1, 5), geom.NewVector(0, 0, -1))) {
+		t.Errorf("Expected a cone along X to be hit")
+	}
+}
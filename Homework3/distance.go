@@ -0,0 +1,814 @@
+package main
+
+import (
+	"fmt"
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"sort"
+)
+
+// patchIterations bounds the Newton steps looking for the point of a
+// non-planar quad nearest to a point.
+const patchIterations = 16
+
+// ClosestPointer is a primitive which can find the point of its surface
+// nearest to any point.
+type ClosestPointer interface {
+	Primitive
+	ClosestPoint(point geom.Vector) geom.Vector
+}
+
+// Nearest is the part of a scene nearest to a point.
+type Nearest struct {
+	// Object is the index of the object in the scene.
+	Object int
+
+	// Primitive is the innermost primitive which is nearest, like a
+	// triangle of a mesh in a group. Instances on the way are looked
+	// through, so it may be in the space of an instance.
+	Primitive Primitive
+
+	// Point is the point of the primitive nearest to the point searched
+	// from and Distance is how far it is.
+	Point    geom.Vector
+	Distance float64
+}
+
+// Nearest returns the part of the scene nearest to point, searching only
+// closer than maxDistance, which may be infinite. Objects are tried in the
+// order of the distance to their bounds and are skipped once their bounds
+// are further than the nearest part found so far.
+//
+// Instances are searched through whatever their transform, but the nearest
+// point of a disk, a cylinder, a cone or a torus which is scaled more in some
+// directions than in others cannot be found, nor can those of CSG shapes
+// whose operands are nearest where they are hidden. When such a part may be
+// nearer than the one found, a *NearestError is returned instead.
+func (scene *Scene) Nearest(point geom.Vector, maxDistance float64) (Nearest, bool, error) {
+	search := newNearestSearch(point, maxDistance)
+	found, unmeasuredObject := false, -1
+	for _, candidate := range search.byBounds(objectPrimitives(scene.Objects)) {
+		if candidate.distance >= search.best.Distance {
+			break
+		}
+		unmeasured := search.unmeasuredDistance
+		if search.visit(scene.Objects[candidate.index].Primitive) {
+			search.best.Object = candidate.index
+			found = true
+		}
+		if search.unmeasuredDistance < unmeasured {
+			unmeasuredObject = candidate.index
+		}
+	}
+
+	if search.unmeasuredDistance < search.best.Distance {
+		return Nearest{}, false, &NearestError{
+			Object:    unmeasuredObject,
+			Primitive: search.unmeasured,
+			Distance:  search.unmeasuredDistance,
+		}
+	}
+	return search.best, found, nil
+}
+
+// NearestError tells that a part of an object whose distance cannot be
+// found may be nearer than what Scene.Nearest found.
+type NearestError struct {
+	Object    int
+	Primitive Primitive
+
+	// Distance is how near the primitive may be.
+	Distance float64
+}
+
+func (err *NearestError) Error() string {
+	return fmt.Sprintf("cannot find the distance to %T in object %d, which may be %v away", err.Primitive, err.Object, err.Distance)
+}
+
+func objectPrimitives(objects []Object) []Primitive {
+	primitives := make([]Primitive, len(objects))
+	for i, object := range objects {
+		primitives[i] = object.Primitive
+	}
+	return primitives
+}
+
+// Distance returns the distance from the point to the box, which is zero
+// inside it.
+func (box AABB) Distance(point geom.Vector) float64 {
+	if box.Empty() {
+		return math.Inf(1)
+	}
+	return length(geom.Sub(maxVector(box.Min, minVector(box.Max, point)), point))
+}
+
+// ClosestPoint returns the point of the triangle nearest to point.
+func (triangle Triangle) ClosestPoint(point geom.Vector) geom.Vector {
+	return closestPointOnTriangle(point, triangle)
+}
+
+// Distance returns the distance from the point to the triangle.
+func (triangle Triangle) Distance(point geom.Vector) float64 {
+	return length(geom.Sub(triangle.ClosestPoint(point), point))
+}
+
+// ClosestPoint returns the point of the quad nearest to point. Non-planar
+// quads are the bilinear patch they are intersected as, on which the point
+// is found with Newton's method and compared with the nearest points of the
+// edges.
+func (quad Quad) ClosestPoint(point geom.Vector) geom.Vector {
+	if quad.planar {
+		return nearerTo(point, quad.triangles[0].ClosestPoint(point), quad.triangles[1].ClosestPoint(point))
+	}
+
+	u, v := quad.patchFoot(point)
+	best := quad.patchPoint(u, v)
+	vertices := quad.vertices()
+	for i := range vertices {
+		best = nearerTo(point, best, closestPointOnSegment(point, vertices[i], vertices[(i+1)%4]))
+	}
+	return best
+}
+
+// Distance returns the distance from the point to the quad.
+func (quad Quad) Distance(point geom.Vector) float64 {
+	return length(geom.Sub(quad.ClosestPoint(point), point))
+}
+
+// patchPoint returns the point P(u, v) of the bilinear patch of the quad.
+func (quad Quad) patchPoint(u, v float64) geom.Vector {
+	return lerp(lerp(quad.a, quad.b, u), lerp(quad.d, quad.c, u), v)
+}
+
+// patchFoot returns the patch coordinates of a point of the patch where it
+// is perpendicular to the direction to point, starting from the nearest of
+// a few samples. Newton's method may leave the patch, in which case the
+// coordinates are clamped and the edges have to be checked too.
+func (quad Quad) patchFoot(point geom.Vector) (float64, float64) {
+	const samples = 4
+	u, v, nearest := 0.0, 0.0, math.Inf(1)
+	for i := 0; i <= samples; i++ {
+		for j := 0; j <= samples; j++ {
+			su, sv := float64(i)/samples, float64(j)/samples
+			if d := length(geom.Sub(quad.patchPoint(su, sv), point)); d < nearest {
+				u, v, nearest = su, sv, d
+			}
+		}
+	}
+
+	// With q the twist of the patch, Pu = b - a + vq, Pv = d - a + uq and
+	// Puv = q, while Puu and Pvv are zero
+	q := geom.Add(geom.Sub(quad.a, quad.b), geom.Sub(quad.c, quad.d))
+	for i := 0; i < patchIterations; i++ {
+		r := geom.Sub(quad.patchPoint(u, v), point)
+		pu := geom.Add(geom.Sub(quad.b, quad.a), scale(q, v))
+		pv := geom.Add(geom.Sub(quad.d, quad.a), scale(q, u))
+
+		gu, gv := geom.Dot(pu, r), geom.Dot(pv, r)
+		huu, hvv, huv := geom.Dot(pu, pu), geom.Dot(pv, pv), geom.Dot(pu, pv)
+
+		// Newton's method where the distance is locally convex and
+		// Gauss-Newton elsewhere
+		if newton := huv + geom.Dot(q, r); huu*hvv-newton*newton > 0 {
+			huv = newton
+		}
+		det := huu*hvv - huv*huv
+		if det <= 0 {
+			break
+		}
+
+		du, dv := (hvv*gu-huv*gv)/det, (huu*gv-huv*gu)/det
+		u, v = clamp01(u-du), clamp01(v-dv)
+		if math.Abs(du)+math.Abs(dv) < 1e-12 {
+			break
+		}
+	}
+	return u, v
+}
+
+func clamp01(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
+}
+
+// ClosestPoint returns the point of the sphere nearest to point. The center
+// is as near to every point of the sphere and gets its top.
+func (sphere Sphere) ClosestPoint(point geom.Vector) geom.Vector {
+	d := geom.Sub(point, sphere.origin)
+	distance := length(d)
+	if distance == 0 {
+		return geom.Add(sphere.origin, geom.NewVector(0, 0, sphere.r))
+	}
+	return geom.Add(sphere.origin, scale(d, sphere.r/distance))
+}
+
+// Distance returns the distance from the point to the surface of the
+// sphere.
+func (sphere Sphere) Distance(point geom.Vector) float64 {
+	return math.Abs(sphere.SignedDistance(point))
+}
+
+// SignedDistance is like Distance, but negative inside the sphere.
+func (sphere Sphere) SignedDistance(point geom.Vector) float64 {
+	return length(geom.Sub(point, sphere.origin)) - sphere.r
+}
+
+// ClosestPoint returns the point of the surface of the box nearest to
+// point. Points inside are moved to the nearest face.
+func (box Box) ClosestPoint(point geom.Vector) geom.Vector {
+	closest := maxVector(box.min, minVector(box.max, point))
+	if closest != point {
+		return closest
+	}
+
+	axis, face, nearest := 0, 0.0, math.Inf(1)
+	for i := 0; i < 3; i++ {
+		lo, hi, p := component(box.min, i), component(box.max, i), component(point, i)
+		if p-lo < nearest {
+			axis, face, nearest = i, lo, p-lo
+		}
+		if hi-p < nearest {
+			axis, face, nearest = i, hi, hi-p
+		}
+	}
+	switch axis {
+	case 0:
+		closest.X = face
+	case 1:
+		closest.Y = face
+	default:
+		closest.Z = face
+	}
+	return closest
+}
+
+// Distance returns the distance from the point to the surface of the box.
+func (box Box) Distance(point geom.Vector) float64 {
+	return math.Abs(box.SignedDistance(point))
+}
+
+// SignedDistance is like Distance, but negative inside the box.
+func (box Box) SignedDistance(point geom.Vector) float64 {
+	outside := length(geom.Sub(maxVector(box.min, minVector(box.max, point)), point))
+	if outside > 0 {
+		return outside
+	}
+
+	inside := math.Inf(1)
+	for i := 0; i < 3; i++ {
+		p := component(point, i)
+		inside = math.Min(inside, math.Min(p-component(box.min, i), component(box.max, i)-p))
+	}
+	return -inside
+}
+
+// ClosestPoint returns the point of the surface of the box nearest to
+// point, found in the frame of the box.
+func (box OrientedBox) ClosestPoint(point geom.Vector) geom.Vector {
+	local := box.box.ClosestPoint(box.frame.localVector(geom.Sub(point, box.frame.origin)))
+	return geom.Add(box.frame.origin, box.frame.worldVector(local))
+}
+
+// Distance returns the distance from the point to the surface of the box.
+func (box OrientedBox) Distance(point geom.Vector) float64 {
+	return math.Abs(box.SignedDistance(point))
+}
+
+// SignedDistance is like Distance, but negative inside the box.
+func (box OrientedBox) SignedDistance(point geom.Vector) float64 {
+	return box.box.SignedDistance(box.frame.localVector(geom.Sub(point, box.frame.origin)))
+}
+
+// ClosestPoint returns the point of the polygon nearest to point.
+func (polygon *Polygon) ClosestPoint(point geom.Vector) geom.Vector {
+	closest := polygon.triangles[0].ClosestPoint(point)
+	for _, triangle := range polygon.triangles[1:] {
+		closest = nearerTo(point, closest, triangle.ClosestPoint(point))
+	}
+	return closest
+}
+
+// ClosestPoint returns the foot of the perpendicular from point to the
+// plane.
+func (plane Plane) ClosestPoint(point geom.Vector) geom.Vector {
+	return geom.Sub(point, scale(plane.normal, geom.Dot(geom.Sub(point, plane.point), plane.normal)))
+}
+
+// ClosestPoint returns the point of the disk nearest to point.
+func (disk Disk) ClosestPoint(point geom.Vector) geom.Vector {
+	r := math.Abs(disk.r)
+	return disk.frame.closestOnProfile(point, geom.NewVector(0, 0, 0), geom.NewVector(r, 0, 0))
+}
+
+// ClosestPoint returns the point of the surface of the cylinder nearest to
+// point, which lies in the plane through the axis and point.
+func (cylinder Cylinder) ClosestPoint(point geom.Vector) geom.Vector {
+	base, baseRim := geom.NewVector(0, 0, 0), geom.NewVector(cylinder.r, 0, 0)
+	top, topRim := geom.NewVector(0, 0, cylinder.height), geom.NewVector(cylinder.r, 0, cylinder.height)
+	if !cylinder.capped {
+		return cylinder.frame.closestOnProfile(point, baseRim, topRim)
+	}
+	return cylinder.frame.closestOnProfile(point, base, baseRim, topRim, top)
+}
+
+// Distance returns the distance from the point to the surface of the
+// cylinder.
+func (cylinder Cylinder) Distance(point geom.Vector) float64 {
+	return length(geom.Sub(cylinder.ClosestPoint(point), point))
+}
+
+// SignedDistance is like Distance, but negative inside the cylinder. As for
+// Spans an open cylinder has the inside of a closed one.
+func (cylinder Cylinder) SignedDistance(point geom.Vector) float64 {
+	local := cylinder.frame.localVector(geom.Sub(point, cylinder.frame.origin))
+	distance := cylinder.Distance(point)
+	if local.Z >= 0 && local.Z <= cylinder.height && math.Hypot(local.X, local.Y) <= cylinder.r {
+		return -distance
+	}
+	return distance
+}
+
+// ClosestPoint returns the point of the surface of the cone nearest to
+// point, which lies in the plane through the axis and point.
+func (cone Cone) ClosestPoint(point geom.Vector) geom.Vector {
+	rim, apex := geom.NewVector(cone.r, 0, 0), geom.NewVector(0, 0, cone.height)
+	if !cone.capped {
+		return cone.frame.closestOnProfile(point, rim, apex)
+	}
+	return cone.frame.closestOnProfile(point, geom.NewVector(0, 0, 0), rim, apex)
+}
+
+// Distance returns the distance from the point to the surface of the cone.
+func (cone Cone) Distance(point geom.Vector) float64 {
+	return length(geom.Sub(cone.ClosestPoint(point), point))
+}
+
+// SignedDistance is like Distance, but negative inside the cone. As for
+// Spans an open cone has the inside of a closed one.
+func (cone Cone) SignedDistance(point geom.Vector) float64 {
+	local := cone.frame.localVector(geom.Sub(point, cone.frame.origin))
+	distance := cone.Distance(point)
+	if local.Z >= 0 && local.Z <= cone.height && math.Hypot(local.X, local.Y) <= cone.r*(1-local.Z/cone.height) {
+		return -distance
+	}
+	return distance
+}
+
+// closestOnProfile returns the point nearest to point of the surface swept
+// around the axis of the frame by the polyline through profile. The points
+// of the profile give the distance from the axis in X and the height in Z.
+func (f frame) closestOnProfile(point geom.Vector, profile ...geom.Vector) geom.Vector {
+	local := f.localVector(geom.Sub(point, f.origin))
+	radial := math.Hypot(local.X, local.Y)
+	flat := geom.NewVector(radial, 0, local.Z)
+
+	closest := profile[0]
+	for i := 1; i < len(profile); i++ {
+		closest = nearerTo(flat, closest, closestPointOnSegment(flat, profile[i-1], profile[i]))
+	}
+
+	// Points on the axis are as near to every side and get the one along X
+	direction := geom.NewVector(1, 0, 0)
+	if radial > 0 {
+		direction = geom.NewVector(local.X/radial, local.Y/radial, 0)
+	}
+	local = geom.Add(scale(direction, closest.X), geom.NewVector(0, 0, closest.Z))
+	return geom.Add(f.origin, f.worldVector(local))
+}
+
+// ClosestPoint returns the point of the torus nearest to point, which is on
+// the tube around the nearest point of its central circle.
+func (torus Torus) ClosestPoint(point geom.Vector) geom.Vector {
+	local := torus.frame.localVector(geom.Sub(point, torus.frame.origin))
+	center := geom.NewVector(torus.major, 0, 0)
+	if radial := math.Hypot(local.X, local.Y); radial > 0 {
+		center = geom.NewVector(local.X*torus.major/radial, local.Y*torus.major/radial, 0)
+	}
+
+	offset := geom.Sub(local, center)
+	if offset == (geom.Vector{}) {
+		offset = geom.NewVector(0, 0, 1)
+	}
+	local = geom.Add(center, scale(normalize(offset), torus.minor))
+	return geom.Add(torus.frame.origin, torus.frame.worldVector(local))
+}
+
+// Distance returns the distance from the point to the surface of the torus.
+func (torus Torus) Distance(point geom.Vector) float64 {
+	return math.Abs(torus.SignedDistance(point))
+}
+
+// SignedDistance is like Distance, but negative inside the tube of the
+// torus.
+func (torus Torus) SignedDistance(point geom.Vector) float64 {
+	local := torus.frame.localVector(geom.Sub(point, torus.frame.origin))
+	return math.Hypot(math.Hypot(local.X, local.Y)-torus.major, local.Z) - torus.minor
+}
+
+// ClosestPoint returns the point of the faces of the mesh nearest to point,
+// found with its bounding volume hierarchy.
+func (mesh *Mesh) ClosestPoint(point geom.Vector) geom.Vector {
+	return mesh.nearest(point).Point
+}
+
+// Distance returns the distance from the point to the faces of the mesh,
+// which is infinite if it has none.
+func (mesh *Mesh) Distance(point geom.Vector) float64 {
+	return mesh.nearest(point).Distance
+}
+
+// SignedDistance is like Distance, but negative inside the mesh, which
+// should be closed with all faces wound the same way. Inside is where the
+// generalized winding number of the faces is over one half, which gives
+// sensible answers for meshes with small holes too.
+func (mesh *Mesh) SignedDistance(point geom.Vector) float64 {
+	distance := mesh.Distance(point)
+	if math.Abs(mesh.windingNumber(point)) > 0.5 {
+		return -distance
+	}
+	return distance
+}
+
+func (mesh *Mesh) nearest(point geom.Vector) Nearest {
+	search := newNearestSearch(point, math.Inf(1))
+	search.visit(mesh.bvh)
+	return search.best
+}
+
+// windingNumber returns how many times the faces of the mesh wind around
+// point, which is the sum of the signed solid angles they cover over 4π.
+// Quads are split the same way whatever their shape, as the solid angles
+// of a fan add up for concave faces too.
+func (mesh *Mesh) windingNumber(point geom.Vector) float64 {
+	var sum float64
+	for _, primitive := range mesh.primitives {
+		switch primitive := primitive.(type) {
+		case Triangle:
+			sum += solidAngle(point, primitive.a, primitive.b, primitive.c)
+		case Quad:
+			sum += solidAngle(point, primitive.a, primitive.b, primitive.c)
+			sum += solidAngle(point, primitive.a, primitive.c, primitive.d)
+		}
+	}
+	return sum / (4 * math.Pi)
+}
+
+// solidAngle returns the signed solid angle of the triangle abc seen from
+// p, by Van Oosterom and Strackee. It is positive when the triangle is
+// wound counterclockwise as seen from p.
+func solidAngle(p, a, b, c geom.Vector) float64 {
+	a, b, c = geom.Sub(a, p), geom.Sub(b, p), geom.Sub(c, p)
+	la, lb, lc := length(a), length(b), length(c)
+
+	numerator := geom.Dot(a, geom.Cross(b, c))
+	denominator := la*lb*lc + geom.Dot(a, b)*lc + geom.Dot(a, c)*lb + geom.Dot(b, c)*la
+	return 2 * math.Atan2(numerator, denominator)
+}
+
+// closestPointOnSegment returns the point of the segment from a to b
+// nearest to p.
+func closestPointOnSegment(p, a, b geom.Vector) geom.Vector {
+	ab := geom.Sub(b, a)
+	lengthSquared := geom.Dot(ab, ab)
+	if lengthSquared == 0 {
+		return a
+	}
+	return geom.Add(a, scale(ab, clamp01(geom.Dot(geom.Sub(p, a), ab)/lengthSquared)))
+}
+
+func nearerTo(p, a, b geom.Vector) geom.Vector {
+	if length(geom.Sub(b, p)) < length(geom.Sub(a, p)) {
+		return b
+	}
+	return a
+}
+
+// nearestSearch holds the nearest primitive found so far while descending
+// through accelerators, whose bounds are skipped once they are further.
+type nearestSearch struct {
+	point geom.Vector
+	best  Nearest
+
+	// The transform of the instances on the way, from the space of the
+	// visited primitives to that of point. scale is how many times it
+	// scales every length, or zero if it scales some directions more.
+	transformed       bool
+	toWorld, toObject Matrix
+	scale             float64
+
+	// unmeasured is the primitive nearest to point whose distance could not
+	// be found and unmeasuredDistance is how near it may be.
+	unmeasured         Primitive
+	unmeasuredDistance float64
+}
+
+func newNearestSearch(point geom.Vector, maxDistance float64) nearestSearch {
+	return nearestSearch{
+		point:              point,
+		best:               Nearest{Distance: maxDistance},
+		unmeasuredDistance: math.Inf(1),
+	}
+}
+
+// nearestCandidate is a primitive or node to visit with the distance to its
+// bounds.
+type nearestCandidate struct {
+	index    int
+	distance float64
+}
+
+// boundsDistance returns the distance to the box, which is in the space of
+// the visited primitives.
+func (search *nearestSearch) boundsDistance(box AABB) float64 {
+	if search.transformed {
+		box = search.toWorld.box(box)
+	}
+	return box.Distance(search.point)
+}
+
+// byBounds returns the primitives by the distance to their bounds.
+func (search *nearestSearch) byBounds(primitives []Primitive) []nearestCandidate {
+	result := make([]nearestCandidate, len(primitives))
+	for i, primitive := range primitives {
+		result[i] = nearestCandidate{index: i, distance: search.boundsDistance(primitive.Bounds())}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].distance < result[j].distance
+	})
+	return result
+}
+
+// visit reports whether the primitive or a part of it is nearer than the
+// nearest one found before.
+func (search *nearestSearch) visit(primitive Primitive) bool {
+	switch primitive := primitive.(type) {
+	case *Mesh:
+		return search.visit(primitive.bvh)
+
+	case *BVH:
+		return search.visitBVH(primitive)
+
+	case *Instance:
+		return search.visitInstance(primitive)
+
+	case *CSG:
+		return search.visitCSG(primitive)
+
+	case Accelerator:
+		found := false
+		primitives := primitive.Primitives()
+		for _, candidate := range search.byBounds(primitives) {
+			if candidate.distance >= search.best.Distance {
+				break
+			}
+			if search.visit(primitives[candidate.index]) {
+				found = true
+			}
+		}
+		return found
+	}
+
+	closest, ok := search.closestPoint(primitive)
+	if !ok {
+		search.skip(primitive, search.boundsDistance(primitive.Bounds()))
+		return false
+	}
+	distance := length(geom.Sub(closest, search.point))
+	if distance >= search.best.Distance {
+		return false
+	}
+	search.best.Primitive, search.best.Point, search.best.Distance = primitive, closest, distance
+	return true
+}
+
+// skip records a primitive whose distance could not be found, but which may
+// be as near as distance.
+func (search *nearestSearch) skip(primitive Primitive, distance float64) {
+	if distance < search.unmeasuredDistance {
+		search.unmeasured, search.unmeasuredDistance = primitive, distance
+	}
+}
+
+// closestPoint returns the point of the primitive nearest to point, or false
+// if it cannot be found. Transforms which keep shapes map the question into
+// the space of the primitive. Otherwise the primitive is transformed, which
+// is possible for flat ones and spheres, which become ellipsoids.
+func (search *nearestSearch) closestPoint(primitive Primitive) (geom.Vector, bool) {
+	pointer, ok := primitive.(ClosestPointer)
+	switch {
+	case !search.transformed:
+		if !ok {
+			return geom.Vector{}, false
+		}
+		return pointer.ClosestPoint(search.point), true
+	case ok && search.scale > 0:
+		return search.toWorld.Point(pointer.ClosestPoint(search.toObject.Point(search.point))), true
+	}
+
+	closest, ok := transformedClosestPoint(search.toWorld, primitive)
+	if !ok {
+		return geom.Vector{}, false
+	}
+	return closest(search.point), true
+}
+
+// transformedClosestPoint returns a function finding the point of the
+// primitive transformed by m which is nearest to a point, for primitives
+// whose transformed shape is known.
+func transformedClosestPoint(m Matrix, primitive Primitive) (func(geom.Vector) geom.Vector, bool) {
+	switch p := primitive.(type) {
+	case Triangle:
+		return NewTriangle(m.Point(p.a), m.Point(p.b), m.Point(p.c)).ClosestPoint, true
+	case Quad:
+		return NewQuad(m.Point(p.a), m.Point(p.b), m.Point(p.c), m.Point(p.d)).ClosestPoint, true
+	case *Polygon:
+		triangles := make([]Triangle, len(p.triangles))
+		for i, triangle := range p.triangles {
+			triangles[i] = NewTriangle(m.Point(triangle.a), m.Point(triangle.b), m.Point(triangle.c))
+		}
+		return nearestOfTriangles(triangles), true
+	case Box:
+		return boxFaces(func(corner geom.Vector) geom.Vector {
+			return m.Point(corner)
+		}, p.min, p.max), true
+	case OrientedBox:
+		return boxFaces(func(corner geom.Vector) geom.Vector {
+			return m.Point(geom.Add(p.frame.origin, p.frame.worldVector(corner)))
+		}, p.box.min, p.box.max), true
+	case Plane:
+		normal := geom.Cross(m.Vector(p.uAxis), m.Vector(p.vAxis))
+		return NewPlane(m.Point(p.point), normal).ClosestPoint, true
+	case Sphere:
+		return newEllipsoid(m.Point(p.origin), m, p.r).ClosestPoint, true
+	}
+	return nil, false
+}
+
+// nearestOfTriangles returns a function finding the point of the triangles
+// nearest to a point.
+func nearestOfTriangles(triangles []Triangle) func(geom.Vector) geom.Vector {
+	return func(point geom.Vector) geom.Vector {
+		closest := triangles[0].ClosestPoint(point)
+		for _, triangle := range triangles[1:] {
+			closest = nearerTo(point, closest, triangle.ClosestPoint(point))
+		}
+		return closest
+	}
+}
+
+// boxFaces returns a function finding the point nearest to a point of the
+// faces of the box from min to max with its corners moved by corner. The
+// faces stay flat under affine transforms, so they are split in triangles.
+func boxFaces(corner func(geom.Vector) geom.Vector, min, max geom.Vector) func(geom.Vector) geom.Vector {
+	var corners [8]geom.Vector
+	for i := range corners {
+		x, y, z := min.X, min.Y, min.Z
+		if i&1 != 0 {
+			x = max.X
+		}
+		if i&2 != 0 {
+			y = max.Y
+		}
+		if i&4 != 0 {
+			z = max.Z
+		}
+		corners[i] = corner(geom.NewVector(x, y, z))
+	}
+
+	// The faces as corner indices, going around each of them
+	faces := [6][4]int{{0, 2, 6, 4}, {1, 3, 7, 5}, {0, 1, 5, 4}, {2, 3, 7, 6}, {0, 1, 3, 2}, {4, 5, 7, 6}}
+	triangles := make([]Triangle, 0, 12)
+	for _, face := range faces {
+		a, b, c, d := corners[face[0]], corners[face[1]], corners[face[2]], corners[face[3]]
+		triangles = append(triangles, NewTriangle(a, b, c), NewTriangle(a, c, d))
+	}
+	return nearestOfTriangles(triangles)
+}
+
+// visitInstance searches the primitive of the instance with its transform
+// added to those on the way.
+func (search *nearestSearch) visitInstance(instance *Instance) bool {
+	outer := *search
+	if search.transformed {
+		search.toWorld = search.toWorld.Mul(instance.toWorld)
+		search.toObject = instance.toObject.Mul(search.toObject)
+	} else {
+		search.toWorld, search.toObject = instance.toWorld, instance.toObject
+	}
+	search.transformed = true
+	search.scale, _ = search.toWorld.uniformScale()
+
+	found := search.visit(instance.primitive)
+	search.transformed, search.toWorld, search.toObject, search.scale = outer.transformed, outer.toWorld, outer.toObject, outer.scale
+	return found
+}
+
+// uniformScale returns how many times the transform scales every length, or
+// false if it scales some directions more than others.
+func (m Matrix) uniformScale() (float64, bool) {
+	x := m.Vector(geom.NewVector(1, 0, 0))
+	y := m.Vector(geom.NewVector(0, 1, 0))
+	z := m.Vector(geom.NewVector(0, 0, 1))
+
+	factor := length(x)
+	tolerance := 1e-9 * factor
+	if math.Abs(length(y)-factor) > tolerance || math.Abs(length(z)-factor) > tolerance {
+		return 0, false
+	}
+	if math.Abs(geom.Dot(x, y)) > tolerance*factor || math.Abs(geom.Dot(y, z)) > tolerance*factor || math.Abs(geom.Dot(z, x)) > tolerance*factor {
+		return 0, false
+	}
+	return factor, true
+}
+
+// visitCSG finds the nearest points of the surfaces of both operands. The
+// surface of the combined solid is made of parts of theirs, so the nearer
+// of the two is the answer when it is on that surface. When it is not, the
+// answer lies further on parts which cannot be searched, and the solid is
+// skipped as being at least as far as the point found.
+func (search *nearestSearch) visitCSG(csg *CSG) bool {
+	left, right := *search, *search
+	leftFound := left.visit(csg.left)
+	rightFound := right.visit(csg.right)
+	search.skip(left.unmeasured, left.unmeasuredDistance)
+	search.skip(right.unmeasured, right.unmeasuredDistance)
+
+	nearer, onLeft := left, true
+	if !leftFound || (rightFound && right.best.Distance < left.best.Distance) {
+		nearer, onLeft = right, false
+	}
+	if !leftFound && !rightFound {
+		return false
+	}
+
+	point := nearer.best.Point
+	if search.transformed {
+		point = search.toObject.Point(point)
+	}
+	if !csg.onSurface(point, onLeft) {
+		search.skip(csg, nearer.best.Distance)
+		return false
+	}
+	search.best = nearer.best
+	return true
+}
+
+// onSurface reports whether a point of the surface of the left or the right
+// operand is on the surface of the combined solid, which it is when the
+// result is different on its two sides.
+func (csg *CSG) onSurface(point geom.Vector, onLeft bool) bool {
+	if onLeft {
+		inRight := solidContains(csg.right, point)
+		return csg.operation.inside(true, inRight) != csg.operation.inside(false, inRight)
+	}
+	inLeft := solidContains(csg.left, point)
+	return csg.operation.inside(inLeft, true) != csg.operation.inside(inLeft, false)
+}
+
+// solidContainsDirection is the direction of the rays telling whether a
+// point is inside a solid, chosen so that they rarely graze anything.
+var solidContainsDirection = normalize(geom.NewVector(0.5773, 0.5779, 0.5769))
+
+// solidContains reports whether the point is inside the solid.
+func solidContains(solid Solid, point geom.Vector) bool {
+	for _, span := range solid.Spans(geom.NewRay(point, solidContainsDirection)) {
+		if span.Enter.T < 0 && span.Exit.T > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// visitBVH descends into the nearer child of each node first.
+func (search *nearestSearch) visitBVH(bvh *BVH) bool {
+	if len(bvh.nodes) == 0 {
+		return false
+	}
+
+	found := false
+	stack := []nearestCandidate{{index: 0, distance: search.boundsDistance(bvh.nodes[0].bounds)}}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if top.distance >= search.best.Distance {
+			continue
+		}
+
+		node := &bvh.nodes[top.index]
+		if node.count > 0 {
+			for _, primitive := range bvh.primitives[node.first : node.first+node.count] {
+				if search.visit(primitive) {
+					found = true
+				}
+			}
+			continue
+		}
+
+		near := nearestCandidate{index: top.index + 1, distance: search.boundsDistance(bvh.nodes[top.index+1].bounds)}
+		far := nearestCandidate{index: node.second, distance: search.boundsDistance(bvh.nodes[node.second].bounds)}
+		if far.distance < near.distance {
+			near, far = far, near
+		}
+		stack = append(stack, far, near)
+	}
+	return found
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+func TestTriangleClosestPoint(t *testing.T) {
+	triangle := NewTriangle(geom.NewVector(0, 0, 0), geom.NewVector(4, 0, 0), geom.NewVector(0, 4, 0))
+
+	cases := []struct {
+		point, closest geom.Vector
+	}{
+		{geom.NewVector(1, 1, 3), geom.NewVector(1, 1, 0)},
+		{geom.NewVector(-1, -1, 1), geom.NewVector(0, 0, 0)},
+		{geom.NewVector(2, -3, 0), geom.NewVector(2, 0, 0)},
+		{geom.NewVector(3, 3, -1), geom.NewVector(2, 2, 0)},
+	}
+	for _, c := range cases {
+		if closest := triangle.ClosestPoint(c.point); !vectorsAlmostEqual(closest, c.closest) {
+			t.Errorf("Expected the point of the triangle nearest to %#v to be %#v, got %#v", c.point, c.closest, closest)
+		}
+		if distance := triangle.Distance(c.point); !almostEqual(distance, length(geom.Sub(c.closest, c.point))) {
+			t.Errorf("Expected %#v to be %v from the triangle, got %v", c.point, length(geom.Sub(c.closest, c.point)), distance)
+		}
+	}
+}
+
+// sampledDistance returns the distance from p to the nearest of a grid of
+// points of the bilinear patch of the quad.
+func sampledDistance(quad Quad, p geom.Vector, samples int) float64 {
+	nearest := math.Inf(1)
+	for i := 0; i <= samples; i++ {
+		for j := 0; j <= samples; j++ {
+			point := quad.patchPoint(float64(i)/float64(samples), float64(j)/float64(samples))
+			nearest = math.Min(nearest, length(geom.Sub(point, p)))
+		}
+	}
+	return nearest
+}
+
+func TestQuadClosestPoint(t *testing.T) {
+	// An L-shaped, concave quad
+	concave := NewQuad(geom.NewVector(0, 0, 0), geom.NewVector(2, 0, 0), geom.NewVector(0.5, 0.5, 0), geom.NewVector(0, 2, 0))
+	if closest := concave.ClosestPoint(geom.NewVector(1, 0.2, 1)); !vectorsAlmostEqual(closest, geom.NewVector(1, 0.2, 0)) {
+		t.Errorf("Expected the point right below to be nearest, got %#v", closest)
+	}
+	if distance := concave.Distance(geom.NewVector(1, 1, 1)); !almostEqual(distance, math.Sqrt(1.4)) {
+		t.Errorf("Expected a point over the notch to be %v away from its edges, got %v", math.Sqrt(1.4), distance)
+	}
+
+	twisted := NewQuad(geom.NewVector(-1, 0, -1), geom.NewVector(1, 1, -1), geom.NewVector(1, 0, 1), geom.NewVector(-1, 1, 1))
+	rng := rand.New(rand.NewSource(25))
+	for i := 0; i < 300; i++ {
+		p := randomVector(rng, 2)
+		distance := twisted.Distance(p)
+		sampled := sampledDistance(twisted, p, 200)
+		if distance > sampled+1e-9 || distance < sampled-0.02 {
+			t.Fatalf("Expected %#v to be about %v from the twisted quad, got %v", p, sampled, distance)
+		}
+	}
+}
+
+func TestSphereSignedDistance(t *testing.T) {
+	sphere := NewSphere(geom.NewVector(1, 0, 0), 2)
+
+	if d := sphere.SignedDistance(geom.NewVector(1, 5, 0)); !almostEqual(d, 3) {
+		t.Errorf("Expected a point outside to be 3 away, got %v", d)
+	}
+	if d := sphere.SignedDistance(geom.NewVector(1.5, 0, 0)); !almostEqual(d, -1.5) {
+		t.Errorf("Expected a point inside to be -1.5 away, got %v", d)
+	}
+	if d := sphere.Distance(geom.NewVector(1.5, 0, 0)); !almostEqual(d, 1.5) {
+		t.Errorf("Expected the distance to be 1.5, got %v", d)
+	}
+	if closest := sphere.ClosestPoint(geom.NewVector(1, 0, -4)); !vectorsAlmostEqual(closest, geom.NewVector(1, 0, -2)) {
+		t.Errorf("Expected (1, 0, -2) to be nearest, got %#v", closest)
+	}
+	if closest := sphere.ClosestPoint(geom.NewVector(1, 0, 0)); !almostEqual(length(geom.Sub(closest, sphere.origin)), 2) {
+		t.Errorf("Expected some point of the sphere to be nearest to its center, got %#v", closest)
+	}
+}
+
+func TestBoxSignedDistance(t *testing.T) {
+	box := NewBox(geom.NewVector(0, 0, 0), geom.NewVector(2, 4, 6))
+
+	cases := []struct {
+		point, closest geom.Vector
+		distance       float64
+	}{
+		{geom.NewVector(1, 0.5, 3), geom.NewVector(1, 0, 3), -0.5},
+		{geom.NewVector(1.8, 2, 3), geom.NewVector(2, 2, 3), -0.2},
+		{geom.NewVector(1, 2, 9), geom.NewVector(1, 2, 6), 3},
+		{geom.NewVector(5, 8, 3), geom.NewVector(2, 4, 3), 5},
+		{geom.NewVector(0, 2, 3), geom.NewVector(0, 2, 3), 0},
+	}
+	for _, c := range cases {
+		if d := box.SignedDistance(c.point); !almostEqual(d, c.distance) {
+			t.Errorf("Expected %#v to be %v from the box, got %v", c.point, c.distance, d)
+		}
+		if closest := box.ClosestPoint(c.point); !vectorsAlmostEqual(closest, c.closest) {
+			t.Errorf("Expected the point of the box nearest to %#v to be %#v, got %#v", c.point, c.closest, closest)
+		}
+	}
+}
+
+func TestMeshSignedDistance(t *testing.T) {
+	cube, _ := ParseOBJ(strings.NewReader(cubeOBJ))
+	if d := cube.SignedDistance(geom.NewVector(0.5, 0.5, 0.7)); !almostEqual(d, -0.3) {
+		t.Errorf("Expected the center of the cube to be -0.3 from its top, got %v", d)
+	}
+	if d := cube.SignedDistance(geom.NewVector(3, 0.5, 0.5)); !almostEqual(d, 2) {
+		t.Errorf("Expected a point beside the cube to be 2 away, got %v", d)
+	}
+
+	rng := rand.New(rand.NewSource(25))
+	mesh := randomClosedMesh(rng, 8, 12)
+	inside := 0
+	for i := 0; i < 500; i++ {
+		p := randomVector(rng, 1.2)
+
+		nearest := math.Inf(1)
+		for _, primitive := range mesh.Primitives() {
+			nearest = math.Min(nearest, length(geom.Sub(primitive.(ClosestPointer).ClosestPoint(p), p)))
+		}
+
+		// Rays from inside leave the mesh once more than they enter it
+		crossings := mesh.AllHits(geom.NewRay(p, randomVector(rng, 1)), 0, math.Inf(1))
+		want := nearest
+		if len(crossings)%2 == 1 {
+			want = -nearest
+			inside++
+		}
+		if d := mesh.SignedDistance(p); !almostEqual(d, want) {
+			t.Fatalf("Expected %#v to be %v from the mesh, got %v", p, want, d)
+		}
+	}
+	if inside < 100 {
+		t.Errorf("Expected many of the points to be inside the mesh, got %d", inside)
+	}
+}
+
+func TestShapeClosestPoint(t *testing.T) {
+	polygon, _ := NewPolygon([]geom.Vector{
+		geom.NewVector(0, 0, 0), geom.NewVector(4, 0, 0), geom.NewVector(4, 4, 0), geom.NewVector(2, 1, 0), geom.NewVector(0, 4, 0),
+	})
+	cases := []struct {
+		shape          ClosestPointer
+		point, closest geom.Vector
+	}{
+		{NewCylinder(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1), geom.NewVector(3, 1, 0), geom.NewVector(1, 1, 0)},
+		{NewCylinder(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1), geom.NewVector(0.5, 1.9, 0), geom.NewVector(0.5, 2, 0)},
+		{NewOpenCylinder(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1), geom.NewVector(0.5, 1.9, 0), geom.NewVector(1, 1.9, 0)},
+		{NewCone(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1), 1), geom.NewVector(0, 1, 1), geom.NewVector(0, 0.5, 0.5)},
+		{NewCone(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1), 1), geom.NewVector(0.2, 0, -1), geom.NewVector(0.2, 0, 0)},
+		{NewOpenCone(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1), 1), geom.NewVector(0.1, 0, -1), geom.NewVector(1, 0, 0)},
+		{NewDisk(geom.NewVector(0, 0, 1), geom.NewVector(0, 0, 1), 2), geom.NewVector(3, 0, 3), geom.NewVector(2, 0, 1)},
+		{NewPlane(geom.NewVector(0, 0, 1), geom.NewVector(0, 0, 1)), geom.NewVector(3, 0, 3), geom.NewVector(3, 0, 1)},
+		{NewTorus(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1), 3, 1), geom.NewVector(0, 6, 0), geom.NewVector(0, 4, 0)},
+		{NewTorus(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1), 3, 1), geom.NewVector(0, 0, 4), geom.NewVector(0, 2.4, 0.8)},
+		{NewOrientedBox(geom.NewVector(0, 0, 0), geom.NewVector(1, 1, 0), geom.NewVector(-1, 1, 0), geom.NewVector(1, 1, 1)), geom.NewVector(3, 3, 0), geom.NewVector(math.Sqrt(0.5), math.Sqrt(0.5), 0)},
+		{polygon, geom.NewVector(2.5, 3, 1), geom.NewVector(40.0/13, 34.0/13, 0)},
+	}
+	for _, c := range cases {
+		if closest := c.shape.ClosestPoint(c.point); !vectorsAlmostEqual(closest, c.closest) {
+			t.Errorf("Expected the point of %#v nearest to %#v to be %#v, got %#v", c.shape, c.point, c.closest, closest)
+		}
+	}
+}
+
+// TestShapeClosestPointIsNearest checks that no ray from a point hits the
+// shape before the distance to its closest point and that points of the
+// surface are their own closest points.
+func TestShapeClosestPointIsNearest(t *testing.T) {
+	polygon, _ := NewPolygon([]geom.Vector{
+		geom.NewVector(-1, -1, 0.5), geom.NewVector(1, -1, -0.5), geom.NewVector(0, 0, 0), geom.NewVector(-1, 1, 0.5),
+	})
+	shapes := []ClosestPointer{
+		NewCylinder(geom.NewVector(0, -1, 0), geom.NewVector(0.5, 1, 0), 0.8),
+		NewOpenCylinder(geom.NewVector(0, -1, 0), geom.NewVector(0.5, 1, 0), 0.8),
+		NewCone(geom.NewVector(0.3, 0, -1), geom.NewVector(0, 0.2, 1), 1),
+		NewOpenCone(geom.NewVector(0.3, 0, -1), geom.NewVector(0, 0.2, 1), 1),
+		NewDisk(geom.NewVector(0, 0, 0), geom.NewVector(1, 2, 3), 1.5),
+		NewTorus(geom.NewVector(0, 0, 0), geom.NewVector(1, 1, 0), 1.2, 0.4),
+		NewOrientedBox(geom.NewVector(0, 0, 0), geom.NewVector(1, 2, 0), geom.NewVector(0, 0, 1), geom.NewVector(1, 0.5, 0.7)),
+		polygon,
+	}
+
+	rng := rand.New(rand.NewSource(25))
+	for _, shape := range shapes {
+		for i := 0; i < 200; i++ {
+			p := randomVector(rng, 3)
+			distance := length(geom.Sub(shape.ClosestPoint(p), p))
+			for j := 0; j < 50; j++ {
+				ray := geom.NewRay(p, normalize(randomVector(rng, 1)))
+				hit, ok := shape.ClosestHitSegment(ray, 0, math.Inf(1))
+				if !ok {
+					continue
+				}
+				if hit.T < distance-1e-6 {
+					t.Fatalf("Expected nothing of %#v closer to %#v than %v, got a hit %v away", shape, p, distance, hit.T)
+				}
+				if closest := shape.ClosestPoint(hit.Point); !vectorsAlmostEqual(closest, hit.Point) {
+					t.Fatalf("Expected %#v of %#v to be its own closest point, got %#v", hit.Point, shape, closest)
+				}
+			}
+		}
+	}
+}
+
+// signedDistancer is a solid telling how far points are from its surface.
+type signedDistancer interface {
+	Solid
+	ClosestPoint(point geom.Vector) geom.Vector
+	SignedDistance(point geom.Vector) float64
+}
+
+func TestShapeSignedDistance(t *testing.T) {
+	cases := []struct {
+		shape    signedDistancer
+		point    geom.Vector
+		distance float64
+	}{
+		{NewCylinder(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1), geom.NewVector(3, 1, 0), 2},
+		{NewCylinder(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1), geom.NewVector(0.5, 1.9, 0), -0.1},
+		{NewOpenCylinder(geom.NewVector(0, 0, 0), geom.NewVector(0, 2, 0), 1), geom.NewVector(0.5, 1.9, 0), -0.5},
+		{NewCone(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1), 1), geom.NewVector(0, 1, 1), math.Sqrt(0.5)},
+		{NewCone(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1), 1), geom.NewVector(0, 0, 0.2), -0.2},
+		{NewTorus(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1), 3, 1), geom.NewVector(0, 6, 0), 2},
+		{NewTorus(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1), 3, 1), geom.NewVector(0, 3.2, 0.3), math.Hypot(0.2, 0.3) - 1},
+		{NewTorus(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1), 3, 1), geom.NewVector(0, 0, 0), 2},
+		{NewOrientedBox(geom.NewVector(0, 0, 0), geom.NewVector(1, 1, 0), geom.NewVector(-1, 1, 0), geom.NewVector(1, 1, 1)), geom.NewVector(3, 3, 0), 3*math.Sqrt(2) - 1},
+		{NewOrientedBox(geom.NewVector(0, 0, 0), geom.NewVector(1, 1, 0), geom.NewVector(-1, 1, 0), geom.NewVector(1, 2, 3)), geom.NewVector(0.5, -0.5, 0), -1},
+		{NewOrientedBox(geom.NewVector(0, 0, 0), geom.NewVector(1, 1, 0), geom.NewVector(-1, 1, 0), geom.NewVector(1, 2, 3)), geom.NewVector(0.1, 0.1, 0.2), -(1 - math.Sqrt(0.02))},
+	}
+	for _, c := range cases {
+		if d := c.shape.SignedDistance(c.point); !almostEqual(d, c.distance) {
+			t.Errorf("Expected %#v to be %v from %#v, got %v", c.point, c.distance, c.shape, d)
+		}
+	}
+
+	// Points are inside where rays from them leave the solid and the
+	// distance is that to the closest point
+	shapes := []signedDistancer{
+		NewCylinder(geom.NewVector(0, -1, 0), geom.NewVector(0.5, 1, 0), 0.8),
+		NewOpenCylinder(geom.NewVector(0, -1, 0), geom.NewVector(0.5, 1, 0), 0.8),
+		NewCone(geom.NewVector(0.3, 0, -1), geom.NewVector(0, 0.2, 1), 1),
+		NewTorus(geom.NewVector(0, 0, 0), geom.NewVector(1, 1, 0), 1.2, 0.4),
+		NewOrientedBox(geom.NewVector(0, 0, 0), geom.NewVector(1, 2, 0), geom.NewVector(0, 0, 1), geom.NewVector(1, 0.5, 0.7)),
+	}
+	rng := rand.New(rand.NewSource(25))
+	for _, shape := range shapes {
+		inside := 0
+		for i := 0; i < 500; i++ {
+			p := randomVector(rng, 1.5)
+			d := shape.SignedDistance(p)
+			if want := length(geom.Sub(shape.ClosestPoint(p), p)); !almostEqual(math.Abs(d), want) {
+				t.Fatalf("Expected %#v to be %v from %#v, got %v", p, want, shape, d)
+			}
+			if contains := solidContains(shape, p); contains != (d < 0) {
+				t.Fatalf("Expected %#v to be inside %#v: %v, got %v", p, shape, contains, d)
+			}
+			if d < 0 {
+				inside++
+			}
+		}
+		if inside < 10 {
+			t.Errorf("Expected many points inside %#v, got %d", shape, inside)
+		}
+	}
+}
+
+// leafPrimitives returns the primitives inside any accelerators and meshes.
+func leafPrimitives(primitive Primitive) []Primitive {
+	accelerator, ok := primitive.(Accelerator)
+	if !ok {
+		return []Primitive{primitive}
+	}
+	var result []Primitive
+	for _, part := range accelerator.Primitives() {
+		result = append(result, leafPrimitives(part)...)
+	}
+	return result
+}
+
+func TestSceneNearest(t *testing.T) {
+	rng := rand.New(rand.NewSource(25))
+	scene := pickScene()
+	scene.Objects = append(scene.Objects,
+		Object{Primitive: NewBVH(randomPrimitives(rng, 300))},
+		Object{Primitive: NewGrid(randomPrimitives(rng, 100))},
+		Object{Primitive: NewCylinder(geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0), 3)},
+	)
+
+	for i := 0; i < 300; i++ {
+		p := randomVector(rng, 25)
+		nearest, ok, err := scene.Nearest(p, math.Inf(1))
+		if !ok || err != nil {
+			t.Fatalf("Expected something to be nearest to %#v, got %v", p, err)
+		}
+
+		want := math.Inf(1)
+		for object := range scene.Objects {
+			for _, primitive := range leafPrimitives(scene.Objects[object].Primitive) {
+				closest, ok := primitive.(ClosestPointer)
+				if !ok {
+					continue
+				}
+				if d := length(geom.Sub(closest.ClosestPoint(p), p)); d < want {
+					want = d
+				}
+			}
+		}
+		if !almostEqual(nearest.Distance, want) || !almostEqual(length(geom.Sub(nearest.Point, p)), want) {
+			t.Fatalf("Expected the nearest part to be %v from %#v, got %#v", want, p, nearest)
+		}
+		if d := nearest.Primitive.(ClosestPointer).ClosestPoint(p); !vectorsAlmostEqual(d, nearest.Point) {
+			t.Fatalf("Expected the nearest point to be on the nearest primitive, got %#v", nearest)
+		}
+	}
+}
+
+func TestSceneNearestInstance(t *testing.T) {
+	mesh, _ := ParseOBJ(strings.NewReader(cubeOBJ))
+	scaled, _ := NewInstance(mesh, Compose(Scale(2, 2, 2), RotateZ(math.Pi/4), Translate(geom.NewVector(5, 0, 0))))
+	scene := &Scene{Objects: []Object{{Primitive: NewBVH([]Primitive{scaled})}}}
+
+	// The cube is turned about its corner at (5, 0, 0), so its front face
+	// is at z = 2 and its corner at (5, 2√2, 2) is the nearest point to p
+	p := geom.NewVector(5, 4, 3)
+	nearest, ok, err := scene.Nearest(p, math.Inf(1))
+	corner := geom.NewVector(5, 2*math.Sqrt2, 2)
+	if !ok || err != nil || nearest.Object != 0 || !vectorsAlmostEqual(nearest.Point, corner) || !almostEqual(nearest.Distance, length(geom.Sub(corner, p))) {
+		t.Errorf("Expected the corner of the scaled cube to be nearest, got %#v and %v", nearest, err)
+	}
+	if _, ok := nearest.Primitive.(ClosestPointer); !ok {
+		t.Errorf("Expected a face of the shared mesh, got %#v", nearest.Primitive)
+	}
+}
+
+// transformedTriangles returns the triangles of the mesh moved by m.
+func transformedTriangles(mesh *Mesh, m Matrix) []Triangle {
+	var result []Triangle
+	for _, triangle := range mesh.Triangles() {
+		result = append(result, NewTriangle(m.Point(triangle.a), m.Point(triangle.b), m.Point(triangle.c)))
+	}
+	return result
+}
+
+func TestSceneNearestStretchedInstance(t *testing.T) {
+	mesh, _ := ParseOBJ(strings.NewReader(cubeOBJ))
+	transforms := []Matrix{
+		Compose(Scale(1, 10, 1), RotateZ(math.Pi/6), Translate(geom.NewVector(-5, 0, 0))),
+		Compose(Scale(3, 0.2, 1), RotateX(1), Translate(geom.NewVector(4, 1, 0))),
+		// A shear, under which angles change too
+		{{1, 2, 0, 0}, {0, 1, 0, 3}, {0, 0.5, 1, 0}, {0, 0, 0, 1}},
+	}
+
+	var objects []Object
+	var triangles []Triangle
+	for _, transform := range transforms {
+		instance, _ := NewInstance(mesh, transform)
+		objects = append(objects, Object{Primitive: NewOctree([]Primitive{instance})})
+		triangles = append(triangles, transformedTriangles(mesh, transform)...)
+	}
+	scene := &Scene{Objects: objects}
+
+	rng := rand.New(rand.NewSource(25))
+	for i := 0; i < 300; i++ {
+		p := randomVector(rng, 12)
+		nearest, ok, err := scene.Nearest(p, math.Inf(1))
+		if !ok || err != nil {
+			t.Fatalf("Expected something to be nearest to %#v, got %v", p, err)
+		}
+
+		want := math.Inf(1)
+		for _, triangle := range triangles {
+			want = math.Min(want, triangle.Distance(p))
+		}
+		if !almostEqual(nearest.Distance, want) || !almostEqual(length(geom.Sub(nearest.Point, p)), want) {
+			t.Fatalf("Expected the stretched cubes to be %v from %#v, got %#v", want, p, nearest)
+		}
+	}
+}
+
+func TestSceneNearestSquashedSphere(t *testing.T) {
+	// An ellipsoid with radii 4, 1 and 0.5 under a sphere, which is nearer
+	// to the points than the sphere the instance was made from
+	squashed, _ := NewInstance(NewSphere(geom.Vector{}, 1), Scale(4, 1, 0.5))
+	scene := &Scene{Objects: []Object{
+		{Primitive: squashed},
+		{Primitive: NewSphere(geom.NewVector(0, 0, 2.5), 0.5)},
+	}}
+
+	nearest, ok, err := scene.Nearest(geom.NewVector(0, 0, 1.2), math.Inf(1))
+	if !ok || err != nil || nearest.Object != 0 || !vectorsAlmostEqual(nearest.Point, geom.NewVector(0, 0, 0.5)) {
+		t.Errorf("Expected the top of the squashed sphere to be nearest, got %#v and %v", nearest, err)
+	}
+
+	// Off its axes, the nearest point is compared with many points of the
+	// ellipsoid
+	p := geom.NewVector(3, 0.5, 1)
+	nearest, ok, err = scene.Nearest(p, math.Inf(1))
+	sampled := math.Inf(1)
+	for i := 0; i <= 400; i++ {
+		for j := 0; j < 400; j++ {
+			theta, phi := math.Pi*float64(i)/400, 2*math.Pi*float64(j)/400
+			point := geom.NewVector(4*math.Sin(theta)*math.Cos(phi), math.Sin(theta)*math.Sin(phi), 0.5*math.Cos(theta))
+			sampled = math.Min(sampled, length(geom.Sub(point, p)))
+		}
+	}
+	if !ok || err != nil || nearest.Object != 0 || nearest.Distance > sampled+1e-9 || nearest.Distance < sampled-1e-3 {
+		t.Errorf("Expected the squashed sphere to be about %v away, got %#v and %v", sampled, nearest, err)
+	}
+	if q := nearest.Point; !almostEqual(q.X*q.X/16+q.Y*q.Y+q.Z*q.Z*4, 1) {
+		t.Errorf("Expected the nearest point to be on the ellipsoid, got %#v", q)
+	}
+}
+
+func TestEllipsoidClosestPoint(t *testing.T) {
+	rng := rand.New(rand.NewSource(25))
+	transform := Compose(Scale(3, 1, 0.2), RotateY(0.7), RotateX(0.3), Translate(geom.NewVector(1, 2, 3)))
+	e := newEllipsoid(geom.NewVector(1, 2, 3), transform, 1)
+	inverse, _ := transform.Inverse()
+
+	for i := 0; i < 300; i++ {
+		p := geom.Add(geom.NewVector(1, 2, 3), randomVector(rng, 4))
+		if i%3 == 0 {
+			// Points in the planes of the axes, where the method has
+			// special cases
+			p = geom.Add(e.center, scale(e.axes[i%2], 5*rng.Float64()-2.5))
+		}
+		closest := e.ClosestPoint(p)
+		if local := inverse.Point(closest); !almostEqual(length(local), 1) {
+			t.Fatalf("Expected the point nearest to %#v to be on the ellipsoid, got %#v", p, closest)
+		}
+
+		// The point is nearer than the nearest of many random ones
+		distance := length(geom.Sub(closest, p))
+		for j := 0; j < 2000; j++ {
+			other := transform.Point(normalize(randomVector(rng, 1)))
+			if d := length(geom.Sub(other, p)); d < distance-1e-9 {
+				t.Fatalf("Expected %#v to be nearest to %#v, but %#v is nearer", closest, p, other)
+			}
+		}
+	}
+}
+
+func TestSceneNearestCSG(t *testing.T) {
+	// A box with a spherical cavity and a lens where two spheres overlap
+	cavity := NewDifference(NewBox(geom.NewVector(-2, -2, -2), geom.NewVector(2, 2, 2)), NewSphere(geom.Vector{}, 1))
+	lens := NewIntersection(NewSphere(geom.NewVector(9.5, 0, 0), 1), NewSphere(geom.NewVector(10.5, 0, 0), 1))
+	scene := &Scene{Objects: []Object{{Primitive: cavity}, {Primitive: lens}}}
+
+	nearest, ok, err := scene.Nearest(geom.NewVector(0, 0.5, 0), math.Inf(1))
+	if !ok || err != nil || nearest.Object != 0 || !vectorsAlmostEqual(nearest.Point, geom.NewVector(0, 1, 0)) {
+		t.Errorf("Expected the wall of the cavity to be nearest, got %#v and %v", nearest, err)
+	}
+	nearest, ok, err = scene.Nearest(geom.NewVector(2.5, 0.5, 0), math.Inf(1))
+	if !ok || err != nil || nearest.Object != 0 || !vectorsAlmostEqual(nearest.Point, geom.NewVector(2, 0.5, 0)) {
+		t.Errorf("Expected the side of the box to be nearest, got %#v and %v", nearest, err)
+	}
+
+	// The edge of the lens is where the spheres meet, on neither of
+	// the parts of their surfaces nearest to the point
+	_, _, err = scene.Nearest(geom.NewVector(10, 3, 0), math.Inf(1))
+	if nearestErr, ok := err.(*NearestError); !ok || nearestErr.Object != 1 {
+		t.Errorf("Expected the lens to be reported as not measured, got %v", err)
+	}
+
+	// Where the cavity is surely nearer, the lens does not matter
+	if _, ok, err := scene.Nearest(geom.NewVector(2.5, 3, 0), math.Inf(1)); !ok || err != nil {
+		t.Errorf("Expected the box to be found, got %v", err)
+	}
+}
+
+func TestSceneNearestUnmeasured(t *testing.T) {
+	stretched, _ := NewInstance(NewCylinder(geom.Vector{}, geom.NewVector(0, 1, 0), 1), Scale(1, 1, 3))
+	scene := &Scene{Objects: []Object{
+		{Primitive: NewSphere(geom.NewVector(10, 0, 0), 1)},
+		{Primitive: stretched},
+	}}
+
+	_, _, err := scene.Nearest(geom.NewVector(0, 0.5, 4), math.Inf(1))
+	if nearestErr, ok := err.(*NearestError); !ok || nearestErr.Object != 1 || nearestErr.Distance > 1 {
+		t.Errorf("Expected the stretched cylinder to be reported, got %v", err)
+	}
+
+	nearest, ok, err := scene.Nearest(geom.NewVector(12, 0, 0), math.Inf(1))
+	if !ok || err != nil || nearest.Object != 0 {
+		t.Errorf("Expected the sphere far from the cylinder to be found, got %#v and %v", nearest, err)
+	}
+}
+
+func TestSceneNearestObject(t *testing.T) {
+	scene := pickScene()
+
+	// The triangle in the grid of the group spans (2, -1, 0) to (3, -1, 0)
+	nearest, ok, err := scene.Nearest(geom.NewVector(2.5, -0.4, 0.3), math.Inf(1))
+	if !ok || err != nil || nearest.Object != 2 || !vectorsAlmostEqual(nearest.Point, geom.NewVector(2.5, -0.4, 0)) {
+		t.Errorf("Expected the triangle of the group to be nearest, got %#v", nearest)
+	}
+	if _, triangle := nearest.Primitive.(Triangle); !triangle {
+		t.Errorf("Expected the innermost primitive to be the triangle, got %#v", nearest.Primitive)
+	}
+
+	p := geom.NewVector(-0.5, 0, 1.5)
+	nearest, ok, err = scene.Nearest(p, math.Inf(1))
+	if !ok || err != nil || nearest.Object != 0 || !almostEqual(nearest.Distance, math.Sqrt(2.5)-1) {
+		t.Errorf("Expected the sphere to be nearer than the cube, got %#v", nearest)
+	}
+
+	if _, ok, err := scene.Nearest(p, 0.4); ok || err != nil {
+		t.Errorf("Expected nothing within 0.4")
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"sort"
+)
+
+// ellipsoidIterations bounds the bisection steps finding the point of an
+// ellipsoid nearest to a point. Each halves the interval, so this is more
+// than enough to reach the precision of a float64.
+const ellipsoidIterations = 1100
+
+// ellipsoidTolerance is the distance from the planes of the axes of an
+// ellipsoid, relative to its size, below which points are taken to be in them.
+const ellipsoidTolerance = 1e-10
+
+// ellipsoid is what a sphere becomes under an affine transform: the points
+// center + Σ radii[i]*s[i]*axes[i] for the points s of the unit sphere, with
+// unit axes perpendicular to each other.
+type ellipsoid struct {
+	center geom.Vector
+	axes   [3]geom.Vector
+	radii  [3]float64
+}
+
+// newEllipsoid returns the sphere of radius r around the origin of the space
+// m transforms from, moved to center by m.
+func newEllipsoid(center geom.Vector, m Matrix, r float64) ellipsoid {
+	// The points are center + L*u for unit vectors u, where L is r times the
+	// linear part of m. Their axes are the eigenvectors of L*Lᵀ and the radii
+	// the square roots of its eigenvalues.
+	var product [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				product[i][j] += m[i][k] * m[j][k] * r * r
+			}
+		}
+	}
+
+	values, vectors := symmetricEigen(product)
+	result := ellipsoid{center: center, axes: vectors}
+	for i, value := range values {
+		result.radii[i] = math.Sqrt(math.Max(value, 0))
+	}
+	return result
+}
+
+// ClosestPoint returns the point of the surface of the ellipsoid nearest to
+// point, by Eberly's method: in the frame of its axes the nearest point is
+// found by bisecting for the root of a function decreasing along a ray.
+func (e ellipsoid) ClosestPoint(point geom.Vector) geom.Vector {
+	// The method wants the radii from the largest and the point in the
+	// first octant, which the symmetry of the ellipsoid allows
+	order := []int{0, 1, 2}
+	sort.Slice(order, func(i, j int) bool {
+		return e.radii[order[i]] > e.radii[order[j]]
+	})
+
+	// Coordinates which are zero but for rounding are made zero, as the
+	// method loses its precision near the planes of the axes
+	offset := geom.Sub(point, e.center)
+	tolerance := ellipsoidTolerance * e.radii[order[0]]
+	var radii, y, signs [3]float64
+	for i, axis := range order {
+		radii[i] = e.radii[axis]
+		c := geom.Dot(offset, e.axes[axis])
+		y[i], signs[i] = math.Abs(c), 1
+		if y[i] < tolerance {
+			y[i] = 0
+		}
+		if c < 0 {
+			signs[i] = -1
+		}
+	}
+
+	x := ellipsoidFoot(radii, y)
+	closest := e.center
+	for i, axis := range order {
+		closest = geom.Add(closest, scale(e.axes[axis], signs[i]*x[i]))
+	}
+	return closest
+}
+
+// ellipsoidFoot returns the point of the ellipsoid with radii e0 >= e1 >= e2
+// along its axes nearest to the point y of the first octant.
+func ellipsoidFoot(e, y [3]float64) [3]float64 {
+	var x [3]float64
+	switch {
+	case y[2] > 0 && y[1] > 0 && y[0] > 0:
+		z := [3]float64{y[0] / e[0], y[1] / e[1], y[2] / e[2]}
+		g := z[0]*z[0] + z[1]*z[1] + z[2]*z[2] - 1
+		if g == 0 {
+			return y
+		}
+		r0, r1 := (e[0]/e[2])*(e[0]/e[2]), (e[1]/e[2])*(e[1]/e[2])
+		s := ellipsoidRoot(r0, r1, z, g)
+		x = [3]float64{r0 * y[0] / (s + r0), r1 * y[1] / (s + r1), y[2] / (s + 1)}
+	case y[2] > 0 && y[1] > 0:
+		x[1], x[2] = ellipseFoot(e[1], e[2], y[1], y[2])
+	case y[2] > 0 && y[0] > 0:
+		x[0], x[2] = ellipseFoot(e[0], e[2], y[0], y[2])
+	case y[2] > 0:
+		x[2] = e[2]
+	default:
+		// In the plane of the two larger axes the point may be nearest to
+		// one off the plane, above it
+		denominator0, denominator1 := e[0]*e[0]-e[2]*e[2], e[1]*e[1]-e[2]*e[2]
+		numerator0, numerator1 := e[0]*y[0], e[1]*y[1]
+		if numerator0 < denominator0 && numerator1 < denominator1 {
+			x0, x1 := numerator0/denominator0, numerator1/denominator1
+			if discriminant := 1 - x0*x0 - x1*x1; discriminant > 0 {
+				return [3]float64{e[0] * x0, e[1] * x1, e[2] * math.Sqrt(discriminant)}
+			}
+		}
+		x[0], x[1] = ellipseFoot(e[0], e[1], y[0], y[1])
+	}
+	return x
+}
+
+// ellipseFoot is ellipsoidFoot for an ellipse with radii e0 >= e1.
+func ellipseFoot(e0, e1, y0, y1 float64) (float64, float64) {
+	switch {
+	case y1 > 0 && y0 > 0:
+		z0, z1 := y0/e0, y1/e1
+		g := z0*z0 + z1*z1 - 1
+		if g == 0 {
+			return y0, y1
+		}
+		r0 := (e0 / e1) * (e0 / e1)
+		s := ellipseRoot(r0, z0, z1, g)
+		return r0 * y0 / (s + r0), y1 / (s + 1)
+	case y1 > 0:
+		return 0, e1
+	}
+
+	numerator, denominator := e0*y0, e0*e0-e1*e1
+	if numerator < denominator {
+		x0 := numerator / denominator
+		return e0 * x0, e1 * math.Sqrt(1-x0*x0)
+	}
+	return e0, 0
+}
+
+// ellipseRoot bisects for the root of
+// (r0*z0/(s+r0))² + (z1/(s+1))² - 1, which is g at zero.
+func ellipseRoot(r0, z0, z1, g float64) float64 {
+	n0 := r0 * z0
+	lo, hi := z1-1, 0.0
+	if g >= 0 {
+		hi = math.Hypot(n0, z1) - 1
+	}
+	return bisectRoot(lo, hi, func(s float64) float64 {
+		a, b := n0/(s+r0), z1/(s+1)
+		return a*a + b*b - 1
+	})
+}
+
+// ellipsoidRoot is ellipseRoot for ellipsoids.
+func ellipsoidRoot(r0, r1 float64, z [3]float64, g float64) float64 {
+	n0, n1 := r0*z[0], r1*z[1]
+	lo, hi := z[2]-1, 0.0
+	if g >= 0 {
+		hi = math.Hypot(math.Hypot(n0, n1), z[2]) - 1
+	}
+	return bisectRoot(lo, hi, func(s float64) float64 {
+		a, b, c := n0/(s+r0), n1/(s+r1), z[2]/(s+1)
+		return a*a + b*b + c*c - 1
+	})
+}
+
+// bisectRoot returns the root between lo and hi of f, which decreases from
+// positive to negative there.
+func bisectRoot(lo, hi float64, f func(float64) float64) float64 {
+	s := lo
+	for i := 0; i < ellipsoidIterations; i++ {
+		s = (lo + hi) / 2
+		if s == lo || s == hi {
+			break
+		}
+		switch g := f(s); {
+		case g > 0:
+			lo = s
+		case g < 0:
+			hi = s
+		default:
+			return s
+		}
+	}
+	return s
+}
+
+// symmetricEigen returns the eigenvalues of the symmetric matrix and their
+// unit eigenvectors, found with Jacobi rotations.
+func symmetricEigen(a [3][3]float64) ([3]float64, [3]geom.Vector) {
+	v := [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+
+	for sweep := 0; sweep < 50; sweep++ {
+		off := a[0][1]*a[0][1] + a[0][2]*a[0][2] + a[1][2]*a[1][2]
+		diagonal := a[0][0]*a[0][0] + a[1][1]*a[1][1] + a[2][2]*a[2][2]
+		if off <= 1e-32*diagonal {
+			break
+		}
+
+		for p := 0; p < 2; p++ {
+			for q := p + 1; q < 3; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+
+				// The rotation in the pq plane which zeroes a[p][q]
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := 0; k < 3; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+				}
+				for k := 0; k < 3; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+				}
+				for k := 0; k < 3; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p], v[k][q] = c*vkp-s*vkq, s*vkp+c*vkq
+				}
+			}
+		}
+	}
+
+	var vectors [3]geom.Vector
+	for i := 0; i < 3; i++ {
+		vectors[i] = geom.NewVector(v[0][i], v[1][i], v[2][i])
+	}
+	return [3]float64{a[0][0], a[1][1], a[2][2]}, vectors
+}
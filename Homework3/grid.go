@@ -0,0 +1,170 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+const (
+	// gridDensity is the number of cells per primitive a grid aims for.
+	gridDensity = 2
+
+	// gridMaxResolution limits the number of cells along each axis.
+	gridMaxResolution = 128
+)
+
+// Grid is a uniform grid of cells over the bounds of its primitives, each
+// cell listing the primitives overlapping it. Rays step from cell to cell
+// with a 3D-DDA, so queries cost little more than the cells they cross.
+type Grid struct {
+	spatialIndex
+
+	resolution [3]int
+	cellSize   geom.Vector
+
+	// The primitives of cell c are cellItems[cellStart[c]:cellStart[c+1]]
+	cellStart []int
+	cellItems []int
+}
+
+// NewGrid builds a grid over the primitives, choosing the number of cells
+// along each axis so that cells are roughly cubes.
+func NewGrid(primitives []Primitive) *Grid {
+	grid := &Grid{spatialIndex: newSpatialIndex(primitives)}
+	grid.walk = grid.walkCells
+	if len(grid.indexed) == 0 {
+		return grid
+	}
+
+	size := geom.Sub(grid.cellBounds.Max, grid.cellBounds.Min)
+	perUnit := math.Cbrt(gridDensity * float64(len(grid.indexed)) / (size.X * size.Y * size.Z))
+	for axis := 0; axis < 3; axis++ {
+		cells := int(math.Round(component(size, axis) * perUnit))
+		grid.resolution[axis] = clampInt(cells, 1, gridMaxResolution)
+	}
+	grid.cellSize = geom.NewVector(
+		size.X/float64(grid.resolution[0]),
+		size.Y/float64(grid.resolution[1]),
+		size.Z/float64(grid.resolution[2]),
+	)
+
+	// Count the primitives of every cell first, then fill them in
+	cells := grid.resolution[0] * grid.resolution[1] * grid.resolution[2]
+	grid.cellStart = make([]int, cells+1)
+	grid.forEachCell(func(cell, _ int) {
+		grid.cellStart[cell+1]++
+	})
+	for cell := 0; cell < cells; cell++ {
+		grid.cellStart[cell+1] += grid.cellStart[cell]
+	}
+
+	grid.cellItems = make([]int, grid.cellStart[cells])
+	next := append([]int(nil), grid.cellStart[:cells]...)
+	grid.forEachCell(func(cell, i int) {
+		grid.cellItems[next[cell]] = i
+		next[cell]++
+	})
+
+	return grid
+}
+
+// forEachCell calls f for every cell and primitive overlapping it.
+func (grid *Grid) forEachCell(f func(cell, primitive int)) {
+	for _, i := range grid.indexed {
+		box := grid.boxes[i]
+		var lo, hi [3]int
+		for axis := 0; axis < 3; axis++ {
+			lo[axis] = grid.cellOf(axis, component(box.Min, axis))
+			hi[axis] = grid.cellOf(axis, component(box.Max, axis))
+		}
+
+		for z := lo[2]; z <= hi[2]; z++ {
+			for y := lo[1]; y <= hi[1]; y++ {
+				for x := lo[0]; x <= hi[0]; x++ {
+					f(grid.cellIndex([3]int{x, y, z}), i)
+				}
+			}
+		}
+	}
+}
+
+// cellOf returns the coordinate along axis of the cell containing x,
+// clamped to the grid.
+func (grid *Grid) cellOf(axis int, x float64) int {
+	cell := int(math.Floor((x - component(grid.cellBounds.Min, axis)) / component(grid.cellSize, axis)))
+	return clampInt(cell, 0, grid.resolution[axis]-1)
+}
+
+func (grid *Grid) cellIndex(cell [3]int) int {
+	return (cell[2]*grid.resolution[1]+cell[1])*grid.resolution[0] + cell[0]
+}
+
+// walkCells visits the cells the ray crosses in order, as in the algorithm
+// of Amanatides and Woo. It stops once the search distance ends before the
+// next cell.
+func (grid *Grid) walkCells(ray geom.Ray, tMin, tMax float64, visit func(index int, tMax float64) (float64, bool)) {
+	tEnter, tExit, ok := grid.cellBounds.Clip(ray, tMin, tMax)
+	if !ok {
+		return
+	}
+	start := pointAt(ray, tEnter)
+
+	var cell, step [3]int
+	var next, delta [3]float64
+	for axis := 0; axis < 3; axis++ {
+		cell[axis] = grid.cellOf(axis, component(start, axis))
+		o, d := component(ray.Origin, axis), component(ray.Direction, axis)
+		lo, size := component(grid.cellBounds.Min, axis), component(grid.cellSize, axis)
+
+		switch {
+		case d > 0:
+			step[axis] = 1
+			next[axis] = (lo + float64(cell[axis]+1)*size - o) / d
+			delta[axis] = size / d
+		case d < 0:
+			step[axis] = -1
+			next[axis] = (lo + float64(cell[axis])*size - o) / d
+			delta[axis] = -size / d
+		default:
+			next[axis] = math.Inf(1)
+		}
+	}
+
+	for {
+		axis := 0
+		if next[1] < next[axis] {
+			axis = 1
+		}
+		if next[2] < next[axis] {
+			axis = 2
+		}
+		cellExit := next[axis]
+
+		index := grid.cellIndex(cell)
+		for _, i := range grid.cellItems[grid.cellStart[index]:grid.cellStart[index+1]] {
+			var stop bool
+			if tMax, stop = visit(i, tMax); stop {
+				return
+			}
+		}
+
+		if tMax <= cellExit || cellExit > tExit {
+			return
+		}
+		cell[axis] += step[axis]
+		if cell[axis] < 0 || cell[axis] >= grid.resolution[axis] {
+			return
+		}
+		next[axis] += delta[axis]
+	}
+}
+
+func clampInt(x, lo, hi int) int {
+	if x < lo {
+		return lo
+	}
+	if x > hi {
+		return hi
+	}
+	return x
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+)
+
+// Hit describes where a ray meets a primitive.
+type Hit struct {
+	// T is the ray parameter of the hit, i.e. Point = Origin + T*Direction.
+	T float64
+
+	// Point is the world-space position of the hit.
+	Point geom.Vector
+
+	// Normal is the unit geometric normal of the surface at Point. It is not
+	// flipped towards the ray.
+	Normal geom.Vector
+
+	// U and V are the surface coordinates of the hit. Triangles report
+	// barycentric coordinates (the weights of b and c), quads report
+	// coordinates in which a, b, c, d map to (0,0), (1,0), (1,1), (0,1)
+	// and spheres report longitude and latitude mapped to [0, 1]. Other
+	// primitives document their own coordinates.
+	U, V float64
+
+	// Primitive is the primitive that was hit.
+	Primitive geom.Intersectable
+}
+
+// Hittable is a primitive which can also tell where a ray hits it.
+type Hittable interface {
+	geom.Intersectable
+
+	// ClosestHit returns the nearest hit along the ray, if there is one.
+	ClosestHit(ray geom.Ray) (Hit, bool)
+}
+
+// candidate is a crossing of a ray with one part of the surface of a shape,
+// like the side or a cap of a cylinder.
+type candidate struct {
+	t    float64
+	part int
+}
+
+// candidates holds the crossings of a ray with a shape in any order.
+type candidates struct {
+	items [4]candidate
+	n     int
+}
+
+func (c *candidates) add(t float64, part int) {
+	if c.n < len(c.items) {
+		c.items[c.n] = candidate{t: t, part: part}
+		c.n++
+	}
+}
+
+// nearest returns the crossing with the smallest parameter between tMin and
+// tMax inclusive.
+func (c *candidates) nearest(tMin, tMax float64) (candidate, bool) {
+	best, found := candidate{}, false
+	for _, item := range c.items[:c.n] {
+		if item.t >= tMin && item.t <= tMax && (!found || item.t < best.t) {
+			best, found = item, true
+		}
+	}
+	return best, found
+}
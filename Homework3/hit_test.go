@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func vectorsAlmostEqual(a, b geom.Vector) bool {
+	return almostEqual(a.X, b.X) && almostEqual(a.Y, b.Y) && almostEqual(a.Z, b.Z)
+}
+
+func TestTriangleClosestHit(t *testing.T) {
+	var prim Hittable
+
+	a, b, c := geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0), geom.NewVector(0, 1, 0)
+	prim = NewTriangle(a, b, c)
+	ray := geom.NewRay(geom.NewVector(0, 0, -1), geom.NewVector(0, 0, 1))
+
+	hit, ok := prim.ClosestHit(ray)
+	if !ok {
+		t.Fatalf("Expected ray %#v to hit triangle %#v but it did not.", ray, prim)
+	}
+
+	if !almostEqual(hit.T, 1) {
+		t.Errorf("Expected hit distance 1, got %v", hit.T)
+	}
+	if !vectorsAlmostEqual(hit.Point, geom.NewVector(0, 0, 0)) {
+		t.Errorf("Expected hit point at the origin, got %#v", hit.Point)
+	}
+	if !vectorsAlmostEqual(hit.Normal, geom.NewVector(0, 0, 1)) {
+		t.Errorf("Expected normal (0, 0, 1), got %#v", hit.Normal)
+	}
+	if !almostEqual(hit.U, 0.25) || !almostEqual(hit.V, 0.5) {
+		t.Errorf("Expected barycentric coordinates (0.25, 0.5), got (%v, %v)", hit.U, hit.V)
+	}
+	if hit.Primitive != prim {
+		t.Errorf("Expected hit primitive %#v, got %#v", prim, hit.Primitive)
+	}
+}
+
+func TestTriangleClosestHitMiss(t *testing.T) {
+	a, b, c := geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0), geom.NewVector(0, 1, 0)
+	prim := NewTriangle(a, b, c)
+	ray := geom.NewRay(geom.NewVector(0, 0, 1), geom.NewVector(0, 0, 1))
+
+	if hit, ok := prim.ClosestHit(ray); ok {
+		t.Errorf("Expected ray %#v to miss triangle %#v but got %#v.", ray, prim, hit)
+	}
+}
+
+func TestQuadClosestHit(t *testing.T) {
+	a, b, c, d := geom.NewVector(0, 0, 0), geom.NewVector(2, 0, 0), geom.NewVector(2, 2, 0), geom.NewVector(0, 2, 0)
+	prim := NewQuad(a, b, c, d)
+
+	cases := []struct {
+		x, y float64
+		u, v float64
+	}{
+		{0.5, 0.5, 0.25, 0.25},
+		{1.5, 0.5, 0.75, 0.25},
+		{1.5, 1.5, 0.75, 0.75},
+		{0.5, 1.5, 0.25, 0.75},
+	}
+
+	for _, tc := range cases {
+		ray := geom.NewRay(geom.NewVector(tc.x, tc.y, 4), geom.NewVector(0, 0, -2))
+
+		hit, ok := prim.ClosestHit(ray)
+		if !ok {
+			t.Errorf("Expected ray %#v to hit quad %#v but it did not.", ray, prim)
+			continue
+		}
+
+		if !almostEqual(hit.T, 2) {
+			t.Errorf("Expected hit distance 2, got %v", hit.T)
+		}
+		if !vectorsAlmostEqual(hit.Point, geom.NewVector(tc.x, tc.y, 0)) {
+			t.Errorf("Expected hit point (%v, %v, 0), got %#v", tc.x, tc.y, hit.Point)
+		}
+		if !almostEqual(math.Abs(hit.Normal.Z), 1) {
+			t.Errorf("Expected normal along the Z axis, got %#v", hit.Normal)
+		}
+		if !almostEqual(hit.U, tc.u) || !almostEqual(hit.V, tc.v) {
+			t.Errorf("Expected coordinates (%v, %v), got (%v, %v)", tc.u, tc.v, hit.U, hit.V)
+		}
+		if hit.Primitive != geom.Intersectable(prim) {
+			t.Errorf("Expected hit primitive %#v, got %#v", prim, hit.Primitive)
+		}
+	}
+}
+
+func TestSphereClosestHit(t *testing.T) {
+	prim := NewSphere(geom.NewVector(0, 0, 0), 2)
+	ray := geom.NewRay(geom.NewVector(0, 0, 5), geom.NewVector(0, 0, -1))
+
+	hit, ok := prim.ClosestHit(ray)
+	if !ok {
+		t.Fatalf("Expected ray %#v to hit sphere %#v but it did not.", ray, prim)
+	}
+
+	if !almostEqual(hit.T, 3) {
+		t.Errorf("Expected hit distance 3, got %v", hit.T)
+	}
+	if !vectorsAlmostEqual(hit.Point, geom.NewVector(0, 0, 2)) {
+		t.Errorf("Expected hit point (0, 0, 2), got %#v", hit.Point)
+	}
+	if !vectorsAlmostEqual(hit.Normal, geom.NewVector(0, 0, 1)) {
+		t.Errorf("Expected normal (0, 0, 1), got %#v", hit.Normal)
+	}
+	if !almostEqual(hit.V, 0.5) {
+		t.Errorf("Expected a point on the equator, got latitude %v", hit.V)
+	}
+}
+
+func TestSphereClosestHitFromInside(t *testing.T) {
+	prim := NewSphere(geom.NewVector(0, 0, 0), 2)
+	ray := geom.NewRay(geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0))
+
+	hit, ok := prim.ClosestHit(ray)
+	if !ok {
+		t.Fatalf("Expected ray %#v to hit sphere %#v but it did not.", ray, prim)
+	}
+
+	if !almostEqual(hit.T, 2) {
+		t.Errorf("Expected hit distance 2, got %v", hit.T)
+	}
+	if !vectorsAlmostEqual(hit.Normal, geom.NewVector(1, 0, 0)) {
+		t.Errorf("Expected normal (1, 0, 0), got %#v", hit.Normal)
+	}
+}
+
+func TestSphereClosestHitBehind(t *testing.T) {
+	prim := NewSphere(geom.NewVector(0, 0, 0), 2)
+	ray := geom.NewRay(geom.NewVector(0, 0, 2.5), geom.NewVector(0, 0, 3.5))
+
+	if hit, ok := prim.ClosestHit(ray); ok {
+		t.Errorf("Expected ray %#v to miss sphere %#v but got %#v.", ray, prim, hit)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"math/rand"
+)
+
+// Material decides where light goes after it hits a surface. PathTrace uses
+// the materials of objects while Render only uses their colors.
+type Material interface {
+	// Scatter picks the ray along which light arriving along in leaves the
+	// surface and returns it with the fraction of the light it carries, or
+	// false if the light is absorbed.
+	Scatter(in geom.Ray, hit Hit, rng *rand.Rand) (out geom.Ray, attenuation Color, ok bool)
+
+	// Emitted returns the light the surface gives off by itself.
+	Emitted() Color
+}
+
+// Diffuse is a matte surface which scatters light equally in all
+// directions. It is the material of objects which do not have one.
+type Diffuse struct {
+	Albedo Color
+}
+
+// Metal reflects light like a mirror. Fuzz between 0 and 1 blurs the
+// reflection.
+type Metal struct {
+	Albedo Color
+	Fuzz   float64
+}
+
+// Dielectric is a clear material like glass or water which reflects part of
+// the light and refracts the rest. IOR is its index of refraction.
+type Dielectric struct {
+	IOR float64
+}
+
+// Emissive is a light source shaped like the object. It absorbs all light
+// falling on it.
+type Emissive struct {
+	Emission Color
+}
+
+func (diffuse Diffuse) Scatter(in geom.Ray, hit Hit, rng *rand.Rand) (geom.Ray, Color, bool) {
+	// Sampling proportionally to the cosine cancels it out of the estimate
+	normal := towards(hit.Normal, in.Direction)
+	u, v := planeBasis(normal)
+	r, phi := math.Sqrt(rng.Float64()), 2*math.Pi*rng.Float64()
+	z := math.Sqrt(math.Max(0, 1-r*r))
+	direction := geom.Add(geom.Add(scale(u, r*math.Cos(phi)), scale(v, r*math.Sin(phi))), scale(normal, z))
+
+	return geom.NewRay(geom.Add(hit.Point, scale(normal, shadowBias)), direction), diffuse.Albedo, true
+}
+
+func (Diffuse) Emitted() Color {
+	return Color{}
+}
+
+func (metal Metal) Scatter(in geom.Ray, hit Hit, rng *rand.Rand) (geom.Ray, Color, bool) {
+	normal := towards(hit.Normal, in.Direction)
+	direction := reflect(normalize(in.Direction), normal)
+	if metal.Fuzz > 0 {
+		direction = geom.Add(direction, scale(randomInUnitSphere(rng), metal.Fuzz))
+	}
+	if geom.Dot(direction, normal) <= 0 {
+		return geom.Ray{}, Color{}, false
+	}
+
+	return geom.NewRay(geom.Add(hit.Point, scale(normal, shadowBias)), direction), metal.Albedo, true
+}
+
+func (Metal) Emitted() Color {
+	return Color{}
+}
+
+func (dielectric Dielectric) Scatter(in geom.Ray, hit Hit, rng *rand.Rand) (geom.Ray, Color, bool) {
+	direction := normalize(in.Direction)
+
+	// The normal points outwards, so a ray along it leaves the material
+	normal, ratio := hit.Normal, 1/dielectric.IOR
+	if geom.Dot(direction, normal) > 0 {
+		normal, ratio = scale(normal, -1), dielectric.IOR
+	}
+
+	cosine := math.Min(-geom.Dot(direction, normal), 1)
+	sine := math.Sqrt(1 - cosine*cosine)
+	white := Color{R: 1, G: 1, B: 1}
+
+	if ratio*sine > 1 || schlick(cosine, ratio) > rng.Float64() {
+		return geom.NewRay(geom.Add(hit.Point, scale(normal, shadowBias)), reflect(direction, normal)), white, true
+	}
+
+	perpendicular := scale(geom.Add(direction, scale(normal, cosine)), ratio)
+	parallel := scale(normal, -math.Sqrt(math.Abs(1-geom.Dot(perpendicular, perpendicular))))
+	return geom.NewRay(geom.Add(hit.Point, scale(normal, -shadowBias)), geom.Add(perpendicular, parallel)), white, true
+}
+
+func (Dielectric) Emitted() Color {
+	return Color{}
+}
+
+func (Emissive) Scatter(geom.Ray, Hit, *rand.Rand) (geom.Ray, Color, bool) {
+	return geom.Ray{}, Color{}, false
+}
+
+func (emissive Emissive) Emitted() Color {
+	return emissive.Emission
+}
+
+// material returns the material of the object, which is diffuse with the
+// color of the object unless it has one.
+func (object *Object) material() Material {
+	if object.Material == nil {
+		return Diffuse{Albedo: object.Color}
+	}
+	return object.Material
+}
+
+// towards returns the normal flipped if needed to the side of the surface
+// which a ray along direction comes from.
+func towards(normal, direction geom.Vector) geom.Vector {
+	if geom.Dot(normal, direction) > 0 {
+		return scale(normal, -1)
+	}
+	return normal
+}
+
+// reflect mirrors direction over the surface with the given unit normal.
+func reflect(direction, normal geom.Vector) geom.Vector {
+	return geom.Sub(direction, scale(normal, 2*geom.Dot(direction, normal)))
+}
+
+// schlick approximates the fraction of light reflected by a dielectric at
+// the given cosine of the angle of incidence and ratio of refraction indices.
+func schlick(cosine, ratio float64) float64 {
+	r0 := (1 - ratio) / (1 + ratio)
+	r0 *= r0
+	return r0 + (1-r0)*math.Pow(1-cosine, 5)
+}
+
+func randomInUnitSphere(rng *rand.Rand) geom.Vector {
+	for {
+		v := geom.NewVector(2*rng.Float64()-1, 2*rng.Float64()-1, 2*rng.Float64()-1)
+		if geom.Dot(v, v) < 1 {
+			return v
+		}
+	}
+}
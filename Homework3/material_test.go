@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+// floorHit is a hit on the plane y = 0 seen from above.
+var floorHit = Hit{T: 1, Point: geom.Vector{}, Normal: geom.NewVector(0, 1, 0)}
+
+func TestDiffuseScatter(t *testing.T) {
+	rng := rand.New(rand.NewSource(21))
+	diffuse := Diffuse{Albedo: Color{R: 0.5, G: 0.5, B: 0.5}}
+
+	// Light scatters back to the side of the surface it came from
+	for _, incoming := range []geom.Vector{geom.NewVector(1, -1, 0), geom.NewVector(0, 1, 0)} {
+		sum := 0.0
+		for i := 0; i < 10000; i++ {
+			out, attenuation, ok := diffuse.Scatter(geom.NewRay(geom.Sub(geom.Vector{}, incoming), incoming), floorHit, rng)
+			if !ok || attenuation != diffuse.Albedo {
+				t.Fatalf("Expected diffuse surfaces to always scatter with their albedo")
+			}
+			if out.Direction.Y*incoming.Y >= 0 || out.Origin.Y*incoming.Y >= 0 {
+				t.Fatalf("Expected ray along %#v to scatter back, got %#v", incoming, out)
+			}
+			sum += math.Abs(out.Direction.Y) / length(out.Direction)
+		}
+
+		// The mean cosine of cosine weighted directions is 2/3
+		if mean := sum / 10000; math.Abs(mean-2.0/3) > 0.01 {
+			t.Errorf("Expected the mean cosine of scattered rays to be 2/3, got %v", mean)
+		}
+	}
+}
+
+func TestMetalScatter(t *testing.T) {
+	rng := rand.New(rand.NewSource(21))
+	in := geom.NewRay(geom.NewVector(-1, 1, 0), geom.NewVector(1, -1, 0))
+
+	out, attenuation, ok := Metal{Albedo: Color{R: 0.9}}.Scatter(in, floorHit, rng)
+	if !ok || attenuation != (Color{R: 0.9}) || !vectorsAlmostEqual(normalize(out.Direction), normalize(geom.NewVector(1, 1, 0))) {
+		t.Errorf("Expected a mirror reflection to (1, 1, 0), got %#v", out.Direction)
+	}
+
+	// Fuzzy reflections of grazing rays sometimes go into the surface
+	grazing := geom.NewRay(geom.NewVector(-1, 0.01, 0), geom.NewVector(1, -0.01, 0))
+	absorbed := 0
+	for i := 0; i < 1000; i++ {
+		out, _, ok := Metal{Albedo: Color{R: 1}, Fuzz: 0.5}.Scatter(grazing, floorHit, rng)
+		if !ok {
+			absorbed++
+		} else if out.Direction.Y <= 0 {
+			t.Fatalf("Expected reflected rays to leave the surface, got %#v", out.Direction)
+		}
+	}
+	if absorbed == 0 || absorbed == 1000 {
+		t.Errorf("Expected some grazing rays to be absorbed by fuzzy metal, got %d of 1000", absorbed)
+	}
+}
+
+func TestDielectricScatter(t *testing.T) {
+	rng := rand.New(rand.NewSource(21))
+
+	// Matching indices pass light straight through
+	in := geom.NewRay(geom.NewVector(-1, 1, 0), geom.NewVector(1, -2, 0))
+	out, _, ok := Dielectric{IOR: 1}.Scatter(in, floorHit, rng)
+	if !ok || !vectorsAlmostEqual(normalize(out.Direction), normalize(in.Direction)) || out.Origin.Y >= 0 {
+		t.Errorf("Expected light to pass into the material undeviated, got %#v", out)
+	}
+
+	// About 4% of the light falling straight on glass is reflected
+	down := geom.NewRay(geom.NewVector(0, 1, 0), geom.NewVector(0, -1, 0))
+	reflected := 0
+	for i := 0; i < 10000; i++ {
+		out, _, _ := Dielectric{IOR: 1.5}.Scatter(down, floorHit, rng)
+		if out.Direction.Y > 0 {
+			reflected++
+		}
+	}
+	if reflected < 300 || reflected > 500 {
+		t.Errorf("Expected about 400 of 10000 rays to be reflected, got %d", reflected)
+	}
+
+	// Snell's law bends a ray at 45 degrees to asin(sin(45) / 1.5)
+	bent := 0
+	for i := 0; i < 100; i++ {
+		out, _, _ := Dielectric{IOR: 1.5}.Scatter(geom.NewRay(geom.NewVector(-1, 1, 0), geom.NewVector(1, -1, 0)), floorHit, rng)
+		if out.Direction.Y > 0 {
+			continue
+		}
+		bent++
+		if sine := out.Direction.X / length(out.Direction); !almostEqual(sine, math.Sqrt(0.5)/1.5) {
+			t.Errorf("Expected the refracted ray to have a sine of %v, got %v", math.Sqrt(0.5)/1.5, sine)
+		}
+	}
+	if bent == 0 {
+		t.Errorf("Expected rays to be refracted")
+	}
+
+	// Leaving glass at a grazing angle all light is reflected
+	for i := 0; i < 100; i++ {
+		out, _, _ := Dielectric{IOR: 1.5}.Scatter(geom.NewRay(geom.NewVector(-1, -0.1, 0), geom.NewVector(1, 0.1, 0)), floorHit, rng)
+		if out.Direction.Y >= 0 || out.Origin.Y >= 0 {
+			t.Fatalf("Expected total internal reflection, got %#v", out)
+		}
+	}
+}
+
+func TestEmissive(t *testing.T) {
+	light := Emissive{Emission: Color{R: 4, G: 4, B: 4}}
+	if _, _, ok := light.Scatter(geom.NewRay(geom.NewVector(0, 1, 0), geom.NewVector(0, -1, 0)), floorHit, nil); ok {
+		t.Errorf("Expected emissive surfaces to absorb light")
+	}
+	if light.Emitted() != light.Emission || (Diffuse{}).Emitted() != (Color{}) {
+		t.Errorf("Expected only emissive surfaces to emit light")
+	}
+
+	object := Object{Color: Color{R: 1}}
+	if object.material() != (Diffuse{Albedo: Color{R: 1}}) {
+		t.Errorf("Expected objects without a material to be diffuse, got %#v", object.material())
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+// Mesh is a set of polygonal faces sharing a common list of vertices, as
+// loaded from a model file. It is intersected through a BVH over its faces.
+type Mesh struct {
+	Vertices  []geom.Vector
+	Normals   []geom.Vector
+	TexCoords [][2]float64
+	Faces     []Face
+
+	primitives []Primitive
+	bvh        *BVH
+}
+
+// Face is a polygon of a mesh. Its fields hold indices into the attribute
+// lists of the mesh. Normals and TexCoords are either empty or as long as
+// Vertices.
+type Face struct {
+	Vertices  []int
+	Normals   []int
+	TexCoords []int
+	Groups    []string
+}
+
+// ParseError reports a malformed line of a model file.
+type ParseError struct {
+	Format  string
+	Line    int
+	Message string
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("%s: line %d: %s", err.Format, err.Line, err.Message)
+}
+
+// build turns the faces into primitives. Triangles and quads map directly to
+// Triangle and Quad, larger faces are triangulated.
+func (mesh *Mesh) build() {
+	mesh.primitives = make([]Primitive, 0, len(mesh.Faces))
+
+	for _, face := range mesh.Faces {
+		vertices := make([]geom.Vector, len(face.Vertices))
+		for i, index := range face.Vertices {
+			vertices[i] = mesh.Vertices[index]
+		}
+
+		switch len(vertices) {
+		case 3:
+			mesh.primitives = append(mesh.primitives, NewTriangle(vertices[0], vertices[1], vertices[2]))
+		case 4:
+			mesh.primitives = append(mesh.primitives, NewQuad(vertices[0], vertices[1], vertices[2], vertices[3]))
+		default:
+			if polygon, err := NewPolygon(vertices); err == nil {
+				for _, triangle := range polygon.Triangles() {
+					mesh.primitives = append(mesh.primitives, triangle)
+				}
+				continue
+			}
+
+			// Faces which are not planar or not simple are split into a fan
+			for i := 1; i+1 < len(vertices); i++ {
+				mesh.primitives = append(mesh.primitives, NewTriangle(vertices[0], vertices[i], vertices[i+1]))
+			}
+		}
+	}
+
+	mesh.bvh = NewBVH(mesh.primitives)
+}
+
+// Primitives returns the triangles and quads the mesh is made of.
+func (mesh *Mesh) Primitives() []Primitive {
+	return mesh.primitives
+}
+
+func (mesh *Mesh) Intersect(ray geom.Ray) bool {
+	return mesh.bvh.Intersect(ray)
+}
+
+// ClosestHit returns the nearest hit with a face of the mesh. The primitive
+// of the hit is the Triangle or Quad which was hit.
+func (mesh *Mesh) ClosestHit(ray geom.Ray) (Hit, bool) {
+	return mesh.bvh.ClosestHit(ray)
+}
+
+func (mesh *Mesh) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	return mesh.bvh.IntersectSegment(ray, tMin, tMax)
+}
+
+func (mesh *Mesh) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	return mesh.bvh.ClosestHitSegment(ray, tMin, tMax)
+}
+
+func (mesh *Mesh) Bounds() AABB {
+	return mesh.bvh.Bounds()
+}
+
+// Triangles returns the mesh as triangles only, splitting its quads into
+// triangles wound like them.
+func (mesh *Mesh) Triangles() []Triangle {
+	triangles := make([]Triangle, 0, len(mesh.primitives))
+	for _, primitive := range mesh.primitives {
+		switch primitive := primitive.(type) {
+		case Triangle:
+			triangles = append(triangles, primitive)
+		case Quad:
+			facing := primitive.facingTriangles()
+			triangles = append(triangles, facing[0], facing[1])
+		}
+	}
+	return triangles
+}
+
+// NewMesh returns a mesh of the given vertices and faces indexing them.
+func NewMesh(vertices []geom.Vector, faces []Face) (*Mesh, error) {
+	mesh := &Mesh{Vertices: vertices, Faces: faces}
+	if err := mesh.checkReferences(); err != nil {
+		return nil, err
+	}
+
+	mesh.build()
+	return mesh, nil
+}
+
+// Validate checks that the faces reference existing attributes and that no
+// vertex or face is degenerate.
+func (mesh *Mesh) Validate() error {
+	for i, vertex := range mesh.Vertices {
+		if !finite(vertex) {
+			return fmt.Errorf("vertex %d is not finite", i)
+		}
+	}
+
+	if err := mesh.checkReferences(); err != nil {
+		return err
+	}
+
+	for i, face := range mesh.Faces {
+		vertices := make([]geom.Vector, len(face.Vertices))
+		for j, index := range face.Vertices {
+			vertices[j] = mesh.Vertices[index]
+		}
+		if newellNormal(vertices) == (geom.Vector{}) {
+			return fmt.Errorf("face %d has no area", i)
+		}
+	}
+
+	return nil
+}
+
+// checkReferences checks that every index of every face is in range.
+func (mesh *Mesh) checkReferences() error {
+	for i, face := range mesh.Faces {
+		if len(face.Vertices) < 3 {
+			return fmt.Errorf("face %d has %d vertices", i, len(face.Vertices))
+		}
+		if len(face.Normals) != 0 && len(face.Normals) != len(face.Vertices) {
+			return fmt.Errorf("face %d has %d normals for %d vertices", i, len(face.Normals), len(face.Vertices))
+		}
+		if len(face.TexCoords) != 0 && len(face.TexCoords) != len(face.Vertices) {
+			return fmt.Errorf("face %d has %d texture coordinates for %d vertices", i, len(face.TexCoords), len(face.Vertices))
+		}
+
+		for _, refs := range []struct {
+			indices []int
+			count   int
+			kind    string
+		}{
+			{face.Vertices, len(mesh.Vertices), "vertex"},
+			{face.Normals, len(mesh.Normals), "normal"},
+			{face.TexCoords, len(mesh.TexCoords), "texture coordinate"},
+		} {
+			for _, index := range refs.indices {
+				if index < 0 || index >= refs.count {
+					return fmt.Errorf("face %d references %s %d, there are %d", i, refs.kind, index, refs.count)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func finite(v geom.Vector) bool {
+	for _, x := range [3]float64{v.X, v.Y, v.Z} {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return false
+		}
+	}
+	return true
+}
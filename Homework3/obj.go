@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/fmi/go-homework/geom"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LoadOBJ reads a Wavefront OBJ file.
+func LoadOBJ(path string) (*Mesh, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseOBJ(file)
+}
+
+// ParseOBJ reads the geometry of a Wavefront OBJ model: vertices, normals,
+// texture coordinates, faces and groups. Statements concerning materials,
+// smoothing, lines and the like are skipped.
+func ParseOBJ(r io.Reader) (*Mesh, error) {
+	mesh := &Mesh{}
+	groups := []string{"default"}
+
+	scanner := bufio.NewScanner(r)
+	line, statement := 0, ""
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+
+		// A trailing backslash joins the next line to this one
+		if strings.HasSuffix(text, "\\") {
+			statement += strings.TrimSuffix(text, "\\") + " "
+			continue
+		}
+		statement += text
+
+		if i := strings.IndexByte(statement, '#'); i >= 0 {
+			statement = statement[:i]
+		}
+		fields := strings.Fields(statement)
+		statement = ""
+		if len(fields) == 0 {
+			continue
+		}
+
+		fail := func(format string, args ...interface{}) error {
+			return &ParseError{Format: "obj", Line: line, Message: fmt.Sprintf(format, args...)}
+		}
+
+		switch keyword, args := fields[0], fields[1:]; keyword {
+		case "v":
+			if len(args) < 3 || len(args) > 4 {
+				return nil, fail("vertex needs 3 coordinates, got %d", len(args))
+			}
+			values, err := parseFloats(args[:3])
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			mesh.Vertices = append(mesh.Vertices, geom.NewVector(values[0], values[1], values[2]))
+
+		case "vn":
+			if len(args) != 3 {
+				return nil, fail("normal needs 3 coordinates, got %d", len(args))
+			}
+			values, err := parseFloats(args)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			mesh.Normals = append(mesh.Normals, geom.NewVector(values[0], values[1], values[2]))
+
+		case "vt":
+			if len(args) < 1 || len(args) > 3 {
+				return nil, fail("texture coordinate needs 1 to 3 values, got %d", len(args))
+			}
+			values, err := parseFloats(args)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			values = append(values, 0)
+			mesh.TexCoords = append(mesh.TexCoords, [2]float64{values[0], values[1]})
+
+		case "f":
+			if len(args) < 3 {
+				return nil, fail("face needs at least 3 vertices, got %d", len(args))
+			}
+			face, err := parseOBJFace(mesh, args)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			face.Groups = groups
+			mesh.Faces = append(mesh.Faces, face)
+
+		case "g":
+			if len(args) == 0 {
+				groups = []string{"default"}
+			} else {
+				groups = args
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	mesh.build()
+	return mesh, nil
+}
+
+func parseFloats(fields []string) ([]float64, error) {
+	values := make([]float64, len(fields))
+	for i, field := range fields {
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", field)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// parseOBJFace parses the v, v/vt, v//vn or v/vt/vn references of a face.
+// All of them have to use the same form.
+func parseOBJFace(mesh *Mesh, args []string) (Face, error) {
+	var face Face
+	parts := -1
+
+	for _, arg := range args {
+		refs := strings.Split(arg, "/")
+		if len(refs) > 3 {
+			return Face{}, fmt.Errorf("invalid face vertex %q", arg)
+		}
+
+		form := len(refs)
+		if form == 3 && refs[1] == "" {
+			form = 4 // v//vn
+		}
+		if parts >= 0 && form != parts {
+			return Face{}, fmt.Errorf("face vertex %q does not match the form of the others", arg)
+		}
+		parts = form
+
+		index, err := resolveOBJIndex(refs[0], len(mesh.Vertices), "vertex")
+		if err != nil {
+			return Face{}, err
+		}
+		face.Vertices = append(face.Vertices, index)
+
+		if len(refs) > 1 && refs[1] != "" {
+			index, err := resolveOBJIndex(refs[1], len(mesh.TexCoords), "texture coordinate")
+			if err != nil {
+				return Face{}, err
+			}
+			face.TexCoords = append(face.TexCoords, index)
+		}
+
+		if len(refs) > 2 {
+			index, err := resolveOBJIndex(refs[2], len(mesh.Normals), "normal")
+			if err != nil {
+				return Face{}, err
+			}
+			face.Normals = append(face.Normals, index)
+		}
+	}
+
+	return face, nil
+}
+
+// resolveOBJIndex turns a one-based or negative, relative to the end, OBJ
+// index into a zero-based one.
+func resolveOBJIndex(field string, count int, kind string) (int, error) {
+	index, err := strconv.Atoi(field)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s index %q", kind, field)
+	}
+
+	if index < 0 {
+		index += count
+	} else {
+		index--
+	}
+
+	if index < 0 || index >= count {
+		return 0, fmt.Errorf("%s index %s out of range, there are %d", kind, field, count)
+	}
+
+	return index, nil
+}
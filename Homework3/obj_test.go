@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+const cubeOBJ = `# A unit cube made of quads
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+v 0 0 1
+v 1 0 1
+v 1 1 1
+v 0 1 1
+vt 0 0
+vt 1 0
+vt 1 1
+vt 0 1
+vn 0 0 -1
+vn 0 0 1
+g bottom top
+f 1/1/1 4/4/1 3/3/1 2/2/1
+f 5/1/2 6/2/2 7/3/2 8/4/2
+g sides
+f 1//1 2//1 6//1 5//1
+f 2 3 7 6
+f -5 -1 -2 -6
+f 4 1 5 \
+  8
+`
+
+func TestParseOBJCube(t *testing.T) {
+	var prim geom.Intersectable
+
+	mesh, err := ParseOBJ(strings.NewReader(cubeOBJ))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	prim = mesh
+
+	if len(mesh.Vertices) != 8 || len(mesh.TexCoords) != 4 || len(mesh.Normals) != 2 {
+		t.Errorf("Expected 8 vertices, 4 texture coordinates and 2 normals, got %d, %d and %d",
+			len(mesh.Vertices), len(mesh.TexCoords), len(mesh.Normals))
+	}
+	if len(mesh.Faces) != 6 {
+		t.Fatalf("Expected 6 faces, got %d", len(mesh.Faces))
+	}
+
+	for _, primitive := range mesh.Primitives() {
+		if _, ok := primitive.(Quad); !ok {
+			t.Errorf("Expected every face to be a quad, got %#v", primitive)
+		}
+	}
+
+	if face := mesh.Faces[0]; len(face.TexCoords) != 4 || len(face.Normals) != 4 || face.TexCoords[2] != 2 {
+		t.Errorf("Expected the first face to reference texture coordinates and normals, got %#v", face)
+	}
+	if face := mesh.Faces[2]; len(face.TexCoords) != 0 || len(face.Normals) != 4 {
+		t.Errorf("Expected the third face to reference only normals, got %#v", face)
+	}
+	if groups := mesh.Faces[1].Groups; len(groups) != 2 || groups[0] != "bottom" || groups[1] != "top" {
+		t.Errorf("Expected the second face to be in groups bottom and top, got %v", groups)
+	}
+	if groups := mesh.Faces[5].Groups; len(groups) != 1 || groups[0] != "sides" {
+		t.Errorf("Expected the last face to be in group sides, got %v", groups)
+	}
+
+	// Negative indices count back from the last vertex
+	if face := mesh.Faces[4]; face.Vertices[0] != 3 || face.Vertices[1] != 7 || face.Vertices[3] != 2 {
+		t.Errorf("Expected negative indices to resolve to 3, 7, 6, 2, got %v", face.Vertices)
+	}
+
+	ray := geom.NewRay(geom.NewVector(0.5, 0.5, -1), geom.NewVector(0, 0, 1))
+	if !prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect the cube but it did not.", ray)
+	}
+	if hit, ok := mesh.ClosestHit(ray); !ok || !almostEqual(hit.T, 1) {
+		t.Errorf("Expected ray %#v to hit the cube at 1, got %v at %v", ray, ok, hit.T)
+	}
+	if bounds := mesh.Bounds(); bounds.Min != geom.NewVector(0, 0, 0) || bounds.Max != geom.NewVector(1, 1, 1) {
+		t.Errorf("Expected unit bounds, got %#v", bounds)
+	}
+}
+
+func TestParseOBJPolygonFace(t *testing.T) {
+	source := `
+v 0 0 0
+v 4 0 0
+v 4 4 0
+v 2 1 0
+v 0 4 0
+f 1 2 3 4 5
+`
+	mesh, err := ParseOBJ(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(mesh.Primitives()) != 3 {
+		t.Fatalf("Expected the pentagon to be split into 3 triangles, got %d primitives", len(mesh.Primitives()))
+	}
+
+	if ray := geom.NewRay(geom.NewVector(2, 3, 1), geom.NewVector(0, 0, -1)); mesh.Intersect(ray) {
+		t.Errorf("Expected ray %#v to pass through the notch of the face", ray)
+	}
+	if ray := geom.NewRay(geom.NewVector(2, 0.5, 1), geom.NewVector(0, 0, -1)); !mesh.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect the face", ray)
+	}
+}
+
+func TestParseOBJErrors(t *testing.T) {
+	cases := []struct {
+		source string
+		line   int
+	}{
+		{"v 0 0 0\nv 1 x 0\n", 2},
+		{"v 0 0\n", 1},
+		{"v 0 0 0\nv 1 0 0\nv 0 1 0\n\nf 1 2 4\n", 5},
+		{"v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2\n", 4},
+		{"v 0 0 0\nv 1 0 0\nv 0 1 0\nf 0 1 2\n", 4},
+		{"v 0 0 0\nv 1 0 0\nv 0 1 0\nf -4 1 2\n", 4},
+		{"v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1/1 2/1 3/1\n", 4},
+		{"v 0 0 0\nv 1 0 0\nv 0 1 0\nvn 0 0 1\nf 1//1 2 3\n", 5},
+		{"# comment\nvn 0 0\n", 2},
+	}
+
+	for _, tc := range cases {
+		_, err := ParseOBJ(strings.NewReader(tc.source))
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("Expected a parse error for %q, got %v", tc.source, err)
+			continue
+		}
+		if parseErr.Line != tc.line {
+			t.Errorf("Expected the error for %q to be on line %d, got %v", tc.source, tc.line, parseErr)
+		}
+	}
+}
+
+func TestLoadOBJ(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cube.obj")
+	if err := os.WriteFile(path, []byte(cubeOBJ), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mesh, err := LoadOBJ(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(mesh.Faces) != 6 {
+		t.Errorf("Expected 6 faces, got %d", len(mesh.Faces))
+	}
+
+	if _, err := LoadOBJ(filepath.Join(t.TempDir(), "missing.obj")); err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+)
+
+const (
+	// octreeLeafSize is the number of primitives above which a node is split.
+	octreeLeafSize = 8
+
+	// octreeMaxDepth limits how often nodes are split.
+	octreeMaxDepth = 10
+
+	// octreeMaxGrowth is how many times more references to primitives the
+	// octants of a node may hold than the node itself.
+	octreeMaxGrowth = 2
+)
+
+// Octree splits the bounds of its primitives in eight octants, and those
+// holding many primitives again, so that it is fine where primitives are
+// dense and coarse where they are sparse. Primitives overlapping several
+// octants are listed in each of them.
+type Octree struct {
+	spatialIndex
+
+	nodes []octreeNode
+	items []int
+}
+
+// octreeNode is a node of the tree. The eight children of an interior node
+// are stored together starting at children. Leaves have no children and own
+// count items starting at first.
+type octreeNode struct {
+	bounds   AABB
+	children int
+	first    int
+	count    int
+}
+
+func NewOctree(primitives []Primitive) *Octree {
+	octree := &Octree{spatialIndex: newSpatialIndex(primitives)}
+	octree.walk = octree.walkNodes
+	if len(octree.indexed) == 0 {
+		return octree
+	}
+
+	octree.nodes = []octreeNode{{bounds: octree.cellBounds}}
+	octree.build(0, octree.indexed, 0)
+	return octree
+}
+
+// build turns the node into a leaf holding items or splits it.
+func (octree *Octree) build(index int, items []int, depth int) {
+	bounds := octree.nodes[index].bounds
+
+	var octants [8][]int
+	split := len(items) > octreeLeafSize && depth < octreeMaxDepth
+	if split {
+		for octant := range octants {
+			box := octantBounds(bounds, octant)
+			for _, i := range items {
+				if octree.boxes[i].Overlaps(box) {
+					octants[octant] = append(octants[octant], i)
+				}
+			}
+		}
+
+		// Splitting does not pay when most primitives straddle the octants,
+		// as around a vertex many triangles share
+		references := 0
+		for _, octant := range octants {
+			references += len(octant)
+		}
+		split = references <= octreeMaxGrowth*len(items)
+	}
+
+	if !split {
+		octree.nodes[index].first = len(octree.items)
+		octree.nodes[index].count = len(items)
+		octree.items = append(octree.items, items...)
+		return
+	}
+
+	children := len(octree.nodes)
+	octree.nodes[index].children = children
+	for octant := range octants {
+		octree.nodes = append(octree.nodes, octreeNode{bounds: octantBounds(bounds, octant)})
+	}
+	for octant, octantItems := range octants {
+		octree.build(children+octant, octantItems, depth+1)
+	}
+}
+
+// octantBounds returns one eighth of the box. Bit 0 of octant selects the
+// upper half along X, bit 1 along Y and bit 2 along Z.
+func octantBounds(box AABB, octant int) AABB {
+	center := scale(geom.Add(box.Min, box.Max), 0.5)
+	result := AABB{Min: box.Min, Max: center}
+	if octant&1 != 0 {
+		result.Min.X, result.Max.X = center.X, box.Max.X
+	}
+	if octant&2 != 0 {
+		result.Min.Y, result.Max.Y = center.Y, box.Max.Y
+	}
+	if octant&4 != 0 {
+		result.Min.Z, result.Max.Z = center.Z, box.Max.Z
+	}
+	return result
+}
+
+// walkNodes visits the leaves the ray passes through, nearest first.
+func (octree *Octree) walkNodes(ray geom.Ray, tMin, tMax float64, visit func(index int, tMax float64) (float64, bool)) {
+	octree.walkNode(0, ray, tMin, tMax, visit)
+}
+
+// walkNode walks the subtree of a node and returns the search distance at
+// the end and whether the walk was stopped.
+func (octree *Octree) walkNode(index int, ray geom.Ray, tMin, tMax float64, visit func(index int, tMax float64) (float64, bool)) (float64, bool) {
+	node := &octree.nodes[index]
+	if node.children == 0 {
+		for _, i := range octree.items[node.first : node.first+node.count] {
+			var stop bool
+			if tMax, stop = visit(i, tMax); stop {
+				return tMax, true
+			}
+		}
+		return tMax, false
+	}
+
+	// Order the octants the ray passes through by where it enters them
+	type entry struct {
+		t     float64
+		index int
+	}
+	var entries [8]entry
+	n := 0
+	for octant := 0; octant < 8; octant++ {
+		child := node.children + octant
+		t, _, ok := octree.nodes[child].bounds.grow(octree.margin).Clip(ray, tMin, tMax)
+		if !ok {
+			continue
+		}
+		j := n
+		for ; j > 0 && entries[j-1].t > t; j-- {
+			entries[j] = entries[j-1]
+		}
+		entries[j] = entry{t: t, index: child}
+		n++
+	}
+
+	for _, child := range entries[:n] {
+		if child.t > tMax {
+			break
+		}
+		var stop bool
+		if tMax, stop = octree.walkNode(child.index, ray, tMin, tMax, visit); stop {
+			return tMax, true
+		}
+	}
+	return tMax, false
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"github.com/fmi/go-homework/geom"
+	"image"
+	"math"
+	"math/rand"
+)
+
+const (
+	defaultSamples    = 16
+	defaultMinBounces = 3
+
+	// maxSurvival caps the chance of a path to go on after Russian roulette,
+	// so that paths between mirrors or inside glass end too.
+	maxSurvival = 0.95
+)
+
+// PathTraceOptions configure PathTrace.
+type PathTraceOptions struct {
+	RenderOptions
+
+	// Samples is the number of paths traced through every pixel. It
+	// defaults to 16.
+	Samples int
+
+	// MinBounces is the number of bounces a path makes before Russian
+	// roulette may end it. It defaults to 3.
+	MinBounces int
+
+	// Seed selects the random numbers. Renders of a scene with the same
+	// options are identical whatever the number of workers.
+	Seed int64
+}
+
+// PathTrace renders the scene with a Monte Carlo path tracer. Paths start at
+// random points of the pixels and of the camera lens and bounce off the
+// materials of the objects until they leave the scene, are absorbed or are
+// ended by Russian roulette, which does not bias the result. Point lights
+// are sampled at every diffuse bounce, emissive objects are found by chance
+// and the background lights the scene like a sky. The ambient light is not
+// used.
+func (scene *Scene) PathTrace(ctx context.Context, options PathTraceOptions) (*image.RGBA, error) {
+	tracer := &pathTracer{
+		scene:      scene.prepared(),
+		samples:    options.Samples,
+		minBounces: options.MinBounces,
+		seed:       options.Seed,
+	}
+	if tracer.samples <= 0 {
+		tracer.samples = defaultSamples
+	}
+	if tracer.minBounces <= 0 {
+		tracer.minBounces = defaultMinBounces
+	}
+
+	return renderTiles(ctx, options.RenderOptions, tracer.pixel)
+}
+
+type pathTracer struct {
+	scene      *Scene
+	samples    int
+	minBounces int
+	seed       int64
+}
+
+// pixel averages the paths through the pixel. Every pixel has its own
+// random numbers, so it does not matter which worker renders it.
+func (tracer *pathTracer) pixel(x, y, width, height int) Color {
+	rng := rand.New(newPixelSource(tracer.seed, y*width+x))
+
+	var sum Color
+	for i := 0; i < tracer.samples; i++ {
+		ray := tracer.scene.Camera.LensRay(float64(x)+rng.Float64(), float64(y)+rng.Float64(), width, height, rng.Float64(), rng.Float64())
+		sum = sum.add(tracer.radiance(ray, rng))
+	}
+	return sum.scale(1 / float64(tracer.samples))
+}
+
+// radiance estimates the light arriving along the ray.
+func (tracer *pathTracer) radiance(ray geom.Ray, rng *rand.Rand) Color {
+	scene := tracer.scene
+	if ray.Direction == (geom.Vector{}) {
+		return scene.Background
+	}
+
+	throughput := Color{R: 1, G: 1, B: 1}
+	var result Color
+	for bounce := 0; ; bounce++ {
+		hit, object, ok := scene.trace(ray)
+		if !ok {
+			return result.add(throughput.mul(scene.Background))
+		}
+
+		material := scene.Objects[object].material()
+		result = result.add(throughput.mul(material.Emitted()))
+		if diffuse, ok := material.(Diffuse); ok {
+			// A Lambertian surface sends the irradiance back as radiance
+			// albedo/π in every direction
+			brdf := diffuse.Albedo.scale(1 / math.Pi)
+			result = result.add(throughput.mul(brdf).mul(scene.directLight(ray, hit)))
+		}
+
+		out, attenuation, ok := material.Scatter(ray, hit, rng)
+		if !ok {
+			return result
+		}
+		throughput = throughput.mul(attenuation)
+
+		// Paths carrying little light are likely to end, and the ones
+		// which go on carry more to make up for it
+		if bounce+1 >= tracer.minBounces {
+			survival := math.Min(throughput.maxComponent(), maxSurvival)
+			if rng.Float64() >= survival {
+				return result
+			}
+			throughput = throughput.scale(1 / survival)
+		}
+		ray = out
+	}
+}
+
+// pixelSource is a SplitMix64 generator. It is much cheaper to seed than
+// rand.NewSource, which matters when every pixel gets its own.
+type pixelSource struct {
+	state uint64
+}
+
+func newPixelSource(seed int64, pixel int) *pixelSource {
+	source := &pixelSource{state: uint64(pixel)}
+	source.state = source.Uint64() ^ uint64(seed)
+	return source
+}
+
+func (source *pixelSource) Uint64() uint64 {
+	source.state += 0x9e3779b97f4a7c15
+	z := source.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (source *pixelSource) Int63() int64 {
+	return int64(source.Uint64() >> 1)
+}
+
+func (source *pixelSource) Seed(seed int64) {
+	source.state = uint64(seed)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+func TestPathTraceIsReproducible(t *testing.T) {
+	scene := testScene()
+	scene.Objects[0].Material = Metal{Albedo: Color{R: 0.9, G: 0.9, B: 0.9}, Fuzz: 0.2}
+
+	render := func(workers int, seed int64) []byte {
+		img, err := scene.PathTrace(context.Background(), PathTraceOptions{
+			RenderOptions: RenderOptions{Width: 24, Height: 16, TileSize: 5, Workers: workers},
+			Samples:       4,
+			Seed:          seed,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return img.Pix
+	}
+
+	expected := render(1, 7)
+	for _, workers := range []int{2, 5} {
+		if !bytes.Equal(render(workers, 7), expected) {
+			t.Errorf("Expected the image rendered by %d workers to match the one by a single worker", workers)
+		}
+	}
+	if bytes.Equal(render(1, 8), expected) {
+		t.Errorf("Expected another seed to give another image")
+	}
+}
+
+// glowing is a diffuse surface which also emits light.
+type glowing struct {
+	Diffuse
+	emission Color
+}
+
+func (g glowing) Emitted() Color {
+	return g.emission
+}
+
+func TestPathTraceIsUnbiased(t *testing.T) {
+	// Inside a closed surface with albedo a emitting e the light converges
+	// to e / (1 - a), which Russian roulette must not change
+	scene := &Scene{Objects: []Object{{
+		Primitive: NewSphere(geom.Vector{}, 1),
+		Material:  glowing{Diffuse: Diffuse{Albedo: Color{R: 0.75, G: 0.5, B: 0}}, emission: Color{R: 0.2, G: 0.2, B: 0.2}},
+	}}}
+	tracer := &pathTracer{scene: scene, samples: 1, minBounces: 1}
+	rng := rand.New(rand.NewSource(21))
+
+	var sum Color
+	const samples = 20000
+	for i := 0; i < samples; i++ {
+		sum = sum.add(tracer.radiance(geom.NewRay(geom.Vector{}, randomVector(rng, 1)), rng))
+	}
+	mean := sum.scale(1.0 / samples)
+
+	if math.Abs(mean.R-0.8) > 0.03 || math.Abs(mean.G-0.4) > 0.01 || math.Abs(mean.B-0.2) > 1e-9 {
+		t.Errorf("Expected the light inside the sphere to average (0.8, 0.4, 0.2), got %#v", mean)
+	}
+}
+
+func TestPathTracePointLight(t *testing.T) {
+	// A diffuse plane lit by a point light sends back albedo/π of the
+	// irradiance I*cos/d², and nothing else lights it
+	scene := &Scene{
+		Objects: []Object{{
+			Primitive: NewPlane(geom.Vector{}, geom.NewVector(0, 0, 1)),
+			Material:  Diffuse{Albedo: Color{R: 0.5, G: 0.25, B: 1}},
+		}},
+		Lights: []PointLight{{Position: geom.NewVector(0, 0, 2), Color: Color{R: 1, G: 1, B: 1}, Intensity: 8}},
+	}
+	tracer := &pathTracer{scene: scene, samples: 1, minBounces: defaultMinBounces}
+	rng := rand.New(rand.NewSource(21))
+
+	// The ray hits the plane at (1, 0, 0), which is √5 from the light
+	irradiance := 8 * (2 / math.Sqrt(5)) / 5
+	got := tracer.radiance(geom.NewRay(geom.NewVector(1, 0, 3), geom.NewVector(0, 0, -1)), rng)
+	want := Color{R: 0.5, G: 0.25, B: 1}.scale(irradiance / math.Pi)
+	if !almostEqual(got.R, want.R) || !almostEqual(got.G, want.G) || !almostEqual(got.B, want.B) {
+		t.Errorf("Expected the plane to send back %#v, got %#v", want, got)
+	}
+}
+
+func TestPathTraceSphereOverFloor(t *testing.T) {
+	// Diffuse surfaces send back 1/π of the light falling on them, so the
+	// light is made as much brighter
+	scene := testScene()
+	scene.Lights[0].Intensity *= math.Pi
+	img, err := scene.PathTrace(context.Background(), PathTraceOptions{
+		RenderOptions: RenderOptions{Width: 64, Height: 64},
+		Samples:       16,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	background := scene.Background.rgba()
+	if c := img.RGBAAt(0, 0); c != background {
+		t.Errorf("Expected the top left corner to be the background %v, got %v", background, c)
+	}
+	if c := img.RGBAAt(32, 24); c.R <= c.G || c.R < 100 {
+		t.Errorf("Expected the top of the sphere to be lit red, got %v", c)
+	}
+	lit, shadowed := img.RGBAAt(48, 43), img.RGBAAt(15, 43)
+	if shadowed.G >= lit.G {
+		t.Errorf("Expected the floor in the shadow %v to be darker than the lit floor %v", shadowed, lit)
+	}
+}
+
+func TestPathTraceEmissiveAndGlass(t *testing.T) {
+	camera := NewCamera(geom.NewVector(0, 0, 5), geom.Vector{}, geom.NewVector(0, 1, 0), 30)
+	light := Object{Primitive: NewSphere(geom.NewVector(0, 0, -5), 2), Material: Emissive{Emission: Color{R: 1, G: 1, B: 1}}}
+
+	// A glass ball in front of a light lets most of it through
+	for _, material := range []Material{Dielectric{IOR: 1.5}, Diffuse{}} {
+		scene := &Scene{Camera: camera, Objects: []Object{light, {Primitive: NewSphere(geom.Vector{}, 0.5), Material: material}}}
+		tracer := &pathTracer{scene: scene, samples: 64, minBounces: defaultMinBounces}
+
+		c := tracer.pixel(8, 8, 16, 16)
+		if _, glass := material.(Dielectric); glass != (c.R > 0.5) {
+			t.Errorf("Expected light to pass only through the glass ball, got %#v through %#v", c, material)
+		}
+	}
+}
+
+func TestPathTraceCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := testScene().PathTrace(ctx, PathTraceOptions{RenderOptions: RenderOptions{Width: 16, Height: 16}}); err != context.Canceled {
+		t.Errorf("Expected a cancelled render to fail with %v, got %v", context.Canceled, err)
+	}
+}
+
+func BenchmarkPathTrace(b *testing.B) {
+	scene := testScene()
+	scene.Objects[0].Material = Dielectric{IOR: 1.5}
+	options := PathTraceOptions{RenderOptions: RenderOptions{Width: 64, Height: 48}, Samples: 8}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scene.PathTrace(context.Background(), options)
+	}
+}
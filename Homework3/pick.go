@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+// pickTolerance is the relative distance from the hit within which a part of
+// an object is taken to be the part which was hit.
+const pickTolerance = 1e-7
+
+// Pick is what is seen at a point of the image.
+type Pick struct {
+	// Object is the index of the object in the scene.
+	Object int
+
+	// Primitive is the innermost primitive which was hit, like a triangle
+	// of a mesh in a group. Path holds its index in the primitives of each
+	// accelerator or mesh on the way to it from the object. Instances on
+	// the way are looked through and add nothing to it.
+	Primitive Primitive
+	Path      []int
+
+	Hit Hit
+}
+
+// Picker finds the objects of a scene seen at points of an image. It shares
+// the objects and their accelerators with the scene, which must not change
+// while it is used.
+type Picker struct {
+	scene *Scene
+}
+
+// NewPicker returns a picker which sees the scene as it is rendered.
+func NewPicker(scene *Scene) *Picker {
+	return &Picker{scene: scene.prepared()}
+}
+
+// Pick returns what the camera sees at the point (x, y) of a width x height
+// image, or false if it sees only the background.
+func (picker *Picker) Pick(camera Camera, x, y float64, width, height int) (Pick, bool) {
+	ray := camera.Ray(x, y, width, height)
+	if ray.Direction == (geom.Vector{}) {
+		return Pick{}, false
+	}
+	return picker.PickRay(ray)
+}
+
+// PickRay returns the nearest thing hit by the ray. The object is found by
+// testing every object as rendering does and the part of it which was hit
+// with the accelerators inside it, searching only around the hit.
+func (picker *Picker) PickRay(ray geom.Ray) (Pick, bool) {
+	hit, object, ok := picker.scene.trace(ray)
+	if !ok {
+		return Pick{}, false
+	}
+
+	pick := Pick{Object: object, Primitive: picker.scene.Objects[object].Primitive, Hit: hit}
+	tolerance := pickTolerance * math.Max(hit.T, 1)
+	for {
+		switch primitive := pick.Primitive.(type) {
+		case *Instance:
+			// Ray parameters are the same in object space
+			ray = primitive.objectRay(ray)
+			pick.Primitive = primitive.primitive
+		case partFinder:
+			part, ok := primitive.partAt(ray, hit.T-tolerance, hit.T+tolerance)
+			if !ok {
+				return pick, true
+			}
+			pick.Primitive = primitive.Primitives()[part]
+			pick.Path = append(pick.Path, part)
+		default:
+			return pick, true
+		}
+	}
+}
+
+// partFinder is an accelerator which can tell which of its primitives the
+// ray hits between tMin and tMax. partAt returns its index in Primitives,
+// which is the order the primitives were given in.
+type partFinder interface {
+	Accelerator
+	partAt(ray geom.Ray, tMin, tMax float64) (int, bool)
+}
+
+// partAt maps the part found back to the order the primitives were given
+// in, as the BVH keeps them in another.
+func (bvh *BVH) partAt(ray geom.Ray, tMin, tMax float64) (int, bool) {
+	part, ok := partNear(bvh.primitives, ray, tMin, tMax, bvh.walk)
+	if !ok {
+		return -1, false
+	}
+	return bvh.order[part], true
+}
+
+// partAt finds the part with the BVH, which is built over the primitives of
+// the mesh in their order.
+func (mesh *Mesh) partAt(ray geom.Ray, tMin, tMax float64) (int, bool) {
+	return mesh.bvh.partAt(ray, tMin, tMax)
+}
+
+func (index *spatialIndex) partAt(ray geom.Ray, tMin, tMax float64) (int, bool) {
+	return partNear(index.primitives, ray, tMin, tMax, index.walkPrimitives)
+}
+
+// partNear returns the index of the primitive hit nearest to the middle of
+// the segment of the ray from tMin to tMax, testing the primitives walk
+// visits.
+func partNear(primitives []Primitive, ray geom.Ray, tMin, tMax float64, walk func(ray geom.Ray, tMin, tMax float64, visit func(index int, tMax float64) (float64, bool))) (int, bool) {
+	middle := (tMin + tMax) / 2
+	best, bestDistance := -1, math.Inf(1)
+
+	walk(ray, tMin, tMax, func(i int, _ float64) (float64, bool) {
+		hit, ok := primitives[i].ClosestHitSegment(ray, tMin, tMax)
+		if ok && math.Abs(hit.T-middle) < bestDistance {
+			best, bestDistance = i, math.Abs(hit.T-middle)
+		}
+		return tMax, false
+	})
+
+	return best, best >= 0
+}
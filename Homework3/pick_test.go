@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+func pickScene() *Scene {
+	mesh, _ := ParseOBJ(strings.NewReader(cubeOBJ))
+	group := NewOctree([]Primitive{
+		NewSphere(geom.NewVector(-2, 0, 0), 0.5),
+		NewGrid([]Primitive{
+			mesh,
+			NewTriangle(geom.NewVector(2, -1, 0), geom.NewVector(3, -1, 0), geom.NewVector(2.5, 0, 0)),
+		}),
+	})
+
+	scene := testScene()
+	scene.Objects = append(scene.Objects, Object{Primitive: group, Color: Color{B: 1}})
+	return scene
+}
+
+func TestPickNested(t *testing.T) {
+	scene := pickScene()
+	picker := NewPicker(scene)
+
+	// The cube spans [0, 1] on every axis
+	pick, ok := picker.PickRay(geom.NewRay(geom.NewVector(0.5, 0.5, 5), geom.NewVector(0, 0, -1)))
+	if !ok || pick.Object != 2 || !vectorsAlmostEqual(pick.Hit.Point, geom.NewVector(0.5, 0.5, 1)) {
+		t.Fatalf("Expected the cube in object 2 to be hit at (0.5, 0.5, 1), got %#v", pick)
+	}
+	if len(pick.Path) != 3 || pick.Path[0] != 1 || pick.Path[1] != 0 {
+		t.Fatalf("Expected a path through the grid and the mesh to one of its faces, got %v", pick.Path)
+	}
+	mesh := scene.Objects[2].Primitive.(Accelerator).Primitives()[1].(Accelerator).Primitives()[0].(*Mesh)
+	if face := mesh.Primitives()[pick.Path[2]]; face != pick.Primitive {
+		t.Errorf("Expected the primitive to be the face the path leads to, got %#v and %#v", pick.Primitive, face)
+	}
+	if bounds := pick.Primitive.Bounds(); !almostEqual(bounds.Min.Z, 1) || !almostEqual(bounds.Max.Z, 1) {
+		t.Errorf("Expected the front face of the cube, got one spanning %#v", bounds)
+	}
+
+	pick, ok = picker.PickRay(geom.NewRay(geom.NewVector(-2, 0, 5), geom.NewVector(0, 0, -1)))
+	if _, sphere := pick.Primitive.(Sphere); !ok || !sphere || len(pick.Path) != 1 || pick.Path[0] != 0 {
+		t.Errorf("Expected the sphere of the group, got %#v", pick)
+	}
+
+	// Objects which are not groups are picked whole
+	pick, ok = picker.PickRay(geom.NewRay(geom.NewVector(0, 0, 5), geom.NewVector(0, 0, -1)))
+	if !ok || pick.Object != 0 || pick.Path != nil || pick.Primitive != scene.Objects[0].Primitive {
+		t.Errorf("Expected the sphere of object 0, got %#v", pick)
+	}
+}
+
+func TestPickBVH(t *testing.T) {
+	// Spheres given in shuffled order, which the BVH sorts along X
+	rng := rand.New(rand.NewSource(23))
+	positions := rng.Perm(20)
+	primitives := make([]Primitive, len(positions))
+	for i, x := range positions {
+		primitives[i] = NewSphere(geom.NewVector(float64(x)*2, 0, 0), 0.5)
+	}
+	bvh := NewBVH(primitives)
+	picker := NewPicker(&Scene{Objects: []Object{{Primitive: bvh}}})
+
+	for i, primitive := range bvh.Primitives() {
+		if primitive != primitives[i] {
+			t.Fatalf("Expected the primitives of the BVH in the order they were given, got %#v at %d", primitive, i)
+		}
+	}
+	for i, x := range positions {
+		pick, ok := picker.PickRay(geom.NewRay(geom.NewVector(float64(x)*2, 0, 5), geom.NewVector(0, 0, -1)))
+		if !ok || len(pick.Path) != 1 || pick.Path[0] != i || pick.Primitive != primitives[i] {
+			t.Errorf("Expected sphere %d to be picked, got %#v", i, pick)
+		}
+	}
+}
+
+func TestPickInstance(t *testing.T) {
+	mesh, _ := ParseOBJ(strings.NewReader(cubeOBJ))
+	left, _ := NewInstance(mesh, Translate(geom.NewVector(-3, 0, 0)))
+	right, _ := NewInstance(mesh, Compose(Scale(2, 2, 2), Translate(geom.NewVector(3, 0, 0))))
+
+	scene := testScene()
+	scene.Objects = []Object{{Primitive: NewBVH([]Primitive{left, right})}}
+	picker := NewPicker(scene)
+
+	// The right cube spans [3, 5] on x and [0, 2] on y and z
+	pick, ok := picker.PickRay(geom.NewRay(geom.NewVector(4, 1, 5), geom.NewVector(0, 0, -1)))
+	if !ok || !vectorsAlmostEqual(pick.Hit.Point, geom.NewVector(4, 1, 2)) {
+		t.Fatalf("Expected the right cube to be hit at (4, 1, 2), got %#v", pick)
+	}
+	if len(pick.Path) != 2 || scene.Objects[0].Primitive.(Accelerator).Primitives()[pick.Path[0]] != right {
+		t.Fatalf("Expected a path through the right instance to a face of the mesh, got %v", pick.Path)
+	}
+	if face := mesh.Primitives()[pick.Path[1]]; face != pick.Primitive {
+		t.Errorf("Expected the primitive to be the face the path leads to, got %#v and %#v", pick.Primitive, face)
+	}
+	if bounds := pick.Primitive.Bounds(); !almostEqual(bounds.Min.Z, 1) || !almostEqual(bounds.Max.Z, 1) {
+		t.Errorf("Expected the front face of the shared cube, got one spanning %#v", bounds)
+	}
+}
+
+func TestPickMatchesRender(t *testing.T) {
+	scene := pickScene()
+	scene.TriangleMode = WatertightTriangles
+	picker := NewPicker(scene)
+	prepared := scene.prepared()
+	rng := rand.New(rand.NewSource(23))
+
+	for i := 0; i < 500; i++ {
+		x, y := 64*rng.Float64(), 48*rng.Float64()
+		ray := scene.Camera.Ray(x, y, 64, 48)
+
+		hit, object, hitOK := prepared.trace(ray)
+		pick, ok := picker.Pick(scene.Camera, x, y, 64, 48)
+		if ok != hitOK || (ok && (pick.Object != object || !almostEqual(pick.Hit.T, hit.T))) {
+			t.Fatalf("Expected pixel (%v, %v) to show object %d at %v, got %#v", x, y, object, hit.T, pick)
+		}
+
+		// The picked primitive itself is hit where the object was
+		if ok {
+			if own, ok := pick.Primitive.ClosestHit(ray); !ok || !almostEqual(own.T, hit.T) {
+				t.Fatalf("Expected the picked primitive to be hit at %v, got %v at %v", hit.T, ok, own.T)
+			}
+		}
+	}
+}
+
+func TestPickBackground(t *testing.T) {
+	scene := pickScene()
+	picker := NewPicker(scene)
+
+	if _, ok := picker.Pick(scene.Camera, 0, 0, 64, 48); ok {
+		t.Errorf("Expected nothing to be picked in the top left corner")
+	}
+
+	fisheye := NewFisheyeCamera(geom.NewVector(0, 0, 5), geom.Vector{}, geom.NewVector(0, 1, 0), 360)
+	if _, ok := picker.Pick(fisheye, 0, 0, 64, 64); ok {
+		t.Errorf("Expected nothing to be picked outside of the fisheye image")
+	}
+}
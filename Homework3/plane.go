@@ -0,0 +1,189 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+// Plane is an infinite plane through a point. Rays lying in the plane do
+// not hit it.
+type Plane struct {
+	point        geom.Vector
+	normal       geom.Vector
+	uAxis, vAxis geom.Vector
+}
+
+// Disk is the part of a plane within a radius of its center.
+type Disk struct {
+	frame frame
+	r     float64
+}
+
+func NewPlane(point, normal geom.Vector) Plane {
+	normal = normalize(normal)
+	uAxis, vAxis := planeBasis(normal)
+
+	return Plane{
+		point:  point,
+		normal: normal,
+		uAxis:  uAxis,
+		vAxis:  vAxis,
+	}
+}
+
+func NewDisk(center, normal geom.Vector, r float64) Disk {
+	return Disk{
+		frame: newFrame(center, normal),
+		r:     r,
+	}
+}
+
+func (plane Plane) Intersect(ray geom.Ray) bool {
+	return plane.IntersectSegment(ray, epsilon, math.Inf(1))
+}
+
+// ClosestHit returns the hit with the plane. The U and V coordinates of the
+// hit are its position in the plane along two perpendicular unit axes,
+// measured from the point the plane was created with.
+func (plane Plane) ClosestHit(ray geom.Ray) (Hit, bool) {
+	return plane.ClosestHitSegment(ray, epsilon, math.Inf(1))
+}
+
+func (plane Plane) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	found := plane.candidates(ray)
+	_, ok := found.nearest(tMin, tMax)
+	return ok
+}
+
+func (plane Plane) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	found := plane.candidates(ray)
+	nearest, ok := found.nearest(tMin, tMax)
+	if !ok {
+		return Hit{}, false
+	}
+
+	point := pointAt(ray, nearest.t)
+	offset := geom.Sub(point, plane.point)
+
+	return Hit{
+		T:         nearest.t,
+		Point:     point,
+		Normal:    plane.normal,
+		U:         geom.Dot(offset, plane.uAxis),
+		V:         geom.Dot(offset, plane.vAxis),
+		Primitive: plane,
+	}, true
+}
+
+func (plane Plane) candidates(ray geom.Ray) candidates {
+	var found candidates
+	if t, ok := planeParameter(ray, plane.point, plane.normal); ok {
+		found.add(t, 0)
+	}
+	return found
+}
+
+// Bounds returns an infinite box, unless the plane is perpendicular to an
+// axis and the box is flat along it.
+func (plane Plane) Bounds() AABB {
+	inf := math.Inf(1)
+	box := AABB{
+		Min: geom.NewVector(-inf, -inf, -inf),
+		Max: geom.NewVector(inf, inf, inf),
+	}
+
+	switch {
+	case plane.normal.X == 0 && plane.normal.Y == 0:
+		box.Min.Z, box.Max.Z = plane.point.Z, plane.point.Z
+	case plane.normal.Y == 0 && plane.normal.Z == 0:
+		box.Min.X, box.Max.X = plane.point.X, plane.point.X
+	case plane.normal.Z == 0 && plane.normal.X == 0:
+		box.Min.Y, box.Max.Y = plane.point.Y, plane.point.Y
+	}
+
+	return box
+}
+
+// planeParameter returns the ray parameter at which the ray crosses the plane
+// through point with the given normal. Rays parallel to the plane never do.
+func planeParameter(ray geom.Ray, point, normal geom.Vector) (float64, bool) {
+	denominator := geom.Dot(normal, ray.Direction)
+	if denominator == 0 {
+		return 0, false
+	}
+	return geom.Dot(normal, geom.Sub(point, ray.Origin)) / denominator, true
+}
+
+func (disk Disk) Intersect(ray geom.Ray) bool {
+	return disk.IntersectSegment(ray, epsilon, math.Inf(1))
+}
+
+// ClosestHit returns the hit with the disk. U is the angle of the hit around
+// the center mapped to [0, 1) and V is its distance from the center relative
+// to the radius.
+func (disk Disk) ClosestHit(ray geom.Ray) (Hit, bool) {
+	return disk.ClosestHitSegment(ray, epsilon, math.Inf(1))
+}
+
+func (disk Disk) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	found := disk.candidates(disk.frame.localRay(ray))
+	_, ok := found.nearest(tMin, tMax)
+	return ok
+}
+
+func (disk Disk) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	local := disk.frame.localRay(ray)
+	found := disk.candidates(local)
+	nearest, ok := found.nearest(tMin, tMax)
+	if !ok {
+		return Hit{}, false
+	}
+
+	p := pointAt(local, nearest.t)
+
+	return Hit{
+		T:         nearest.t,
+		Point:     pointAt(ray, nearest.t),
+		Normal:    disk.frame.w,
+		U:         angle(p.X, p.Y),
+		V:         math.Hypot(p.X, p.Y) / disk.r,
+		Primitive: disk,
+	}, true
+}
+
+// candidates finds the crossing of a ray, given in the frame of the disk,
+// with the disk in the plane z = 0.
+func (disk Disk) candidates(local geom.Ray) candidates {
+	var found candidates
+	addCapCandidate(&found, local, 0, disk.r, 0)
+	return found
+}
+
+func (disk Disk) Bounds() AABB {
+	return diskBounds(disk.frame.origin, disk.frame.w, disk.r)
+}
+
+// addCapCandidate adds the crossing of a ray, given in the frame of a shape,
+// with the disk of radius r in the plane z = height.
+func addCapCandidate(found *candidates, local geom.Ray, height, r float64, part int) {
+	if local.Direction.Z == 0 {
+		return
+	}
+	t := (height - local.Origin.Z) / local.Direction.Z
+	p := pointAt(local, t)
+	if p.X*p.X+p.Y*p.Y <= r*r {
+		found.add(t, part)
+	}
+}
+
+// diskBounds returns the box around the disk with the given center, unit
+// normal and radius.
+func diskBounds(center, normal geom.Vector, r float64) AABB {
+	r = math.Abs(r)
+	extent := geom.NewVector(
+		r*math.Sqrt(math.Max(0, 1-normal.X*normal.X)),
+		r*math.Sqrt(math.Max(0, 1-normal.Y*normal.Y)),
+		r*math.Sqrt(math.Max(0, 1-normal.Z*normal.Z)),
+	)
+	return AABB{Min: geom.Sub(center, extent), Max: geom.Add(center, extent)}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"testing"
+)
+
+func TestSampleSimplePlaneShouldIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	prim = NewPlane(geom.NewVector(0, -1, 0), geom.NewVector(0, 1, 0))
+	ray := geom.NewRay(geom.NewVector(5, 3, -2), geom.NewVector(1, -1, 0))
+
+	if !prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect plane %#v but it did not.", ray, prim)
+	}
+}
+
+func TestSampleParallelRayShouldNotIntersectPlane(t *testing.T) {
+	var prim geom.Intersectable
+
+	prim = NewPlane(geom.NewVector(0, -1, 0), geom.NewVector(0, 1, 0))
+	ray := geom.NewRay(geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 1))
+
+	if prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to not intersect plane %#v but it did.", ray, prim)
+	}
+}
+
+func TestPlaneClosestHit(t *testing.T) {
+	prim := NewPlane(geom.NewVector(1, 2, 3), geom.NewVector(0, 0, -2))
+	ray := geom.NewRay(geom.NewVector(1, 2, 0), geom.NewVector(0, 0, 2))
+
+	hit, ok := prim.ClosestHit(ray)
+	if !ok {
+		t.Fatalf("Expected ray %#v to hit plane %#v but it did not.", ray, prim)
+	}
+	if !almostEqual(hit.T, 1.5) || !vectorsAlmostEqual(hit.Point, geom.NewVector(1, 2, 3)) {
+		t.Errorf("Expected a hit at (1, 2, 3), got %#v", hit)
+	}
+	if !vectorsAlmostEqual(hit.Normal, geom.NewVector(0, 0, -1)) {
+		t.Errorf("Expected normal (0, 0, -1), got %#v", hit.Normal)
+	}
+	if !almostEqual(hit.U, 0) || !almostEqual(hit.V, 0) {
+		t.Errorf("Expected the hit at the origin of the plane, got %v, %v", hit.U, hit.V)
+	}
+}
+
+func TestPlaneInBVH(t *testing.T) {
+	plane := NewPlane(geom.NewVector(0, -1, 0), geom.NewVector(1, 1, 0))
+	bvh := NewBVH([]Primitive{plane, NewSphere(geom.NewVector(0, 5, 0), 1)})
+	ray := geom.NewRay(geom.NewVector(10, 10, 0), geom.NewVector(-1, -1, 0))
+
+	hit, ok := bvh.ClosestHit(ray)
+	if !ok || hit.Primitive != plane {
+		t.Errorf("Expected the plane to be hit through the BVH, got %#v", hit)
+	}
+	if !math.IsInf(plane.Bounds().Max.X, 1) {
+		t.Errorf("Expected an infinite box around a slanted plane")
+	}
+}
+
+func TestSampleSimpleDiskShouldIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	prim = NewDisk(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1), 2)
+	ray := geom.NewRay(geom.NewVector(1.9, 0, 3), geom.NewVector(0, 0, -1))
+
+	if !prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect disk %#v but it did not.", ray, prim)
+	}
+}
+
+func TestSampleRayOutsideDiskShouldNotIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	prim = NewDisk(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1), 2)
+	ray := geom.NewRay(geom.NewVector(1.5, 1.5, 3), geom.NewVector(0, 0, -1))
+
+	if prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to not intersect disk %#v but it did.", ray, prim)
+	}
+}
+
+func TestDiskClosestHit(t *testing.T) {
+	prim := NewDisk(geom.NewVector(0, 1, 0), geom.NewVector(0, 1, 0), 2)
+	ray := geom.NewRay(geom.NewVector(1, 3, 0), geom.NewVector(0, -1, 0))
+
+	hit, ok := prim.ClosestHit(ray)
+	if !ok {
+		t.Fatalf("Expected ray %#v to hit disk %#v but it did not.", ray, prim)
+	}
+	if !almostEqual(hit.T, 2) || !vectorsAlmostEqual(hit.Normal, geom.NewVector(0, 1, 0)) {
+		t.Errorf("Expected a hit at 2 with normal (0, 1, 0), got %#v", hit)
+	}
+	if !almostEqual(hit.V, 0.5) {
+		t.Errorf("Expected the hit halfway to the rim, got %v", hit.V)
+	}
+
+	bounds := prim.Bounds()
+	if !vectorsAlmostEqual(bounds.Min, geom.NewVector(-2, 1, -2)) || !vectorsAlmostEqual(bounds.Max, geom.NewVector(2, 1, 2)) {
+		t.Errorf("Expected a flat box around the disk, got %#v", bounds)
+	}
+}
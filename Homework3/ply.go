@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/fmi/go-homework/geom"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// plyProperty is a scalar or list property of a PLY element.
+type plyProperty struct {
+	name      string
+	typ       string
+	countType string // set for list properties only
+}
+
+type plyElement struct {
+	name       string
+	count      int
+	properties []plyProperty
+}
+
+// plySizes are the sizes in bytes of the PLY scalar types.
+var plySizes = map[string]int{
+	"char": 1, "uchar": 1, "short": 2, "ushort": 2, "int": 4, "uint": 4, "float": 4, "double": 8,
+	"int8": 1, "uint8": 1, "int16": 2, "uint16": 2, "int32": 4, "uint32": 4, "float32": 4, "float64": 8,
+}
+
+// ReadPLY reads an ASCII or binary little-endian PLY file. Vertex positions,
+// normals and texture coordinates are read along with the faces, any other
+// element or property is skipped.
+func ReadPLY(r io.Reader) (*Mesh, error) {
+	in := bufio.NewReader(r)
+	line := 0
+	fail := func(format string, args ...interface{}) error {
+		return &ParseError{Format: "ply", Line: line, Message: fmt.Sprintf(format, args...)}
+	}
+	readLine := func() ([]string, error) {
+		text, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || text == "") {
+			if err == io.EOF {
+				return nil, fail("unexpected end of file")
+			}
+			return nil, err
+		}
+		line++
+		return strings.Fields(text), nil
+	}
+
+	fields, err := readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != 1 || fields[0] != "ply" {
+		return nil, fail("missing ply magic")
+	}
+
+	var format string
+	var elements []plyElement
+	for {
+		fields, err := readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "format":
+			if len(fields) != 3 {
+				return nil, fail("invalid format line")
+			}
+			format = fields[1]
+			if format != "ascii" && format != "binary_little_endian" {
+				return nil, fail("unsupported format %q", format)
+			}
+		case "comment", "obj_info":
+		case "element":
+			if len(fields) != 3 {
+				return nil, fail("invalid element line")
+			}
+			count, err := strconv.Atoi(fields[2])
+			if err != nil || count < 0 {
+				return nil, fail("invalid element count %q", fields[2])
+			}
+			elements = append(elements, plyElement{name: fields[1], count: count})
+		case "property":
+			if len(elements) == 0 {
+				return nil, fail("property outside of an element")
+			}
+			property, err := parsePLYProperty(fields[1:])
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			element := &elements[len(elements)-1]
+			element.properties = append(element.properties, property)
+		case "end_header":
+			if format == "" {
+				return nil, fail("missing format")
+			}
+			return readPLYBody(in, format, elements, line)
+		default:
+			return nil, fail("unknown header keyword %q", fields[0])
+		}
+	}
+}
+
+func parsePLYProperty(fields []string) (plyProperty, error) {
+	if len(fields) == 4 && fields[0] == "list" {
+		if _, ok := plySizes[fields[1]]; !ok {
+			return plyProperty{}, fmt.Errorf("unknown type %q", fields[1])
+		}
+		if _, ok := plySizes[fields[2]]; !ok {
+			return plyProperty{}, fmt.Errorf("unknown type %q", fields[2])
+		}
+		return plyProperty{name: fields[3], typ: fields[2], countType: fields[1]}, nil
+	}
+
+	if len(fields) != 2 {
+		return plyProperty{}, errors.New("invalid property line")
+	}
+	if _, ok := plySizes[fields[0]]; !ok {
+		return plyProperty{}, fmt.Errorf("unknown type %q", fields[0])
+	}
+	return plyProperty{name: fields[1], typ: fields[0]}, nil
+}
+
+// plyReader reads the values of element instances from the body of a file.
+type plyReader interface {
+	// next starts a new element instance
+	next() error
+	scalar(typ string) (float64, error)
+}
+
+type asciiPLYReader struct {
+	in     *bufio.Reader
+	line   int
+	fields []string
+}
+
+func (reader *asciiPLYReader) next() error {
+	if len(reader.fields) != 0 {
+		return reader.fail("unexpected value %q", reader.fields[0])
+	}
+	for len(reader.fields) == 0 {
+		text, err := reader.in.ReadString('\n')
+		if err != nil && (err != io.EOF || text == "") {
+			if err == io.EOF {
+				return reader.fail("unexpected end of file")
+			}
+			return err
+		}
+		reader.line++
+		reader.fields = strings.Fields(text)
+	}
+	return nil
+}
+
+func (reader *asciiPLYReader) scalar(typ string) (float64, error) {
+	if len(reader.fields) == 0 {
+		return 0, reader.fail("too few values")
+	}
+	value, err := strconv.ParseFloat(reader.fields[0], 64)
+	if err != nil {
+		return 0, reader.fail("invalid number %q", reader.fields[0])
+	}
+	reader.fields = reader.fields[1:]
+	return value, nil
+}
+
+func (reader *asciiPLYReader) fail(format string, args ...interface{}) error {
+	return &ParseError{Format: "ply", Line: reader.line, Message: fmt.Sprintf(format, args...)}
+}
+
+type binaryPLYReader struct {
+	in     *bufio.Reader
+	buffer [8]byte
+}
+
+func (reader *binaryPLYReader) next() error {
+	return nil
+}
+
+func (reader *binaryPLYReader) scalar(typ string) (float64, error) {
+	data := reader.buffer[:plySizes[typ]]
+	if _, err := io.ReadFull(reader.in, data); err != nil {
+		return 0, errors.New("ply: unexpected end of binary data")
+	}
+
+	switch typ {
+	case "char", "int8":
+		return float64(int8(data[0])), nil
+	case "uchar", "uint8":
+		return float64(data[0]), nil
+	case "short", "int16":
+		return float64(int16(binary.LittleEndian.Uint16(data))), nil
+	case "ushort", "uint16":
+		return float64(binary.LittleEndian.Uint16(data)), nil
+	case "int", "int32":
+		return float64(int32(binary.LittleEndian.Uint32(data))), nil
+	case "uint", "uint32":
+		return float64(binary.LittleEndian.Uint32(data)), nil
+	case "float", "float32":
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data))), nil
+	default:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+	}
+}
+
+func readPLYBody(in *bufio.Reader, format string, elements []plyElement, line int) (*Mesh, error) {
+	var reader plyReader
+	if format == "ascii" {
+		reader = &asciiPLYReader{in: in, line: line}
+	} else {
+		reader = &binaryPLYReader{in: in}
+	}
+
+	var vertices, normals []geom.Vector
+	var texCoords [][2]float64
+	var faces []Face
+
+	for _, element := range elements {
+		for i := 0; i < element.count; i++ {
+			if err := reader.next(); err != nil {
+				return nil, err
+			}
+
+			values := make(map[string]float64, len(element.properties))
+			var list []int
+			for _, property := range element.properties {
+				if property.countType == "" {
+					value, err := reader.scalar(property.typ)
+					if err != nil {
+						return nil, err
+					}
+					values[property.name] = value
+					continue
+				}
+
+				count, err := reader.scalar(property.countType)
+				if err != nil {
+					return nil, err
+				}
+				if count < 0 || count != math.Trunc(count) {
+					return nil, fmt.Errorf("ply: invalid list length %v in element %s %d", count, element.name, i)
+				}
+				// The list is not preallocated, a bogus length fails on missing data instead
+				var items []int
+				for j := 0; j < int(count); j++ {
+					value, err := reader.scalar(property.typ)
+					if err != nil {
+						return nil, err
+					}
+					items = append(items, int(value))
+				}
+				if property.name == "vertex_indices" || property.name == "vertex_index" {
+					list = items
+				}
+			}
+
+			switch element.name {
+			case "vertex":
+				vertices = append(vertices, geom.NewVector(values["x"], values["y"], values["z"]))
+				if _, ok := values["nx"]; ok {
+					normals = append(normals, geom.NewVector(values["nx"], values["ny"], values["nz"]))
+				}
+				if u, ok := values["u"]; ok {
+					texCoords = append(texCoords, [2]float64{u, values["v"]})
+				} else if s, ok := values["s"]; ok {
+					texCoords = append(texCoords, [2]float64{s, values["t"]})
+				}
+			case "face":
+				faces = append(faces, Face{Vertices: list})
+			}
+		}
+	}
+
+	if ascii, ok := reader.(*asciiPLYReader); ok && len(ascii.fields) != 0 {
+		return nil, ascii.fail("unexpected value %q", ascii.fields[0])
+	}
+
+	// Per-vertex attributes are indexed like the vertices themselves
+	for i := range faces {
+		if len(normals) == len(vertices) && len(normals) > 0 {
+			faces[i].Normals = faces[i].Vertices
+		}
+		if len(texCoords) == len(vertices) && len(texCoords) > 0 {
+			faces[i].TexCoords = faces[i].Vertices
+		}
+	}
+
+	mesh := &Mesh{Vertices: vertices, Normals: normals, TexCoords: texCoords, Faces: faces}
+	if err := mesh.checkReferences(); err != nil {
+		return nil, fmt.Errorf("ply: %v", err)
+	}
+
+	mesh.build()
+	return mesh, nil
+}
+
+// writePLYHeader writes the header shared by the ASCII and binary writers.
+func writePLYHeader(out io.Writer, format string, mesh *Mesh) {
+	fmt.Fprintf(out, "ply\nformat %s 1.0\n", format)
+	fmt.Fprintf(out, "element vertex %d\n", len(mesh.Vertices))
+	fmt.Fprintf(out, "property double x\nproperty double y\nproperty double z\n")
+	fmt.Fprintf(out, "element face %d\n", len(mesh.Faces))
+	fmt.Fprintf(out, "property list uchar int vertex_indices\nend_header\n")
+}
+
+// checkPLYFaces makes sure the face sizes fit in the uchar count of the list.
+func checkPLYFaces(mesh *Mesh) error {
+	for i, face := range mesh.Faces {
+		if len(face.Vertices) > math.MaxUint8 {
+			return fmt.Errorf("ply: face %d has more than %d vertices", i, math.MaxUint8)
+		}
+	}
+	return nil
+}
+
+// WriteASCIIPLY writes the vertices and faces of the mesh as an ASCII PLY file.
+func WriteASCIIPLY(w io.Writer, mesh *Mesh) error {
+	if err := checkPLYFaces(mesh); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	writePLYHeader(out, "ascii", mesh)
+
+	for _, v := range mesh.Vertices {
+		fmt.Fprintf(out, "%g %g %g\n", v.X, v.Y, v.Z)
+	}
+	for _, face := range mesh.Faces {
+		fmt.Fprintf(out, "%d", len(face.Vertices))
+		for _, index := range face.Vertices {
+			fmt.Fprintf(out, " %d", index)
+		}
+		fmt.Fprintln(out)
+	}
+
+	return out.Flush()
+}
+
+// WriteBinaryPLY writes the vertices and faces of the mesh as a binary
+// little-endian PLY file.
+func WriteBinaryPLY(w io.Writer, mesh *Mesh) error {
+	if err := checkPLYFaces(mesh); err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	writePLYHeader(out, "binary_little_endian", mesh)
+
+	var buffer [8]byte
+	for _, v := range mesh.Vertices {
+		for _, x := range [3]float64{v.X, v.Y, v.Z} {
+			binary.LittleEndian.PutUint64(buffer[:], math.Float64bits(x))
+			out.Write(buffer[:])
+		}
+	}
+	for _, face := range mesh.Faces {
+		out.WriteByte(uint8(len(face.Vertices)))
+		for _, index := range face.Vertices {
+			binary.LittleEndian.PutUint32(buffer[:4], uint32(index))
+			out.Write(buffer[:4])
+		}
+	}
+
+	return out.Flush()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+const squarePLY = `ply
+format ascii 1.0
+comment a unit square with a triangle on top
+element vertex 5
+property float x
+property float y
+property float z
+property float nx
+property float ny
+property float nz
+property uchar red
+element face 2
+property list uchar int vertex_indices
+element edge 1
+property int vertex1
+property int vertex2
+end_header
+0 0 0 0 0 1 255
+1 0 0 0 0 1 255
+1 1 0 0 0 1 255
+0 1 0 0 0 1 255
+0.5 2 0 0 0 1 255
+4 0 1 2 3
+3 3 2 4
+0 1
+`
+
+func TestReadASCIIPLY(t *testing.T) {
+	var prim geom.Intersectable
+
+	mesh, err := ReadPLY(strings.NewReader(squarePLY))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	prim = mesh
+
+	if len(mesh.Vertices) != 5 || len(mesh.Faces) != 2 || len(mesh.Normals) != 5 {
+		t.Fatalf("Expected 5 vertices with normals and 2 faces, got %d, %d and %d", len(mesh.Vertices), len(mesh.Normals), len(mesh.Faces))
+	}
+	if face := mesh.Faces[1]; len(face.Normals) != 3 || face.Normals[2] != 4 {
+		t.Errorf("Expected the faces to index the vertex normals, got %#v", face)
+	}
+	if _, ok := mesh.Primitives()[0].(Quad); !ok {
+		t.Errorf("Expected the four-sided face to be a quad, got %#v", mesh.Primitives()[0])
+	}
+	if err := mesh.Validate(); err != nil {
+		t.Errorf("Expected a valid mesh, got %v", err)
+	}
+
+	ray := geom.NewRay(geom.NewVector(0.5, 1.5, 1), geom.NewVector(0, 0, -1))
+	if !prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect the mesh but it did not.", ray)
+	}
+}
+
+func TestPLYRoundTrip(t *testing.T) {
+	mesh, err := ReadPLY(strings.NewReader(squarePLY))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for name, write := range map[string]func(*bytes.Buffer, *Mesh) error{
+		"ascii":  func(b *bytes.Buffer, m *Mesh) error { return WriteASCIIPLY(b, m) },
+		"binary": func(b *bytes.Buffer, m *Mesh) error { return WriteBinaryPLY(b, m) },
+	} {
+		var buffer bytes.Buffer
+		if err := write(&buffer, mesh); err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+
+		copied, err := ReadPLY(&buffer)
+		if err != nil {
+			t.Fatalf("%s: unexpected error reading the copy: %v", name, err)
+		}
+
+		if len(copied.Vertices) != len(mesh.Vertices) {
+			t.Fatalf("%s: expected %d vertices, got %d", name, len(mesh.Vertices), len(copied.Vertices))
+		}
+		for i := range mesh.Vertices {
+			if copied.Vertices[i] != mesh.Vertices[i] {
+				t.Errorf("%s: expected vertex %d to be %#v, got %#v", name, i, mesh.Vertices[i], copied.Vertices[i])
+			}
+		}
+		sameTriangles(t, mesh.Triangles(), copied.Triangles(), 0)
+	}
+}
+
+func TestReadPLYErrors(t *testing.T) {
+	header := "ply\nformat ascii 1.0\nelement vertex 3\nproperty float x\nproperty float y\nproperty float z\n" +
+		"element face 1\nproperty list uchar int vertex_indices\nend_header\n"
+
+	cases := []struct {
+		source string
+		line   int
+	}{
+		{"plx\n", 1},
+		{"ply\nformat binary_big_endian 1.0\n", 2},
+		{"ply\nformat ascii 1.0\nelement vertex 1\nproperty quad x\n", 4},
+		{"ply\nformat ascii 1.0\nbogus\n", 3},
+		{header + "0 0 0\n1 0 x\n0 1 0\n3 0 1 2\n", 11},
+		{header + "0 0 0\n1 0 0 7\n0 1 0\n3 0 1 2\n", 11},
+		{header + "0 0 0\n1 0 0\n0 1 0\n3 0 1\n", 13},
+		{header + "0 0 0\n1 0 0\n", 11},
+	}
+
+	for _, tc := range cases {
+		_, err := ReadPLY(strings.NewReader(tc.source))
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("Expected a parse error for %q, got %v", tc.source, err)
+			continue
+		}
+		if parseErr.Line != tc.line {
+			t.Errorf("Expected the error for %q to be on line %d, got %v", tc.source, tc.line, parseErr)
+		}
+	}
+
+	if _, err := ReadPLY(strings.NewReader(header + "0 0 0\n1 0 0\n0 1 0\n3 0 1 5\n")); err == nil {
+		t.Errorf("Expected an error for a face referencing a missing vertex")
+	}
+}
+
+func TestMeshValidate(t *testing.T) {
+	vertices := []geom.Vector{geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0), geom.NewVector(2, 0, 0)}
+	mesh, err := NewMesh(vertices, []Face{{Vertices: []int{0, 1, 2}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := mesh.Validate(); err == nil {
+		t.Errorf("Expected a face of collinear vertices to be invalid")
+	}
+
+	if _, err := NewMesh(vertices, []Face{{Vertices: []int{0, 1, 3}}}); err == nil {
+		t.Errorf("Expected an error for a face referencing a missing vertex")
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"sort"
+)
+
+// polygonPlanarityTolerance is the distance, relative to the size of the
+// polygon, a vertex may be off its plane.
+const polygonPlanarityTolerance = 1e-6
+
+// Polygon is a simple planar polygon which may be concave and have holes.
+// It is split into triangles once, when it is created.
+type Polygon struct {
+	triangles []Triangle
+
+	// The outline and holes it was made of, which give the same triangles
+	// and basis again
+	outline []geom.Vector
+	holes   [][]geom.Vector
+
+	origin geom.Vector
+	uAxis  geom.Vector
+	vAxis  geom.Vector
+	bounds AABB
+}
+
+// point2 is a vertex projected in the plane of the polygon.
+type point2 struct {
+	x, y  float64
+	index int
+}
+
+// NewPolygon triangulates the polygon with the given outline and holes by ear
+// clipping. The outline and the holes may be given in either winding but all
+// of their vertices must lie in one plane.
+func NewPolygon(outline []geom.Vector, holes ...[]geom.Vector) (*Polygon, error) {
+	if len(outline) < 3 {
+		return nil, errors.New("polygon needs at least three vertices")
+	}
+	for i, hole := range holes {
+		if len(hole) < 3 {
+			return nil, fmt.Errorf("hole %d needs at least three vertices", i)
+		}
+	}
+
+	normal := newellNormal(outline)
+	if normal == (geom.Vector{}) {
+		return nil, errors.New("polygon has no area")
+	}
+
+	// In this basis of the plane the outline winds counterclockwise
+	uAxis, vAxis := planeBasis(normal)
+
+	polygon := &Polygon{
+		outline: append([]geom.Vector(nil), outline...),
+		origin:  outline[0],
+		uAxis:   uAxis,
+		vAxis:   vAxis,
+		bounds:  boundsOfPoints(outline...),
+	}
+
+	size := length(geom.Sub(polygon.bounds.Max, polygon.bounds.Min))
+	vertices := make([]geom.Vector, 0, len(outline))
+	project := func(ring []geom.Vector) ([]point2, error) {
+		points := make([]point2, len(ring))
+		for i, vertex := range ring {
+			offset := geom.Sub(vertex, polygon.origin)
+			if math.Abs(geom.Dot(offset, normal)) > polygonPlanarityTolerance*size {
+				return nil, fmt.Errorf("vertex %d is not in the plane of the polygon", i)
+			}
+			points[i] = point2{x: geom.Dot(offset, uAxis), y: geom.Dot(offset, vAxis), index: len(vertices)}
+			vertices = append(vertices, vertex)
+		}
+		return points, nil
+	}
+
+	ring, err := project(outline)
+	if err != nil {
+		return nil, err
+	}
+
+	holeRings := make([][]point2, len(holes))
+	for i, hole := range holes {
+		if holeRings[i], err = project(hole); err != nil {
+			return nil, fmt.Errorf("hole %d: %v", i, err)
+		}
+		polygon.holes = append(polygon.holes, append([]geom.Vector(nil), hole...))
+		// Holes have to wind opposite to the outline
+		if signedArea(holeRings[i]) > 0 {
+			reverse(holeRings[i])
+		}
+	}
+
+	ring, err = bridgeHoles(ring, holeRings)
+	if err != nil {
+		return nil, err
+	}
+
+	indices, err := earClip(ring)
+	if err != nil {
+		return nil, err
+	}
+
+	polygon.triangles = make([]Triangle, len(indices))
+	for i, triangle := range indices {
+		polygon.triangles[i] = NewTriangle(vertices[triangle[0]], vertices[triangle[1]], vertices[triangle[2]])
+	}
+
+	return polygon, nil
+}
+
+func (polygon *Polygon) Intersect(ray geom.Ray) bool {
+	return polygon.IntersectSegment(ray, epsilon, math.Inf(1))
+}
+
+// ClosestHit returns the hit with the polygon. The U and V coordinates of the
+// hit are its position in the plane of the polygon, measured from the first
+// vertex of the outline along two perpendicular unit axes.
+func (polygon *Polygon) ClosestHit(ray geom.Ray) (Hit, bool) {
+	return polygon.ClosestHitSegment(ray, epsilon, math.Inf(1))
+}
+
+func (polygon *Polygon) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	for _, triangle := range polygon.triangles {
+		if triangle.IntersectSegment(ray, tMin, tMax) {
+			return true
+		}
+	}
+	return false
+}
+
+func (polygon *Polygon) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	var closest Hit
+	found := false
+
+	for _, triangle := range polygon.triangles {
+		if hit, ok := triangle.ClosestHitSegment(ray, tMin, tMax); ok {
+			closest, found, tMax = hit, true, hit.T
+		}
+	}
+	if !found {
+		return Hit{}, false
+	}
+
+	offset := geom.Sub(closest.Point, polygon.origin)
+	closest.U = geom.Dot(offset, polygon.uAxis)
+	closest.V = geom.Dot(offset, polygon.vAxis)
+	closest.Primitive = polygon
+
+	return closest, true
+}
+
+func (polygon *Polygon) Bounds() AABB {
+	return polygon.bounds
+}
+
+// Triangles returns the triangles the polygon was split into.
+func (polygon *Polygon) Triangles() []Triangle {
+	return polygon.triangles
+}
+
+// newellNormal returns the unit normal of a polygon following its winding.
+func newellNormal(vertices []geom.Vector) geom.Vector {
+	var normal geom.Vector
+	for i := range vertices {
+		current, next := vertices[i], vertices[(i+1)%len(vertices)]
+		normal.X += (current.Y - next.Y) * (current.Z + next.Z)
+		normal.Y += (current.Z - next.Z) * (current.X + next.X)
+		normal.Z += (current.X - next.X) * (current.Y + next.Y)
+	}
+	return normalize(normal)
+}
+
+func signedArea(ring []point2) float64 {
+	var area float64
+	for i := range ring {
+		current, next := ring[i], ring[(i+1)%len(ring)]
+		area += current.x*next.y - next.x*current.y
+	}
+	return area / 2
+}
+
+func reverse(ring []point2) {
+	for i, j := 0, len(ring)-1; i < j; i, j = i+1, j-1 {
+		ring[i], ring[j] = ring[j], ring[i]
+	}
+}
+
+func cross2(o, a, b point2) float64 {
+	return (a.x-o.x)*(b.y-o.y) - (a.y-o.y)*(b.x-o.x)
+}
+
+func samePoint(a, b point2) bool {
+	return a.x == b.x && a.y == b.y
+}
+
+// segmentsCross reports whether the segments ab and cd cross at a point
+// interior to both of them.
+func segmentsCross(a, b, c, d point2) bool {
+	d1, d2 := cross2(a, b, c), cross2(a, b, d)
+	d3, d4 := cross2(c, d, a), cross2(c, d, b)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+// insideRing reports whether p is inside the ring by the even-odd rule.
+func insideRing(p point2, ring []point2) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.y > p.y) != (b.y > p.y) && p.x < (b.x-a.x)*(p.y-a.y)/(b.y-a.y)+a.x {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// bridgeHoles merges the holes into the outline by cutting a zero-width
+// channel from each hole to a vertex of the outline it can see. The result is
+// a single ring which ear clipping can handle.
+func bridgeHoles(ring []point2, holes [][]point2) ([]point2, error) {
+	// Holes are merged from right to left so that the bridges never cross
+	rightmost := func(hole []point2) int {
+		best := 0
+		for i, p := range hole {
+			if p.x > hole[best].x {
+				best = i
+			}
+		}
+		return best
+	}
+	order := make([]int, len(holes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := holes[order[i]], holes[order[j]]
+		return a[rightmost(a)].x > b[rightmost(b)].x
+	})
+
+	merged := make([]bool, len(holes))
+	for _, h := range order {
+		hole := holes[h]
+		m := hole[rightmost(hole)]
+
+		visible := func(p point2) bool {
+			if samePoint(p, m) {
+				return false
+			}
+			blocks := func(edges []point2) bool {
+				for i := range edges {
+					if segmentsCross(m, p, edges[i], edges[(i+1)%len(edges)]) {
+						return true
+					}
+				}
+				return false
+			}
+			if blocks(ring) {
+				return false
+			}
+			for i, other := range holes {
+				if (i == h || !merged[i]) && blocks(other) {
+					return false
+				}
+			}
+
+			// The bridge has to run through the inside of the polygon
+			mid := point2{x: (m.x + p.x) / 2, y: (m.y + p.y) / 2}
+			if !insideRing(mid, ring) {
+				return false
+			}
+			for i, other := range holes {
+				if !merged[i] && insideRing(mid, other) {
+					return false
+				}
+			}
+			return true
+		}
+
+		candidates := make([]int, len(ring))
+		for i := range candidates {
+			candidates[i] = i
+		}
+		distance := func(p point2) float64 {
+			return (p.x-m.x)*(p.x-m.x) + (p.y-m.y)*(p.y-m.y)
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return distance(ring[candidates[i]]) < distance(ring[candidates[j]])
+		})
+
+		bridge := -1
+		for _, candidate := range candidates {
+			if visible(ring[candidate]) {
+				bridge = candidate
+				break
+			}
+		}
+		if bridge < 0 {
+			return nil, fmt.Errorf("hole %d is not inside the polygon", h)
+		}
+
+		// Walk the outline up to the bridge, around the hole and back
+		start := rightmost(hole)
+		result := make([]point2, 0, len(ring)+len(hole)+2)
+		result = append(result, ring[:bridge+1]...)
+		for i := 0; i <= len(hole); i++ {
+			result = append(result, hole[(start+i)%len(hole)])
+		}
+		result = append(result, ring[bridge])
+		result = append(result, ring[bridge+1:]...)
+
+		ring = result
+		merged[h] = true
+	}
+
+	return ring, nil
+}
+
+// earClip triangulates a counterclockwise ring and returns the vertex indices
+// of the triangles.
+func earClip(ring []point2) ([][3]int, error) {
+	if signedArea(ring) < 0 {
+		reverse(ring)
+	}
+
+	remaining := make([]point2, len(ring))
+	copy(remaining, ring)
+	triangles := make([][3]int, 0, len(ring)-2)
+
+	for len(remaining) > 3 {
+		n := len(remaining)
+		clipped := false
+
+		for i := 0; i < n; i++ {
+			previous, current, next := remaining[(i+n-1)%n], remaining[i], remaining[(i+1)%n]
+			turn := cross2(previous, current, next)
+			if turn < 0 {
+				continue
+			}
+
+			if turn > 0 {
+				if containsAnyPoint(previous, current, next, remaining) {
+					continue
+				}
+				triangles = append(triangles, [3]int{previous.index, current.index, next.index})
+			}
+
+			// Collinear vertices are dropped without producing a triangle
+			remaining = append(remaining[:i], remaining[i+1:]...)
+			clipped = true
+			break
+		}
+
+		if !clipped {
+			return nil, errors.New("polygon is not simple")
+		}
+	}
+
+	if cross2(remaining[0], remaining[1], remaining[2]) > 0 {
+		triangles = append(triangles, [3]int{remaining[0].index, remaining[1].index, remaining[2].index})
+	}
+
+	return triangles, nil
+}
+
+// containsAnyPoint reports whether a point of the ring other than the corners
+// lies inside or on the border of the triangle abc.
+func containsAnyPoint(a, b, c point2, ring []point2) bool {
+	for _, p := range ring {
+		if samePoint(p, a) || samePoint(p, b) || samePoint(p, c) {
+			continue
+		}
+		if cross2(a, b, p) >= 0 && cross2(b, c, p) >= 0 && cross2(c, a, p) >= 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+func triangulatedArea(polygon *Polygon) float64 {
+	var area float64
+	for _, triangle := range polygon.Triangles() {
+		area += length(geom.Cross(geom.Sub(triangle.b, triangle.a), geom.Sub(triangle.c, triangle.a))) / 2
+	}
+	return area
+}
+
+func xyRing(points ...[2]float64) []geom.Vector {
+	ring := make([]geom.Vector, len(points))
+	for i, p := range points {
+		ring[i] = geom.NewVector(p[0], p[1], 0)
+	}
+	return ring
+}
+
+func downRay(x, y float64) geom.Ray {
+	return geom.NewRay(geom.NewVector(x, y, 2), geom.NewVector(0, 0, -1))
+}
+
+func TestPolygonConvex(t *testing.T) {
+	var prim geom.Intersectable
+
+	polygon, err := NewPolygon(xyRing([2]float64{0, 0}, [2]float64{2, 0}, [2]float64{3, 1}, [2]float64{2, 2}, [2]float64{0, 2}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	prim = polygon
+
+	if area := triangulatedArea(polygon); !almostEqual(area, 5) {
+		t.Errorf("Expected the triangles to cover an area of 5, got %v", area)
+	}
+	if ray := downRay(2.5, 1); !prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect polygon %#v but it did not.", ray, prim)
+	}
+	if ray := downRay(2.9, 1.5); prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to not intersect polygon %#v but it did.", ray, prim)
+	}
+}
+
+func TestPolygonConcave(t *testing.T) {
+	// An L-shaped floor plan given clockwise
+	polygon, err := NewPolygon(xyRing([2]float64{0, 0}, [2]float64{0, 4}, [2]float64{1, 4}, [2]float64{1, 1}, [2]float64{3, 1}, [2]float64{3, 0}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if area := triangulatedArea(polygon); !almostEqual(area, 6) {
+		t.Errorf("Expected the triangles to cover an area of 6, got %v", area)
+	}
+	for _, p := range [][2]float64{{0.5, 3.5}, {2.5, 0.5}, {0.5, 0.5}} {
+		if ray := downRay(p[0], p[1]); !polygon.Intersect(ray) {
+			t.Errorf("Expected ray %#v to intersect polygon but it did not.", ray)
+		}
+	}
+	for _, p := range [][2]float64{{2, 2}, {1.5, 1.5}, {2.9, 3.9}} {
+		if ray := downRay(p[0], p[1]); polygon.Intersect(ray) {
+			t.Errorf("Expected ray %#v to not intersect polygon but it did.", ray)
+		}
+	}
+}
+
+func TestPolygonWithHoles(t *testing.T) {
+	outline := xyRing([2]float64{0, 0}, [2]float64{10, 0}, [2]float64{10, 10}, [2]float64{0, 10})
+	window1 := xyRing([2]float64{1, 1}, [2]float64{4, 1}, [2]float64{4, 4}, [2]float64{1, 4})
+	window2 := xyRing([2]float64{6, 6}, [2]float64{6, 9}, [2]float64{9, 9}, [2]float64{9, 6})
+	window3 := xyRing([2]float64{6, 1}, [2]float64{9, 1}, [2]float64{7.5, 4})
+
+	polygon, err := NewPolygon(outline, window1, window2, window3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if area := triangulatedArea(polygon); !almostEqual(area, 100-9-9-4.5) {
+		t.Errorf("Expected the triangles to cover an area of %v, got %v", 100-9-9-4.5, area)
+	}
+	for _, p := range [][2]float64{{0.5, 0.5}, {5, 5}, {9.5, 9.5}, {2, 8}, {6.2, 3.8}} {
+		if ray := downRay(p[0], p[1]); !polygon.Intersect(ray) {
+			t.Errorf("Expected ray %#v to intersect polygon but it did not.", ray)
+		}
+	}
+	for _, p := range [][2]float64{{2, 2}, {3.5, 1.5}, {7, 7}, {7.5, 2}, {11, 5}} {
+		if ray := downRay(p[0], p[1]); polygon.Intersect(ray) {
+			t.Errorf("Expected ray %#v to not intersect polygon but it did.", ray)
+		}
+	}
+}
+
+func TestPolygonTiltedHit(t *testing.T) {
+	// A square facade in the plane x = z
+	outline := []geom.Vector{
+		geom.NewVector(0, 0, 0),
+		geom.NewVector(2, 0, 2),
+		geom.NewVector(2, 2, 2),
+		geom.NewVector(0, 2, 0),
+	}
+	polygon, err := NewPolygon(outline)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ray := geom.NewRay(geom.NewVector(1, 1, 5), geom.NewVector(0, 0, -1))
+	hit, ok := polygon.ClosestHit(ray)
+	if !ok {
+		t.Fatalf("Expected ray %#v to hit polygon but it did not.", ray)
+	}
+	if !vectorsAlmostEqual(hit.Point, geom.NewVector(1, 1, 1)) {
+		t.Errorf("Expected hit point (1, 1, 1), got %#v", hit.Point)
+	}
+	if hit.Primitive != geom.Intersectable(polygon) {
+		t.Errorf("Expected hit primitive %#v, got %#v", polygon, hit.Primitive)
+	}
+
+	// The plane coordinates are distances from the first vertex
+	if d := hit.U*hit.U + hit.V*hit.V; !almostEqual(d, 3) {
+		t.Errorf("Expected the hit to be at squared distance 3 in the plane, got %v", d)
+	}
+}
+
+func TestPolygonErrors(t *testing.T) {
+	square := xyRing([2]float64{0, 0}, [2]float64{1, 0}, [2]float64{1, 1}, [2]float64{0, 1})
+
+	if _, err := NewPolygon(square[:2]); err == nil {
+		t.Errorf("Expected an error for a polygon with two vertices")
+	}
+	if _, err := NewPolygon(xyRing([2]float64{0, 0}, [2]float64{1, 1}, [2]float64{2, 2})); err == nil {
+		t.Errorf("Expected an error for a polygon without area")
+	}
+
+	bent := append([]geom.Vector{}, square...)
+	bent[2] = geom.NewVector(1, 1, 0.5)
+	if _, err := NewPolygon(bent); err == nil {
+		t.Errorf("Expected an error for a polygon which is not planar")
+	}
+
+	outside := xyRing([2]float64{2, 2}, [2]float64{3, 2}, [2]float64{3, 3})
+	if _, err := NewPolygon(square, outside); err == nil {
+		t.Errorf("Expected an error for a hole outside of the polygon")
+	}
+}
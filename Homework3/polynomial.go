@@ -0,0 +1,162 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// polynomialEpsilon is how close to zero a coefficient of the reduced
+// equations has to be to count as zero. The equations are scaled so that
+// their roots are about one in size first, which makes it relative to them.
+const polynomialEpsilon = 1e-9
+
+func nearZero(x float64) bool {
+	return x > -polynomialEpsilon && x < polynomialEpsilon
+}
+
+// rootScale returns about how large the roots of the monic polynomial
+// x^n + c[0]*x^(n-1) + ... + c[n-1] are: the largest of |c[i]|^(1/(i+1)),
+// rounded to a power of two, or one if they are all zero. Substituting
+// x = s*y for it gives a polynomial whose coefficients are about one at
+// most, without rounding them.
+func rootScale(c ...float64) float64 {
+	s := 0.0
+	for i, coefficient := range c {
+		s = math.Max(s, math.Pow(math.Abs(coefficient), 1/float64(i+1)))
+	}
+	if s == 0 || math.IsInf(s, 0) || math.IsNaN(s) {
+		return 1
+	}
+	_, exponent := math.Frexp(s)
+	return math.Ldexp(1, exponent)
+}
+
+// quadraticRoots returns the real roots of a*x^2 + b*x + c in ascending
+// order. When a is zero the equation is solved as a linear one.
+func quadraticRoots(a, b, c float64) []float64 {
+	if a == 0 {
+		if b == 0 {
+			return nil
+		}
+		return []float64{-c / b}
+	}
+
+	discriminant := b*b - 4*a*c
+	if discriminant < 0 {
+		return nil
+	}
+
+	x1, x2 := solveQuadraticEquation(a, b, c, discriminant)
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	return []float64{x1, x2}
+}
+
+// cubicRoots returns the real roots of x^3 + a*x^2 + b*x + c by Cardano's
+// method.
+func cubicRoots(a, b, c float64) []float64 {
+	s := rootScale(a, b, c)
+	a, b, c = a/s, b/(s*s), c/(s*s*s)
+
+	// Substitute x = y - a/3 to get y^3 + 3*p*y + 2*q = 0
+	p := (b - a*a/3) / 3
+	q := (2*a*a*a/27 - a*b/3 + c) / 2
+	d := q*q + p*p*p
+
+	var roots []float64
+	switch {
+	case nearZero(d):
+		if nearZero(q) {
+			roots = []float64{0}
+		} else {
+			u := math.Cbrt(-q)
+			roots = []float64{2 * u, -u}
+		}
+	case d < 0:
+		// Three real roots, found by the trigonometric method
+		phi := math.Acos(-q/math.Sqrt(-p*p*p)) / 3
+		t := 2 * math.Sqrt(-p)
+		roots = []float64{t * math.Cos(phi), -t * math.Cos(phi+math.Pi/3), -t * math.Cos(phi-math.Pi/3)}
+	default:
+		s := math.Sqrt(d)
+		roots = []float64{math.Cbrt(s-q) - math.Cbrt(s+q)}
+	}
+
+	for i := range roots {
+		roots[i] = (roots[i] - a/3) * s
+	}
+	return roots
+}
+
+// quarticRoots returns the real roots of
+// c[4]*x^4 + c[3]*x^3 + c[2]*x^2 + c[1]*x + c[0] in ascending order. They
+// are found by Ferrari's method and refined with a few Newton steps, since
+// the closed form loses precision.
+func quarticRoots(c [5]float64) []float64 {
+	if c[4] == 0 {
+		return nil
+	}
+	a, b, cc, d := c[3]/c[4], c[2]/c[4], c[1]/c[4], c[0]/c[4]
+	s := rootScale(a, b, cc, d)
+	a, b, cc, d = a/s, b/(s*s), cc/(s*s*s), d/(s*s*s*s)
+
+	// Substitute x = y - a/4 to get y^4 + p*y^2 + q*y + r = 0
+	a2 := a * a
+	p := -3*a2/8 + b
+	q := a2*a/8 - a*b/2 + cc
+	r := -3*a2*a2/256 + a2*b/16 - a*cc/4 + d
+
+	var roots []float64
+	if nearZero(r) {
+		// y * (y^3 + p*y + q) = 0
+		roots = append(cubicRoots(0, p, q), 0)
+	} else {
+		// A root of the resolvent cubic with z*z >= r and 2*z >= p splits
+		// the quartic into two quadratics. When the quartic has real roots
+		// the largest one does.
+		z := math.Inf(-1)
+		for _, root := range cubicRoots(-p/2, -r, r*p/2-q*q/8) {
+			z = math.Max(z, root)
+		}
+
+		u, v := z*z-r, 2*z-p
+		switch {
+		case nearZero(u):
+			u = 0
+		case u > 0:
+			u = math.Sqrt(u)
+		default:
+			return nil
+		}
+		switch {
+		case nearZero(v):
+			v = 0
+		case v > 0:
+			v = math.Sqrt(v)
+		default:
+			return nil
+		}
+
+		if q < 0 {
+			v = -v
+		}
+		roots = append(quadraticRoots(1, v, z-u), quadraticRoots(1, -v, z+u)...)
+	}
+
+	for i := range roots {
+		x := (roots[i] - a/4) * s
+		for step := 0; step < 4; step++ {
+			value := (((c[4]*x+c[3])*x+c[2])*x+c[1])*x + c[0]
+			slope := ((4*c[4]*x+3*c[3])*x+2*c[2])*x + c[1]
+			if slope == 0 {
+				break
+			}
+			x -= value / slope
+		}
+		roots[i] = x
+	}
+
+	sort.Float64s(roots)
+	return roots
+}
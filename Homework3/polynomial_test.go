@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuarticRootsDoubleResolventRoot(t *testing.T) {
+	// (x - 1)^2 (x^2 + 2x - 5), whose resolvent cubic has the single root
+	// -2 below the double root -1
+	roots := quarticRoots([5]float64{-5, 12, -8, 0, 1})
+
+	expected := []float64{-1 - math.Sqrt(6), 1, -1 + math.Sqrt(6)}
+	for _, root := range expected {
+		found := false
+		for _, got := range roots {
+			found = found || math.Abs(got-root) < 1e-6
+		}
+		if !found {
+			t.Errorf("Expected %v to be a root, got %v", root, roots)
+		}
+	}
+}
+
+func TestQuarticRootsFromFactors(t *testing.T) {
+	cases := [][4]float64{
+		{-3, -1, 2, 5},
+		{-1, -1, 1, 1},
+		{0.5, 0.5, 0.5, 2},
+		{-2, 0, 0, 2},
+	}
+	for _, factors := range cases {
+		// Multiply out (x - f0)(x - f1)(x - f2)(x - f3)
+		c := [5]float64{1}
+		for _, f := range factors {
+			for i := 4; i > 0; i-- {
+				c[i] = c[i-1] - f*c[i]
+			}
+			c[0] *= -f
+		}
+
+		roots := quarticRoots(c)
+		for _, f := range factors {
+			found := false
+			for _, got := range roots {
+				found = found || math.Abs(got-f) < 1e-5
+			}
+			if !found {
+				t.Errorf("Expected %v to be a root of %v, got %v", f, c, roots)
+			}
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+// quadOrientations are the bases of planes a 2D quad is embedded in.
+var quadOrientations = []struct {
+	name   string
+	origin geom.Vector
+	u, v   geom.Vector
+}{
+	{"XY", geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0), geom.NewVector(0, 1, 0)},
+	{"XZ", geom.NewVector(1, 2, 3), geom.NewVector(1, 0, 0), geom.NewVector(0, 0, 1)},
+	{"YZ", geom.NewVector(-3, 0, 1), geom.NewVector(0, 1, 0), geom.NewVector(0, 0, 1)},
+	{"ZX", geom.NewVector(0, 5, 0), geom.NewVector(0, 0, 1), geom.NewVector(1, 0, 0)},
+	{"Tilted", geom.NewVector(2, -1, 4),
+		normalize(geom.NewVector(1, -1, 0)), normalize(geom.NewVector(1, 1, -2))},
+}
+
+func embed(origin, u, v geom.Vector, x, y float64) geom.Vector {
+	return geom.Add(origin, geom.Add(scale(u, x), scale(v, y)))
+}
+
+// quadRayTest embeds the 2D quad in every orientation, in both windings, and
+// checks rays shot perpendicularly at the given 2D points.
+func quadRayTest(t *testing.T, corners [4][2]float64, inside, outside [][2]float64) {
+	for _, orientation := range quadOrientations {
+		o, u, v := orientation.origin, orientation.u, orientation.v
+		normal := geom.Cross(u, v)
+
+		var vertices [4]geom.Vector
+		for i, corner := range corners {
+			vertices[i] = embed(o, u, v, corner[0], corner[1])
+		}
+
+		quads := map[string]Quad{
+			"forward":  NewQuad(vertices[0], vertices[1], vertices[2], vertices[3]),
+			"backward": NewQuad(vertices[3], vertices[2], vertices[1], vertices[0]),
+		}
+
+		for winding, quad := range quads {
+			name := fmt.Sprintf("%s/%s", orientation.name, winding)
+
+			if !quad.Planar() {
+				t.Errorf("%s: expected quad %#v to be planar", name, quad)
+			}
+
+			for _, point := range inside {
+				ray := geom.NewRay(geom.Add(embed(o, u, v, point[0], point[1]), scale(normal, 3)), scale(normal, -1))
+				if !quad.Intersect(ray) {
+					t.Errorf("%s: expected ray %#v to intersect quad %#v but it did not.", name, ray, quad)
+				}
+				if hit, ok := quad.ClosestHit(ray); !ok || !almostEqual(hit.T, 3) {
+					t.Errorf("%s: expected ray %#v to hit quad %#v at 3, got %v at %v", name, ray, quad, ok, hit.T)
+				}
+			}
+
+			for _, point := range outside {
+				ray := geom.NewRay(geom.Add(embed(o, u, v, point[0], point[1]), scale(normal, 3)), scale(normal, -1))
+				if quad.Intersect(ray) {
+					t.Errorf("%s: expected ray %#v to not intersect quad %#v but it did.", name, ray, quad)
+				}
+			}
+		}
+	}
+}
+
+func TestQuadConvexInEveryOrientation(t *testing.T) {
+	corners := [4][2]float64{{0, -2}, {3, 0}, {0, 1}, {-1, 0}}
+	inside := [][2]float64{{0, 0}, {2, 0.1}, {-0.5, 0.2}, {0.1, -1.5}}
+	outside := [][2]float64{{3, 1}, {-1, 1}, {-1, -1}, {2, -1.5}}
+
+	quadRayTest(t, corners, inside, outside)
+}
+
+func TestQuadConcaveInEveryOrientation(t *testing.T) {
+	// A dart with its reflex vertex at (1, 1)
+	dart := [4][2]float64{{0, 0}, {4, 0}, {1, 1}, {0, 4}}
+	inside := [][2]float64{{0.5, 0.5}, {3, 0.2}, {0.2, 3}}
+	outside := [][2]float64{{1.5, 1.5}, {2, 1.9}, {1.9, 2}}
+
+	// Rotate the vertices so that the reflex one comes at every index
+	for shift := 0; shift < 4; shift++ {
+		var corners [4][2]float64
+		for i := range corners {
+			corners[i] = dart[(i+shift)%4]
+		}
+
+		quadRayTest(t, corners, inside, outside)
+	}
+}
+
+func TestQuadReflexVertex(t *testing.T) {
+	a, b, c, d := geom.NewVector(0, 0, 0), geom.NewVector(0, 4, 0), geom.NewVector(0, 1, 1), geom.NewVector(0, 0, 4)
+	quad := NewQuad(a, b, c, d)
+
+	if reflex := quad.reflexVertex(); reflex != 2 {
+		t.Errorf("Expected the reflex vertex of quad %#v in the YZ plane to be 2, got %d", quad, reflex)
+	}
+}
+
+func TestNonPlanarQuadIntersectsAsBilinearPatch(t *testing.T) {
+	// A saddle whose height is z = u*v
+	a, b, c, d := geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0), geom.NewVector(1, 1, 1), geom.NewVector(0, 1, 0)
+	quad := NewQuad(a, b, c, d)
+
+	if quad.Planar() {
+		t.Fatalf("Expected quad %#v to not be planar", quad)
+	}
+
+	for _, point := range [][2]float64{{0.5, 0.5}, {0.1, 0.9}, {0.8, 0.3}, {0.95, 0.95}} {
+		x, y := point[0], point[1]
+		ray := geom.NewRay(geom.NewVector(x, y, 5), geom.NewVector(0, 0, -1))
+
+		if !quad.Intersect(ray) {
+			t.Errorf("Expected ray %#v to intersect quad %#v but it did not.", ray, quad)
+		}
+
+		hit, ok := quad.ClosestHit(ray)
+		if !ok {
+			t.Errorf("Expected ray %#v to hit quad %#v but it did not.", ray, quad)
+			continue
+		}
+		if !almostEqual(hit.T, 5-x*y) {
+			t.Errorf("Expected ray %#v to hit at %v, got %v", ray, 5-x*y, hit.T)
+		}
+		if !almostEqual(hit.U, x) || !almostEqual(hit.V, y) {
+			t.Errorf("Expected patch coordinates (%v, %v), got (%v, %v)", x, y, hit.U, hit.V)
+		}
+
+		// The normal of z = xy is (-y, -x, 1)
+		expected := normalize(geom.NewVector(-y, -x, 1))
+		if !vectorsAlmostEqual(hit.Normal, expected) {
+			t.Errorf("Expected normal %#v, got %#v", expected, hit.Normal)
+		}
+	}
+
+	for _, point := range [][2]float64{{1.5, 0.5}, {-0.1, 0.5}, {0.5, 1.01}} {
+		ray := geom.NewRay(geom.NewVector(point[0], point[1], 5), geom.NewVector(0, 0, -1))
+		if quad.Intersect(ray) {
+			t.Errorf("Expected ray %#v to not intersect quad %#v but it did.", ray, quad)
+		}
+	}
+}
+
+func TestNonPlanarQuadSideways(t *testing.T) {
+	a, b, c, d := geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0), geom.NewVector(1, 1, 1), geom.NewVector(0, 1, 0)
+	quad := NewQuad(a, b, c, d)
+
+	// A ray along the X axis at height z crosses the saddle where x*y = z
+	ray := geom.NewRay(geom.NewVector(-1, 0.5, 0.25), geom.NewVector(2, 0, 0))
+
+	hit, ok := quad.ClosestHit(ray)
+	if !ok {
+		t.Fatalf("Expected ray %#v to hit quad %#v but it did not.", ray, quad)
+	}
+	if !vectorsAlmostEqual(hit.Point, geom.NewVector(0.5, 0.5, 0.25)) {
+		t.Errorf("Expected hit point (0.5, 0.5, 0.25), got %#v", hit.Point)
+	}
+	if !almostEqual(hit.T, 0.75) {
+		t.Errorf("Expected hit distance 0.75, got %v", hit.T)
+	}
+}
+
+// legacyQuadIntersect is the original implementation of Quad.Intersect, which
+// tests the two triangles in separate goroutines. It is kept as a baseline for
+// the benchmarks.
+func legacyQuadIntersect(quad Quad, ray geom.Ray) bool {
+	var firstTriangle, secondTriangle Triangle
+
+	if legacyIsConvex(quad) {
+		firstTriangle = NewTriangle(quad.a, quad.c, quad.b)
+		secondTriangle = NewTriangle(quad.a, quad.c, quad.d)
+	} else {
+		firstTriangle = NewTriangle(quad.b, quad.d, quad.a)
+		secondTriangle = NewTriangle(quad.b, quad.d, quad.c)
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var foundIntersection bool
+
+	checkIntersection := func(triangle *Triangle) {
+		defer wg.Done()
+		result := triangle.Intersect(ray)
+		mutex.Lock()
+		foundIntersection = foundIntersection || result
+		mutex.Unlock()
+	}
+
+	wg.Add(2)
+	go checkIntersection(&firstTriangle)
+	go checkIntersection(&secondTriangle)
+	wg.Wait()
+
+	return foundIntersection
+}
+
+func legacyIsConvex(quad Quad) bool {
+	var sign bool
+	vertices := []geom.Vector{quad.a, quad.b, quad.c, quad.d}
+	n := len(vertices)
+
+	for i := 0; i < n; i++ {
+		dx1 := vertices[(i+2)%n].X - vertices[(i+1)%n].X
+		dy1 := vertices[(i+2)%n].Y - vertices[(i+1)%n].Y
+
+		dx2 := vertices[i].X - vertices[(i+1)%n].X
+		dy2 := vertices[i].Y - vertices[(i+1)%n].Y
+
+		zcross := dx1*dy2 - dy1*dx2
+
+		if i == 0 {
+			sign = zcross > 0
+		} else if sign != (zcross > 0) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func randomQuadRays(rng *rand.Rand, n int) []geom.Ray {
+	rays := make([]geom.Ray, n)
+	for i := range rays {
+		rays[i] = geom.NewRay(
+			geom.NewVector(rng.Float64()*6-2, rng.Float64()*6-3, 3),
+			geom.NewVector(rng.Float64()-0.5, rng.Float64()-0.5, -1),
+		)
+	}
+	return rays
+}
+
+func TestQuadIntersectMatchesLegacy(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	quads := []Quad{
+		NewQuad(geom.NewVector(0, -2, 0), geom.NewVector(3, 0, 0), geom.NewVector(0, 1, 0), geom.NewVector(-1, 0, 0)),
+		NewQuad(geom.NewVector(0, -2, 0), geom.NewVector(3, 0, 0), geom.NewVector(0, 1, 0), geom.NewVector(1, 0, 0)),
+	}
+
+	for _, quad := range quads {
+		for _, ray := range randomQuadRays(rng, 2000) {
+			if expected := legacyQuadIntersect(quad, ray); quad.Intersect(ray) != expected {
+				t.Fatalf("Expected ray %#v against quad %#v to return %v", ray, quad, expected)
+			}
+		}
+	}
+}
+
+func TestQuadIntersectDoesNotAllocate(t *testing.T) {
+	quad := NewQuad(geom.NewVector(0, -2, 0), geom.NewVector(3, 0, 0), geom.NewVector(0, 1, 0), geom.NewVector(-1, 0, 0))
+	ray := geom.NewRay(geom.NewVector(0, 0, 2), geom.NewVector(0, 0, -1))
+
+	if allocs := testing.AllocsPerRun(100, func() { quad.Intersect(ray) }); allocs != 0 {
+		t.Errorf("Expected Quad.Intersect to not allocate, got %v allocations per call", allocs)
+	}
+}
+
+func benchmarkQuad(b *testing.B, intersect func(Quad, geom.Ray) bool) {
+	quad := NewQuad(geom.NewVector(0, -2, 0), geom.NewVector(3, 0, 0), geom.NewVector(0, 1, 0), geom.NewVector(-1, 0, 0))
+	rays := randomQuadRays(rand.New(rand.NewSource(1)), 1024)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		intersect(quad, rays[i%len(rays)])
+	}
+}
+
+func BenchmarkQuadIntersect(b *testing.B) {
+	benchmarkQuad(b, Quad.Intersect)
+}
+
+func BenchmarkQuadIntersectLegacy(b *testing.B) {
+	benchmarkQuad(b, legacyQuadIntersect)
+}
+
+func BenchmarkQuadClosestHit(b *testing.B) {
+	benchmarkQuad(b, func(quad Quad, ray geom.Ray) bool {
+		_, ok := quad.ClosestHit(ray)
+		return ok
+	})
+}
+
+func BenchmarkNonPlanarQuadIntersect(b *testing.B) {
+	quad := NewQuad(geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0), geom.NewVector(1, 1, 1), geom.NewVector(0, 1, 0))
+	rays := randomQuadRays(rand.New(rand.NewSource(1)), 1024)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		quad.Intersect(rays[i%len(rays)])
+	}
+}
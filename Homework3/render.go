@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/fmi/go-homework/geom"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// shadowBias is how far shadow rays start off the surface so that they do
+// not hit it again because of rounding.
+const shadowBias = 1e-4
+
+// Color is a linear RGB color. Components are not limited to [0, 1] until
+// the color is written to an image.
+type Color struct {
+	R, G, B float64
+}
+
+func (c Color) add(other Color) Color {
+	return Color{R: c.R + other.R, G: c.G + other.G, B: c.B + other.B}
+}
+
+func (c Color) mul(other Color) Color {
+	return Color{R: c.R * other.R, G: c.G * other.G, B: c.B * other.B}
+}
+
+func (c Color) scale(s float64) Color {
+	return Color{R: c.R * s, G: c.G * s, B: c.B * s}
+}
+
+func (c Color) maxComponent() float64 {
+	return math.Max(c.R, math.Max(c.G, c.B))
+}
+
+// rgba converts the linear color to an 8-bit sRGB one.
+func (c Color) rgba() color.RGBA {
+	encode := func(x float64) uint8 {
+		x = math.Max(0, math.Min(1, x))
+		return uint8(math.Round(255 * math.Pow(x, 1/2.2)))
+	}
+	return color.RGBA{R: encode(c.R), G: encode(c.G), B: encode(c.B), A: 255}
+}
+
+// PointLight emits light in all directions from a single point. Its
+// contribution falls off with the square of the distance.
+type PointLight struct {
+	Position  geom.Vector
+	Color     Color
+	Intensity float64
+}
+
+// Object is a primitive placed in a scene along with its diffuse color.
+// PathTrace uses Material instead of the color if it is set.
+type Object struct {
+	Primitive Primitive
+	Color     Color
+	Material  Material
+}
+
+// Scene is everything needed to render an image.
+type Scene struct {
+	Camera     Camera
+	Objects    []Object
+	Lights     []PointLight
+	Ambient    Color
+	Background Color
+
+	// TriangleMode selects how the triangles of the objects are intersected
+	// while rendering. The objects themselves are not changed.
+	TriangleMode TriangleMode
+}
+
+// prepared returns the scene with its objects switched to the triangle mode
+// of the scene.
+func (scene *Scene) prepared() *Scene {
+	if scene.TriangleMode == FastTriangles {
+		return scene
+	}
+
+	result := *scene
+	result.Objects = make([]Object, len(scene.Objects))
+	for i, object := range scene.Objects {
+		object.Primitive = WithTriangleMode(object.Primitive, scene.TriangleMode)
+		result.Objects[i] = object
+	}
+	return &result
+}
+
+// trace returns the nearest hit among the objects of the scene and the index
+// of the object that was hit.
+func (scene *Scene) trace(ray geom.Ray) (Hit, int, bool) {
+	var closest Hit
+	object := -1
+
+	for i := range scene.Objects {
+		hit, ok := scene.Objects[i].Primitive.ClosestHit(ray)
+		if ok && (object < 0 || hit.T < closest.T) {
+			closest, object = hit, i
+		}
+	}
+
+	return closest, object, object >= 0
+}
+
+// occluded reports whether anything blocks the segment from point to target.
+func (scene *Scene) occluded(point, target geom.Vector) bool {
+	// With the target at parameter 1 anything behind it is left out
+	ray := geom.NewRay(point, geom.Sub(target, point))
+	for i := range scene.Objects {
+		if scene.Objects[i].Primitive.IntersectSegment(ray, 0, 1) {
+			return true
+		}
+	}
+	return false
+}
+
+// shade returns the color seen along the ray using Lambert's cosine law.
+func (scene *Scene) shade(ray geom.Ray) Color {
+	// Fisheye cameras give rays with no direction where they see nothing
+	if ray.Direction == (geom.Vector{}) {
+		return scene.Background
+	}
+
+	hit, object, ok := scene.trace(ray)
+	if !ok {
+		return scene.Background
+	}
+
+	return scene.Objects[object].Color.mul(scene.Ambient.add(scene.directLight(ray, hit)))
+}
+
+// directLight returns the light the point lights shed on the hit, weighted
+// by Lambert's cosine law.
+func (scene *Scene) directLight(ray geom.Ray, hit Hit) Color {
+	// Light the side of the surface which faces the viewer
+	normal := towards(hit.Normal, ray.Direction)
+	origin := geom.Add(hit.Point, scale(normal, shadowBias))
+
+	var light Color
+	for _, source := range scene.Lights {
+		toLight := geom.Sub(source.Position, hit.Point)
+		distance := length(toLight)
+		cosine := geom.Dot(normal, toLight) / distance
+		if cosine <= 0 || scene.occluded(origin, source.Position) {
+			continue
+		}
+
+		light = light.add(source.Color.scale(source.Intensity * cosine / (distance * distance)))
+	}
+
+	return light
+}
+
+// Render traces one ray through the center of every pixel.
+func (scene *Scene) Render(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	renderTile(context.Background(), img, img.Bounds(), scene.prepared().shadePixel)
+	return img
+}
+
+// pixelShader returns the color of the pixel (x, y) of a width x height
+// image. It is called concurrently for different pixels.
+type pixelShader func(x, y, width, height int) Color
+
+// shadePixel shades the ray through the center of the pixel.
+func (scene *Scene) shadePixel(x, y, width, height int) Color {
+	return scene.shade(scene.Camera.Ray(float64(x)+0.5, float64(y)+0.5, width, height))
+}
+
+// renderTile renders the pixels of img inside tile. It returns false if the
+// context was cancelled before the tile was finished.
+func renderTile(ctx context.Context, img *image.RGBA, tile image.Rectangle, shader pixelShader) bool {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	for y := tile.Min.Y; y < tile.Max.Y; y++ {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		for x := tile.Min.X; x < tile.Max.X; x++ {
+			img.SetRGBA(x, y, shader(x, y, width, height).rgba())
+		}
+	}
+
+	return true
+}
+
+// RenderToFile renders the scene and writes it to path. The format is chosen
+// by the extension of the file, which must be .png or .ppm.
+func (scene *Scene) RenderToFile(path string, width, height int) error {
+	var encode func(io.Writer, image.Image) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		encode = png.Encode
+	case ".ppm":
+		encode = EncodePPM
+	default:
+		return fmt.Errorf("unsupported image format %q", filepath.Ext(path))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := encode(file, scene.Render(width, height)); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// EncodePPM writes the image in the binary PPM (P6) format.
+func EncodePPM(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	out := bufio.NewWriter(w)
+
+	if _, err := fmt.Fprintf(out, "P6\n%d %d\n255\n", bounds.Dx(), bounds.Dy()); err != nil {
+		return err
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			if _, err := out.Write([]byte{c.R, c.G, c.B}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return out.Flush()
+}
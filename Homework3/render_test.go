@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+func testScene() *Scene {
+	floor := NewQuad(
+		geom.NewVector(-10, -1, -10),
+		geom.NewVector(10, -1, -10),
+		geom.NewVector(10, -1, 10),
+		geom.NewVector(-10, -1, 10),
+	)
+
+	return &Scene{
+		Camera: NewCamera(geom.NewVector(0, 0, 5), geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0), 60),
+		Objects: []Object{
+			{Primitive: NewSphere(geom.NewVector(0, 0, 0), 1), Color: Color{R: 1, G: 0.2, B: 0.2}},
+			{Primitive: floor, Color: Color{R: 0.8, G: 0.8, B: 0.8}},
+		},
+		Lights: []PointLight{
+			{Position: geom.NewVector(10, 10, 0), Color: Color{R: 1, G: 1, B: 1}, Intensity: 100},
+		},
+		Ambient:    Color{R: 0.05, G: 0.05, B: 0.05},
+		Background: Color{R: 0, G: 0, B: 0.5},
+	}
+}
+
+func TestCameraRayThroughCenter(t *testing.T) {
+	camera := NewCamera(geom.NewVector(0, 0, 5), geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0), 90)
+
+	ray := camera.Ray(50, 25, 100, 50)
+	if !vectorsAlmostEqual(ray.Direction, geom.NewVector(0, 0, -1)) {
+		t.Errorf("Expected the central ray to look along -Z, got %#v", ray.Direction)
+	}
+
+	// With a 90 degree field of view the top edge is at 45 degrees
+	ray = camera.Ray(50, 0, 100, 50)
+	if !vectorsAlmostEqual(ray.Direction, normalize(geom.NewVector(0, 1, -1))) {
+		t.Errorf("Expected the top ray to look up at 45 degrees, got %#v", ray.Direction)
+	}
+
+	// The left edge is wider by the aspect ratio
+	ray = camera.Ray(0, 25, 100, 50)
+	if !vectorsAlmostEqual(ray.Direction, normalize(geom.NewVector(-2, 0, -1))) {
+		t.Errorf("Expected the left ray to follow the aspect ratio, got %#v", ray.Direction)
+	}
+}
+
+func TestRenderSphereOverFloor(t *testing.T) {
+	scene := testScene()
+	img := scene.Render(64, 64)
+
+	background := scene.Background.rgba()
+	if c := img.RGBAAt(0, 0); c != background {
+		t.Errorf("Expected the top left corner to be the background %v, got %v", background, c)
+	}
+
+	// The top of the sphere faces the light
+	if c := img.RGBAAt(32, 24); c.R <= c.G || c.R < 100 {
+		t.Errorf("Expected the top of the sphere to be lit red, got %v", c)
+	}
+
+	// The light comes from the right, so the sphere casts its shadow to the left
+	lit, shadowed := img.RGBAAt(48, 43), img.RGBAAt(15, 43)
+	if shadowed.G >= lit.G {
+		t.Errorf("Expected the floor in the shadow %v to be darker than the lit floor %v", shadowed, lit)
+	}
+}
+
+func TestEncodePPM(t *testing.T) {
+	scene := testScene()
+	img := scene.Render(4, 3)
+
+	var buffer bytes.Buffer
+	if err := EncodePPM(&buffer, img); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	header := []byte("P6\n4 3\n255\n")
+	if !bytes.HasPrefix(buffer.Bytes(), header) {
+		t.Errorf("Expected the PPM to start with %q, got %q", header, buffer.Bytes()[:len(header)])
+	}
+	if size := buffer.Len(); size != len(header)+4*3*3 {
+		t.Errorf("Expected %d bytes, got %d", len(header)+4*3*3, size)
+	}
+
+	c := img.RGBAAt(0, 0)
+	if pixel := buffer.Bytes()[len(header):][:3]; pixel[0] != c.R || pixel[1] != c.G || pixel[2] != c.B {
+		t.Errorf("Expected the first pixel to be %v, got %v", c, pixel)
+	}
+}
+
+func TestRenderToFile(t *testing.T) {
+	dir := t.TempDir()
+	scene := testScene()
+	path := filepath.Join(dir, "scene.png")
+	if err := scene.RenderToFile(path, 16, 8); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer file.Close()
+
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatalf("Expected a valid PNG, got %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != 16 || size.Y != 8 {
+		t.Errorf("Expected a 16x8 image, got %v", size)
+	}
+
+	if err := scene.RenderToFile(filepath.Join(dir, "scene.bmp"), 16, 8); err == nil {
+		t.Errorf("Expected an error for an unsupported format")
+	}
+}
@@ -0,0 +1,1133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/fmi/go-homework/geom"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SceneFormat is the encoding of a scene file.
+type SceneFormat int
+
+const (
+	JSONScene SceneFormat = iota
+	YAMLScene
+)
+
+// SceneFormatOf returns the format of a scene file from its extension.
+func SceneFormatOf(path string) (SceneFormat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSONScene, nil
+	case ".yaml", ".yml":
+		return YAMLScene, nil
+	}
+	return 0, fmt.Errorf("unknown scene file extension %q", filepath.Ext(path))
+}
+
+// SceneDescription is the declarative form of a Scene kept in scene files.
+// Vectors and colors are lists of three numbers.
+type SceneDescription struct {
+	Camera       CameraDescription              `json:"camera"`
+	Ambient      []float64                      `json:"ambient,omitempty"`
+	Background   []float64                      `json:"background,omitempty"`
+	TriangleMode string                         `json:"triangle_mode,omitempty"`
+	Materials    map[string]MaterialDescription `json:"materials,omitempty"`
+	Lights       []LightDescription             `json:"lights,omitempty"`
+	Objects      []ObjectDescription            `json:"objects"`
+}
+
+// CameraDescription describes a camera. Type is perspective (the default),
+// thin_lens, orthographic or fisheye and selects the constructor the other
+// fields are passed to. Up defaults to +Y.
+type CameraDescription struct {
+	Type          string    `json:"type,omitempty"`
+	Position      []float64 `json:"position"`
+	LookAt        []float64 `json:"look_at"`
+	Up            []float64 `json:"up,omitempty"`
+	FOV           float64   `json:"fov,omitempty"`
+	Height        float64   `json:"height,omitempty"`
+	Aperture      float64   `json:"aperture,omitempty"`
+	FocusDistance float64   `json:"focus_distance,omitempty"`
+}
+
+// MaterialDescription is a named material which objects refer to. Type is
+// diffuse (the default), metal, dielectric or emissive. Color is the albedo,
+// or the emitted light of emissive materials. Dielectrics have an IOR
+// instead and their color, white by default, is only used by Render.
+type MaterialDescription struct {
+	Type  string    `json:"type,omitempty"`
+	Color []float64 `json:"color,omitempty"`
+	Fuzz  float64   `json:"fuzz,omitempty"`
+	IOR   float64   `json:"ior,omitempty"`
+}
+
+// LightDescription describes a point light. Color defaults to white.
+type LightDescription struct {
+	Position  []float64 `json:"position"`
+	Color     []float64 `json:"color,omitempty"`
+	Intensity float64   `json:"intensity"`
+}
+
+// ObjectDescription describes a primitive. Type selects which of the other
+// fields it uses:
+//
+//	triangle, quad                  vertices
+//	polygon                         vertices, holes
+//	sphere                          center, radius
+//	plane                           point, normal
+//	disk                            center, normal, radius
+//	box                             min, max
+//	oriented_box                    center, x_axis, y_axis, half_size
+//	cylinder, cone                  base, top, radius, open
+//	torus                           center, axis, major, minor
+//	mesh                            vertices and faces, or file
+//	group                           children, accelerator
+//	union, intersection, difference left, right
+//
+// The top of a cone is its apex. Groups are put in a bvh, a grid or an
+// octree as their accelerator says, a bvh by default. Mesh files are OBJ,
+// STL or PLY and are found relative to the scene file. Any object may have
+// transforms, which are applied in order, but only objects directly in the
+// scene have a material or a color.
+type ObjectDescription struct {
+	Type      string                 `json:"type"`
+	Material  string                 `json:"material,omitempty"`
+	Color     []float64              `json:"color,omitempty"`
+	Transform []TransformDescription `json:"transform,omitempty"`
+
+	Vertices [][]float64   `json:"vertices,omitempty"`
+	Holes    [][][]float64 `json:"holes,omitempty"`
+	Faces    [][]int       `json:"faces,omitempty"`
+	File     string        `json:"file,omitempty"`
+
+	Center   []float64 `json:"center,omitempty"`
+	Point    []float64 `json:"point,omitempty"`
+	Normal   []float64 `json:"normal,omitempty"`
+	Min      []float64 `json:"min,omitempty"`
+	Max      []float64 `json:"max,omitempty"`
+	XAxis    []float64 `json:"x_axis,omitempty"`
+	YAxis    []float64 `json:"y_axis,omitempty"`
+	HalfSize []float64 `json:"half_size,omitempty"`
+	Base     []float64 `json:"base,omitempty"`
+	Top      []float64 `json:"top,omitempty"`
+	Axis     []float64 `json:"axis,omitempty"`
+	Radius   float64   `json:"radius,omitempty"`
+	Major    float64   `json:"major,omitempty"`
+	Minor    float64   `json:"minor,omitempty"`
+	Open     bool      `json:"open,omitempty"`
+
+	Children    []ObjectDescription `json:"children,omitempty"`
+	Accelerator string              `json:"accelerator,omitempty"`
+	Left        *ObjectDescription  `json:"left,omitempty"`
+	Right       *ObjectDescription  `json:"right,omitempty"`
+}
+
+// TransformDescription is one step of the transform of an object. Exactly
+// one of its fields is set. Rotations are counterclockwise in degrees and
+// matrices are given as four rows.
+type TransformDescription struct {
+	Translate []float64            `json:"translate,omitempty"`
+	Scale     []float64            `json:"scale,omitempty"`
+	Rotate    *RotationDescription `json:"rotate,omitempty"`
+	Matrix    [][]float64          `json:"matrix,omitempty"`
+}
+
+type RotationDescription struct {
+	Axis    []float64 `json:"axis"`
+	Degrees float64   `json:"degrees"`
+}
+
+// objectFields lists the fields each type of object uses besides type,
+// material, color and transform.
+var objectFields = map[string][]string{
+	"triangle":     {"vertices"},
+	"quad":         {"vertices"},
+	"polygon":      {"vertices", "holes"},
+	"sphere":       {"center", "radius"},
+	"plane":        {"point", "normal"},
+	"disk":         {"center", "normal", "radius"},
+	"box":          {"min", "max"},
+	"oriented_box": {"center", "x_axis", "y_axis", "half_size"},
+	"cylinder":     {"base", "top", "radius", "open"},
+	"cone":         {"base", "top", "radius", "open"},
+	"torus":        {"center", "axis", "major", "minor"},
+	"mesh":         {"vertices", "faces", "file"},
+	"group":        {"children", "accelerator"},
+	"union":        {"left", "right"},
+	"intersection": {"left", "right"},
+	"difference":   {"left", "right"},
+}
+
+// given returns the names of the shape fields which are set.
+func (desc *ObjectDescription) given() []string {
+	var names []string
+	for _, field := range []struct {
+		name string
+		set  bool
+	}{
+		{"vertices", desc.Vertices != nil},
+		{"holes", desc.Holes != nil},
+		{"faces", desc.Faces != nil},
+		{"file", desc.File != ""},
+		{"center", desc.Center != nil},
+		{"point", desc.Point != nil},
+		{"normal", desc.Normal != nil},
+		{"min", desc.Min != nil},
+		{"max", desc.Max != nil},
+		{"x_axis", desc.XAxis != nil},
+		{"y_axis", desc.YAxis != nil},
+		{"half_size", desc.HalfSize != nil},
+		{"base", desc.Base != nil},
+		{"top", desc.Top != nil},
+		{"axis", desc.Axis != nil},
+		{"radius", desc.Radius != 0},
+		{"major", desc.Major != 0},
+		{"minor", desc.Minor != 0},
+		{"open", desc.Open},
+		{"children", desc.Children != nil},
+		{"accelerator", desc.Accelerator != ""},
+		{"left", desc.Left != nil},
+		{"right", desc.Right != nil},
+	} {
+		if field.set {
+			names = append(names, field.name)
+		}
+	}
+	return names
+}
+
+// SceneError is a problem with one field of a scene description. Path
+// leads to the field from the top of the description, as in
+// objects[2].left.radius.
+type SceneError struct {
+	Path    string
+	Message string
+}
+
+func (err *SceneError) Error() string {
+	return fmt.Sprintf("%s: %s", err.Path, err.Message)
+}
+
+// SceneErrors are all problems found in a scene description.
+type SceneErrors []*SceneError
+
+func (errs SceneErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// ParseScene decodes a scene description. Unknown fields are errors, so
+// that misspelled ones are not silently ignored. YAML is read through the
+// JSON it stands for, see yamlToJSON.
+func ParseScene(r io.Reader, format SceneFormat) (*SceneDescription, error) {
+	switch format {
+	case JSONScene:
+	case YAMLScene:
+		data, err := yamlToJSON(r)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	default:
+		return nil, fmt.Errorf("unknown scene format %d", format)
+	}
+
+	desc := &SceneDescription{}
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(desc); err != nil {
+		if format == YAMLScene {
+			return nil, fmt.Errorf("yaml: %v", err)
+		}
+		return nil, fmt.Errorf("json: %v", err)
+	}
+	return desc, nil
+}
+
+// WriteScene encodes a scene description so that ParseScene reads it back.
+func WriteScene(w io.Writer, desc *SceneDescription, format SceneFormat) error {
+	if format != JSONScene && format != YAMLScene {
+		return fmt.Errorf("unknown scene format %d", format)
+	}
+
+	data, err := json.MarshalIndent(desc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if format == YAMLScene {
+		return jsonToYAML(w, data)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// LoadScene reads, validates and builds the scene in a JSON or YAML file.
+func LoadScene(path string) (*Scene, error) {
+	format, err := SceneFormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	desc, err := ParseScene(file, format)
+	if err != nil {
+		return nil, err
+	}
+	return desc.Build(filepath.Dir(path))
+}
+
+// SaveScene writes the description of a scene to a JSON or YAML file.
+func SaveScene(path string, scene *Scene) error {
+	format, err := SceneFormatOf(path)
+	if err != nil {
+		return err
+	}
+
+	desc, err := DescribeScene(scene)
+	if err != nil {
+		return err
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteScene(&buffer, desc, format); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buffer.Bytes(), 0644)
+}
+
+// Validate reports every problem in the description as SceneErrors. Mesh
+// files are not read.
+func (desc *SceneDescription) Validate() error {
+	builder := &sceneBuilder{}
+	builder.scene(desc)
+	return builder.err()
+}
+
+// Build validates the description and returns the scene it describes. Mesh
+// files are looked up relative to dir.
+func (desc *SceneDescription) Build(dir string) (*Scene, error) {
+	builder := &sceneBuilder{dir: dir, load: true}
+	scene := builder.scene(desc)
+	if err := builder.err(); err != nil {
+		return nil, err
+	}
+	return scene, nil
+}
+
+// sceneBuilder turns a description into a scene, collecting the problems it
+// finds on the way instead of stopping at the first one.
+type sceneBuilder struct {
+	dir  string
+	load bool
+	errs SceneErrors
+}
+
+func (builder *sceneBuilder) fail(path, format string, args ...interface{}) {
+	builder.errs = append(builder.errs, &SceneError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (builder *sceneBuilder) err() error {
+	if len(builder.errs) == 0 {
+		return nil
+	}
+	return builder.errs
+}
+
+func (builder *sceneBuilder) scene(desc *SceneDescription) *Scene {
+	scene := &Scene{
+		Camera:     builder.camera("camera", desc.Camera),
+		Ambient:    builder.optionalColor("ambient", desc.Ambient, Color{}),
+		Background: builder.optionalColor("background", desc.Background, Color{}),
+	}
+
+	switch desc.TriangleMode {
+	case "", "fast":
+		scene.TriangleMode = FastTriangles
+	case "watertight":
+		scene.TriangleMode = WatertightTriangles
+	default:
+		builder.fail("triangle_mode", "unknown mode %q, want fast or watertight", desc.TriangleMode)
+	}
+
+	materials := make(map[string]Object, len(desc.Materials))
+	for _, name := range sortedMaterialNames(desc.Materials) {
+		materials[name] = builder.material("materials."+name, desc.Materials[name])
+	}
+
+	for i, light := range desc.Lights {
+		path := fmt.Sprintf("lights[%d]", i)
+		if light.Intensity <= 0 || math.IsInf(light.Intensity, 0) || math.IsNaN(light.Intensity) {
+			builder.fail(path+".intensity", "must be a positive number")
+		}
+		scene.Lights = append(scene.Lights, PointLight{
+			Position:  builder.vector(path+".position", light.Position),
+			Color:     builder.optionalColor(path+".color", light.Color, Color{R: 1, G: 1, B: 1}),
+			Intensity: light.Intensity,
+		})
+	}
+
+	if len(desc.Objects) == 0 {
+		builder.fail("objects", "scene has no objects")
+	}
+	for i := range desc.Objects {
+		path := fmt.Sprintf("objects[%d]", i)
+		object := &desc.Objects[i]
+
+		// The object takes the color and material from its material
+		var result Object
+		switch {
+		case object.Material != "" && object.Color != nil:
+			builder.fail(path, "has both a material and a color")
+		case object.Material != "":
+			material, ok := materials[object.Material]
+			if !ok {
+				builder.fail(path+".material", "unknown material %q", object.Material)
+			}
+			result = material
+		case object.Color != nil:
+			result.Color = builder.color(path+".color", object.Color)
+		default:
+			builder.fail(path, "needs a material or a color")
+		}
+
+		if result.Primitive = builder.object(path, object); result.Primitive != nil {
+			scene.Objects = append(scene.Objects, result)
+		}
+	}
+
+	return scene
+}
+
+func sortedMaterialNames(materials map[string]MaterialDescription) []string {
+	names := make([]string, 0, len(materials))
+	for name := range materials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// material returns an object with the color and material of the
+// description and no primitive.
+func (builder *sceneBuilder) material(path string, desc MaterialDescription) Object {
+	if desc.Fuzz != 0 && desc.Type != "metal" {
+		builder.fail(path+".fuzz", "is only used by metal materials")
+	}
+	if desc.IOR != 0 && desc.Type != "dielectric" {
+		builder.fail(path+".ior", "is only used by dielectric materials")
+	}
+
+	switch desc.Type {
+	case "", "diffuse":
+		color := builder.color(path+".color", desc.Color)
+		return Object{Color: color, Material: Diffuse{Albedo: color}}
+	case "metal":
+		if !(desc.Fuzz >= 0 && desc.Fuzz <= 1) {
+			builder.fail(path+".fuzz", "must be between 0 and 1, got %v", desc.Fuzz)
+		}
+		color := builder.color(path+".color", desc.Color)
+		return Object{Color: color, Material: Metal{Albedo: color, Fuzz: desc.Fuzz}}
+	case "dielectric":
+		builder.positive(path+".ior", desc.IOR)
+		color := builder.optionalColor(path+".color", desc.Color, Color{R: 1, G: 1, B: 1})
+		return Object{Color: color, Material: Dielectric{IOR: desc.IOR}}
+	case "emissive":
+		color := builder.color(path+".color", desc.Color)
+		return Object{Color: color, Material: Emissive{Emission: color}}
+	}
+
+	builder.fail(path+".type", "unknown material type %q", desc.Type)
+	return Object{}
+}
+
+func (builder *sceneBuilder) camera(path string, desc CameraDescription) Camera {
+	position := builder.vector(path+".position", desc.Position)
+	lookAt := builder.vector(path+".look_at", desc.LookAt)
+	up := builder.optionalVector(path+".up", desc.Up, geom.NewVector(0, 1, 0))
+
+	if desc.FOV != 0 && desc.Type == "orthographic" {
+		builder.fail(path+".fov", "is not used by orthographic cameras")
+	}
+	if desc.Height != 0 && desc.Type != "orthographic" {
+		builder.fail(path+".height", "is only used by orthographic cameras")
+	}
+	if desc.Aperture != 0 && desc.Type != "thin_lens" {
+		builder.fail(path+".aperture", "is only used by thin_lens cameras")
+	}
+	if desc.FocusDistance != 0 && desc.Type != "thin_lens" {
+		builder.fail(path+".focus_distance", "is only used by thin_lens cameras")
+	}
+
+	switch desc.Type {
+	case "", "perspective", "thin_lens":
+		if !(desc.FOV > 0 && desc.FOV < 180) {
+			builder.fail(path+".fov", "must be between 0 and 180 degrees, got %v", desc.FOV)
+		}
+	case "fisheye":
+		if !(desc.FOV > 0 && desc.FOV <= 360) {
+			builder.fail(path+".fov", "must be between 0 and 360 degrees, got %v", desc.FOV)
+		}
+	case "orthographic":
+		builder.positive(path+".height", desc.Height)
+	default:
+		builder.fail(path+".type", "unknown camera type %q", desc.Type)
+	}
+	if desc.Type == "thin_lens" {
+		builder.positive(path+".aperture", desc.Aperture)
+		builder.positive(path+".focus_distance", desc.FocusDistance)
+	}
+
+	forward := geom.Sub(lookAt, position)
+	if desc.Position != nil && desc.LookAt != nil && forward == (geom.Vector{}) {
+		builder.fail(path+".look_at", "is the same as the position")
+	} else if geom.Cross(forward, up) == (geom.Vector{}) && forward != (geom.Vector{}) {
+		builder.fail(path+".up", "is parallel to the view direction")
+	}
+
+	switch desc.Type {
+	case "thin_lens":
+		return NewThinLensCamera(position, lookAt, up, desc.FOV, desc.Aperture, desc.FocusDistance)
+	case "orthographic":
+		return NewOrthographicCamera(position, lookAt, up, desc.Height)
+	case "fisheye":
+		return NewFisheyeCamera(position, lookAt, up, desc.FOV)
+	}
+	return NewCamera(position, lookAt, up, desc.FOV)
+}
+
+// object builds the primitive of a description, or returns nil if it has
+// problems or could not be made without reading a file.
+func (builder *sceneBuilder) object(path string, desc *ObjectDescription) Primitive {
+	fields, ok := objectFields[desc.Type]
+	if !ok {
+		if desc.Type == "" {
+			builder.fail(path+".type", "missing")
+		} else {
+			builder.fail(path+".type", "unknown type %q", desc.Type)
+		}
+		return nil
+	}
+
+	for _, name := range desc.given() {
+		if !containsString(fields, name) {
+			builder.fail(path+"."+name, "is not used by %s objects", desc.Type)
+		}
+	}
+
+	before := len(builder.errs)
+	primitive := builder.shape(path, desc)
+	transform := builder.transform(path+".transform", desc.Transform)
+	if primitive == nil || len(builder.errs) > before || len(desc.Transform) == 0 {
+		return primitive
+	}
+
+	instance, err := NewInstance(primitive, transform)
+	if err != nil {
+		builder.fail(path+".transform", "%v", err)
+		return nil
+	}
+	return instance
+}
+
+func (builder *sceneBuilder) shape(path string, desc *ObjectDescription) Primitive {
+	switch desc.Type {
+	case "triangle", "quad", "polygon":
+		return builder.polygon(path, desc)
+
+	case "sphere":
+		center := builder.vector(path+".center", desc.Center)
+		builder.positive(path+".radius", desc.Radius)
+		return NewSphere(center, desc.Radius)
+
+	case "plane":
+		point := builder.vector(path+".point", desc.Point)
+		return NewPlane(point, builder.direction(path+".normal", desc.Normal))
+
+	case "disk":
+		center := builder.vector(path+".center", desc.Center)
+		normal := builder.direction(path+".normal", desc.Normal)
+		builder.positive(path+".radius", desc.Radius)
+		return NewDisk(center, normal, desc.Radius)
+
+	case "box":
+		min, max := builder.vector(path+".min", desc.Min), builder.vector(path+".max", desc.Max)
+		if min.X > max.X || min.Y > max.Y || min.Z > max.Z {
+			builder.fail(path+".max", "is below min")
+		}
+		return NewBox(min, max)
+
+	case "oriented_box":
+		center := builder.vector(path+".center", desc.Center)
+		xAxis := builder.direction(path+".x_axis", desc.XAxis)
+		yAxis := builder.direction(path+".y_axis", desc.YAxis)
+		half := builder.vector(path+".half_size", desc.HalfSize)
+		if xAxis != (geom.Vector{}) && yAxis != (geom.Vector{}) && geom.Cross(xAxis, yAxis) == (geom.Vector{}) {
+			builder.fail(path+".y_axis", "is parallel to x_axis")
+		}
+		if half.X <= 0 || half.Y <= 0 || half.Z <= 0 {
+			builder.fail(path+".half_size", "must be positive")
+		}
+		return NewOrientedBox(center, xAxis, yAxis, half)
+
+	case "cylinder", "cone":
+		base, top := builder.vector(path+".base", desc.Base), builder.vector(path+".top", desc.Top)
+		if desc.Base != nil && desc.Top != nil && base == top {
+			builder.fail(path+".top", "is the same as the base")
+		}
+		builder.positive(path+".radius", desc.Radius)
+		switch {
+		case desc.Type == "cylinder" && desc.Open:
+			return NewOpenCylinder(base, top, desc.Radius)
+		case desc.Type == "cylinder":
+			return NewCylinder(base, top, desc.Radius)
+		case desc.Open:
+			return NewOpenCone(base, top, desc.Radius)
+		default:
+			return NewCone(base, top, desc.Radius)
+		}
+
+	case "torus":
+		center := builder.vector(path+".center", desc.Center)
+		axis := builder.direction(path+".axis", desc.Axis)
+		builder.positive(path+".major", desc.Major)
+		builder.positive(path+".minor", desc.Minor)
+		return NewTorus(center, axis, desc.Major, desc.Minor)
+
+	case "mesh":
+		return builder.mesh(path, desc)
+
+	case "group":
+		if len(desc.Children) == 0 {
+			builder.fail(path+".children", "group has no children")
+		}
+		var children []Primitive
+		for i := range desc.Children {
+			if child := builder.part(fmt.Sprintf("%s.children[%d]", path, i), &desc.Children[i]); child != nil {
+				children = append(children, child)
+			}
+		}
+		kinds := map[string]AcceleratorKind{"": BVHAccelerator, "bvh": BVHAccelerator, "grid": GridAccelerator, "octree": OctreeAccelerator}
+		kind, ok := kinds[desc.Accelerator]
+		if !ok {
+			builder.fail(path+".accelerator", "unknown accelerator %q, want bvh, grid or octree", desc.Accelerator)
+		}
+		return NewAccelerator(kind, children)
+
+	default:
+		left := builder.solid(path+".left", desc.Left)
+		right := builder.solid(path+".right", desc.Right)
+		if left == nil || right == nil {
+			return nil
+		}
+		operation := map[string]CSGOperation{"union": Union, "intersection": Intersection, "difference": Difference}
+		return NewCSG(operation[desc.Type], left, right)
+	}
+}
+
+// part builds an object nested in another one, which takes its material.
+func (builder *sceneBuilder) part(path string, desc *ObjectDescription) Primitive {
+	if desc.Material != "" {
+		builder.fail(path+".material", "only objects directly in the scene have a material")
+	}
+	if desc.Color != nil {
+		builder.fail(path+".color", "only objects directly in the scene have a color")
+	}
+	return builder.object(path, desc)
+}
+
+// solid builds an operand of a CSG object.
+func (builder *sceneBuilder) solid(path string, desc *ObjectDescription) Solid {
+	if desc == nil {
+		builder.fail(path, "missing")
+		return nil
+	}
+
+	before := len(builder.errs)
+	primitive := builder.part(path, desc)
+	if len(builder.errs) > before {
+		return nil
+	}
+
+	// Every instance has spans, but only those of solids have an inside
+	solid, ok := primitive.(Solid)
+	if instance, transformed := primitive.(*Instance); transformed {
+		_, ok = instance.primitive.(Solid)
+	}
+	if !ok {
+		if len(desc.Transform) > 0 {
+			builder.fail(path, "a transformed %s is not a solid", desc.Type)
+		} else {
+			builder.fail(path, "a %s is not a solid", desc.Type)
+		}
+		return nil
+	}
+	return solid
+}
+
+func (builder *sceneBuilder) polygon(path string, desc *ObjectDescription) Primitive {
+	want := map[string]int{"triangle": 3, "quad": 4}[desc.Type]
+	if want != 0 && len(desc.Vertices) != want {
+		builder.fail(path+".vertices", "%s needs %d vertices, got %d", desc.Type, want, len(desc.Vertices))
+		return nil
+	}
+
+	vertices := builder.vectors(path+".vertices", desc.Vertices)
+	holes := make([][]geom.Vector, len(desc.Holes))
+	for i, hole := range desc.Holes {
+		holes[i] = builder.vectors(fmt.Sprintf("%s.holes[%d]", path, i), hole)
+	}
+
+	if want != 0 && newellNormal(vertices) == (geom.Vector{}) {
+		builder.fail(path+".vertices", "%s has no area", desc.Type)
+	}
+	switch desc.Type {
+	case "triangle":
+		return NewTriangle(vertices[0], vertices[1], vertices[2])
+	case "quad":
+		return NewQuad(vertices[0], vertices[1], vertices[2], vertices[3])
+	}
+
+	polygon, err := NewPolygon(vertices, holes...)
+	if err != nil {
+		builder.fail(path+".vertices", "%v", err)
+		return nil
+	}
+	return polygon
+}
+
+func (builder *sceneBuilder) mesh(path string, desc *ObjectDescription) Primitive {
+	if desc.File != "" {
+		if desc.Vertices != nil || desc.Faces != nil {
+			builder.fail(path+".file", "mesh has both a file and inline vertices or faces")
+			return nil
+		}
+		return builder.meshFile(path+".file", desc.File)
+	}
+
+	if len(desc.Faces) == 0 {
+		builder.fail(path+".faces", "mesh has no faces")
+		return nil
+	}
+
+	faces := make([]Face, len(desc.Faces))
+	for i, indices := range desc.Faces {
+		faces[i] = Face{Vertices: indices}
+	}
+	mesh := &Mesh{Vertices: builder.vectors(path+".vertices", desc.Vertices), Faces: faces}
+	if err := mesh.Validate(); err != nil {
+		builder.fail(path+".faces", "%v", err)
+		return nil
+	}
+
+	mesh.build()
+	return mesh
+}
+
+// meshFile reads the mesh in an OBJ, STL or PLY file. Without loading only
+// the extension is checked.
+func (builder *sceneBuilder) meshFile(path, name string) Primitive {
+	var read func(io.Reader) (*Mesh, error)
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".obj":
+		read = ParseOBJ
+	case ".stl":
+		read = ReadSTL
+	case ".ply":
+		read = ReadPLY
+	default:
+		builder.fail(path, "unknown mesh file extension %q", filepath.Ext(name))
+		return nil
+	}
+	if !builder.load {
+		return nil
+	}
+
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(builder.dir, name)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		builder.fail(path, "%v", err)
+		return nil
+	}
+	defer file.Close()
+
+	mesh, err := read(file)
+	if err != nil {
+		builder.fail(path, "%v", err)
+		return nil
+	}
+	return mesh
+}
+
+// transform returns the steps of a transform composed in order.
+func (builder *sceneBuilder) transform(path string, steps []TransformDescription) Matrix {
+	matrices := make([]Matrix, 0, len(steps))
+	before := len(builder.errs)
+
+	for i, step := range steps {
+		stepPath := fmt.Sprintf("%s[%d]", path, i)
+		set := 0
+		for _, given := range []bool{step.Translate != nil, step.Scale != nil, step.Rotate != nil, step.Matrix != nil} {
+			if given {
+				set++
+			}
+		}
+		if set != 1 {
+			builder.fail(stepPath, "needs exactly one of translate, scale, rotate and matrix, got %d", set)
+			continue
+		}
+
+		switch {
+		case step.Translate != nil:
+			matrices = append(matrices, Translate(builder.vector(stepPath+".translate", step.Translate)))
+		case step.Scale != nil:
+			factors := builder.vector(stepPath+".scale", step.Scale)
+			if factors.X == 0 || factors.Y == 0 || factors.Z == 0 {
+				builder.fail(stepPath+".scale", "factors must not be zero")
+			}
+			matrices = append(matrices, Scale(factors.X, factors.Y, factors.Z))
+		case step.Rotate != nil:
+			axis := builder.direction(stepPath+".rotate.axis", step.Rotate.Axis)
+			if math.IsInf(step.Rotate.Degrees, 0) || math.IsNaN(step.Rotate.Degrees) {
+				builder.fail(stepPath+".rotate.degrees", "is not finite")
+			}
+			matrices = append(matrices, Rotate(axis, step.Rotate.Degrees*math.Pi/180))
+		default:
+			matrices = append(matrices, builder.matrix(stepPath+".matrix", step.Matrix))
+		}
+	}
+
+	// A singular step has already been reported
+	transform := Compose(matrices...)
+	if _, err := transform.Inverse(); err != nil && len(builder.errs) == before {
+		builder.fail(path, "%v", err)
+	}
+	return transform
+}
+
+func (builder *sceneBuilder) matrix(path string, rows [][]float64) Matrix {
+	var m Matrix
+	if len(rows) != 4 {
+		builder.fail(path, "want 4 rows, got %d", len(rows))
+		return Identity()
+	}
+
+	for i, row := range rows {
+		if len(row) != 4 {
+			builder.fail(fmt.Sprintf("%s[%d]", path, i), "want 4 numbers, got %d", len(row))
+			return Identity()
+		}
+		copy(m[i][:], row)
+	}
+	if m[3] != [4]float64{0, 0, 0, 1} {
+		builder.fail(fmt.Sprintf("%s[3]", path), "last row must be 0, 0, 0, 1")
+	}
+	return m
+}
+
+// vector reads a required vector.
+func (builder *sceneBuilder) vector(path string, values []float64) geom.Vector {
+	if values == nil {
+		builder.fail(path, "missing")
+		return geom.Vector{}
+	}
+	if len(values) != 3 {
+		builder.fail(path, "want 3 numbers, got %d", len(values))
+		return geom.Vector{}
+	}
+
+	v := geom.NewVector(values[0], values[1], values[2])
+	if !finite(v) {
+		builder.fail(path, "is not finite")
+	}
+	return v
+}
+
+func (builder *sceneBuilder) optionalVector(path string, values []float64, fallback geom.Vector) geom.Vector {
+	if values == nil {
+		return fallback
+	}
+	return builder.vector(path, values)
+}
+
+// direction reads a required vector which must not be zero.
+func (builder *sceneBuilder) direction(path string, values []float64) geom.Vector {
+	v := builder.vector(path, values)
+	if values != nil && v == (geom.Vector{}) {
+		builder.fail(path, "must not be zero")
+	}
+	return v
+}
+
+func (builder *sceneBuilder) vectors(path string, values [][]float64) []geom.Vector {
+	vectors := make([]geom.Vector, len(values))
+	for i, v := range values {
+		vectors[i] = builder.vector(fmt.Sprintf("%s[%d]", path, i), v)
+	}
+	return vectors
+}
+
+func (builder *sceneBuilder) color(path string, values []float64) Color {
+	v := builder.vector(path, values)
+	if v.X < 0 || v.Y < 0 || v.Z < 0 {
+		builder.fail(path, "components must not be negative")
+	}
+	return Color{R: v.X, G: v.Y, B: v.Z}
+}
+
+func (builder *sceneBuilder) optionalColor(path string, values []float64, fallback Color) Color {
+	if values == nil {
+		return fallback
+	}
+	return builder.color(path, values)
+}
+
+func (builder *sceneBuilder) positive(path string, x float64) {
+	if !(x > 0) || math.IsInf(x, 1) {
+		builder.fail(path, "must be a positive number, got %v", x)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DescribeScene returns the description of a scene built in code, so that
+// it can be written to a file. Meshes keep only their vertices and faces.
+func DescribeScene(scene *Scene) (*SceneDescription, error) {
+	desc := &SceneDescription{
+		Camera:     describeCamera(scene.Camera),
+		Ambient:    colorValues(scene.Ambient),
+		Background: colorValues(scene.Background),
+	}
+	if scene.TriangleMode == WatertightTriangles {
+		desc.TriangleMode = "watertight"
+	}
+
+	for _, light := range scene.Lights {
+		desc.Lights = append(desc.Lights, LightDescription{
+			Position:  vectorValues(light.Position),
+			Color:     colorValues(light.Color),
+			Intensity: light.Intensity,
+		})
+	}
+
+	// Objects sharing a material and color share a named material
+	type materialKey struct {
+		material Material
+		color    Color
+	}
+	materials := make(map[materialKey]string)
+
+	for i, object := range scene.Objects {
+		path := fmt.Sprintf("objects[%d]", i)
+		objectDesc, err := describePrimitive(object.Primitive)
+		if err != nil {
+			return nil, &SceneError{Path: path, Message: err.Error()}
+		}
+
+		if object.Material == nil {
+			objectDesc.Color = colorValues(object.Color)
+			desc.Objects = append(desc.Objects, objectDesc)
+			continue
+		}
+
+		materialDesc, err := describeMaterial(object.Material, object.Color)
+		if err != nil {
+			return nil, &SceneError{Path: path + ".material", Message: err.Error()}
+		}
+		key := materialKey{material: object.Material, color: object.Color}
+		name, ok := materials[key]
+		if !ok {
+			name = fmt.Sprintf("material%d", len(materials)+1)
+			materials[key] = name
+			if desc.Materials == nil {
+				desc.Materials = make(map[string]MaterialDescription)
+			}
+			desc.Materials[name] = materialDesc
+		}
+		objectDesc.Material = name
+		desc.Objects = append(desc.Objects, objectDesc)
+	}
+
+	return desc, nil
+}
+
+func describeCamera(camera Camera) CameraDescription {
+	desc := CameraDescription{
+		Position: vectorValues(camera.position),
+		LookAt:   vectorValues(geom.Add(camera.position, camera.forward)),
+		Up:       vectorValues(camera.up),
+	}
+
+	switch camera.projection {
+	case OrthographicProjection:
+		desc.Type = "orthographic"
+		desc.Height = 2 * camera.halfHeight
+	case FisheyeProjection:
+		desc.Type = "fisheye"
+		desc.FOV = camera.halfAngle * 360 / math.Pi
+	default:
+		desc.FOV = math.Atan(camera.tanHalf) * 360 / math.Pi
+		if camera.lensRadius > 0 {
+			desc.Type = "thin_lens"
+			desc.Aperture = 2 * camera.lensRadius
+			desc.FocusDistance = camera.focusDistance
+		}
+	}
+	return desc
+}
+
+// describeMaterial describes the material of an object of the given color.
+// Only dielectrics keep the color, the others have their own.
+func describeMaterial(material Material, color Color) (MaterialDescription, error) {
+	switch m := material.(type) {
+	case Diffuse:
+		return MaterialDescription{Type: "diffuse", Color: colorValues(m.Albedo)}, nil
+	case Metal:
+		return MaterialDescription{Type: "metal", Color: colorValues(m.Albedo), Fuzz: m.Fuzz}, nil
+	case Dielectric:
+		return MaterialDescription{Type: "dielectric", Color: colorValues(color), IOR: m.IOR}, nil
+	case Emissive:
+		return MaterialDescription{Type: "emissive", Color: colorValues(m.Emission)}, nil
+	}
+	return MaterialDescription{}, fmt.Errorf("unsupported material %T", material)
+}
+
+func describePrimitive(primitive Primitive) (ObjectDescription, error) {
+	switch p := primitive.(type) {
+	case Triangle:
+		return ObjectDescription{Type: "triangle", Vertices: vectorList(p.a, p.b, p.c)}, nil
+	case Quad:
+		return ObjectDescription{Type: "quad", Vertices: vectorList(p.a, p.b, p.c, p.d)}, nil
+	case *Polygon:
+		desc := ObjectDescription{Type: "polygon", Vertices: vectorList(p.outline...)}
+		for _, hole := range p.holes {
+			desc.Holes = append(desc.Holes, vectorList(hole...))
+		}
+		return desc, nil
+	case Sphere:
+		return ObjectDescription{Type: "sphere", Center: vectorValues(p.origin), Radius: p.r}, nil
+	case Plane:
+		return ObjectDescription{Type: "plane", Point: vectorValues(p.point), Normal: vectorValues(p.normal)}, nil
+	case Disk:
+		return ObjectDescription{Type: "disk", Center: vectorValues(p.frame.origin), Normal: vectorValues(p.frame.w), Radius: p.r}, nil
+	case Box:
+		return ObjectDescription{Type: "box", Min: vectorValues(p.min), Max: vectorValues(p.max)}, nil
+	case OrientedBox:
+		return ObjectDescription{
+			Type:     "oriented_box",
+			Center:   vectorValues(p.frame.origin),
+			XAxis:    vectorValues(p.frame.u),
+			YAxis:    vectorValues(p.frame.v),
+			HalfSize: vectorValues(p.box.max),
+		}, nil
+	case Cylinder:
+		return describeAxial("cylinder", p.frame, p.height, p.r, !p.capped), nil
+	case Cone:
+		return describeAxial("cone", p.frame, p.height, p.r, !p.capped), nil
+	case Torus:
+		return ObjectDescription{
+			Type:   "torus",
+			Center: vectorValues(p.frame.origin),
+			Axis:   vectorValues(p.frame.w),
+			Major:  p.major,
+			Minor:  p.minor,
+		}, nil
+	case *Mesh:
+		faces := make([][]int, len(p.Faces))
+		for i, face := range p.Faces {
+			faces[i] = face.Vertices
+		}
+		return ObjectDescription{Type: "mesh", Vertices: vectorList(p.Vertices...), Faces: faces}, nil
+	case Accelerator:
+		desc := ObjectDescription{Type: "group", Children: []ObjectDescription{}}
+		switch p.(type) {
+		case *Grid:
+			desc.Accelerator = "grid"
+		case *Octree:
+			desc.Accelerator = "octree"
+		}
+		for _, child := range p.Primitives() {
+			childDesc, err := describePrimitive(child)
+			if err != nil {
+				return ObjectDescription{}, err
+			}
+			desc.Children = append(desc.Children, childDesc)
+		}
+		return desc, nil
+	case *Instance:
+		desc, err := describePrimitive(p.primitive)
+		if err != nil {
+			return ObjectDescription{}, err
+		}
+		rows := make([][]float64, 4)
+		for i := range rows {
+			rows[i] = append([]float64(nil), p.toWorld[i][:]...)
+		}
+		desc.Transform = append(desc.Transform, TransformDescription{Matrix: rows})
+		return desc, nil
+	case *CSG:
+		left, err := describePrimitive(p.left)
+		if err != nil {
+			return ObjectDescription{}, err
+		}
+		right, err := describePrimitive(p.right)
+		if err != nil {
+			return ObjectDescription{}, err
+		}
+		types := map[CSGOperation]string{Union: "union", Intersection: "intersection", Difference: "difference"}
+		return ObjectDescription{Type: types[p.operation], Left: &left, Right: &right}, nil
+	}
+
+	return ObjectDescription{}, fmt.Errorf("can not describe primitives of type %T", primitive)
+}
+
+func describeAxial(typ string, f frame, height, r float64, open bool) ObjectDescription {
+	return ObjectDescription{
+		Type:   typ,
+		Base:   vectorValues(f.origin),
+		Top:    vectorValues(geom.Add(f.origin, scale(f.w, height))),
+		Radius: r,
+		Open:   open,
+	}
+}
+
+func vectorValues(v geom.Vector) []float64 {
+	return []float64{v.X, v.Y, v.Z}
+}
+
+func colorValues(c Color) []float64 {
+	return []float64{c.R, c.G, c.B}
+}
+
+func vectorList(vectors ...geom.Vector) [][]float64 {
+	values := make([][]float64, len(vectors))
+	for i, v := range vectors {
+		values[i] = vectorValues(v)
+	}
+	return values
+}
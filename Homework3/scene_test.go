@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+const sceneJSON = `{
+  "camera": {"position": [0, 1, 8], "look_at": [0, 0, 0], "fov": 50},
+  "background": [0, 0, 0.2],
+  "triangle_mode": "watertight",
+  "materials": {
+    "red": {"color": [1, 0.1, 0.1]}
+  },
+  "lights": [
+    {"position": [5, 5, 5], "intensity": 80}
+  ],
+  "objects": [
+    {"type": "sphere", "material": "red", "center": [0, 0, 0], "radius": 1},
+    {
+      "type": "mesh",
+      "file": "cube.obj",
+      "color": [0.5, 0.5, 0.5],
+      "transform": [{"scale": [2, 2, 2]}, {"translate": [3, -1, 0]}]
+    },
+    {
+      "type": "difference",
+      "color": [0, 1, 0],
+      "left": {"type": "box", "min": [-4, -1, -1], "max": [-2, 1, 1]},
+      "right": {"type": "sphere", "center": [-3, 0, 1], "radius": 0.8}
+    }
+  ]
+}
+`
+
+// sceneYAML is sceneJSON in YAML.
+const sceneYAML = `# The scene of TestLoadScene
+camera:
+  position: [0, 1, 8]
+  look_at: [0, 0, 0]
+  fov: 50
+background: [0, 0, 0.2]
+triangle_mode: watertight
+materials:
+  red: {color: [1, 0.1, 0.1]}
+lights:
+- position: [5, 5, 5]
+  intensity: 80
+objects:
+  - type: sphere
+    material: "red"
+    center: [0, 0, 0]
+    radius: 1
+  - type: mesh
+    file: 'cube.obj'  # next to the scene
+    color: [0.5, 0.5, 0.5]
+    transform:
+      - scale: [2, 2, 2]
+      - {translate: [3, -1, 0]}
+  - type: difference
+    color: [0, 1, 0]
+    left: {type: box, min: [-4, -1, -1], max: [-2, 1, 1]}
+    right:
+      type: sphere
+      center: [-3, 0, 1]
+      radius: 0.8
+`
+
+func TestLoadScene(t *testing.T) {
+	for name, input := range map[string]string{"scene.json": sceneJSON, "scene.yaml": sceneYAML} {
+		t.Run(name, func(t *testing.T) {
+			testLoadScene(t, name, input)
+		})
+	}
+}
+
+func testLoadScene(t *testing.T, name, input string) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cube.obj"), []byte(cubeOBJ), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scene, err := LoadScene(path)
+	if err != nil {
+		t.Fatalf("Expected the scene to load, got %v", err)
+	}
+
+	if len(scene.Objects) != 3 || len(scene.Lights) != 1 || scene.TriangleMode != WatertightTriangles {
+		t.Fatalf("Expected 3 objects, 1 light and watertight triangles, got %#v", scene)
+	}
+	if scene.Objects[0].Color != (Color{R: 1, G: 0.1, B: 0.1}) {
+		t.Errorf("Expected the sphere to take the color of its material, got %#v", scene.Objects[0].Color)
+	}
+	if scene.Lights[0].Color != (Color{R: 1, G: 1, B: 1}) {
+		t.Errorf("Expected lights to be white by default, got %#v", scene.Lights[0].Color)
+	}
+
+	// The cube is scaled to [3, 5] x [-1, 1] x [0, 2]
+	bounds := scene.Objects[1].Primitive.Bounds()
+	if !vectorsAlmostEqual(bounds.Min, geom.NewVector(3, -1, 0)) || !vectorsAlmostEqual(bounds.Max, geom.NewVector(5, 1, 2)) {
+		t.Errorf("Expected the transformed cube to span [3, -1, 0] to [5, 1, 2], got %#v", bounds)
+	}
+
+	// The sphere carves the front of the box
+	hit, ok := scene.Objects[2].Primitive.ClosestHit(geom.NewRay(geom.NewVector(-3, 0, 5), geom.NewVector(0, 0, -1)))
+	if !ok || !almostEqual(hit.T, 5-0.2) {
+		t.Errorf("Expected to hit the carved box at 4.8, got %#v", hit)
+	}
+}
+
+func TestSceneValidationPaths(t *testing.T) {
+	desc := &SceneDescription{
+		Camera: CameraDescription{
+			Position: []float64{0, 0, 5},
+			LookAt:   []float64{0, 0, 5},
+			FOV:      200,
+		},
+		Lights: []LightDescription{{Position: []float64{0, 1}, Intensity: 1}},
+		Objects: []ObjectDescription{
+			{Type: "sphere", Color: []float64{1, 1, 1}, Center: []float64{0, 0, 0}, Radius: -1},
+			{Type: "cube", Color: []float64{1, 1, 1}},
+			{
+				Type:     "union",
+				Material: "gold",
+				Left:     &ObjectDescription{Type: "triangle", Vertices: [][]float64{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}},
+				Right: &ObjectDescription{
+					Type:   "sphere",
+					Center: []float64{0, 0, 0},
+					Radius: 1,
+					Normal: []float64{0, 0, 1},
+				},
+			},
+			{
+				Type:      "box",
+				Color:     []float64{1, -1, 1},
+				Min:       []float64{0, 0, 0},
+				Max:       []float64{1, 1, 1},
+				Transform: []TransformDescription{{}, {Scale: []float64{1, 0, 1}}},
+			},
+			{Type: "group", Color: []float64{1, 1, 1}, Children: []ObjectDescription{{Type: "mesh", File: "model.gltf", Color: []float64{1, 1, 1}}}},
+		},
+	}
+
+	err := desc.Validate()
+	errs, ok := err.(SceneErrors)
+	if !ok {
+		t.Fatalf("Expected SceneErrors, got %#v", err)
+	}
+
+	want := []string{
+		"camera.fov",
+		"camera.look_at",
+		"lights[0].position",
+		"objects[0].radius",
+		"objects[1].type",
+		"objects[2].material",
+		"objects[2].left",
+		"objects[2].right.normal",
+		"objects[3].color",
+		"objects[3].transform[0]",
+		"objects[3].transform[1].scale",
+		"objects[4].children[0].color",
+		"objects[4].children[0].file",
+	}
+	paths := make(map[string]bool)
+	for _, e := range errs {
+		paths[e.Path] = true
+	}
+	for _, path := range want {
+		if !paths[path] {
+			t.Errorf("Expected an error at %s, got:\n%v", path, err)
+		}
+	}
+	if len(errs) != len(want) {
+		t.Errorf("Expected %d errors, got %d:\n%v", len(want), len(errs), err)
+	}
+}
+
+func TestParseSceneRejectsUnknownFields(t *testing.T) {
+	inputs := map[SceneFormat]string{
+		JSONScene: `{"camera": {"position": [0, 0, 1], "look_at": [0, 0, 0], "fov": 60}, "objects": [{"type": "sphere", "raduis": 1}]}`,
+		YAMLScene: "camera: {position: [0, 0, 1], look_at: [0, 0, 0], fov: 60}\nobjects:\n  - {type: sphere, raduis: 1}\n",
+	}
+
+	for format, input := range inputs {
+		_, err := ParseScene(strings.NewReader(input), format)
+		if err == nil || !strings.Contains(err.Error(), "raduis") {
+			t.Errorf("Expected format %d to reject the misspelled field, got %v", format, err)
+		}
+	}
+}
+
+func roundTripScene() *Scene {
+	scene := testScene()
+	scene.TriangleMode = WatertightTriangles
+
+	mesh, _ := ParseOBJ(strings.NewReader(cubeOBJ))
+	instance, _ := NewInstance(mesh, Compose(RotateY(0.5), Translate(geom.NewVector(-3, 0, -2))))
+	polygon, _ := NewPolygon([]geom.Vector{
+		geom.NewVector(2, 2, -3),
+		geom.NewVector(4, 2, -3),
+		geom.NewVector(4, 4, -3),
+		geom.NewVector(3, 3, -3),
+		geom.NewVector(2, 4, -3),
+	}, []geom.Vector{
+		geom.NewVector(2.3, 2.3, -3),
+		geom.NewVector(2.8, 2.3, -3),
+		geom.NewVector(2.3, 2.8, -3),
+	})
+	group := NewGrid([]Primitive{
+		NewCylinder(geom.NewVector(2, -1, 0), geom.NewVector(2, 0, 0), 0.3),
+		NewOpenCone(geom.NewVector(-2, -1, 1), geom.NewVector(-2, 0.5, 1), 0.4),
+		NewTorus(geom.NewVector(0, 2, -1), geom.NewVector(1, 1, 0), 0.6, 0.2),
+		NewDisk(geom.NewVector(0, -0.9, 2), geom.NewVector(0, 1, 0), 0.5),
+	})
+	csg := NewIntersection(
+		NewOrientedBox(geom.NewVector(1.5, 1, 1), geom.NewVector(1, 1, 0), geom.NewVector(0, 0, 1), geom.NewVector(0.5, 0.5, 0.5)),
+		NewSphere(geom.NewVector(1.5, 1, 1), 0.6),
+	)
+
+	scene.Objects = append(scene.Objects,
+		Object{Primitive: instance, Color: Color{R: 0.2, G: 0.9, B: 0.2}},
+		Object{Primitive: polygon, Color: Color{R: 0.9, G: 0.9, B: 0.2}},
+		Object{Primitive: group, Color: Color{R: 0.2, G: 0.2, B: 0.9}},
+		Object{Primitive: csg, Color: Color{R: 0.9, G: 0.2, B: 0.9}},
+		Object{Primitive: NewPlane(geom.NewVector(0, 0, -8), geom.NewVector(0, 0, 1)), Color: Color{R: 0.5, G: 0.5, B: 0.5}},
+		Object{Primitive: NewTriangle(geom.NewVector(-4, 2, 0), geom.NewVector(-3, 2, 0), geom.NewVector(-3.5, 3, 0)), Color: Color{R: 1}},
+	)
+	return scene
+}
+
+func TestSceneRoundTrip(t *testing.T) {
+	for _, format := range []SceneFormat{JSONScene, YAMLScene} {
+		testSceneRoundTrip(t, format)
+	}
+}
+
+func testSceneRoundTrip(t *testing.T, format SceneFormat) {
+	original := roundTripScene()
+
+	desc, err := DescribeScene(original)
+	if err != nil {
+		t.Fatalf("Expected the scene to be described, got %v", err)
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteScene(&buffer, desc, format); err != nil {
+		t.Fatalf("Expected the scene to be written in format %d, got %v", format, err)
+	}
+	parsed, err := ParseScene(&buffer, format)
+	if err != nil {
+		t.Fatalf("Expected the written scene to parse in format %d, got %v", format, err)
+	}
+	scene, err := parsed.Build("")
+	if err != nil {
+		t.Fatalf("Expected the written scene to build in format %d, got %v", format, err)
+	}
+
+	if len(scene.Objects) != len(original.Objects) || scene.TriangleMode != original.TriangleMode ||
+		scene.Ambient != original.Ambient || scene.Background != original.Background {
+		t.Fatalf("Expected the settings of the scene to survive format %d, got %#v", format, scene)
+	}
+	if _, ok := scene.Objects[4].Primitive.(*Grid); !ok {
+		t.Errorf("Expected the group to stay a grid in format %d, got %T", format, scene.Objects[4].Primitive)
+	}
+
+	// The polygon keeps its hole and its surface coordinates
+	want, got := original.Objects[3].Primitive.(*Polygon), scene.Objects[3].Primitive.(*Polygon)
+	if len(got.holes) != 1 || len(got.Triangles()) != len(want.Triangles()) || got.uAxis != want.uAxis || got.vAxis != want.vAxis {
+		t.Errorf("Expected the polygon to survive with its hole, got %#v", got)
+	}
+
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			want := original.Camera.Ray(float64(x)+0.5, float64(y)+0.5, 32, 24)
+			got := scene.Camera.Ray(float64(x)+0.5, float64(y)+0.5, 32, 24)
+			if !vectorsAlmostEqual(want.Direction, got.Direction) {
+				t.Fatalf("Expected the camera to survive, got %#v for %#v", got, want)
+			}
+
+			wantHit, wantObject, wantOK := original.trace(want)
+			gotHit, gotObject, gotOK := scene.trace(want)
+			if wantOK != gotOK || wantObject != gotObject || !almostEqual(wantHit.T, gotHit.T) ||
+				!almostEqual(wantHit.U, gotHit.U) || !almostEqual(wantHit.V, gotHit.V) {
+				t.Errorf("Expected pixel (%d, %d) to hit object %d at %v in format %d, got object %d at %v",
+					x, y, wantObject, wantHit.T, format, gotObject, gotHit.T)
+			}
+		}
+	}
+}
+
+type unknownPrimitive struct {
+	Sphere
+}
+
+func TestDescribeSceneUnknownPrimitive(t *testing.T) {
+	scene := testScene()
+	scene.Objects[1].Primitive = unknownPrimitive{NewSphere(geom.Vector{}, 1)}
+
+	_, err := DescribeScene(scene)
+	if sceneErr, ok := err.(*SceneError); !ok || sceneErr.Path != "objects[1]" {
+		t.Errorf("Expected an error at objects[1], got %#v", err)
+	}
+}
+
+func TestSaveScene(t *testing.T) {
+	for _, name := range []string{"scene.json", "scene.yml"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := SaveScene(path, testScene()); err != nil {
+			t.Fatalf("Expected %s to be saved, got %v", name, err)
+		}
+
+		scene, err := LoadScene(path)
+		if err != nil {
+			t.Fatalf("Expected %s to load, got %v", name, err)
+		}
+		if len(scene.Objects) != 2 || scene.Objects[0].Color != (Color{R: 1, G: 0.2, B: 0.2}) {
+			t.Errorf("Expected the objects of the test scene in %s, got %#v", name, scene.Objects)
+		}
+	}
+
+	if err := SaveScene(filepath.Join(t.TempDir(), "scene.txt"), testScene()); err == nil {
+		t.Errorf("Expected an unknown extension to be rejected")
+	}
+}
+
+func TestSceneMaterials(t *testing.T) {
+	input := `{
+  "camera": {"position": [0, 0, 5], "look_at": [0, 0, 0], "fov": 60},
+  "materials": {
+    "chalk": {"color": [0.8, 0.8, 0.8]},
+    "steel": {"type": "metal", "color": [0.6, 0.6, 0.7], "fuzz": 0.1},
+    "glass": {"type": "dielectric", "ior": 1.5},
+    "lamp": {"type": "emissive", "color": [4, 4, 4]}
+  },
+  "objects": [
+    {"type": "sphere", "material": "chalk", "center": [-3, 0, 0], "radius": 1},
+    {"type": "sphere", "material": "steel", "center": [-1, 0, 0], "radius": 1},
+    {"type": "sphere", "material": "glass", "center": [1, 0, 0], "radius": 1},
+    {"type": "sphere", "material": "lamp", "center": [3, 0, 0], "radius": 1},
+    {"type": "sphere", "color": [1, 0, 0], "center": [0, 3, 0], "radius": 1}
+  ]
+}`
+	desc, err := ParseScene(strings.NewReader(input), JSONScene)
+	if err != nil {
+		t.Fatalf("Expected the scene to parse, got %v", err)
+	}
+	scene, err := desc.Build("")
+	if err != nil {
+		t.Fatalf("Expected the scene to build, got %v", err)
+	}
+
+	want := []Object{
+		{Color: Color{R: 0.8, G: 0.8, B: 0.8}, Material: Diffuse{Albedo: Color{R: 0.8, G: 0.8, B: 0.8}}},
+		{Color: Color{R: 0.6, G: 0.6, B: 0.7}, Material: Metal{Albedo: Color{R: 0.6, G: 0.6, B: 0.7}, Fuzz: 0.1}},
+		{Color: Color{R: 1, G: 1, B: 1}, Material: Dielectric{IOR: 1.5}},
+		{Color: Color{R: 4, G: 4, B: 4}, Material: Emissive{Emission: Color{R: 4, G: 4, B: 4}}},
+		{Color: Color{R: 1}},
+	}
+	for i, object := range scene.Objects {
+		if object.Color != want[i].Color || object.Material != want[i].Material {
+			t.Errorf("Expected object %d to have color %#v and material %#v, got %#v and %#v",
+				i, want[i].Color, want[i].Material, object.Color, object.Material)
+		}
+	}
+
+	// Describing the scene keeps the materials
+	described, err := DescribeScene(scene)
+	if err != nil {
+		t.Fatalf("Expected the scene to be described, got %v", err)
+	}
+	if len(described.Materials) != 4 || described.Objects[4].Material != "" {
+		t.Errorf("Expected 4 materials and an object with only a color, got %#v", described)
+	}
+	rebuilt, err := described.Build("")
+	if err != nil {
+		t.Fatalf("Expected the described scene to build, got %v", err)
+	}
+	for i, object := range rebuilt.Objects {
+		if object.Color != want[i].Color || object.Material != want[i].Material {
+			t.Errorf("Expected object %d to keep its material, got %#v and %#v", i, object.Color, object.Material)
+		}
+	}
+}
+
+func TestSceneMaterialValidation(t *testing.T) {
+	desc := &SceneDescription{
+		Camera: CameraDescription{Position: []float64{0, 0, 5}, LookAt: []float64{0, 0, 0}, FOV: 60},
+		Materials: map[string]MaterialDescription{
+			"a": {Type: "metal", Color: []float64{1, 1, 1}, Fuzz: 2},
+			"b": {Type: "dielectric"},
+			"c": {Type: "plastic", Color: []float64{1, 1, 1}},
+			"d": {Type: "emissive", IOR: 1.5},
+		},
+		Objects: []ObjectDescription{{Type: "sphere", Material: "a", Center: []float64{0, 0, 0}, Radius: 1}},
+	}
+
+	err := desc.Validate()
+	errs, ok := err.(SceneErrors)
+	if !ok {
+		t.Fatalf("Expected SceneErrors, got %#v", err)
+	}
+
+	want := []string{"materials.a.fuzz", "materials.b.ior", "materials.c.type", "materials.d.ior", "materials.d.color"}
+	if len(errs) != len(want) {
+		t.Fatalf("Expected %d errors, got %d:\n%v", len(want), len(errs), err)
+	}
+	for i, path := range want {
+		if errs[i].Path != path {
+			t.Errorf("Expected error %d at %s, got %v", i, path, errs[i])
+		}
+	}
+}
+
+func TestSceneCameras(t *testing.T) {
+	position, lookAt, up := geom.NewVector(1, 2, 5), geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0)
+	cameras := []Camera{
+		NewCamera(position, lookAt, up, 45),
+		NewThinLensCamera(position, lookAt, up, 45, 0.2, 5),
+		NewOrthographicCamera(position, lookAt, up, 4),
+		NewFisheyeCamera(position, lookAt, up, 270),
+	}
+
+	for _, camera := range cameras {
+		scene := testScene()
+		scene.Camera = camera
+
+		desc, err := DescribeScene(scene)
+		if err != nil {
+			t.Fatalf("Expected the scene to be described, got %v", err)
+		}
+		var buffer bytes.Buffer
+		if err := WriteScene(&buffer, desc, YAMLScene); err != nil {
+			t.Fatalf("Expected the scene to be written, got %v", err)
+		}
+		parsed, err := ParseScene(&buffer, YAMLScene)
+		if err != nil {
+			t.Fatalf("Expected the written scene to parse, got %v", err)
+		}
+		rebuilt, err := parsed.Build("")
+		if err != nil {
+			t.Fatalf("Expected the %q camera to build, got %v", desc.Camera.Type, err)
+		}
+
+		if rebuilt.Camera.Projection() != camera.Projection() {
+			t.Errorf("Expected the %q camera to keep its projection", desc.Camera.Type)
+		}
+		for _, lens := range [][2]float64{{0, 0}, {0.3, 0.6}} {
+			want := camera.LensRay(5, 7, 32, 24, lens[0], lens[1])
+			got := rebuilt.Camera.LensRay(5, 7, 32, 24, lens[0], lens[1])
+			if !vectorsAlmostEqual(want.Origin, got.Origin) || !vectorsAlmostEqual(want.Direction, got.Direction) {
+				t.Errorf("Expected the %q camera to give ray %#v, got %#v", desc.Camera.Type, want, got)
+			}
+		}
+	}
+}
+
+func TestSceneCameraValidation(t *testing.T) {
+	cameras := map[string]CameraDescription{
+		"camera.height":         {Type: "orthographic", Height: -1},
+		"camera.fov":            {Type: "fisheye", FOV: 400},
+		"camera.aperture":       {FOV: 60, Aperture: 1},
+		"camera.focus_distance": {Type: "thin_lens", FOV: 60, Aperture: 1},
+		"camera.type":           {Type: "panoramic", FOV: 60},
+	}
+
+	for path, camera := range cameras {
+		camera.Position, camera.LookAt = []float64{0, 0, 5}, []float64{0, 0, 0}
+		desc := &SceneDescription{
+			Camera:  camera,
+			Objects: []ObjectDescription{{Type: "sphere", Color: []float64{1, 1, 1}, Center: []float64{0, 0, 0}, Radius: 1}},
+		}
+
+		errs, ok := desc.Validate().(SceneErrors)
+		if !ok || len(errs) != 1 || errs[0].Path != path {
+			t.Errorf("Expected a single error at %s, got %v", path, errs)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"testing"
+)
+
+func TestTriangleIntersectSegment(t *testing.T) {
+	triangle := NewTriangle(geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0), geom.NewVector(0, 1, 0))
+	ray := geom.NewRay(geom.NewVector(0, 0, -1), geom.NewVector(0, 0, 1))
+
+	cases := []struct {
+		tMin, tMax float64
+		expected   bool
+	}{
+		{0, math.Inf(1), true},
+		{0, 1, true},
+		{1, 1, true},
+		{0, 0.999, false},
+		{1.001, 2, false},
+	}
+
+	for _, c := range cases {
+		if triangle.IntersectSegment(ray, c.tMin, c.tMax) != c.expected {
+			t.Errorf("Expected %v for the segment [%v, %v]", c.expected, c.tMin, c.tMax)
+		}
+	}
+}
+
+func TestSphereClosestHitSegment(t *testing.T) {
+	sphere := NewSphere(geom.NewVector(0, 0, 5), 2)
+	ray := geom.NewRay(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1))
+
+	cases := []struct {
+		tMin, tMax float64
+		expected   float64
+		ok         bool
+	}{
+		{0, math.Inf(1), 3, true},
+		{3.5, math.Inf(1), 7, true},
+		{0, 2.5, 0, false},
+		{3.5, 6.5, 0, false},
+		{7.5, math.Inf(1), 0, false},
+	}
+
+	for _, c := range cases {
+		hit, ok := sphere.ClosestHitSegment(ray, c.tMin, c.tMax)
+		if ok != c.ok || (ok && !almostEqual(hit.T, c.expected)) {
+			t.Errorf("Expected %v, %v for the segment [%v, %v], got %#v, %v", c.expected, c.ok, c.tMin, c.tMax, hit.T, ok)
+		}
+		if sphere.IntersectSegment(ray, c.tMin, c.tMax) != c.ok {
+			t.Errorf("Expected IntersectSegment to agree with ClosestHitSegment for [%v, %v]", c.tMin, c.tMax)
+		}
+	}
+}
+
+func TestQuadIntersectSegment(t *testing.T) {
+	quads := map[string]Quad{
+		"planar": NewQuad(
+			geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0),
+			geom.NewVector(1, 1, 0), geom.NewVector(-1, 1, 0),
+		),
+		"bilinear": NewQuad(
+			geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0.5),
+			geom.NewVector(1, 1, 0), geom.NewVector(-1, 1, 0.5),
+		),
+	}
+	ray := geom.NewRay(geom.NewVector(0.1, 0.1, -2), geom.NewVector(0, 0, 1))
+
+	for name, quad := range quads {
+		hit, ok := quad.ClosestHit(ray)
+		if !ok {
+			t.Errorf("Expected the %s quad to be hit", name)
+			continue
+		}
+		if !quad.IntersectSegment(ray, 0, hit.T+1e-6) {
+			t.Errorf("Expected the %s quad to be hit before %#v", name, hit.T)
+		}
+		if quad.IntersectSegment(ray, 0, hit.T-1e-3) {
+			t.Errorf("Expected the %s quad not to be hit before %#v", name, hit.T-1e-3)
+		}
+		if _, ok := quad.ClosestHitSegment(ray, hit.T+1e-3, math.Inf(1)); ok {
+			t.Errorf("Expected the %s quad not to be hit after %#v", name, hit.T+1e-3)
+		}
+	}
+}
+
+func TestBVHClosestHitSegment(t *testing.T) {
+	near := NewSphere(geom.NewVector(0, 0, 5), 1)
+	far := NewSphere(geom.NewVector(0, 0, 10), 1)
+	bvh := NewBVH([]Primitive{near, far})
+	ray := geom.NewRay(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 1))
+
+	hit, ok := bvh.ClosestHitSegment(ray, 6.5, math.Inf(1))
+	if !ok || !almostEqual(hit.T, 9) || hit.Primitive != far {
+		t.Errorf("Expected the far sphere at 9, got %#v", hit)
+	}
+
+	if bvh.IntersectSegment(ray, 6.5, 8.5) {
+		t.Errorf("Expected nothing between the spheres")
+	}
+	if !bvh.IntersectSegment(ray, 0, 4.5) {
+		t.Errorf("Expected the near sphere to be hit")
+	}
+}
+
+func TestAggregatesIntersectSegment(t *testing.T) {
+	polygon, err := NewPolygon([]geom.Vector{
+		geom.NewVector(-1, -1, 3), geom.NewVector(1, -1, 3), geom.NewVector(1, 1, 3),
+		geom.NewVector(0, 0.5, 3), geom.NewVector(-1, 1, 3),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	mesh, err := NewMesh(
+		[]geom.Vector{geom.NewVector(-1, -1, 3), geom.NewVector(1, -1, 3), geom.NewVector(0, 1, 3)},
+		[]Face{{Vertices: []int{0, 1, 2}}},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	instance, err := NewInstance(NewTriangle(
+		geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0), geom.NewVector(0, 1, 0),
+	), Translate(geom.NewVector(0, 0, 3)))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	ray := geom.NewRay(geom.NewVector(0, -0.5, 0), geom.NewVector(0, 0, 1))
+	for name, primitive := range map[string]Primitive{"polygon": polygon, "mesh": mesh, "instance": instance} {
+		if !primitive.IntersectSegment(ray, 0, 3) {
+			t.Errorf("Expected the %s to be hit at 3", name)
+		}
+		if primitive.IntersectSegment(ray, 0, 2.9) {
+			t.Errorf("Expected the %s not to be hit before 2.9", name)
+		}
+		hit, ok := primitive.ClosestHitSegment(ray, 2, 4)
+		if !ok || !almostEqual(hit.T, 3) || !vectorsAlmostEqual(hit.Point, geom.NewVector(0, -0.5, 3)) {
+			t.Errorf("Expected the %s to be hit at (0, -0.5, 3), got %#v", name, hit)
+		}
+	}
+}
+
+func TestOccluderBehindLight(t *testing.T) {
+	scene := &Scene{
+		Objects: []Object{{Primitive: NewSphere(geom.NewVector(0, 5, 0), 1), Color: Color{1, 1, 1}}},
+	}
+	point := geom.NewVector(0, 0, 0)
+
+	if scene.occluded(point, geom.NewVector(0, 2, 0)) {
+		t.Errorf("Expected a sphere behind the light not to cast a shadow")
+	}
+	if !scene.occluded(point, geom.NewVector(0, 10, 0)) {
+		t.Errorf("Expected a sphere in front of the light to cast a shadow")
+	}
+}
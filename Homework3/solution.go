@@ -3,138 +3,321 @@ package main
 import (
 	"github.com/fmi/go-homework/geom"
 	"math"
-	"sync"
 )
 
 const epsilon = 1e-7
 
+// quadPlanarityTolerance is the distance, relative to the longest edge, a quad
+// vertex may be off the plane of the others for the quad to count as planar.
+const quadPlanarityTolerance = 1e-6
+
+// sphereTangentTolerance is the relative amount by which a ray may pass a
+// sphere and still count as touching it.
+const sphereTangentTolerance = 1e-12
+
 type Triangle struct {
 	a, b, c geom.Vector
+
+	// Edges sharing the first vertex, kept for the intersection test
+	edge1, edge2 geom.Vector
+
+	mode TriangleMode
 }
 
 type Quad struct {
 	a, b, c, d geom.Vector
+
+	// How the quad is intersected is decided once in NewQuad
+	planar    bool
+	split     [2][3]int
+	triangles [2]Triangle
 }
 
 type Sphere struct {
 	origin geom.Vector
 	r      float64
+
+	// Hits closer to the ray origin than this are ignored, so that rays
+	// leaving the surface do not hit it again
+	epsilon float64
+}
+
+// SphereCrossing describes how the line of a ray passes through a sphere.
+type SphereCrossing struct {
+	// Entry and Exit are the ray parameters at which the line enters and
+	// leaves the sphere, with Entry <= Exit. Either of them may be negative.
+	Entry, Exit float64
+
+	// Inside is set when the ray origin is inside the sphere by more than
+	// the epsilon of the sphere. An origin on the surface is not inside.
+	Inside bool
+
+	// Tangent is set when the ray only grazes the sphere and Entry == Exit.
+	Tangent bool
 }
 
 func NewTriangle(a, b, c geom.Vector) Triangle {
 	return Triangle{
-		a: a,
-		b: b,
-		c: c,
+		a:     a,
+		b:     b,
+		c:     c,
+		edge1: geom.Sub(b, a),
+		edge2: geom.Sub(c, a),
 	}
 }
 
 func NewQuad(a, b, c, d geom.Vector) Quad {
-	return Quad{
+	quad := Quad{
 		a: a,
 		b: b,
 		c: c,
 		d: d,
 	}
+
+	quad.planar = quad.isPlanar()
+
+	// A concave quad has to be split along the diagonal through its reflex vertex
+	switch quad.reflexVertex() {
+	case 1, 3:
+		quad.split = [2][3]int{{1, 3, 0}, {1, 3, 2}}
+	default:
+		quad.split = [2][3]int{{0, 2, 1}, {0, 2, 3}}
+	}
+
+	vertices := quad.vertices()
+	for i, indices := range quad.split {
+		quad.triangles[i] = NewTriangle(vertices[indices[0]], vertices[indices[1]], vertices[indices[2]])
+	}
+
+	return quad
 }
 
 func NewSphere(origin geom.Vector, r float64) Sphere {
 	return Sphere{
-		origin: origin,
-		r:      r,
+		origin:  origin,
+		r:       r,
+		epsilon: epsilon,
 	}
 }
 
+// WithEpsilon returns a copy of the sphere which ignores hits closer than e
+// to the ray origin in Intersect and ClosestHit.
+func (sphere Sphere) WithEpsilon(e float64) Sphere {
+	sphere.epsilon = e
+	return sphere
+}
+
 func (triangle Triangle) Intersect(ray geom.Ray) bool {
-	// Find vectors for two edges sharing the first vertex
-	edge1 := geom.Sub(triangle.b, triangle.a)
-	edge2 := geom.Sub(triangle.c, triangle.a)
+	return triangle.IntersectSegment(ray, epsilon, math.Inf(1))
+}
 
+func (triangle Triangle) ClosestHit(ray geom.Ray) (Hit, bool) {
+	return triangle.ClosestHitSegment(ray, epsilon, math.Inf(1))
+}
+
+// IntersectSegment reports whether the ray hits the triangle at a parameter
+// between tMin and tMax inclusive.
+func (triangle Triangle) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	_, _, _, ok := triangle.intersect(ray, tMin, tMax)
+	return ok
+}
+
+// ClosestHitSegment returns the hit of the ray with the triangle if its
+// parameter is between tMin and tMax inclusive.
+func (triangle Triangle) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	t, u, v, ok := triangle.intersect(ray, tMin, tMax)
+	if !ok {
+		return Hit{}, false
+	}
+
+	return Hit{
+		T:         t,
+		Point:     pointAt(ray, t),
+		Normal:    triangle.normal(),
+		U:         u,
+		V:         v,
+		Primitive: triangle,
+	}, true
+}
+
+func (triangle Triangle) normal() geom.Vector {
+	return normalize(geom.Cross(triangle.edge1, triangle.edge2))
+}
+
+// intersect returns the ray parameter of the hit along with its barycentric
+// coordinates, using the algorithm selected by the mode of the triangle.
+func (triangle Triangle) intersect(ray geom.Ray, tMin, tMax float64) (t, u, v float64, ok bool) {
+	if triangle.mode == WatertightTriangles {
+		return triangle.intersectWatertight(ray, tMin, tMax)
+	}
+	return triangle.intersectMollerTrumbore(ray, tMin, tMax)
+}
+
+// intersectMollerTrumbore implements the Möller–Trumbore algorithm.
+func (triangle Triangle) intersectMollerTrumbore(ray geom.Ray, tMin, tMax float64) (t, u, v float64, ok bool) {
+	t, u, v, ok = mollerTrumbore(triangle.a, triangle.edge1, triangle.edge2, ray.Origin, ray.Direction)
+
+	// Final check to see if the hit is within the segment
+	if ok && t >= tMin && t <= tMax {
+		return t, u, v, true
+	}
+
+	return 0, 0, 0, false
+}
+
+// mollerTrumbore returns where the line through origin along direction
+// crosses the plane of the triangle at a with the given edges, if that is
+// inside the triangle. The ray parameter t is not checked.
+func mollerTrumbore(a, edge1, edge2, origin, direction geom.Vector) (t, u, v float64, ok bool) {
 	// Begin calculating determinant
-	h := geom.Cross(ray.Direction, edge2)
+	h := geom.Cross(direction, edge2)
 
 	det := geom.Dot(edge1, h)
 	if det > -epsilon && det < epsilon {
-		return false // The ray is parallel to triangle plane, impossible that they intersect
+		return 0, 0, 0, false // The ray is parallel to triangle plane, impossible that they intersect
 	}
 
 	f := 1 / det
 
 	// Calculate vector from vertex to the ray origin
-	s := geom.Sub(ray.Origin, triangle.a)
+	s := geom.Sub(origin, a)
 
 	// Calculating U parameter
-	u := f * geom.Dot(s, h)
+	u = f * geom.Dot(s, h)
 	if u < 0 || u > 1 {
-		return false
+		return 0, 0, 0, false
 	}
 
 	// Prepare to test V parameter
 	q := geom.Cross(s, edge1)
 
-	v := f * geom.Dot(ray.Direction, q)
+	v = f * geom.Dot(direction, q)
 	if v < 0 || u+v > 1 {
-		return false
+		return 0, 0, 0, false
 	}
 
-	// Calculating t - final check to see if ray intersects triangle
-	t := f * geom.Dot(edge2, q)
-	if t > epsilon {
-		return true
-	}
-
-	return false
+	// Calculating t
+	return f * geom.Dot(edge2, q), u, v, true
 }
 
+// quadCornerUV holds the surface coordinates of the quad vertices a, b, c, d.
+var quadCornerUV = [4][2]float64{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+
 func (quad Quad) Intersect(ray geom.Ray) bool {
-	var firstTriangle, secondTriangle Triangle
+	return quad.IntersectSegment(ray, epsilon, math.Inf(1))
+}
 
-	// Determining how to split the polygon
-	if quad.isConvex() {
-		firstTriangle = Triangle{a: quad.a, b: quad.c, c: quad.b}
-		secondTriangle = Triangle{a: quad.a, b: quad.c, c: quad.d}
-	} else {
-		firstTriangle = Triangle{a: quad.b, b: quad.d, c: quad.a}
-		secondTriangle = Triangle{a: quad.b, b: quad.d, c: quad.c}
+func (quad Quad) ClosestHit(ray geom.Ray) (Hit, bool) {
+	return quad.ClosestHitSegment(ray, epsilon, math.Inf(1))
+}
+
+// IntersectSegment reports whether the ray hits the quad at a parameter
+// between tMin and tMax inclusive.
+func (quad Quad) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	if !quad.planar {
+		_, _, _, ok := quad.bilinearIntersect(ray, tMin, tMax)
+		return ok
 	}
 
-	var wg sync.WaitGroup
-	var mutex sync.Mutex
-	var foundIntersection bool
+	return quad.triangles[0].IntersectSegment(ray, tMin, tMax) || quad.triangles[1].IntersectSegment(ray, tMin, tMax)
+}
+
+// ClosestHitSegment returns the nearest hit of the ray with the quad whose
+// parameter is between tMin and tMax inclusive.
+func (quad Quad) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	if !quad.planar {
+		return quad.bilinearHit(ray, tMin, tMax)
+	}
 
-	checkIntersection := func(triangle *Triangle) {
-		defer wg.Done()
-		result := triangle.Intersect(ray)
-		mutex.Lock()
-		foundIntersection = foundIntersection || result
-		mutex.Unlock()
+	closest, part := math.Inf(1), -1
+	var u, v float64
+	for i, triangle := range quad.triangles {
+		if t, tu, tv, ok := triangle.intersect(ray, tMin, tMax); ok && t < closest {
+			closest, part, u, v = t, i, tu, tv
+		}
+	}
+	if part < 0 {
+		return Hit{}, false
 	}
 
-	wg.Add(2)
-	go checkIntersection(&firstTriangle)
-	go checkIntersection(&secondTriangle)
-	wg.Wait()
+	// Interpolate the corner coordinates with the barycentric ones of the triangle
+	indices := quad.split[part]
+	w := 1 - u - v
+	uv0, uv1, uv2 := quadCornerUV[indices[0]], quadCornerUV[indices[1]], quadCornerUV[indices[2]]
+
+	return Hit{
+		T:         closest,
+		Point:     pointAt(ray, closest),
+		Normal:    quad.normal(), // one of the split triangles winds the other way
+		U:         w*uv0[0] + u*uv1[0] + v*uv2[0],
+		V:         w*uv0[1] + u*uv1[1] + v*uv2[1],
+		Primitive: quad,
+	}, true
+}
 
-	return foundIntersection
+func (quad Quad) vertices() [4]geom.Vector {
+	return [4]geom.Vector{quad.a, quad.b, quad.c, quad.d}
 }
 
-func (quad Quad) isConvex() bool {
-	var sign bool
-	vertices := []geom.Vector{quad.a, quad.b, quad.c, quad.d}
+// facingTriangles returns the triangles of the quad wound the way the quad
+// is. The ones it is intersected as both start with the diagonal, so that
+// they agree on hits along it, and one of them winds the other way.
+func (quad Quad) facingTriangles() [2]Triangle {
+	triangles := quad.triangles
+	normal := quad.normal()
+	for i, triangle := range triangles {
+		if geom.Dot(geom.Cross(triangle.edge1, triangle.edge2), normal) < 0 {
+			triangles[i] = NewTriangle(triangle.a, triangle.c, triangle.b).WithMode(triangle.mode)
+		}
+	}
+	return triangles
+}
+
+// normal returns the Newell normal of the quad. Unlike the cross product of
+// two edges it follows the winding of the whole quad even when it is concave
+// or slightly twisted.
+func (quad Quad) normal() geom.Vector {
+	vertices := quad.vertices()
+	return newellNormal(vertices[:])
+}
+
+// reflexVertex returns the index of the vertex at which the quad turns against
+// its own winding, or -1 if it is convex. The turns are measured in the plane
+// of the quad, so its orientation in space does not matter.
+func (quad Quad) reflexVertex() int {
+	normal := quad.normal()
+	vertices := quad.vertices()
 	n := len(vertices)
 
 	for i := 0; i < n; i++ {
-		dx1 := vertices[(i+2)%n].X - vertices[(i+1)%n].X
-		dy1 := vertices[(i+2)%n].Y - vertices[(i+1)%n].Y
+		previous, current, next := vertices[(i+n-1)%n], vertices[i], vertices[(i+1)%n]
+		turn := geom.Dot(geom.Cross(geom.Sub(current, previous), geom.Sub(next, current)), normal)
+		if turn < 0 {
+			return i
+		}
+	}
 
-		dx2 := vertices[i].X - vertices[(i+1)%n].X
-		dy2 := vertices[i].Y - vertices[(i+1)%n].Y
+	return -1
+}
 
-		zcross := dx1*dy2 - dy1*dx2
+// Planar reports whether all four vertices lie in a common plane. Quads which
+// are not planar are intersected as bilinear patches instead of being split
+// into two triangles.
+func (quad Quad) Planar() bool {
+	return quad.planar
+}
+
+func (quad Quad) isPlanar() bool {
+	normal := quad.normal()
+	vertices := quad.vertices()
+
+	var size float64
+	for i := range vertices {
+		size = math.Max(size, length(geom.Sub(vertices[(i+1)%len(vertices)], vertices[i])))
+	}
 
-		if i == 0 {
-			sign = zcross > 0
-		} else if sign != (zcross > 0) {
+	for _, vertex := range vertices[1:] {
+		if math.Abs(geom.Dot(geom.Sub(vertex, quad.a), normal)) > quadPlanarityTolerance*size {
 			return false
 		}
 	}
@@ -142,26 +325,124 @@ func (quad Quad) isConvex() bool {
 	return true
 }
 
+// Intersect reports whether the ray hits the sphere farther than its epsilon
+// from the origin. A ray starting inside hits the sphere where it leaves it,
+// a tangent ray hits it at the point it touches and a ray starting on the
+// surface only hits it if it goes through the sphere.
 func (sphere Sphere) Intersect(ray geom.Ray) bool {
+	return sphere.IntersectSegment(ray, sphere.epsilon, math.Inf(1))
+}
+
+// ClosestHit returns the first hit of the ray with the sphere by the rules of
+// Intersect.
+func (sphere Sphere) ClosestHit(ray geom.Ray) (Hit, bool) {
+	return sphere.ClosestHitSegment(ray, sphere.epsilon, math.Inf(1))
+}
+
+// IntersectSegment reports whether the ray crosses the sphere surface at a
+// parameter between tMin and tMax inclusive.
+func (sphere Sphere) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	_, ok := sphere.nearestRoot(ray, tMin, tMax)
+	return ok
+}
+
+// ClosestHitSegment returns the nearest crossing of the ray with the sphere
+// surface whose parameter is between tMin and tMax inclusive.
+func (sphere Sphere) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	t, ok := sphere.nearestRoot(ray, tMin, tMax)
+	if !ok {
+		return Hit{}, false
+	}
+	return sphere.hitAt(ray, t), true
+}
+
+// hitAt returns the hit with the sphere at parameter t of the ray.
+func (sphere Sphere) hitAt(ray geom.Ray, t float64) Hit {
+	point := pointAt(ray, t)
+	normal := scale(geom.Sub(point, sphere.origin), 1/sphere.r)
+	u, v := sphereUV(normal)
+
+	return Hit{
+		T:         t,
+		Point:     point,
+		Normal:    normal,
+		U:         u,
+		V:         v,
+		Primitive: sphere,
+	}
+}
+
+// nearestRoot returns the smallest root between tMin and tMax.
+func (sphere Sphere) nearestRoot(ray geom.Ray, tMin, tMax float64) (float64, bool) {
+	crossing, ok := sphere.Crossing(ray)
+	if !ok {
+		return 0, false
+	}
+
+	if crossing.Entry >= tMin && crossing.Entry <= tMax {
+		return crossing.Entry, true
+	}
+	if crossing.Exit >= tMin && crossing.Exit <= tMax {
+		return crossing.Exit, true
+	}
+
+	return 0, false
+}
+
+// Crossing returns where the line of the ray enters and leaves the sphere.
+// It fails when the line misses the sphere or the ray has no direction.
+func (sphere Sphere) Crossing(ray geom.Ray) (SphereCrossing, bool) {
+	x1, x2, ok := sphere.roots(ray)
+	if !ok {
+		return SphereCrossing{}, false
+	}
+
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+
+	return SphereCrossing{
+		Entry:   x1,
+		Exit:    x2,
+		Inside:  x1 < -sphere.epsilon && x2 > sphere.epsilon,
+		Tangent: x1 == x2,
+	}, true
+}
+
+// roots returns the ray parameters at which the line of the ray crosses the
+// sphere surface.
+func (sphere Sphere) roots(ray geom.Ray) (float64, float64, bool) {
 	oc := geom.Sub(ray.Origin, sphere.origin)
 
 	a := geom.Dot(ray.Direction, ray.Direction)
+	if a == 0 {
+		return 0, 0, false
+	}
 	b := 2.0 * geom.Dot(oc, ray.Direction)
 	c := geom.Dot(oc, oc) - (sphere.r * sphere.r)
 
-	discriminant := b*b - 4*a*c
-
-	if discriminant < 0 {
-		return false
+	// b*b - 4*a*c cancels badly for distant spheres, so the discriminant is
+	// found from the distance between the center and the line instead
+	perpendicular := geom.Sub(oc, scale(ray.Direction, geom.Dot(oc, ray.Direction)/a))
+	h := sphere.r*sphere.r - geom.Dot(perpendicular, perpendicular)
+	if h < 0 {
+		// Grazing rays may land just outside through rounding
+		if h < -sphereTangentTolerance*sphere.r*sphere.r {
+			return 0, 0, false
+		}
+		h = 0
 	}
+	discriminant := 4 * a * h
 
 	x1, x2 := solveQuadraticEquation(a, b, c, discriminant)
+	return x1, x2, true
+}
 
-	if x1 < 0 && x2 < 0 {
-		return false
-	}
-
-	return true
+// sphereUV maps a unit normal of a sphere to longitude and latitude in [0, 1].
+func sphereUV(normal geom.Vector) (float64, float64) {
+	u := 0.5 + math.Atan2(normal.Z, normal.X)/(2*math.Pi)
+	v := math.Acos(math.Max(-1, math.Min(1, normal.Y))) / math.Pi
+	return u, v
 }
 
 func solveQuadraticEquation(a, b, c, discriminant float64) (float64, float64) {
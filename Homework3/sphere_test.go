@@ -0,0 +1,166 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"testing"
+)
+
+func TestSphereEdgeCases(t *testing.T) {
+	sphere := NewSphere(geom.NewVector(0, 0, 0), 2)
+
+	cases := []struct {
+		name      string
+		ray       geom.Ray
+		hit       bool
+		t         float64
+		crossing  SphereCrossing
+		crossesOk bool
+	}{
+		{
+			name:      "outside towards",
+			ray:       geom.NewRay(geom.NewVector(0, 0, 5), geom.NewVector(0, 0, -1)),
+			hit:       true,
+			t:         3,
+			crossing:  SphereCrossing{Entry: 3, Exit: 7},
+			crossesOk: true,
+		},
+		{
+			name:      "outside away",
+			ray:       geom.NewRay(geom.NewVector(0, 0, 5), geom.NewVector(0, 0, 1)),
+			crossing:  SphereCrossing{Entry: -7, Exit: -3},
+			crossesOk: true,
+		},
+		{
+			name:      "inside at the center",
+			ray:       geom.NewRay(geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0)),
+			hit:       true,
+			t:         2,
+			crossing:  SphereCrossing{Entry: -2, Exit: 2, Inside: true},
+			crossesOk: true,
+		},
+		{
+			name:      "inside off center",
+			ray:       geom.NewRay(geom.NewVector(0, 0, 1), geom.NewVector(0, 0, -1)),
+			hit:       true,
+			t:         3,
+			crossing:  SphereCrossing{Entry: -1, Exit: 3, Inside: true},
+			crossesOk: true,
+		},
+		{
+			name:      "on the surface going in",
+			ray:       geom.NewRay(geom.NewVector(0, 0, 2), geom.NewVector(0, 0, -1)),
+			hit:       true,
+			t:         4,
+			crossing:  SphereCrossing{Entry: 0, Exit: 4},
+			crossesOk: true,
+		},
+		{
+			name:      "on the surface going out",
+			ray:       geom.NewRay(geom.NewVector(0, 0, 2), geom.NewVector(0, 0, 1)),
+			crossing:  SphereCrossing{Entry: -4, Exit: 0},
+			crossesOk: true,
+		},
+		{
+			name:      "on the surface going along it",
+			ray:       geom.NewRay(geom.NewVector(0, 0, 2), geom.NewVector(1, 0, 0)),
+			crossing:  SphereCrossing{Tangent: true},
+			crossesOk: true,
+		},
+		{
+			name:      "tangent ahead",
+			ray:       geom.NewRay(geom.NewVector(-5, 2, 0), geom.NewVector(1, 0, 0)),
+			hit:       true,
+			t:         5,
+			crossing:  SphereCrossing{Entry: 5, Exit: 5, Tangent: true},
+			crossesOk: true,
+		},
+		{
+			name:      "tangent behind",
+			ray:       geom.NewRay(geom.NewVector(5, 2, 0), geom.NewVector(1, 0, 0)),
+			crossing:  SphereCrossing{Entry: -5, Exit: -5, Tangent: true},
+			crossesOk: true,
+		},
+		{
+			name: "just missing",
+			ray:  geom.NewRay(geom.NewVector(-5, 2.0001, 0), geom.NewVector(1, 0, 0)),
+		},
+		{
+			name:      "scaled direction",
+			ray:       geom.NewRay(geom.NewVector(0, 0, 5), geom.NewVector(0, 0, -2)),
+			hit:       true,
+			t:         1.5,
+			crossing:  SphereCrossing{Entry: 1.5, Exit: 3.5},
+			crossesOk: true,
+		},
+		{
+			name: "no direction",
+			ray:  geom.NewRay(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 0)),
+		},
+	}
+
+	for _, c := range cases {
+		hit, ok := sphere.ClosestHit(c.ray)
+		if ok != c.hit || (ok && !almostEqual(hit.T, c.t)) {
+			t.Errorf("%s: expected hit %v at %v, got %v at %#v", c.name, c.hit, c.t, ok, hit.T)
+		}
+		if sphere.Intersect(c.ray) != c.hit {
+			t.Errorf("%s: expected Intersect to return %v", c.name, c.hit)
+		}
+
+		crossing, ok := sphere.Crossing(c.ray)
+		if ok != c.crossesOk {
+			t.Errorf("%s: expected the line to cross the sphere: %v, got %v", c.name, c.crossesOk, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if crossing.Inside != c.crossing.Inside || crossing.Tangent != c.crossing.Tangent {
+			t.Errorf("%s: expected %#v, got %#v", c.name, c.crossing, crossing)
+		}
+		if !almostEqual(crossing.Entry, c.crossing.Entry) || !almostEqual(crossing.Exit, c.crossing.Exit) {
+			t.Errorf("%s: expected %#v, got %#v", c.name, c.crossing, crossing)
+		}
+	}
+}
+
+func TestSphereDistantTangent(t *testing.T) {
+	sphere := NewSphere(geom.NewVector(1e6, 1, 0), 1)
+	ray := geom.NewRay(geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0))
+
+	crossing, ok := sphere.Crossing(ray)
+	if !ok || !crossing.Tangent {
+		t.Fatalf("Expected a tangent crossing, got %#v, %v", crossing, ok)
+	}
+	if math.Abs(crossing.Entry-1e6) > 1e-6 {
+		t.Errorf("Expected the ray to touch the sphere at 1e6, got %v", crossing.Entry)
+	}
+}
+
+func TestSphereWithEpsilon(t *testing.T) {
+	sphere := NewSphere(geom.NewVector(0, 0, 0), 2)
+	// The origin is just off the surface, as after a rounding error
+	ray := geom.NewRay(geom.NewVector(0, 0, 2.001), geom.NewVector(0, 0, 1))
+
+	if hit, ok := sphere.ClosestHit(ray); ok {
+		t.Errorf("Expected no hit away from the sphere, got %#v", hit)
+	}
+
+	ray = geom.NewRay(geom.NewVector(0, 0, 1.999), geom.NewVector(0, 0, 1))
+	if hit, ok := sphere.ClosestHit(ray); !ok || !almostEqual(hit.T, 0.001) {
+		t.Errorf("Expected a hit at 0.001 with the default epsilon, got %#v", hit)
+	}
+	if hit, ok := sphere.WithEpsilon(0.01).ClosestHit(ray); ok {
+		t.Errorf("Expected the hit to be ignored with a larger epsilon, got %#v", hit)
+	}
+
+	crossing, _ := sphere.WithEpsilon(0.01).Crossing(ray)
+	if crossing.Inside {
+		t.Errorf("Expected an origin within epsilon of the surface not to be inside")
+	}
+	crossing, _ = sphere.Crossing(ray)
+	if !crossing.Inside {
+		t.Errorf("Expected the origin to be inside with the default epsilon")
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/fmi/go-homework/geom"
+	"io"
+	"math"
+	"strings"
+)
+
+const (
+	stlHeaderSize = 80
+	stlFacetSize  = 50
+)
+
+// ReadSTL reads an ASCII or binary STL file. Vertices shared by facets are
+// merged, so the mesh keeps the connectivity of the model.
+func ReadSTL(r io.Reader) (*Mesh, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Binary files may start with "solid" too, so trust the facet count first
+	if len(data) >= stlHeaderSize+4 {
+		count := binary.LittleEndian.Uint32(data[stlHeaderSize:])
+		if uint64(len(data)) == stlHeaderSize+4+uint64(count)*stlFacetSize {
+			return readBinarySTL(data[stlHeaderSize+4:], int(count))
+		}
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid")) {
+		return readASCIISTL(data)
+	}
+
+	return nil, errors.New("stl: file is neither ASCII nor a complete binary STL")
+}
+
+// meshBuilder merges equal vertices while triangles are added.
+type meshBuilder struct {
+	vertices []geom.Vector
+	faces    []Face
+	indices  map[geom.Vector]int
+}
+
+func newMeshBuilder() *meshBuilder {
+	return &meshBuilder{indices: make(map[geom.Vector]int)}
+}
+
+func (builder *meshBuilder) vertex(v geom.Vector) int {
+	index, ok := builder.indices[v]
+	if !ok {
+		index = len(builder.vertices)
+		builder.indices[v] = index
+		builder.vertices = append(builder.vertices, v)
+	}
+	return index
+}
+
+func (builder *meshBuilder) triangle(a, b, c geom.Vector) {
+	builder.faces = append(builder.faces, Face{
+		Vertices: []int{builder.vertex(a), builder.vertex(b), builder.vertex(c)},
+	})
+}
+
+func (builder *meshBuilder) mesh() (*Mesh, error) {
+	return NewMesh(builder.vertices, builder.faces)
+}
+
+func readBinarySTL(data []byte, count int) (*Mesh, error) {
+	builder := newMeshBuilder()
+
+	for i := 0; i < count; i++ {
+		facet := data[i*stlFacetSize:]
+
+		// The stored normal is skipped, the one of the triangle is used instead
+		var corners [3]geom.Vector
+		for j := range corners {
+			corners[j] = readSTLVector(facet[12+12*j:])
+		}
+		builder.triangle(corners[0], corners[1], corners[2])
+	}
+
+	return builder.mesh()
+}
+
+func readSTLVector(data []byte) geom.Vector {
+	coordinate := func(offset int) float64 {
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data[offset:])))
+	}
+	return geom.NewVector(coordinate(0), coordinate(4), coordinate(8))
+}
+
+func readASCIISTL(data []byte) (*Mesh, error) {
+	builder := newMeshBuilder()
+	var corners []geom.Vector
+
+	// expect lists the keywords which may come next
+	expect := []string{"solid"}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		fail := func(format string, args ...interface{}) error {
+			return &ParseError{Format: "stl", Line: line, Message: fmt.Sprintf(format, args...)}
+		}
+
+		keyword := fields[0]
+		allowed := false
+		for _, candidate := range expect {
+			allowed = allowed || keyword == candidate
+		}
+		if !allowed {
+			return nil, fail("expected %s, got %q", strings.Join(expect, " or "), keyword)
+		}
+
+		switch keyword {
+		case "solid":
+			expect = []string{"facet", "endsolid"}
+		case "facet":
+			expect = []string{"outer"}
+		case "outer":
+			corners = corners[:0]
+			expect = []string{"vertex"}
+		case "vertex":
+			if len(fields) != 4 {
+				return nil, fail("vertex needs 3 coordinates, got %d", len(fields)-1)
+			}
+			values, err := parseFloats(fields[1:])
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			corners = append(corners, geom.NewVector(values[0], values[1], values[2]))
+			if len(corners) < 3 {
+				expect = []string{"vertex"}
+			} else {
+				expect = []string{"endloop"}
+			}
+		case "endloop":
+			builder.triangle(corners[0], corners[1], corners[2])
+			expect = []string{"endfacet"}
+		case "endfacet":
+			expect = []string{"facet", "endsolid"}
+		case "endsolid":
+			// Some exporters put several solids in one file
+			expect = []string{"solid"}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if expect[0] != "solid" {
+		return nil, &ParseError{Format: "stl", Line: line, Message: "unexpected end of file"}
+	}
+
+	return builder.mesh()
+}
+
+// WriteBinarySTL writes the triangles of the mesh as a binary STL file.
+func WriteBinarySTL(w io.Writer, mesh *Mesh) error {
+	triangles := mesh.Triangles()
+	out := bufio.NewWriter(w)
+
+	header := make([]byte, stlHeaderSize+4)
+	copy(header, "binary STL")
+	binary.LittleEndian.PutUint32(header[stlHeaderSize:], uint32(len(triangles)))
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	facet := make([]byte, stlFacetSize)
+	for _, triangle := range triangles {
+		for i, v := range [4]geom.Vector{triangle.normal(), triangle.a, triangle.b, triangle.c} {
+			binary.LittleEndian.PutUint32(facet[12*i:], math.Float32bits(float32(v.X)))
+			binary.LittleEndian.PutUint32(facet[12*i+4:], math.Float32bits(float32(v.Y)))
+			binary.LittleEndian.PutUint32(facet[12*i+8:], math.Float32bits(float32(v.Z)))
+		}
+		if _, err := out.Write(facet); err != nil {
+			return err
+		}
+	}
+
+	return out.Flush()
+}
+
+// WriteASCIISTL writes the triangles of the mesh as an ASCII STL solid.
+func WriteASCIISTL(w io.Writer, mesh *Mesh, name string) error {
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintf(out, "solid %s\n", name)
+	for _, triangle := range mesh.Triangles() {
+		n := triangle.normal()
+		fmt.Fprintf(out, "  facet normal %g %g %g\n    outer loop\n", n.X, n.Y, n.Z)
+		for _, v := range [3]geom.Vector{triangle.a, triangle.b, triangle.c} {
+			fmt.Fprintf(out, "      vertex %g %g %g\n", v.X, v.Y, v.Z)
+		}
+		fmt.Fprintf(out, "    endloop\n  endfacet\n")
+	}
+	fmt.Fprintf(out, "endsolid %s\n", name)
+
+	return out.Flush()
+}
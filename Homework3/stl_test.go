@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+const tetrahedronSTL = `solid tetrahedron
+  facet normal 0 0 -1
+    outer loop
+      vertex 0 0 0
+      vertex 0 1 0
+      vertex 1 0 0
+    endloop
+  endfacet
+  facet normal 0 -1 0
+    outer loop
+      vertex 0 0 0
+      vertex 1 0 0
+      vertex 0 0 1
+    endloop
+  endfacet
+  facet normal -1 0 0
+    outer loop
+      vertex 0 0 0
+      vertex 0 0 1
+      vertex 0 1 0
+    endloop
+  endfacet
+  facet normal 1 1 1
+    outer loop
+      vertex 1 0 0
+      vertex 0 1 0
+      vertex 0 0 1
+    endloop
+  endfacet
+endsolid tetrahedron
+`
+
+func sameTriangles(t *testing.T, expected, actual []Triangle, tolerance float64) {
+	if len(expected) != len(actual) {
+		t.Fatalf("Expected %d triangles, got %d", len(expected), len(actual))
+	}
+
+	close := func(a, b geom.Vector) bool {
+		return math.Abs(a.X-b.X) <= tolerance && math.Abs(a.Y-b.Y) <= tolerance && math.Abs(a.Z-b.Z) <= tolerance
+	}
+	for i := range expected {
+		e, a := expected[i], actual[i]
+		if !close(e.a, a.a) || !close(e.b, a.b) || !close(e.c, a.c) {
+			t.Errorf("Expected triangle %d to be %#v, got %#v", i, e, a)
+		}
+	}
+}
+
+func TestReadASCIISTL(t *testing.T) {
+	var prim geom.Intersectable
+
+	mesh, err := ReadSTL(strings.NewReader(tetrahedronSTL))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	prim = mesh
+
+	if len(mesh.Vertices) != 4 || len(mesh.Faces) != 4 {
+		t.Errorf("Expected the shared vertices to be merged into 4, got %d vertices and %d faces", len(mesh.Vertices), len(mesh.Faces))
+	}
+	if err := mesh.Validate(); err != nil {
+		t.Errorf("Expected a valid mesh, got %v", err)
+	}
+
+	ray := geom.NewRay(geom.NewVector(0.2, 0.2, -1), geom.NewVector(0, 0, 1))
+	if !prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect the tetrahedron but it did not.", ray)
+	}
+}
+
+func TestSTLRoundTrip(t *testing.T) {
+	mesh, err := ReadSTL(strings.NewReader(tetrahedronSTL))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var ascii, bin bytes.Buffer
+	if err := WriteASCIISTL(&ascii, mesh, "copy"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := WriteBinarySTL(&bin, mesh); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if size := bin.Len(); size != 84+4*50 {
+		t.Errorf("Expected a binary file of %d bytes, got %d", 84+4*50, size)
+	}
+
+	fromASCII, err := ReadSTL(&ascii)
+	if err != nil {
+		t.Fatalf("Unexpected error reading the ASCII copy: %v", err)
+	}
+	sameTriangles(t, mesh.Triangles(), fromASCII.Triangles(), 0)
+
+	fromBinary, err := ReadSTL(&bin)
+	if err != nil {
+		t.Fatalf("Unexpected error reading the binary copy: %v", err)
+	}
+	sameTriangles(t, mesh.Triangles(), fromBinary.Triangles(), 1e-6)
+}
+
+func TestReadBinarySTLStartingWithSolid(t *testing.T) {
+	data := make([]byte, 84+50)
+	copy(data, "solid but actually binary")
+	binary.LittleEndian.PutUint32(data[80:], 1)
+	for i, x := range []float32{0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0} {
+		binary.LittleEndian.PutUint32(data[84+4*i:], math.Float32bits(x))
+	}
+
+	mesh, err := ReadSTL(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Triangle{NewTriangle(geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0), geom.NewVector(0, 1, 0))}
+	sameTriangles(t, expected, mesh.Triangles(), 0)
+}
+
+func TestSTLQuadMeshIsTriangulated(t *testing.T) {
+	// A square and a concave quad, which is split along the other diagonal
+	mesh, err := NewMesh([]geom.Vector{
+		geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0), geom.NewVector(1, 1, 0), geom.NewVector(0, 1, 0),
+		geom.NewVector(0, 0, 1), geom.NewVector(2, 0, 1), geom.NewVector(0.5, 0.5, 1), geom.NewVector(0, 2, 1),
+	}, []Face{{Vertices: []int{0, 1, 2, 3}}, {Vertices: []int{4, 5, 6, 7}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	writers := map[string]func(io.Writer) error{
+		"binary": func(w io.Writer) error { return WriteBinarySTL(w, mesh) },
+		"ASCII":  func(w io.Writer) error { return WriteASCIISTL(w, mesh, "quads") },
+	}
+	for name, write := range writers {
+		var buffer bytes.Buffer
+		if err := write(&buffer); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		copied, err := ReadSTL(&buffer)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(copied.Faces) != 4 {
+			t.Errorf("Expected the %s quads to be written as 4 triangles, got %d", name, len(copied.Faces))
+		}
+		for i, triangle := range copied.Triangles() {
+			if normal := triangle.normal(); !vectorsAlmostEqual(normal, geom.NewVector(0, 0, 1)) {
+				t.Errorf("Expected %s facet %d to face along the quads, got %#v", name, i, normal)
+			}
+		}
+	}
+}
+
+func TestReadSTLErrors(t *testing.T) {
+	cases := []struct {
+		source string
+		line   int
+	}{
+		{"solid x\n  facet normal 0 0 1\n    vertex 0 0 0\n", 3},
+		{"solid x\n  facet normal 0 0 1\n    outer loop\n      vertex 0 0 zero\n", 4},
+		{"solid x\n  facet normal 0 0 1\n    outer loop\n      vertex 0 0 0\n    endloop\n", 5},
+		{"solid x\n  facet normal 0 0 1\n    outer loop\n", 3},
+	}
+
+	for _, tc := range cases {
+		_, err := ReadSTL(strings.NewReader(tc.source))
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("Expected a parse error for %q, got %v", tc.source, err)
+			continue
+		}
+		if parseErr.Line != tc.line {
+			t.Errorf("Expected the error for %q to be on line %d, got %v", tc.source, tc.line, parseErr)
+		}
+	}
+
+	if _, err := ReadSTL(bytes.NewReader(make([]byte, 90))); err == nil {
+		t.Errorf("Expected an error for a truncated binary file")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"image"
+	"runtime"
+	"sync"
+)
+
+const defaultTileSize = 32
+
+// RenderOptions configure a parallel render.
+type RenderOptions struct {
+	Width, Height int
+
+	// TileSize is the side of the square tiles the image is split into.
+	// It defaults to 32 pixels.
+	TileSize int
+
+	// Workers is the number of goroutines rendering tiles. It defaults to
+	// the number of CPUs.
+	Workers int
+
+	// Progress, if set, is called after every finished tile. Calls are never
+	// concurrent, so it does not need to synchronize.
+	Progress func(TileProgress)
+}
+
+// TileProgress reports a finished tile.
+type TileProgress struct {
+	Tile  image.Rectangle
+	Done  int
+	Total int
+}
+
+// splitTiles cuts bounds into tiles in row-major order. Tiles at the right
+// and bottom edges may be smaller.
+func splitTiles(bounds image.Rectangle, size int) []image.Rectangle {
+	tiles := make([]image.Rectangle, 0, (bounds.Dx()/size+1)*(bounds.Dy()/size+1))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += size {
+		for x := bounds.Min.X; x < bounds.Max.X; x += size {
+			tiles = append(tiles, image.Rect(x, y, x+size, y+size).Intersect(bounds))
+		}
+	}
+	return tiles
+}
+
+// RenderParallel renders the scene by distributing tiles over a pool of
+// workers. Every pixel is computed independently, so the image does not
+// depend on the number of workers or on the order the tiles finish in. If
+// ctx is cancelled before all tiles are done its error is returned.
+func (scene *Scene) RenderParallel(ctx context.Context, options RenderOptions) (*image.RGBA, error) {
+	return renderTiles(ctx, options, scene.prepared().shadePixel)
+}
+
+// renderTiles renders an image with the shader as RenderParallel describes.
+func renderTiles(ctx context.Context, options RenderOptions, shader pixelShader) (*image.RGBA, error) {
+	if options.Width <= 0 || options.Height <= 0 {
+		return nil, errors.New("image size must be positive")
+	}
+
+	tileSize := options.TileSize
+	if tileSize <= 0 {
+		tileSize = defaultTileSize
+	}
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, options.Width, options.Height))
+	tiles := splitTiles(img.Bounds(), tileSize)
+
+	jobs := make(chan image.Rectangle)
+	finished := make(chan image.Rectangle)
+
+	go func() {
+		defer close(jobs)
+		for _, tile := range tiles {
+			select {
+			case jobs <- tile:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for tile := range jobs {
+				if renderTile(ctx, img, tile, shader) {
+					finished <- tile
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	done := 0
+	for tile := range finished {
+		done++
+		if options.Progress != nil {
+			options.Progress(TileProgress{Tile: tile, Done: done, Total: len(tiles)})
+		}
+	}
+
+	if done < len(tiles) {
+		return nil, ctx.Err()
+	}
+
+	return img, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"testing"
+)
+
+func TestSplitTiles(t *testing.T) {
+	tiles := splitTiles(image.Rect(0, 0, 10, 5), 4)
+
+	if len(tiles) != 6 {
+		t.Fatalf("Expected 6 tiles, got %d", len(tiles))
+	}
+
+	area := 0
+	for _, tile := range tiles {
+		area += tile.Dx() * tile.Dy()
+	}
+	if area != 50 {
+		t.Errorf("Expected the tiles to cover 50 pixels, got %d", area)
+	}
+	if last := tiles[len(tiles)-1]; last != image.Rect(8, 4, 10, 5) {
+		t.Errorf("Expected the last tile to be clipped to the image, got %v", last)
+	}
+}
+
+func TestRenderParallelIsDeterministic(t *testing.T) {
+	scene := testScene()
+	expected := scene.Render(45, 30)
+
+	for _, workers := range []int{1, 3, 8} {
+		img, err := scene.RenderParallel(context.Background(), RenderOptions{
+			Width:    45,
+			Height:   30,
+			TileSize: 7,
+			Workers:  workers,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if !bytes.Equal(img.Pix, expected.Pix) {
+			t.Errorf("Expected the image rendered by %d workers to match the serial one", workers)
+		}
+	}
+}
+
+func TestRenderParallelProgress(t *testing.T) {
+	scene := testScene()
+
+	var reports []TileProgress
+	_, err := scene.RenderParallel(context.Background(), RenderOptions{
+		Width:    40,
+		Height:   20,
+		TileSize: 10,
+		Workers:  4,
+		Progress: func(progress TileProgress) {
+			reports = append(reports, progress)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(reports) != 8 {
+		t.Fatalf("Expected a report for each of the 8 tiles, got %d", len(reports))
+	}
+
+	seen := make(map[image.Rectangle]bool)
+	for i, report := range reports {
+		if report.Done != i+1 || report.Total != 8 {
+			t.Errorf("Expected report %d to be %d of 8, got %d of %d", i, i+1, report.Done, report.Total)
+		}
+		seen[report.Tile] = true
+	}
+	if len(seen) != 8 {
+		t.Errorf("Expected every tile to be reported once, got %d distinct tiles", len(seen))
+	}
+}
+
+func TestRenderParallelCancel(t *testing.T) {
+	scene := testScene()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := scene.RenderParallel(ctx, RenderOptions{Width: 64, Height: 64}); err != context.Canceled {
+		t.Errorf("Expected a cancelled render to fail with %v, got %v", context.Canceled, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	reports := 0
+	_, err := scene.RenderParallel(ctx, RenderOptions{
+		Width:    64,
+		Height:   64,
+		TileSize: 8,
+		Workers:  2,
+		Progress: func(TileProgress) {
+			reports++
+			cancel()
+		},
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected a render cancelled midway to fail with %v, got %v", context.Canceled, err)
+	}
+	if reports >= 64 {
+		t.Errorf("Expected the render to stop before finishing all 64 tiles")
+	}
+}
+
+func TestRenderParallelInvalidSize(t *testing.T) {
+	scene := testScene()
+
+	if _, err := scene.RenderParallel(context.Background(), RenderOptions{Width: 0, Height: 10}); err == nil {
+		t.Errorf("Expected an error for an empty image")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+// Torus is the surface swept by a circle of radius minor whose center goes
+// around a circle of radius major.
+type Torus struct {
+	frame        frame
+	major, minor float64
+}
+
+// NewTorus returns the torus around center in the plane perpendicular to
+// axis.
+func NewTorus(center, axis geom.Vector, major, minor float64) Torus {
+	return Torus{
+		frame: newFrame(center, axis),
+		major: math.Abs(major),
+		minor: math.Abs(minor),
+	}
+}
+
+func (torus Torus) Intersect(ray geom.Ray) bool {
+	return torus.IntersectSegment(ray, epsilon, math.Inf(1))
+}
+
+// ClosestHit returns the hit with the torus. U is the angle of the hit
+// around the axis and V the angle around the tube, both mapped to [0, 1).
+func (torus Torus) ClosestHit(ray geom.Ray) (Hit, bool) {
+	return torus.ClosestHitSegment(ray, epsilon, math.Inf(1))
+}
+
+func (torus Torus) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	found := torus.candidates(torus.frame.localRay(ray))
+	_, ok := found.nearest(tMin, tMax)
+	return ok
+}
+
+func (torus Torus) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	local := torus.frame.localRay(ray)
+	found := torus.candidates(local)
+	nearest, ok := found.nearest(tMin, tMax)
+	if !ok {
+		return Hit{}, false
+	}
+	return torus.hitAt(ray, local, nearest), true
+}
+
+// hitAt returns the hit for a crossing found in the frame of the torus.
+func (torus Torus) hitAt(ray, local geom.Ray, c candidate) Hit {
+	// The gradient of (|p|^2 + R^2 - r^2)^2 - 4*R^2*(x^2 + y^2)
+	p := pointAt(local, c.t)
+	r2, s := torus.major*torus.major, geom.Dot(p, p)+torus.major*torus.major-torus.minor*torus.minor
+	normal := geom.NewVector(p.X*(s-2*r2), p.Y*(s-2*r2), p.Z*s)
+
+	return Hit{
+		T:         c.t,
+		Point:     pointAt(ray, c.t),
+		Normal:    normalize(torus.frame.worldVector(normal)),
+		U:         angle(p.X, p.Y),
+		V:         angle(math.Hypot(p.X, p.Y)-torus.major, p.Z),
+		Primitive: torus,
+	}
+}
+
+// candidates finds the crossings of a ray, given in the frame of the torus,
+// with the torus.
+func (torus Torus) candidates(local geom.Ray) candidates {
+	var found candidates
+
+	// The quartic is solved for a unit direction starting near the torus,
+	// where its coefficients are best conditioned
+	speed := length(local.Direction)
+	if speed == 0 {
+		return found
+	}
+	d := geom.NewVector(local.Direction.X/speed, local.Direction.Y/speed, local.Direction.Z/speed)
+
+	bounding := NewSphere(geom.Vector{}, torus.major+torus.minor)
+	crossing, ok := bounding.Crossing(geom.NewRay(local.Origin, d))
+	if !ok {
+		return found
+	}
+	start := crossing.Entry
+	o := pointAt(geom.NewRay(local.Origin, d), start)
+
+	r2 := torus.major * torus.major
+	e := geom.Dot(o, o) + r2 - torus.minor*torus.minor
+	f := geom.Dot(o, d)
+	coefficients := [5]float64{
+		e*e - 4*r2*(o.X*o.X+o.Y*o.Y),
+		4*e*f - 8*r2*(o.X*d.X+o.Y*d.Y),
+		4*f*f + 2*e - 4*r2*(d.X*d.X+d.Y*d.Y),
+		4 * f,
+		1,
+	}
+
+	for _, t := range quarticRoots(coefficients) {
+		found.add((start+t)/speed, 0)
+	}
+	return found
+}
+
+func (torus Torus) Bounds() AABB {
+	w := torus.frame.w
+	extent := func(x float64) float64 {
+		return torus.major*math.Sqrt(math.Max(0, 1-x*x)) + torus.minor
+	}
+	offset := geom.NewVector(extent(w.X), extent(w.Y), extent(w.Z))
+	return AABB{Min: geom.Sub(torus.frame.origin, offset), Max: geom.Add(torus.frame.origin, offset)}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSampleSimpleTorusShouldIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	prim = NewTorus(geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0), 2, 0.5)
+	ray := geom.NewRay(geom.NewVector(-5, 0, 0), geom.NewVector(1, 0, 0))
+
+	if !prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to intersect torus %#v but it did not.", ray, prim)
+	}
+}
+
+func TestSampleRayThroughTorusHoleShouldNotIntersect(t *testing.T) {
+	var prim geom.Intersectable
+
+	prim = NewTorus(geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0), 2, 0.5)
+	ray := geom.NewRay(geom.NewVector(0, 5, 0), geom.NewVector(0, -1, 0))
+
+	if prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to not intersect torus %#v but it did.", ray, prim)
+	}
+}
+
+func TestTorusClosestHit(t *testing.T) {
+	prim := NewTorus(geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0), 2, 0.5)
+
+	cases := []struct {
+		ray    geom.Ray
+		t      float64
+		normal geom.Vector
+	}{
+		{geom.NewRay(geom.NewVector(-5, 0, 0), geom.NewVector(1, 0, 0)), 2.5, geom.NewVector(-1, 0, 0)},
+		{geom.NewRay(geom.NewVector(0, 0, 0), geom.NewVector(0, 0, 2)), 0.75, geom.NewVector(0, 0, -1)},
+		{geom.NewRay(geom.NewVector(2, 5, 0), geom.NewVector(0, -1, 0)), 4.5, geom.NewVector(0, 1, 0)},
+		{geom.NewRay(geom.NewVector(-2, 0, 0), geom.NewVector(1, 0, 0)), 0.5, geom.NewVector(1, 0, 0)},
+	}
+
+	for _, c := range cases {
+		hit, ok := prim.ClosestHit(c.ray)
+		if !ok {
+			t.Errorf("Expected ray %#v to hit torus %#v but it did not.", c.ray, prim)
+			continue
+		}
+		if !almostEqual(hit.T, c.t) || !vectorsAlmostEqual(hit.Normal, c.normal) {
+			t.Errorf("Expected a hit at %v with normal %#v, got %#v", c.t, c.normal, hit)
+		}
+	}
+}
+
+func TestTorusHitsLieOnSurface(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	prim := NewTorus(geom.NewVector(1, 2, 3), geom.NewVector(1, 1, 0), 2, 0.7)
+	hits := 0
+
+	for i := 0; i < 1000; i++ {
+		ray := geom.NewRay(geom.Add(geom.NewVector(1, 2, 3), randomVector(rng, 6)), randomVector(rng, 1))
+		hit, ok := prim.ClosestHit(ray)
+		if !ok {
+			continue
+		}
+		hits++
+
+		// The distance from the tube circle has to be the minor radius
+		local := prim.frame.localVector(geom.Sub(hit.Point, prim.frame.origin))
+		distance := math.Hypot(math.Hypot(local.X, local.Y)-2, local.Z)
+		if math.Abs(distance-0.7) > 1e-6 {
+			t.Errorf("Expected hit %#v to be on the torus, it is %v off", hit.Point, distance-0.7)
+		}
+	}
+
+	if hits == 0 {
+		t.Errorf("Expected some random rays to hit the torus")
+	}
+}
+
+func TestTorusHitsAtAnyScale(t *testing.T) {
+	// Tori a thousand times smaller and ten thousand times larger than a
+	// unit one are hit by the scaled rays at the scaled distances
+	unit := NewTorus(geom.NewVector(1, 2, 3), geom.NewVector(1, 1, 0), 2, 0.7)
+	for _, size := range []float64{1e-3, 1e4} {
+		rng := rand.New(rand.NewSource(3))
+		prim := NewTorus(scale(geom.NewVector(1, 2, 3), size), geom.NewVector(1, 1, 0), 2*size, 0.7*size)
+		hits := 0
+
+		for i := 0; i < 1000; i++ {
+			origin, direction := geom.Add(geom.NewVector(1, 2, 3), randomVector(rng, 6)), randomVector(rng, 1)
+			want, wantOK := unit.ClosestHit(geom.NewRay(origin, direction))
+			hit, ok := prim.ClosestHit(geom.NewRay(scale(origin, size), direction))
+			if ok != wantOK {
+				t.Errorf("Expected the ray %v to hit the torus of size %v: %v, got %v", i, size, wantOK, ok)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			hits++
+
+			if math.Abs(hit.T/size-want.T) > 1e-6 || !vectorsAlmostEqual(hit.Normal, want.Normal) {
+				t.Errorf("Expected the ray %v to hit the torus of size %v at %v, got %v", i, size, want.T*size, hit.T)
+			}
+		}
+
+		if hits == 0 {
+			t.Errorf("Expected some random rays to hit the torus of size %v", size)
+		}
+	}
+}
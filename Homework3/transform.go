@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+// Matrix is a 4x4 matrix of an affine transform acting on column vectors.
+// The last row is always 0, 0, 0, 1 for the transforms built here.
+type Matrix [4][4]float64
+
+func Identity() Matrix {
+	return Matrix{
+		{1, 0, 0, 0},
+		{0, 1, 0, 0},
+		{0, 0, 1, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+func Translate(offset geom.Vector) Matrix {
+	m := Identity()
+	m[0][3], m[1][3], m[2][3] = offset.X, offset.Y, offset.Z
+	return m
+}
+
+func Scale(x, y, z float64) Matrix {
+	m := Identity()
+	m[0][0], m[1][1], m[2][2] = x, y, z
+	return m
+}
+
+// Rotate returns a rotation by angle radians around axis, counterclockwise
+// when looking from the tip of the axis towards the origin.
+func Rotate(axis geom.Vector, angle float64) Matrix {
+	a := normalize(axis)
+	sin, cos := math.Sincos(angle)
+	k := 1 - cos
+
+	return Matrix{
+		{cos + a.X*a.X*k, a.X*a.Y*k - a.Z*sin, a.X*a.Z*k + a.Y*sin, 0},
+		{a.Y*a.X*k + a.Z*sin, cos + a.Y*a.Y*k, a.Y*a.Z*k - a.X*sin, 0},
+		{a.Z*a.X*k - a.Y*sin, a.Z*a.Y*k + a.X*sin, cos + a.Z*a.Z*k, 0},
+		{0, 0, 0, 1},
+	}
+}
+
+func RotateX(angle float64) Matrix {
+	return Rotate(geom.NewVector(1, 0, 0), angle)
+}
+
+func RotateY(angle float64) Matrix {
+	return Rotate(geom.NewVector(0, 1, 0), angle)
+}
+
+func RotateZ(angle float64) Matrix {
+	return Rotate(geom.NewVector(0, 0, 1), angle)
+}
+
+// Mul returns the product m * other, which applies other first and m second.
+func (m Matrix) Mul(other Matrix) Matrix {
+	var result Matrix
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			for k := 0; k < 4; k++ {
+				result[i][j] += m[i][k] * other[k][j]
+			}
+		}
+	}
+	return result
+}
+
+// Compose returns the transform which applies the given ones in order, so
+// Compose(Scale(2, 2, 2), Translate(v)) scales first and translates second.
+func Compose(transforms ...Matrix) Matrix {
+	result := Identity()
+	for _, transform := range transforms {
+		result = transform.Mul(result)
+	}
+	return result
+}
+
+func (m Matrix) Transpose() Matrix {
+	var result Matrix
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			result[i][j] = m[j][i]
+		}
+	}
+	return result
+}
+
+// Inverse returns the inverse of the matrix by Gauss-Jordan elimination with
+// partial pivoting. It fails for singular matrices.
+func (m Matrix) Inverse() (Matrix, error) {
+	a, inverse := m, Identity()
+
+	for column := 0; column < 4; column++ {
+		pivot := column
+		for row := column + 1; row < 4; row++ {
+			if math.Abs(a[row][column]) > math.Abs(a[pivot][column]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][column]) < 1e-12 {
+			return Matrix{}, errors.New("matrix is singular")
+		}
+		a[column], a[pivot] = a[pivot], a[column]
+		inverse[column], inverse[pivot] = inverse[pivot], inverse[column]
+
+		scale := 1 / a[column][column]
+		for j := 0; j < 4; j++ {
+			a[column][j] *= scale
+			inverse[column][j] *= scale
+		}
+
+		for row := 0; row < 4; row++ {
+			if row == column || a[row][column] == 0 {
+				continue
+			}
+			factor := a[row][column]
+			for j := 0; j < 4; j++ {
+				a[row][j] -= factor * a[column][j]
+				inverse[row][j] -= factor * inverse[column][j]
+			}
+		}
+	}
+
+	return inverse, nil
+}
+
+// Point transforms a position, which is affected by translation.
+func (m Matrix) Point(p geom.Vector) geom.Vector {
+	return geom.NewVector(
+		m[0][0]*p.X+m[0][1]*p.Y+m[0][2]*p.Z+m[0][3],
+		m[1][0]*p.X+m[1][1]*p.Y+m[1][2]*p.Z+m[1][3],
+		m[2][0]*p.X+m[2][1]*p.Y+m[2][2]*p.Z+m[2][3],
+	)
+}
+
+// Vector transforms a direction, which is not affected by translation.
+func (m Matrix) Vector(v geom.Vector) geom.Vector {
+	return geom.NewVector(
+		m[0][0]*v.X+m[0][1]*v.Y+m[0][2]*v.Z,
+		m[1][0]*v.X+m[1][1]*v.Y+m[1][2]*v.Z,
+		m[2][0]*v.X+m[2][1]*v.Y+m[2][2]*v.Z,
+	)
+}
+
+// Instance places a primitive in the world through an affine transform, so
+// that one primitive or mesh can be shared by many instances. Rays are
+// brought into the space of the primitive instead of moving the primitive.
+type Instance struct {
+	primitive Primitive
+	toWorld   Matrix
+	toObject  Matrix
+	bounds    AABB
+}
+
+// NewInstance returns the primitive transformed by the matrix. The matrix
+// must be invertible.
+func NewInstance(primitive Primitive, transform Matrix) (*Instance, error) {
+	inverse, err := transform.Inverse()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Instance{
+		primitive: primitive,
+		toWorld:   transform,
+		toObject:  inverse,
+		bounds:    transform.box(primitive.Bounds()),
+	}, nil
+}
+
+// box returns the box around the transformed box. Each coordinate adds up
+// the extremes of the terms of its row, skipping zero entries, so that the
+// infinite sides of unbounded primitives stay infinite instead of becoming
+// NaN.
+func (m Matrix) box(box AABB) AABB {
+	if box.Empty() {
+		return box
+	}
+
+	var lo, hi [3]float64
+	for i := 0; i < 3; i++ {
+		lo[i], hi[i] = m[i][3], m[i][3]
+		for j := 0; j < 3; j++ {
+			if m[i][j] == 0 {
+				continue
+			}
+			a, b := m[i][j]*component(box.Min, j), m[i][j]*component(box.Max, j)
+			lo[i] += math.Min(a, b)
+			hi[i] += math.Max(a, b)
+		}
+	}
+	return AABB{Min: geom.NewVector(lo[0], lo[1], lo[2]), Max: geom.NewVector(hi[0], hi[1], hi[2])}
+}
+
+// objectRay returns the ray in the space of the primitive. The direction is
+// not normalized, so ray parameters are the same in both spaces.
+func (instance *Instance) objectRay(ray geom.Ray) geom.Ray {
+	return geom.NewRay(instance.toObject.Point(ray.Origin), instance.toObject.Vector(ray.Direction))
+}
+
+func (instance *Instance) Intersect(ray geom.Ray) bool {
+	return instance.primitive.Intersect(instance.objectRay(ray))
+}
+
+// ClosestHit returns the hit in world space. The primitive of the hit is the
+// instance itself, since the transformed primitive may be shared.
+func (instance *Instance) ClosestHit(ray geom.Ray) (Hit, bool) {
+	hit, ok := instance.primitive.ClosestHit(instance.objectRay(ray))
+	return instance.worldHit(ray, hit, ok)
+}
+
+func (instance *Instance) IntersectSegment(ray geom.Ray, tMin, tMax float64) bool {
+	return instance.primitive.IntersectSegment(instance.objectRay(ray), tMin, tMax)
+}
+
+func (instance *Instance) ClosestHitSegment(ray geom.Ray, tMin, tMax float64) (Hit, bool) {
+	hit, ok := instance.primitive.ClosestHitSegment(instance.objectRay(ray), tMin, tMax)
+	return instance.worldHit(ray, hit, ok)
+}
+
+// worldHit brings a hit found in the space of the primitive back to the world.
+func (instance *Instance) worldHit(ray geom.Ray, hit Hit, ok bool) (Hit, bool) {
+	if !ok {
+		return Hit{}, false
+	}
+
+	// Normals are transformed by the inverse transpose to stay perpendicular
+	hit.Point = pointAt(ray, hit.T)
+	hit.Normal = normalize(instance.toObject.Transpose().Vector(hit.Normal))
+	hit.Primitive = instance
+
+	return hit, true
+}
+
+func (instance *Instance) Bounds() AABB {
+	return instance.bounds
+}
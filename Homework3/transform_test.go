@@ -0,0 +1,221 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/fmi/go-homework/geom"
+)
+
+func matricesAlmostEqual(a, b Matrix) bool {
+	for i := range a {
+		for j := range a[i] {
+			if !almostEqual(a[i][j], b[i][j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestMatrixTransforms(t *testing.T) {
+	p := geom.NewVector(1, 2, 3)
+
+	if q := Translate(geom.NewVector(1, -1, 0)).Point(p); !vectorsAlmostEqual(q, geom.NewVector(2, 1, 3)) {
+		t.Errorf("Expected the translated point to be (2, 1, 3), got %#v", q)
+	}
+	if v := Translate(geom.NewVector(1, -1, 0)).Vector(p); !vectorsAlmostEqual(v, p) {
+		t.Errorf("Expected directions to ignore translation, got %#v", v)
+	}
+	if q := Scale(2, 3, 4).Point(p); !vectorsAlmostEqual(q, geom.NewVector(2, 6, 12)) {
+		t.Errorf("Expected the scaled point to be (2, 6, 12), got %#v", q)
+	}
+	if q := RotateZ(math.Pi / 2).Point(geom.NewVector(1, 0, 0)); !vectorsAlmostEqual(q, geom.NewVector(0, 1, 0)) {
+		t.Errorf("Expected a quarter turn around Z to map X to Y, got %#v", q)
+	}
+	if q := RotateX(math.Pi / 2).Point(geom.NewVector(0, 1, 0)); !vectorsAlmostEqual(q, geom.NewVector(0, 0, 1)) {
+		t.Errorf("Expected a quarter turn around X to map Y to Z, got %#v", q)
+	}
+	if q := RotateY(math.Pi / 2).Point(geom.NewVector(0, 0, 1)); !vectorsAlmostEqual(q, geom.NewVector(1, 0, 0)) {
+		t.Errorf("Expected a quarter turn around Y to map Z to X, got %#v", q)
+	}
+
+	// Compose applies the transforms in the given order
+	m := Compose(Scale(2, 2, 2), Translate(geom.NewVector(1, 0, 0)))
+	if q := m.Point(geom.NewVector(1, 0, 0)); !vectorsAlmostEqual(q, geom.NewVector(3, 0, 0)) {
+		t.Errorf("Expected scaling and then translating (1, 0, 0) to give (3, 0, 0), got %#v", q)
+	}
+}
+
+func TestMatrixInverse(t *testing.T) {
+	m := Compose(
+		Scale(2, 0.5, 3),
+		Rotate(geom.NewVector(1, 2, 3), 0.7),
+		Translate(geom.NewVector(4, -5, 6)),
+	)
+
+	inverse, err := m.Inverse()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if product := m.Mul(inverse); !matricesAlmostEqual(product, Identity()) {
+		t.Errorf("Expected m * m^-1 to be the identity, got %v", product)
+	}
+	if product := inverse.Mul(m); !matricesAlmostEqual(product, Identity()) {
+		t.Errorf("Expected m^-1 * m to be the identity, got %v", product)
+	}
+
+	if _, err := Scale(1, 0, 1).Inverse(); err == nil {
+		t.Errorf("Expected an error inverting a singular matrix")
+	}
+}
+
+func TestInstanceTranslatedTriangle(t *testing.T) {
+	var prim geom.Intersectable
+
+	a, b, c := geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0), geom.NewVector(0, 1, 0)
+	instance, err := NewInstance(NewTriangle(a, b, c), Translate(geom.NewVector(10, 0, 0)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	prim = instance
+
+	if ray := geom.NewRay(geom.NewVector(0, 0, -1), geom.NewVector(0, 0, 1)); prim.Intersect(ray) {
+		t.Errorf("Expected ray %#v to miss the moved triangle", ray)
+	}
+
+	ray := geom.NewRay(geom.NewVector(10, 0, -1), geom.NewVector(0, 0, 1))
+	hit, ok := instance.ClosestHit(ray)
+	if !ok {
+		t.Fatalf("Expected ray %#v to hit the moved triangle", ray)
+	}
+	if !vectorsAlmostEqual(hit.Point, geom.NewVector(10, 0, 0)) || !almostEqual(hit.T, 1) {
+		t.Errorf("Expected a hit at (10, 0, 0) at distance 1, got %#v at %v", hit.Point, hit.T)
+	}
+	if hit.Primitive != geom.Intersectable(instance) {
+		t.Errorf("Expected the hit primitive to be the instance, got %#v", hit.Primitive)
+	}
+}
+
+func TestInstanceEllipsoid(t *testing.T) {
+	ellipsoid, err := NewInstance(NewSphere(geom.NewVector(0, 0, 0), 1), Scale(3, 1, 1))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ray := geom.NewRay(geom.NewVector(-5, 0, 0), geom.NewVector(1, 0, 0))
+	hit, ok := ellipsoid.ClosestHit(ray)
+	if !ok || !almostEqual(hit.T, 2) {
+		t.Errorf("Expected ray %#v to hit the ellipsoid at 2, got %v at %v", ray, ok, hit.T)
+	}
+
+	// Off the axes the normal of x²/9 + y² = 1 is (x/9, y, 0)
+	x := 3 * math.Cos(math.Pi/4)
+	y := math.Sin(math.Pi / 4)
+	ray = geom.NewRay(geom.NewVector(x, 5, 0), geom.NewVector(0, -1, 0))
+	hit, ok = ellipsoid.ClosestHit(ray)
+	if !ok {
+		t.Fatalf("Expected ray %#v to hit the ellipsoid", ray)
+	}
+	if !vectorsAlmostEqual(hit.Point, geom.NewVector(x, y, 0)) {
+		t.Errorf("Expected a hit at (%v, %v, 0), got %#v", x, y, hit.Point)
+	}
+	if expected := normalize(geom.NewVector(x/9, y, 0)); !vectorsAlmostEqual(hit.Normal, expected) {
+		t.Errorf("Expected normal %#v, got %#v", expected, hit.Normal)
+	}
+
+	if bounds := ellipsoid.Bounds(); !vectorsAlmostEqual(bounds.Min, geom.NewVector(-3, -1, -1)) || !vectorsAlmostEqual(bounds.Max, geom.NewVector(3, 1, 1)) {
+		t.Errorf("Expected bounds from (-3, -1, -1) to (3, 1, 1), got %#v", bounds)
+	}
+}
+
+func TestInstancedMesh(t *testing.T) {
+	mesh, err := NewMesh([]geom.Vector{
+		geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0), geom.NewVector(1, 1, 0), geom.NewVector(0, 1, 0),
+	}, []Face{{Vertices: []int{0, 1, 2, 3}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var primitives []Primitive
+	for i := 0; i < 5; i++ {
+		instance, err := NewInstance(mesh, Compose(RotateX(math.Pi/2), Translate(geom.NewVector(float64(2*i), 0, 0))))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		primitives = append(primitives, instance)
+	}
+	scene := NewBVH(primitives)
+
+	for i := 0; i < 5; i++ {
+		ray := geom.NewRay(geom.NewVector(float64(2*i)+0.5, -3, 0.5), geom.NewVector(0, 1, 0))
+		hit, ok := scene.ClosestHit(ray)
+		if !ok || hit.Primitive != geom.Intersectable(primitives[i]) {
+			t.Errorf("Expected ray %#v to hit instance %d, got %v", ray, i, ok)
+		}
+	}
+
+	if ray := geom.NewRay(geom.NewVector(1.5, -3, 0.5), geom.NewVector(0, 1, 0)); scene.Intersect(ray) {
+		t.Errorf("Expected ray %#v to pass between the instances", ray)
+	}
+}
+
+func TestNewInstanceSingular(t *testing.T) {
+	if _, err := NewInstance(NewSphere(geom.NewVector(0, 0, 0), 1), Scale(1, 1, 0)); err == nil {
+		t.Errorf("Expected an error for a singular transform")
+	}
+}
+
+func TestInstanceUnboundedBounds(t *testing.T) {
+	plane := NewPlane(geom.NewVector(0, 0, 0), geom.NewVector(0, 1, 0))
+
+	raised, err := NewInstance(plane, Translate(geom.NewVector(0, 2, 0)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	bounds := raised.Bounds()
+	if !math.IsInf(bounds.Min.X, -1) || !math.IsInf(bounds.Max.Z, 1) || bounds.Min.Y != 2 || bounds.Max.Y != 2 {
+		t.Errorf("Expected the raised plane to be bounded only at y = 2, got %#v", bounds)
+	}
+
+	tilted, err := NewInstance(plane, Compose(RotateZ(0.3), Translate(geom.NewVector(1, 2, 3))))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	bounds = tilted.Bounds()
+	for _, v := range []float64{bounds.Min.X, bounds.Min.Y, bounds.Min.Z, bounds.Max.X, bounds.Max.Y, bounds.Max.Z} {
+		if math.IsNaN(v) {
+			t.Fatalf("Expected the bounds of the tilted plane to not be NaN, got %#v", bounds)
+		}
+	}
+
+	bvh := NewBVH([]Primitive{raised, NewSphere(geom.NewVector(0, 10, 0), 1)})
+	ray := geom.NewRay(geom.NewVector(5, 5, 5), geom.NewVector(0, -1, 0))
+	if hit, ok := bvh.ClosestHit(ray); !ok || !almostEqual(hit.T, 3) {
+		t.Errorf("Expected the raised plane in a BVH to be hit at 3, got %v at %v", ok, hit.T)
+	}
+}
+
+func TestInstanceSpans(t *testing.T) {
+	ellipsoid, err := NewInstance(NewSphere(geom.NewVector(0, 0, 0), 1), Scale(3, 1, 1))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The ellipsoid with a ball cut out of its middle
+	hollow := NewDifference(ellipsoid, NewSphere(geom.NewVector(0, 0, 0), 0.5))
+	ray := geom.NewRay(geom.NewVector(-5, 0, 0), geom.NewVector(1, 0, 0))
+	spans := hollow.Spans(ray)
+	if len(spans) != 2 || !almostEqual(spans[0].Enter.T, 2) || !almostEqual(spans[0].Exit.T, 4.5) ||
+		!almostEqual(spans[1].Enter.T, 5.5) || !almostEqual(spans[1].Exit.T, 8) {
+		t.Fatalf("Expected the hollow ellipsoid to span 2 to 4.5 and 5.5 to 8, got %#v", spans)
+	}
+	if !vectorsAlmostEqual(spans[0].Enter.Normal, geom.NewVector(-1, 0, 0)) || spans[0].Enter.Primitive != ellipsoid {
+		t.Errorf("Expected the ellipsoid to be entered facing the ray, got %#v", spans[0].Enter)
+	}
+
+	triangle, _ := NewInstance(NewTriangle(geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0), geom.NewVector(0, 1, 0)), Scale(2, 2, 2))
+	if spans := triangle.Spans(geom.NewRay(geom.NewVector(0.5, 0.5, 5), geom.NewVector(0, 0, -1))); spans != nil {
+		t.Errorf("Expected a transformed triangle to have no inside, got %#v", spans)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+func scale(v geom.Vector, s float64) geom.Vector {
+	return geom.Vector{X: v.X * s, Y: v.Y * s, Z: v.Z * s}
+}
+
+func length(v geom.Vector) float64 {
+	return math.Sqrt(geom.Dot(v, v))
+}
+
+// normalize returns v scaled to unit length. The zero vector is returned as is.
+func normalize(v geom.Vector) geom.Vector {
+	l := length(v)
+	if l == 0 {
+		return v
+	}
+	return scale(v, 1/l)
+}
+
+// pointAt returns the point Origin + t*Direction of the ray.
+func pointAt(ray geom.Ray, t float64) geom.Vector {
+	return geom.Add(ray.Origin, scale(ray.Direction, t))
+}
+
+// component returns the X, Y or Z coordinate of v for axis 0, 1 or 2.
+func component(v geom.Vector, axis int) float64 {
+	switch axis {
+	case 0:
+		return v.X
+	case 1:
+		return v.Y
+	default:
+		return v.Z
+	}
+}
+
+func minVector(a, b geom.Vector) geom.Vector {
+	return geom.Vector{X: math.Min(a.X, b.X), Y: math.Min(a.Y, b.Y), Z: math.Min(a.Z, b.Z)}
+}
+
+func maxVector(a, b geom.Vector) geom.Vector {
+	return geom.Vector{X: math.Max(a.X, b.X), Y: math.Max(a.Y, b.Y), Z: math.Max(a.Z, b.Z)}
+}
+
+// reciprocal returns the component-wise inverse of v, used for slab tests.
+func reciprocal(v geom.Vector) geom.Vector {
+	return geom.Vector{X: 1 / v.X, Y: 1 / v.Y, Z: 1 / v.Z}
+}
+
+// planeBasis returns two unit axes which form a right-handed basis together
+// with the unit normal.
+func planeBasis(normal geom.Vector) (geom.Vector, geom.Vector) {
+	u := geom.Cross(normal, geom.NewVector(1, 0, 0))
+	if length(u) < 0.5 {
+		u = geom.Cross(normal, geom.NewVector(0, 1, 0))
+	}
+	u = normalize(u)
+	return u, geom.Cross(normal, u)
+}
+
+// frame is an orthonormal basis placed at a point. Shapes are intersected in
+// the coordinates of their frame, in which their axis is Z.
+type frame struct {
+	origin  geom.Vector
+	u, v, w geom.Vector
+}
+
+func newFrame(origin, axis geom.Vector) frame {
+	w := normalize(axis)
+	u, v := planeBasis(w)
+	return frame{origin: origin, u: u, v: v, w: w}
+}
+
+// localVector returns a direction in the coordinates of the frame.
+func (f frame) localVector(d geom.Vector) geom.Vector {
+	return geom.NewVector(geom.Dot(d, f.u), geom.Dot(d, f.v), geom.Dot(d, f.w))
+}
+
+// localRay returns the ray in the coordinates of the frame. Since the frame
+// is orthonormal ray parameters are the same in both.
+func (f frame) localRay(ray geom.Ray) geom.Ray {
+	return geom.NewRay(f.localVector(geom.Sub(ray.Origin, f.origin)), f.localVector(ray.Direction))
+}
+
+// worldVector returns a direction given in the coordinates of the frame.
+func (f frame) worldVector(d geom.Vector) geom.Vector {
+	return geom.Add(geom.Add(scale(f.u, d.X), scale(f.v, d.Y)), scale(f.w, d.Z))
+}
+
+// angle returns the angle of (x, y) around the origin mapped to [0, 1).
+func angle(x, y float64) float64 {
+	a := math.Atan2(y, x) / (2 * math.Pi)
+	if a < 0 {
+		a++
+	}
+	return a
+}
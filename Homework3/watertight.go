@@ -0,0 +1,141 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+)
+
+// TriangleMode selects the algorithm used to intersect triangles.
+type TriangleMode int
+
+const (
+	// FastTriangles uses the Möller–Trumbore test. It is the fastest, but
+	// rays through an edge shared by two triangles may miss both of them.
+	FastTriangles TriangleMode = iota
+
+	// WatertightTriangles uses the test of Woop, Benthin and Wald, which
+	// computes the edges shared by two triangles in exactly the same way for
+	// both of them. A ray through a shared edge or vertex hits at least one
+	// of the triangles around it.
+	WatertightTriangles
+)
+
+// WithMode returns a copy of the triangle which is intersected in the given
+// mode.
+func (triangle Triangle) WithMode(mode TriangleMode) Triangle {
+	triangle.mode = mode
+	return triangle
+}
+
+// intersectWatertight implements "Watertight Ray/Triangle Intersection" by
+// Woop, Benthin and Wald. The vertices are moved into a space where the ray
+// starts at the origin and goes along the Z axis, and the hit is found with
+// edge functions in the XY plane. Values on an edge are accepted, so no ray
+// falls through the gap between two triangles.
+func (triangle Triangle) intersectWatertight(ray geom.Ray, tMin, tMax float64) (t, u, v float64, ok bool) {
+	direction := ray.Direction
+
+	// The axis along which the ray goes fastest becomes Z, the winding is
+	// kept by swapping the other two when that component is negative
+	kz := 0
+	for axis := 1; axis < 3; axis++ {
+		if math.Abs(component(direction, axis)) > math.Abs(component(direction, kz)) {
+			kz = axis
+		}
+	}
+	kx, ky := (kz+1)%3, (kz+2)%3
+	dz := component(direction, kz)
+	if dz < 0 {
+		kx, ky = ky, kx
+	}
+	if dz == 0 {
+		return 0, 0, 0, false
+	}
+
+	// Shear the vertices so the ray points straight along Z
+	sx, sy, sz := component(direction, kx)/dz, component(direction, ky)/dz, 1/dz
+	transform := func(vertex geom.Vector) (x, y, z float64) {
+		p := geom.Sub(vertex, ray.Origin)
+		pz := component(p, kz)
+		return component(p, kx) - sx*pz, component(p, ky) - sy*pz, sz * pz
+	}
+	ax, ay, az := transform(triangle.a)
+	bx, by, bz := transform(triangle.b)
+	cx, cy, cz := transform(triangle.c)
+
+	// Edge functions, each of them is the weight of the opposite vertex
+	e0 := cx*by - cy*bx
+	e1 := ax*cy - ay*cx
+	e2 := bx*ay - by*ax
+
+	if (e0 < 0 || e1 < 0 || e2 < 0) && (e0 > 0 || e1 > 0 || e2 > 0) {
+		return 0, 0, 0, false
+	}
+
+	det := e0 + e1 + e2
+	if det == 0 {
+		return 0, 0, 0, false // The ray is parallel to the triangle plane
+	}
+
+	t = (e0*az + e1*bz + e2*cz) / det
+	if t < tMin || t > tMax {
+		return 0, 0, 0, false
+	}
+
+	return t, e1 / det, e2 / det, true
+}
+
+// WithTriangleMode returns a copy of the primitive whose triangles are
+// intersected in the given mode. Triangles, planar quads, polygons, meshes,
+// accelerators, instances and CSG shapes are copied, other primitives are
+// returned as they are. Quads which are not planar are intersected as bilinear patches
+// in either mode.
+func WithTriangleMode(primitive Primitive, mode TriangleMode) Primitive {
+	switch primitive := primitive.(type) {
+	case Triangle:
+		return primitive.WithMode(mode)
+	case Quad:
+		for i := range primitive.triangles {
+			primitive.triangles[i] = primitive.triangles[i].WithMode(mode)
+		}
+		return primitive
+	case *Polygon:
+		polygon := *primitive
+		polygon.triangles = make([]Triangle, len(primitive.triangles))
+		for i, triangle := range primitive.triangles {
+			polygon.triangles[i] = triangle.WithMode(mode)
+		}
+		return &polygon
+	case *Mesh:
+		mesh := *primitive
+		mesh.primitives = withTriangleModes(primitive.primitives, mode)
+		mesh.bvh = NewBVH(mesh.primitives)
+		return &mesh
+	case *BVH:
+		return NewBVH(withTriangleModes(primitive.given, mode))
+	case *Grid:
+		return NewGrid(withTriangleModes(primitive.primitives, mode))
+	case *Octree:
+		return NewOctree(withTriangleModes(primitive.primitives, mode))
+	case *Instance:
+		instance := *primitive
+		instance.primitive = WithTriangleMode(primitive.primitive, mode)
+		return &instance
+	case *CSG:
+		// Copies of solids are solids of the same type
+		csg := *primitive
+		csg.left = WithTriangleMode(primitive.left, mode).(Solid)
+		csg.right = WithTriangleMode(primitive.right, mode).(Solid)
+		return &csg
+	default:
+		return primitive
+	}
+}
+
+func withTriangleModes(primitives []Primitive, mode TriangleMode) []Primitive {
+	result := make([]Primitive, len(primitives))
+	for i, primitive := range primitives {
+		result[i] = WithTriangleMode(primitive, mode)
+	}
+	return result
+}
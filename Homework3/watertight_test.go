@@ -0,0 +1,196 @@
+package main
+
+import (
+	"github.com/fmi/go-homework/geom"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// randomClosedMesh returns a closed triangle mesh around the origin. It is a
+// latitude and longitude grid whose vertices are moved in and out at random,
+// so every ray from the origin leaves it exactly once.
+func randomClosedMesh(rng *rand.Rand, rings, segments int) *Mesh {
+	radius := func() float64 {
+		return 0.7 + 0.6*rng.Float64()
+	}
+
+	vertices := []geom.Vector{geom.NewVector(0, radius(), 0)}
+	for ring := 1; ring < rings; ring++ {
+		theta := math.Pi * float64(ring) / float64(rings)
+		for segment := 0; segment < segments; segment++ {
+			phi := 2 * math.Pi * float64(segment) / float64(segments)
+			r := radius()
+			vertices = append(vertices, geom.NewVector(
+				r*math.Sin(theta)*math.Cos(phi), r*math.Cos(theta), r*math.Sin(theta)*math.Sin(phi),
+			))
+		}
+	}
+	vertices = append(vertices, geom.NewVector(0, -radius(), 0))
+	bottom := len(vertices) - 1
+
+	index := func(ring, segment int) int {
+		return 1 + (ring-1)*segments + segment%segments
+	}
+
+	var faces []Face
+	for segment := 0; segment < segments; segment++ {
+		faces = append(faces, Face{Vertices: []int{0, index(1, segment+1), index(1, segment)}})
+		faces = append(faces, Face{Vertices: []int{bottom, index(rings-1, segment), index(rings-1, segment+1)}})
+		for ring := 1; ring+1 < rings; ring++ {
+			faces = append(faces,
+				Face{Vertices: []int{index(ring, segment), index(ring, segment+1), index(ring+1, segment+1)}},
+				Face{Vertices: []int{index(ring, segment), index(ring+1, segment+1), index(ring+1, segment)}},
+			)
+		}
+	}
+
+	mesh, err := NewMesh(vertices, faces)
+	if err != nil {
+		panic(err)
+	}
+	return mesh
+}
+
+func TestWatertightMatchesMollerTrumbore(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+
+	for i := 0; i < 1000; i++ {
+		fast := NewTriangle(randomVector(rng, 5), randomVector(rng, 5), randomVector(rng, 5))
+		watertight := fast.WithMode(WatertightTriangles)
+		ray := geom.NewRay(randomVector(rng, 10), randomVector(rng, 1))
+
+		expected, expectedOk := fast.ClosestHit(ray)
+		hit, ok := watertight.ClosestHit(ray)
+		if ok != expectedOk {
+			// Hits right on an edge may go either way with the fast test
+			if math.Min(expected.U, expected.V) > 1e-9 && expected.U+expected.V < 1-1e-9 {
+				t.Errorf("Expected hit %v for ray %#v, got %v", expectedOk, ray, ok)
+			}
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if math.Abs(hit.T-expected.T) > 1e-9*math.Max(1, expected.T) ||
+			math.Abs(hit.U-expected.U) > 1e-9 || math.Abs(hit.V-expected.V) > 1e-9 {
+			t.Errorf("Expected %#v, got %#v", expected, hit)
+		}
+	}
+}
+
+func TestWatertightSharedEdge(t *testing.T) {
+	// Two triangles sharing the diagonal of the unit square
+	a, b, c, d := geom.NewVector(0, 0, 0), geom.NewVector(1, 0, 0), geom.NewVector(1, 1, 0), geom.NewVector(0, 1, 0)
+	first := NewTriangle(a, b, c).WithMode(WatertightTriangles)
+	second := NewTriangle(a, c, d).WithMode(WatertightTriangles)
+
+	for i := 1; i < 100; i++ {
+		s := float64(i) / 100
+		ray := geom.NewRay(geom.NewVector(s+0.3, s-0.2, 1), geom.NewVector(-0.3, 0.2, -1))
+		if !first.Intersect(ray) && !second.Intersect(ray) {
+			t.Errorf("Expected ray %#v through the shared edge to hit a triangle", ray)
+		}
+	}
+}
+
+func TestWatertightClosedMeshes(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	leaks := 0
+
+	for i := 0; i < 20; i++ {
+		fast := randomClosedMesh(rng, 8+rng.Intn(8), 8+rng.Intn(8))
+		watertight := WithTriangleMode(fast, WatertightTriangles).(*Mesh)
+
+		for j := 0; j < 500; j++ {
+			// Aim at a point on a random edge, or at a vertex
+			face := fast.Faces[rng.Intn(len(fast.Faces))]
+			k := rng.Intn(3)
+			from, to := fast.Vertices[face.Vertices[k]], fast.Vertices[face.Vertices[(k+1)%3]]
+			s := rng.Float64()
+			if j%5 == 0 {
+				s = 0
+			}
+			target := geom.Add(scale(from, 1-s), scale(to, s))
+
+			rays := []geom.Ray{
+				geom.NewRay(geom.NewVector(0, 0, 0), target),
+				geom.NewRay(scale(target, 3), scale(target, -1)),
+			}
+			for _, ray := range rays {
+				if !watertight.Intersect(ray) {
+					t.Fatalf("Expected ray %#v to hit closed mesh %d", ray, i)
+				}
+				if _, ok := watertight.ClosestHit(ray); !ok {
+					t.Fatalf("Expected ray %#v to have a closest hit with closed mesh %d", ray, i)
+				}
+				if !fast.Intersect(ray) {
+					leaks++
+				}
+			}
+		}
+	}
+
+	t.Logf("%d rays leaked through the meshes with fast triangles", leaks)
+}
+
+func TestWithTriangleModeAggregates(t *testing.T) {
+	triangle := NewTriangle(geom.NewVector(-1, -1, 0), geom.NewVector(1, -1, 0), geom.NewVector(0, 1, 0))
+	instance, err := NewInstance(triangle, Translate(geom.NewVector(0, 0, 1)))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	bvh := NewBVH([]Primitive{triangle, instance})
+
+	converted := WithTriangleMode(bvh, WatertightTriangles).(*BVH)
+	for _, primitive := range converted.primitives {
+		switch primitive := primitive.(type) {
+		case Triangle:
+			if primitive.mode != WatertightTriangles {
+				t.Errorf("Expected the triangle to be watertight")
+			}
+		case *Instance:
+			if primitive.primitive.(Triangle).mode != WatertightTriangles {
+				t.Errorf("Expected the instanced triangle to be watertight")
+			}
+		}
+	}
+
+	for _, primitive := range bvh.primitives {
+		if primitive, ok := primitive.(Triangle); ok && primitive.mode != FastTriangles {
+			t.Errorf("Expected the original triangle to be left alone")
+		}
+	}
+
+	// Instances inside CSG shapes are converted as well
+	csg := NewUnion(NewDifference(instance, NewSphere(geom.Vector{}, 1)), NewBox(geom.NewVector(2, 2, 2), geom.NewVector(3, 3, 3)))
+	convertedCSG := WithTriangleMode(csg, WatertightTriangles).(*CSG)
+	inner := convertedCSG.left.(*CSG).left.(*Instance).primitive.(Triangle)
+	if inner.mode != WatertightTriangles {
+		t.Errorf("Expected the triangle inside the CSG shape to be watertight")
+	}
+	if _, ok := convertedCSG.right.(Box); !ok || csg.left.(*CSG).left.(*Instance).primitive.(Triangle).mode != FastTriangles {
+		t.Errorf("Expected the box to be kept and the original CSG shape to be left alone")
+	}
+}
+
+func TestRenderWatertightScene(t *testing.T) {
+	scene := testScene()
+	expected := scene.Render(64, 48)
+
+	scene.TriangleMode = WatertightTriangles
+	img := scene.Render(64, 48)
+
+	differences := 0
+	for i := range img.Pix {
+		if img.Pix[i] != expected.Pix[i] {
+			differences++
+		}
+	}
+	if differences > len(img.Pix)/100 {
+		t.Errorf("Expected the watertight render to match the fast one, %d values differ", differences)
+	}
+	if scene.Objects[1].Primitive.(Quad).triangles[0].mode != FastTriangles {
+		t.Errorf("Expected rendering not to change the objects of the scene")
+	}
+}
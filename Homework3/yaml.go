@@ -0,0 +1,631 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Scene files in YAML are read and written through JSON: the YAML is turned
+// into the JSON document it stands for, which is decoded like any other, and
+// written scenes are encoded as JSON and turned into YAML.
+//
+// Only the part of YAML which scene files need is supported: block mappings
+// and sequences, single-line flow mappings and sequences, plain, single- and
+// double-quoted scalars and comments. Anchors, tags, multi-line scalars and
+// multiple documents are not.
+
+// yamlKind is what a yamlNode holds.
+type yamlKind int
+
+const (
+	yamlScalar yamlKind = iota
+	yamlSequence
+	yamlMapping
+)
+
+// yamlNode is a value of a document. Scalars keep their JSON text and
+// mappings the order of their keys, so that written files follow the order
+// of the fields.
+type yamlNode struct {
+	kind   yamlKind
+	scalar string
+	keys   []string
+	items  []*yamlNode
+}
+
+// yamlLine is a line with content, without its indentation and comment.
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+var yamlNumber = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+
+// yamlPlain matches strings which are written without quotes.
+var yamlPlain = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_./-]*$`)
+
+// yamlReserved are plain scalars which are not strings in some version of
+// YAML and are quoted when written.
+var yamlReserved = map[string]bool{
+	"true": true, "false": true, "null": true, "yes": true, "no": true, "on": true, "off": true, "y": true, "n": true,
+}
+
+// yamlToJSON returns the JSON form of a YAML document.
+func yamlToJSON(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &yamlParser{}
+	if err := parser.split(string(data)); err != nil {
+		return nil, err
+	}
+	if len(parser.lines) == 0 {
+		return []byte("null"), nil
+	}
+
+	root, err := parser.block(parser.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if parser.next < len(parser.lines) {
+		return nil, parser.fail(parser.lines[parser.next], "unexpected indentation")
+	}
+
+	var buffer bytes.Buffer
+	root.writeJSON(&buffer)
+	return buffer.Bytes(), nil
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	next  int
+}
+
+func (parser *yamlParser) fail(line yamlLine, format string, args ...interface{}) error {
+	return &ParseError{Format: "yaml", Line: line.number, Message: fmt.Sprintf(format, args...)}
+}
+
+// split keeps the lines with content, dropping comments and document
+// markers.
+func (parser *yamlParser) split(data string) error {
+	for i, text := range strings.Split(data, "\n") {
+		line := yamlLine{number: i + 1}
+		text = strings.TrimRight(text, " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return parser.fail(line, "tabs cannot indent")
+		}
+		line.indent = len(text) - len(trimmed)
+		line.text = strings.TrimRight(stripYAMLComment(trimmed), " \t")
+		if line.text == "" || (line.indent == 0 && line.text == "---") {
+			continue
+		}
+		if line.indent == 0 && line.text == "..." {
+			break
+		}
+		parser.lines = append(parser.lines, line)
+	}
+	return nil
+}
+
+// stripYAMLComment removes a comment, which starts with # at the start of
+// the text or after a space, outside of quotes.
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// block parses the mapping or sequence whose lines are indented by indent.
+func (parser *yamlParser) block(indent int) (*yamlNode, error) {
+	line := parser.lines[parser.next]
+	if line.indent != indent {
+		return nil, parser.fail(line, "unexpected indentation")
+	}
+	if isYAMLItem(line.text) {
+		return parser.sequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(line.text); ok {
+		return parser.mapping(indent)
+	}
+
+	// A scalar or flow collection on a line of its own
+	parser.next++
+	return parser.flow(line, line.text)
+}
+
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (parser *yamlParser) sequence(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlSequence}
+	for parser.next < len(parser.lines) {
+		line := parser.lines[parser.next]
+		if line.indent < indent || (line.indent == indent && !isYAMLItem(line.text)) {
+			break
+		}
+		if line.indent > indent {
+			return nil, parser.fail(line, "unexpected indentation")
+		}
+
+		rest := strings.TrimLeft(line.text[1:], " ")
+		var item *yamlNode
+		var err error
+		switch {
+		case rest == "":
+			parser.next++
+			item, err = parser.nested(indent)
+		case isYAMLItem(rest) || isYAMLMappingEntry(rest):
+			// The item is a collection starting on the line of its dash,
+			// which is read as if the dash were indentation
+			offset := len(line.text) - len(rest)
+			parser.lines[parser.next] = yamlLine{number: line.number, indent: indent + offset, text: rest}
+			item, err = parser.block(indent + offset)
+		default:
+			parser.next++
+			item, err = parser.flow(line, rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.items = append(node.items, item)
+	}
+	return node, nil
+}
+
+func isYAMLMappingEntry(text string) bool {
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return false
+	}
+	_, _, ok := splitYAMLKey(text)
+	return ok
+}
+
+func (parser *yamlParser) mapping(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlMapping}
+	for parser.next < len(parser.lines) {
+		line := parser.lines[parser.next]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, parser.fail(line, "unexpected indentation")
+		}
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, parser.fail(line, "expected a key")
+		}
+		name, err := parser.key(line, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range node.keys {
+			if other == name {
+				return nil, parser.fail(line, "duplicate key %q", name)
+			}
+		}
+		parser.next++
+
+		var value *yamlNode
+		if rest == "" {
+			// Sequences may be indented as much as the key they belong to
+			if parser.next < len(parser.lines) && parser.lines[parser.next].indent == indent && isYAMLItem(parser.lines[parser.next].text) {
+				value, err = parser.sequence(indent)
+			} else {
+				value, err = parser.nested(indent)
+			}
+		} else {
+			value, err = parser.flow(line, rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.keys = append(node.keys, name)
+		node.items = append(node.items, value)
+	}
+	return node, nil
+}
+
+// nested parses the block indented more than indent, which is null if there
+// is none.
+func (parser *yamlParser) nested(indent int) (*yamlNode, error) {
+	if parser.next == len(parser.lines) || parser.lines[parser.next].indent <= indent {
+		return &yamlNode{kind: yamlScalar, scalar: "null"}, nil
+	}
+	return parser.block(parser.lines[parser.next].indent)
+}
+
+// splitYAMLKey splits a mapping entry at the colon after its key.
+func splitYAMLKey(text string) (string, string, bool) {
+	end := 0
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end = quotedEnd(text)
+		if end < 0 {
+			return "", "", false
+		}
+	}
+	for i := end; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// quotedEnd returns the index after the quoted scalar text starts with, or
+// -1 if it is not closed.
+func quotedEnd(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func (parser *yamlParser) key(line yamlLine, text string) (string, error) {
+	node, err := parser.flow(line, text)
+	if err != nil {
+		return "", err
+	}
+	if node.kind != yamlScalar {
+		return "", parser.fail(line, "keys must be scalars")
+	}
+	// Keys which are not strings, like numbers, are kept as written
+	key := node.scalar
+	json.Unmarshal([]byte(node.scalar), &key)
+	return key, nil
+}
+
+// flow parses text as a single flow value.
+func (parser *yamlParser) flow(line yamlLine, text string) (*yamlNode, error) {
+	scanner := &yamlFlow{text: text}
+	node, err := scanner.value(false)
+	if err == nil {
+		scanner.skipSpaces()
+		if scanner.pos < len(scanner.text) {
+			err = fmt.Errorf("unexpected %q", scanner.text[scanner.pos:])
+		}
+	}
+	if err != nil {
+		return nil, parser.fail(line, "%v", err)
+	}
+	return node, nil
+}
+
+// yamlFlow reads flow values from a line.
+type yamlFlow struct {
+	text string
+	pos  int
+}
+
+func (scanner *yamlFlow) skipSpaces() {
+	for scanner.pos < len(scanner.text) && (scanner.text[scanner.pos] == ' ' || scanner.text[scanner.pos] == '\t') {
+		scanner.pos++
+	}
+}
+
+// value reads a value. In flow collections plain scalars end at commas,
+// colons and closing brackets.
+func (scanner *yamlFlow) value(inFlow bool) (*yamlNode, error) {
+	scanner.skipSpaces()
+	if scanner.pos == len(scanner.text) {
+		return &yamlNode{kind: yamlScalar, scalar: "null"}, nil
+	}
+
+	switch scanner.text[scanner.pos] {
+	case '[':
+		return scanner.collection(']')
+	case '{':
+		return scanner.collection('}')
+	case '"', '\'':
+		return scanner.quoted()
+	case '&', '*', '!', '|', '>', '%', '@', '`':
+		return nil, fmt.Errorf("unsupported %q", scanner.text[scanner.pos:])
+	}
+
+	start := scanner.pos
+	for scanner.pos < len(scanner.text) {
+		c := scanner.text[scanner.pos]
+		if inFlow && (c == ',' || c == ']' || c == '}' || (c == ':' && scanner.colonEnds())) {
+			break
+		}
+		scanner.pos++
+	}
+	return plainYAMLScalar(strings.TrimSpace(scanner.text[start:scanner.pos])), nil
+}
+
+// colonEnds reports whether the colon at the position separates a key from
+// its value.
+func (scanner *yamlFlow) colonEnds() bool {
+	next := scanner.pos + 1
+	return next == len(scanner.text) || strings.IndexByte(" ,]}", scanner.text[next]) >= 0
+}
+
+// collection reads a flow sequence or mapping ending with end.
+func (scanner *yamlFlow) collection(end byte) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlSequence}
+	if end == '}' {
+		node.kind = yamlMapping
+	}
+	scanner.pos++
+
+	for {
+		scanner.skipSpaces()
+		if scanner.pos == len(scanner.text) {
+			return nil, fmt.Errorf("missing %q", end)
+		}
+		if scanner.text[scanner.pos] == end {
+			scanner.pos++
+			return node, nil
+		}
+
+		if node.kind == yamlMapping {
+			key, err := scanner.value(true)
+			if err != nil {
+				return nil, err
+			}
+			if key.kind != yamlScalar {
+				return nil, fmt.Errorf("keys must be scalars")
+			}
+			scanner.skipSpaces()
+			if scanner.pos == len(scanner.text) || scanner.text[scanner.pos] != ':' {
+				return nil, fmt.Errorf("missing ':' after key %s", key.scalar)
+			}
+			scanner.pos++
+			name := key.scalar
+			json.Unmarshal([]byte(key.scalar), &name)
+			for _, other := range node.keys {
+				if other == name {
+					return nil, fmt.Errorf("duplicate key %q", name)
+				}
+			}
+			node.keys = append(node.keys, name)
+		}
+
+		item, err := scanner.value(true)
+		if err != nil {
+			return nil, err
+		}
+		node.items = append(node.items, item)
+
+		scanner.skipSpaces()
+		if scanner.pos < len(scanner.text) && scanner.text[scanner.pos] == ',' {
+			scanner.pos++
+		} else if scanner.pos == len(scanner.text) || scanner.text[scanner.pos] != end {
+			return nil, fmt.Errorf("missing %q", end)
+		}
+	}
+}
+
+// quoted reads a quoted scalar. Double-quoted ones have the escapes of JSON
+// and single-quoted ones escape a quote by doubling it.
+func (scanner *yamlFlow) quoted() (*yamlNode, error) {
+	rest := scanner.text[scanner.pos:]
+	end := quotedEnd(rest)
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated string %s", rest)
+	}
+	scanner.pos += end
+
+	var value string
+	if rest[0] == '"' {
+		if err := json.Unmarshal([]byte(rest[:end]), &value); err != nil {
+			return nil, fmt.Errorf("bad string %s", rest[:end])
+		}
+	} else {
+		value = strings.Replace(rest[1:end-1], "''", "'", -1)
+	}
+	encoded, _ := json.Marshal(value)
+	return &yamlNode{kind: yamlScalar, scalar: string(encoded)}, nil
+}
+
+// plainYAMLScalar resolves an unquoted scalar to null, a boolean, a number
+// or a string.
+func plainYAMLScalar(text string) *yamlNode {
+	node := &yamlNode{kind: yamlScalar}
+	switch {
+	case text == "" || text == "~" || text == "null" || text == "Null" || text == "NULL":
+		node.scalar = "null"
+	case text == "true" || text == "True" || text == "TRUE":
+		node.scalar = "true"
+	case text == "false" || text == "False" || text == "FALSE":
+		node.scalar = "false"
+	case yamlNumber.MatchString(text):
+		value, _ := strconv.ParseFloat(text, 64)
+		node.scalar = strconv.FormatFloat(value, 'g', -1, 64)
+		if strings.IndexAny(text, ".eE") < 0 {
+			// Keep integers in full, which faces need
+			node.scalar = strings.TrimPrefix(text, "+")
+		}
+	default:
+		encoded, _ := json.Marshal(text)
+		node.scalar = string(encoded)
+	}
+	return node
+}
+
+func (node *yamlNode) writeJSON(buffer *bytes.Buffer) {
+	switch node.kind {
+	case yamlScalar:
+		buffer.WriteString(node.scalar)
+	case yamlSequence:
+		buffer.WriteByte('[')
+		for i, item := range node.items {
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+			item.writeJSON(buffer)
+		}
+		buffer.WriteByte(']')
+	case yamlMapping:
+		buffer.WriteByte('{')
+		for i, item := range node.items {
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+			key, _ := json.Marshal(node.keys[i])
+			buffer.Write(key)
+			buffer.WriteByte(':')
+			item.writeJSON(buffer)
+		}
+		buffer.WriteByte('}')
+	}
+}
+
+// jsonToYAML writes the JSON document as YAML. Collections of scalars, like
+// vectors and faces, are written in flow style and everything else in block
+// style.
+func jsonToYAML(w io.Writer, data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	root, err := readJSONNode(decoder)
+	if err != nil {
+		return err
+	}
+
+	var buffer bytes.Buffer
+	if root.kind == yamlScalar || root.flat() {
+		buffer.WriteString(root.flowText())
+		buffer.WriteByte('\n')
+	} else {
+		root.writeBlock(&buffer, 0)
+	}
+	_, err = w.Write(buffer.Bytes())
+	return err
+}
+
+func readJSONNode(decoder *json.Decoder) (*yamlNode, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		node := &yamlNode{kind: yamlSequence}
+		if token == '{' {
+			node.kind = yamlMapping
+		}
+		for decoder.More() {
+			if node.kind == yamlMapping {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.keys = append(node.keys, key.(string))
+			}
+			item, err := readJSONNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		return &yamlNode{kind: yamlScalar, scalar: yamlString(token)}, nil
+	case json.Number:
+		return &yamlNode{kind: yamlScalar, scalar: token.String()}, nil
+	case bool:
+		return &yamlNode{kind: yamlScalar, scalar: strconv.FormatBool(token)}, nil
+	default:
+		return &yamlNode{kind: yamlScalar, scalar: "null"}, nil
+	}
+}
+
+// yamlString returns the scalar text of a string, quoting it unless it is
+// a plain word.
+func yamlString(s string) string {
+	if yamlPlain.MatchString(s) && !yamlReserved[strings.ToLower(s)] {
+		return s
+	}
+	encoded, _ := json.Marshal(s)
+	return string(encoded)
+}
+
+// flat reports whether the node holds only scalars and collections of
+// them, so that it fits on a line.
+func (node *yamlNode) flat() bool {
+	if node.kind == yamlMapping && len(node.items) > 0 {
+		return false
+	}
+	for _, item := range node.items {
+		if !item.flat() {
+			return false
+		}
+	}
+	return true
+}
+
+func (node *yamlNode) flowText() string {
+	switch node.kind {
+	case yamlSequence:
+		items := make([]string, len(node.items))
+		for i, item := range node.items {
+			items[i] = item.flowText()
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case yamlMapping:
+		return "{}"
+	}
+	return node.scalar
+}
+
+// writeBlock writes a mapping or sequence with its entries indented by
+// indent.
+func (node *yamlNode) writeBlock(buffer *bytes.Buffer, indent int) {
+	prefix := strings.Repeat(" ", indent)
+	for i, item := range node.items {
+		if node.kind == yamlMapping {
+			buffer.WriteString(prefix + yamlString(node.keys[i]) + ":")
+		} else {
+			buffer.WriteString(prefix + "-")
+		}
+
+		switch {
+		case item.flat():
+			buffer.WriteString(" " + item.flowText() + "\n")
+		case node.kind == yamlSequence && item.kind == yamlMapping:
+			// The first entry goes on the line of the dash
+			var nested bytes.Buffer
+			item.writeBlock(&nested, indent+2)
+			buffer.WriteString(" ")
+			buffer.Write(nested.Bytes()[indent+2:])
+		default:
+			buffer.WriteString("\n")
+			item.writeBlock(buffer, indent+2)
+		}
+	}
+}
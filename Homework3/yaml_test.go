@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// sameJSON reports whether the two JSON documents hold the same values.
+func sameJSON(t *testing.T, a, b []byte) bool {
+	var x, y interface{}
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatalf("Expected valid JSON, got %v in %s", err, a)
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatalf("Expected valid JSON, got %v in %s", err, b)
+	}
+	// Marshalling sorts the keys of objects
+	xText, _ := json.Marshal(x)
+	yText, _ := json.Marshal(y)
+	return bytes.Equal(xText, yText)
+}
+
+func TestYAMLToJSON(t *testing.T) {
+	cases := []struct {
+		yaml, json string
+	}{
+		{"a: 1\nb: [1, -2.5, 3e2]\n", `{"a": 1, "b": [1, -2.5, 300]}`},
+		{"# comment\n---\nname: plain words # trailing\n", `{"name": "plain words"}`},
+		{"s: \"tab\\tand # not a comment\"\nq: 'it''s'\n", `{"s": "tab\tand # not a comment", "q": "it's"}`},
+		{"t: true\nf: False\nn: ~\ne:\nnum: '1'\n", `{"t": true, "f": false, "n": null, "e": null, "num": "1"}`},
+		{"list:\n- a\n- b\nnext: {x: [], y: {}}\n", `{"list": ["a", "b"], "next": {"x": [], "y": {}}}`},
+		{"- - 1\n  - 2\n- k: v\n  l:\n    - m: [[1, 2], [3]]\n-\n  z: 0\n", `[[1, 2], {"k": "v", "l": [{"m": [[1, 2], [3]]}]}, {"z": 0}]`},
+		{"path: dir/file.obj\nurl: a:b\n", `{"path": "dir/file.obj", "url": "a:b"}`},
+		{"\"quoted key\": 1\n", `{"quoted key": 1}`},
+	}
+
+	for _, c := range cases {
+		got, err := yamlToJSON(strings.NewReader(c.yaml))
+		if err != nil {
+			t.Errorf("Expected %q to parse, got %v", c.yaml, err)
+			continue
+		}
+		if !sameJSON(t, got, []byte(c.json)) {
+			t.Errorf("Expected %q to be %s, got %s", c.yaml, c.json, got)
+		}
+	}
+}
+
+func TestYAMLErrors(t *testing.T) {
+	cases := []struct {
+		yaml string
+		line int
+	}{
+		{"a: 1\n  b: 2\n", 2},
+		{"a: [1, 2\n", 1},
+		{"a: 1\nb: 2\na: 3\n", 3},
+		{"a:\n\t- 1\n", 2},
+		{"a: &anchor 1\n", 1},
+		{"a: 'open\n", 1},
+		{"- 1\nb: 2\n", 2},
+	}
+
+	for _, c := range cases {
+		_, err := yamlToJSON(strings.NewReader(c.yaml))
+		parseErr, ok := err.(*ParseError)
+		if !ok || parseErr.Format != "yaml" || parseErr.Line != c.line {
+			t.Errorf("Expected %q to fail at line %d, got %v", c.yaml, c.line, err)
+		}
+	}
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	documents := []string{
+		`{"a": 1, "b": [1, 2.5, -3], "c": {"d": "e f", "g": [{"h": true}, {"i": null}]}}`,
+		`{"strings": ["yes", "no", "1", "", "x: y", "a # b", "quote \"it\"", "dir/file.obj"]}`,
+		`{"nested": [[1, [2, 3]], [], {}], "empty": {}, "objects": [{"x": [{"y": 1}]}]}`,
+		`[{"a": 1}, [1, {"b": 2}], "c"]`,
+		`7`,
+	}
+
+	for _, document := range documents {
+		var buffer bytes.Buffer
+		if err := jsonToYAML(&buffer, []byte(document)); err != nil {
+			t.Fatalf("Expected %s to be written, got %v", document, err)
+		}
+		got, err := yamlToJSON(&buffer)
+		if err != nil {
+			t.Fatalf("Expected the YAML of %s to parse, got %v", document, err)
+		}
+		if !sameJSON(t, got, []byte(document)) {
+			t.Errorf("Expected %s to survive YAML, got %s", document, got)
+		}
+	}
+}